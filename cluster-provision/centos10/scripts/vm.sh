@@ -54,12 +54,23 @@ function calc_next_disk {
 
 NODE_NUM=${NODE_NUM-1}
 n="$(printf "%02d" $(( 10#${NODE_NUM} )))"
+# Addresses of the node as planned by gocli, the defaults match the plan for the first 99 nodes
+NODE_IP=${NODE_IP:-192.168.66.1${n}}
+NODE_MAC=${NODE_MAC:-52:55:00:d1:55:${n}}
+NODE_SRIOV_MAC=${NODE_SRIOV_MAC:-52:55:00:d1:57:${n}}
+
+# Memory of the VM saved by gocli snapshot save, the VM resumes from it instead of booting
+VM_STATE=/vm-memory.state
+RESTORE=false
+if [ -f ${VM_STATE} ]; then
+  RESTORE=true
+fi
 
 cat >/usr/local/bin/ssh.sh <<EOL
 #!/bin/bash
 set -e
-dockerize -wait tcp://192.168.66.1${n}:22 -timeout 120s &>/dev/null
-ssh -o UserKnownHostsFile=/dev/null -o StrictHostKeyChecking=no ${VM_USER}@192.168.66.1${n} -i ${VM_USER_SSH_KEY} -p 22 -q \$@
+dockerize -wait tcp://${NODE_IP}:22 -timeout 120s &>/dev/null
+ssh -o UserKnownHostsFile=/dev/null -o StrictHostKeyChecking=no ${VM_USER}@${NODE_IP} -i ${VM_USER_SSH_KEY} -p 22 -q \$@
 EOL
 chmod u+x /usr/local/bin/ssh.sh
 echo "done" >/ssh_ready
@@ -85,10 +96,10 @@ fi
 iptables -t nat -A POSTROUTING ! -s 192.168.66.0/16 --out-interface br0 -j MASQUERADE
 if [ "$ROOTLESS" != "1" ]; then
   iptables -A FORWARD --in-interface eth0 -j ACCEPT
-  iptables -t nat -A PREROUTING -p tcp -i eth0 -m tcp --dport 22${n} -j DNAT --to-destination 192.168.66.1${n}:22
+  iptables -t nat -A PREROUTING -p tcp -i eth0 -m tcp --dport 22${n} -j DNAT --to-destination ${NODE_IP}:22
 else
   # Add DNAT rule for rootless podman (traffic originating from loopback adapter)
-  iptables -t nat -A OUTPUT -p tcp --dport 22${n} -j DNAT --to-destination 192.168.66.1${n}:22
+  iptables -t nat -A OUTPUT -p tcp --dport 22${n} -j DNAT --to-destination ${NODE_IP}:22
 fi
 
 function create_ip_rules {
@@ -134,8 +145,8 @@ qemu-img create -f qcow2 -o backing_file=${last} -F qcow2 ${next} ${disk_size}
 echo ""
 echo "SSH will be available on container port 22${n}."
 echo "VNC will be available on container port 59${n}."
-echo "VM MAC in the guest network will be 52:55:00:d1:55:${n}"
-echo "VM IP in the guest network will be 192.168.66.1${n}"
+echo "VM MAC in the guest network will be ${NODE_MAC}"
+echo "VM IP in the guest network will be ${NODE_IP}"
 echo "VM hostname will be node${n}"
 
 # Try to create /dev/kvm if it does not exist
@@ -151,7 +162,10 @@ block_dev_drive_arg=""
 if [ -n "${BLOCK_DEV}" ]; then
   # 10Gi default
   block_device_size="${BLOCK_DEV_SIZE:-10737418240}"
-  qemu-img create -f qcow2 ${BLOCK_DEV} ${block_device_size}
+  # restarted and restored nodes keep their disks
+  if [ ! -f ${BLOCK_DEV} ]; then
+    qemu-img create -f qcow2 ${BLOCK_DEV} ${block_device_size}
+  fi
   block_dev_drive_arg="-drive format=qcow2,file=${BLOCK_DEV},if=none,id=extdisk,cache=unsafe"
 fi
 
@@ -159,7 +173,9 @@ disk_num=0
 for size in ${NVME_DISK_SIZES[@]}; do
   echo "Creating disk "$size" for NVMe disk emulation"
   disk="/nvme-"${disk_num}".img"
-  qemu-img create -f raw $disk $size
+  if [ ! -f $disk ]; then
+    qemu-img create -f raw $disk $size
+  fi
   let "disk_num+=1"
 done
 
@@ -167,7 +183,9 @@ disk_num=0
 for size in ${SCSI_DISK_SIZES[@]}; do
   echo "Creating disk "$size" for SCSI disk emulation"
   disk="/scsi-"${disk_num}".img"
-  qemu-img create -f raw $disk $size
+  if [ ! -f $disk ]; then
+    qemu-img create -f raw $disk $size
+  fi
   let "disk_num+=1"
 done
 
@@ -176,7 +194,9 @@ disk_num=0
 for size in ${USB_SIZES[@]}; do
   echo "Creating disk "$size" for USB disk emulation"
   disk="/usb-"${disk_num}".img"
-  qemu-img create -f raw $disk $size
+  if [ ! -f $disk ]; then
+    qemu-img create -f raw $disk $size
+  fi
   let "disk_num+=1"
 done
 
@@ -185,7 +205,9 @@ if [ "$n" = "01" ] ; then
   for size in ${SHARED_DISK_SIZES[@]}; do
     echo "Creating disk "$size" for shared disk emulation"
     disk="/shared/disk"${disk_num}".img"
-    qemu-img create -f raw $disk $size
+    if [ ! -f $disk ]; then
+      qemu-img create -f raw $disk $size
+    fi
     let "disk_num+=1"
   done
 fi
@@ -216,6 +238,12 @@ if [ "${NUMA}" -gt 1 ]; then
     done
 fi
 
+# The invariant TSC keeps QEMU from saving the VM
+cpu_model="host,migratable=no,+invtsc"
+if [ "${VM_MIGRATABLE}" = "true" ]; then
+  cpu_model="host"
+fi
+
 if [ "$(uname -m)" == "s390x" ]; then
   # As per https://www.qemu.org/docs/master/system/s390x/bootdevices.html#booting-without-bootindex-parameter -drive if=virtio can't be specified with bootindex for s390x
   qemu_system_cmd="qemu-system-s390x \
@@ -223,7 +251,7 @@ if [ "$(uname -m)" == "s390x" ]; then
     -drive format=qcow2,file=${next},if=none,cache=unsafe,id=drive1 ${block_dev_drive_arg} \
     -device virtio-blk,drive=drive1,bootindex=1 \
     ${BLOCK_DEV:+ -device virtio-blk,drive=extdisk} \
-    -device virtio-net-ccw,netdev=network0,mac=52:55:00:d1:55:${n} \
+    -device virtio-net-ccw,netdev=network0,mac=${NODE_MAC} \
     -netdev tap,id=network0,ifname=tap${n},script=no,downscript=no \
     -device virtio-rng \
     -initrd /initrd.img \
@@ -233,7 +261,8 @@ if [ "$(uname -m)" == "s390x" ]; then
     -cpu host \
     -m ${MEMORY} \
     -smp ${CPU} ${numa_arg} \
-    -serial pty \
+    -chardev pty,id=serial0,logfile=/var/log/vm-serial.log \
+    -serial chardev:serial0 \
     -machine s390-ccw-virtio,accel=kvm \
     -uuid $(cat /proc/sys/kernel/random/uuid) \
     -monitor unix:/tmp/qemu-monitor.sock,server,nowait \
@@ -244,22 +273,23 @@ else
     -drive format=qcow2,file=${next},if=none,id=bootdisk,cache=unsafe ${block_dev_drive_arg} \
     -device virtio-blk-pci,drive=bootdisk,bus=pcie.0 \
     ${BLOCK_DEV:+ -device virtio-blk-pci,drive=extdisk,bus=pcie.0} \
-    -device virtio-net-pci,netdev=network0,mac=52:55:00:d1:55:${n},bus=pcie.0 \
+    -device virtio-net-pci,netdev=network0,mac=${NODE_MAC},bus=pcie.0 \
     -netdev tap,id=network0,ifname=tap${n},script=no,downscript=no \
     -device pxb-pcie,id=sriovpxb,bus=pcie.0,bus_nr=128${sriov_pxb_numa_arg} \
     ${secondary_nic_pxb_args} \
     -device pcie-root-port,id=sriovrp,slot=3,chassis=3,bus=sriovpxb \
-    -device igb,id=igb0,bus=sriovrp,netdev=sriovnet0,mac=52:55:00:d1:57:${n} \
+    -device igb,id=igb0,bus=sriovrp,netdev=sriovnet0,mac=${NODE_SRIOV_MAC} \
     -netdev tap,id=sriovnet0,ifname=tap-sriov${n},script=no,downscript=no \
     -device virtio-rng-pci,bus=pcie.0 \
     -initrd /initrd.img \
     -kernel /vmlinuz \
     -append \"$(cat /kernel.args) $(cat /additional.kernel.args) ${KERNEL_ARGS}\" \
     -vnc :${n} \
-    -cpu host,migratable=no,+invtsc \
+    -cpu ${cpu_model} \
     -m ${MEMORY} \
     -smp ${CPU} ${numa_arg} \
-    -serial pty \
+    -chardev pty,id=serial0,logfile=/var/log/vm-serial.log \
+    -serial chardev:serial0 \
     -machine q35,accel=kvm,kernel_irqchip=split \
     -device intel-iommu,intremap=on,caching-mode=on \
     -device intel-hda,id=sound0,bus=pcie.0 -device hda-duplex,bus=sound0.0 \
@@ -269,6 +299,11 @@ else
     ${QEMU_ARGS}"
 fi
 
+# The VM waits for its memory until the monitor commands recreated the hot-plugged devices
+if [ "$RESTORE" = true ]; then
+  qemu_system_cmd+=" -incoming defer"
+fi
+
 PID=0
 eval "nohup $qemu_system_cmd &"
 PID=$!
@@ -297,4 +332,18 @@ if [[ -n "$QEMU_MONITOR_ARGS" ]]; then
   done
 fi
 
+if [ "$RESTORE" = true ]; then
+  echo "migrate_incoming \"exec:cat ${VM_STATE}\"" | socat - UNIX-CONNECT:/tmp/qemu-monitor.sock
+  while echo "info status" | socat - UNIX-CONNECT:/tmp/qemu-monitor.sock | grep -q "inmigrate"; do
+    if ! kill -0 $PID; then
+      echo "QEMU failed to restore the VM from ${VM_STATE}."
+      exit 1
+    fi
+    sleep 0.5
+  done
+  echo "cont" | socat - UNIX-CONNECT:/tmp/qemu-monitor.sock
+  rm -f ${VM_STATE}
+  echo "VM resumed from ${VM_STATE}."
+fi
+
 wait $PID
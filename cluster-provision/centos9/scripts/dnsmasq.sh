@@ -4,6 +4,11 @@ set -ex
 
 NUM_NODES=${NUM_NODES-1}
 NUM_SECONDARY_NICS=${NUM_SECONDARY_NICS:-0}
+# Static leases of the nodes as planned by gocli, separated by spaces
+NODE_DHCP_HOSTS=${NODE_DHCP_HOSTS-}
+# Hosts of nodes added to the running cluster, re-read by dnsmasq on SIGHUP
+DHCP_HOSTS_FILE=/etc/dnsmasq-dhcp-hosts
+touch ${DHCP_HOSTS_FILE}
 
 ip link add br0 type bridge
 echo 0 > /proc/sys/net/ipv6/conf/br0/disable_ipv6
@@ -26,7 +31,9 @@ for i in $(seq 1 ${NUM_NODES}); do
   ip tuntap add dev tap${n} mode tap user $(whoami)
   ip link set tap${n} master br0
   ip link set dev tap${n} up
-  DHCP_HOSTS="${DHCP_HOSTS} --dhcp-host=52:55:00:d1:55:${n},192.168.66.1${n},[fd00::1${n}],node${n},infinite"
+  if [ -z "${NODE_DHCP_HOSTS}" ]; then
+    DHCP_HOSTS="${DHCP_HOSTS} --dhcp-host=52:55:00:d1:55:${n},192.168.66.1${n},[fd00::1${n}],node${n},infinite"
+  fi
 
   ip tuntap add dev tap-sriov${n} mode tap user $(whoami)
   ip link set tap-sriov${n} master br-sriov
@@ -40,6 +47,10 @@ for i in $(seq 1 ${NUM_NODES}); do
   done
 done
 
+for host in ${NODE_DHCP_HOSTS}; do
+  DHCP_HOSTS="${DHCP_HOSTS} --dhcp-host=${host}"
+done
+
 # Make sure that all VMs can reach the internet
 iptables -t nat -A POSTROUTING -o eth0 -j MASQUERADE
 iptables -A FORWARD -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT
@@ -48,4 +59,4 @@ ip6tables -t nat -A POSTROUTING -o eth0 -j MASQUERADE
 ip6tables -A FORWARD -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT
 ip6tables -A FORWARD -i br0 -o eth0 -j ACCEPT
 
-exec dnsmasq --interface=br0 --enable-ra --dhcp-option=option6:dns-server,[::] -d ${DHCP_HOSTS} --dhcp-range=192.168.66.10,192.168.66.200,infinite --dhcp-range=::10,::200,constructor:br0,static
+exec dnsmasq --interface=br0 --enable-ra --dhcp-option=option6:dns-server,[::] -d ${DHCP_HOSTS} --dhcp-hostsfile=${DHCP_HOSTS_FILE} --dhcp-range=192.168.66.10,192.168.66.200,infinite --dhcp-range=::10,::200,constructor:br0,static
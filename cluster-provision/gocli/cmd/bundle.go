@@ -0,0 +1,324 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/distribution/reference"
+	"github.com/spf13/cobra"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/cmd/nodesconfig"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/cmd/utils"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/istio"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/libssh"
+)
+
+// NewBundleCommand returns the command to carry the images of clusters to hosts without internet access
+func NewBundleCommand() *cobra.Command {
+	bundle := &cobra.Command{
+		Use:   "bundle",
+		Short: "bundle moves the images clusters need to hosts without internet access",
+		Args:  cobra.NoArgs,
+	}
+
+	export := &cobra.Command{
+		Use:   "export PROVIDER...",
+		Short: "export pulls the images of the providers and writes them into a single archive",
+		Long: `export pulls the images of the providers and writes them into a single archive
+
+The archive holds the provider images, the registry and nfs server images and the images
+the opts deploy, load it with gocli bundle import on the offline host and start clusters
+there with gocli run --offline. The archive keeps the tags of its images but not the digests
+they were pulled by, the images opts pin by digest, like the ones of cnao, are carried by their
+digest tag, e.g. repo:sha256-<hex>, which run --offline deploys instead.`,
+		RunE: bundleExport,
+		Args: cobra.MinimumNArgs(1),
+	}
+	export.Flags().StringP("output-file", "o", "", "path of the archive to write")
+	export.Flags().StringSlice("opts", nil, "opts whose images are exported, defaults to all opts")
+	export.Flags().String("container-registry", "quay.io", "the registry to pull cluster container from")
+	export.Flags().String("container-org", "kubevirtci", "the organization at the registry to pull the container from")
+	export.Flags().String("container-suffix", "", "Override container suffix stored at the cli binary")
+	export.Flags().Bool("slim", false, "use the slim flavor")
+	_ = export.MarkFlagRequired("output-file")
+
+	imp := &cobra.Command{
+		Use:   "import FILE",
+		Short: "import loads the images of an archive written by gocli bundle export",
+		RunE:  bundleImport,
+		Args:  cobra.ExactArgs(1),
+	}
+
+	bundle.AddCommand(export, imp)
+	return bundle
+}
+
+func bundleExport(cmd *cobra.Command, args []string) error {
+	output, err := cmd.Flags().GetString("output-file")
+	if err != nil {
+		return err
+	}
+	optNames, err := cmd.Flags().GetStringSlice("opts")
+	if err != nil {
+		return err
+	}
+	containerRegistry, err := cmd.Flags().GetString("container-registry")
+	if err != nil {
+		return err
+	}
+	containerOrg, err := cmd.Flags().GetString("container-org")
+	if err != nil {
+		return err
+	}
+	containerSuffix, err := cmd.Flags().GetString("container-suffix")
+	if err != nil {
+		return err
+	}
+	slim, err := cmd.Flags().GetBool("slim")
+	if err != nil {
+		return err
+	}
+	if containerRegistry == "" {
+		return fmt.Errorf("the provider images are exported from a registry, --container-registry can't be empty")
+	}
+
+	byOpt, err := imagesByOpt()
+	if err != nil {
+		return err
+	}
+	if len(optNames) == 0 {
+		for _, o := range k8sOpts {
+			optNames = append(optNames, o.Name)
+		}
+	}
+	optRefs := []string{}
+	for _, name := range optNames {
+		if !slices.ContainsFunc(k8sOpts, func(o k8sOpt) bool { return o.Name == name }) {
+			return fmt.Errorf("unknown opt %q", name)
+		}
+		optRefs = append(optRefs, byOpt[name]...)
+	}
+
+	refs := []string{}
+	for _, provider := range args {
+		// docker saves every tag of a repository given without tag
+		named, err := reference.ParseNormalizedNamed(providerImage(provider, containerRegistry, containerOrg, containerSuffix, slim))
+		if err != nil {
+			return fmt.Errorf("invalid provider %q: %v", provider, err)
+		}
+		refs = append(refs, reference.TagNameOnly(named).String())
+	}
+	refs = append(refs, offlineImages("", true, optRefs)...)
+	slices.Sort(refs)
+	refs = slices.Compact(refs)
+
+	cli, err := newRuntime()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	for _, ref := range refs {
+		if err := docker.ImagePull(cli, ctx, ref, cmd.OutOrStdout()); err != nil {
+			return fmt.Errorf("failed to pull %s: %w", ref, err)
+		}
+	}
+	// the runtime verified the digests while pulling, the tags keep them in the archive
+	for ref, tag := range digestTags(refs) {
+		if err := cli.ImageTag(ctx, ref, tag); err != nil {
+			return fmt.Errorf("failed to tag %s: %w", ref, err)
+		}
+	}
+	saved := carriedImages(refs)
+
+	// write next to the output and rename it, an interrupted export leaves no truncated archive behind
+	tmp := filepath.Join(filepath.Dir(output), "."+filepath.Base(output)+".tmp")
+	if err := saveImages(ctx, cli, saved, tmp); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, output); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "exported %d images to %s\n", len(saved), output)
+	return nil
+}
+
+func bundleImport(cmd *cobra.Command, args []string) error {
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	cli, err := newRuntime()
+	if err != nil {
+		return err
+	}
+	if err := cli.ImageLoad(context.Background(), f); err != nil {
+		return fmt.Errorf("failed to load %s: %w", args[0], err)
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "imported the images of %s into %s\n", args[0], cli.Name())
+	return nil
+}
+
+// imagesByOpt returns the images of all opts keyed by the opt deploying them
+func imagesByOpt() (map[string][]string, error) {
+	byOpt, err := opts.Images()
+	if err != nil {
+		return nil, err
+	}
+	byOpt["istio"] = append(byOpt["istio"], istio.Images()...)
+	return byOpt, nil
+}
+
+// optImages returns the images the enabled opts deploy
+func optImages(n *nodesconfig.NodeK8sConfig) ([]string, error) {
+	byOpt, err := imagesByOpt()
+	if err != nil {
+		return nil, err
+	}
+
+	refs := []string{}
+	for _, o := range k8sOpts {
+		if o.enabled(n) {
+			refs = append(refs, byOpt[o.Name]...)
+		}
+	}
+	slices.Sort(refs)
+	return slices.Compact(refs), nil
+}
+
+// digestTags returns the tags bundles carry the images pinned by digest by, keyed by the pinned reference.
+// A docker-archive keeps the tags of its images but not the digests they were pulled by, so repo@sha256:<hex>
+// is carried as repo:sha256-<hex>
+func digestTags(refs []string) map[string]string {
+	tags := map[string]string{}
+	for _, ref := range refs {
+		named, err := reference.ParseNormalizedNamed(ref)
+		if err != nil {
+			continue
+		}
+		if digested, ok := named.(reference.Digested); ok {
+			digest := digested.Digest()
+			tags[ref] = fmt.Sprintf("%s:%s-%s", named.Name(), digest.Algorithm(), digest.Encoded())
+		}
+	}
+	return tags
+}
+
+// carriedImages returns the references bundles carry the images by
+func carriedImages(refs []string) []string {
+	tags := digestTags(refs)
+	carried := []string{}
+	for _, ref := range refs {
+		if tag, ok := tags[ref]; ok {
+			ref = tag
+		}
+		carried = append(carried, ref)
+	}
+	return carried
+}
+
+// offlineImages returns the images which have to exist locally to run a cluster without pulling
+func offlineImages(clusterImage string, nfs bool, optRefs []string) []string {
+	refs := []string{}
+	if clusterImage != "" {
+		refs = append(refs, clusterImage)
+	}
+	refs = append(refs, utils.DockerRegistryImage)
+	if nfs {
+		refs = append(refs, utils.NFSServerImage)
+	}
+	return append(refs, optRefs...)
+}
+
+// checkLocalImages fails listing all images which don't exist in the local container runtime
+func checkLocalImages(ctx context.Context, cli docker.Runtime, refs []string) error {
+	missing := []string{}
+	for _, ref := range refs {
+		exists, err := cli.ImageExists(ctx, ref)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			missing = append(missing, ref)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("the images %s are missing in %s, export them with gocli bundle export on a host with internet access and load them with gocli bundle import",
+			strings.Join(missing, ", "), cli.Name())
+	}
+	return nil
+}
+
+// nodeMissingImagesScript prints the carried images cri-o doesn't have, one per line. The digest tag of an image
+// pinned by digest is added to the image if a node pulled it by digest already, e.g. when its provider image was built
+func nodeMissingImagesScript(refs []string) string {
+	tags := digestTags(refs)
+	checks := []string{}
+	for _, ref := range refs {
+		tag, ok := tags[ref]
+		if !ok {
+			checks = append(checks, fmt.Sprintf(`has %[1]s || echo %[1]s`, shellescape.Quote(ref)))
+			continue
+		}
+		checks = append(checks, fmt.Sprintf(`has %[2]s || { has %[1]s && tag %[1]s %[2]s; } || echo %[2]s`, shellescape.Quote(ref), shellescape.Quote(tag)))
+	}
+	return fmt.Sprintf(`has() { crictl inspecti -q "$1" >/dev/null 2>&1; }
+tag() { { podman tag "$1" "$2" || skopeo copy -q "containers-storage:$1" "containers-storage:$2"; } >/dev/null 2>&1; }
+%s`, strings.Join(checks, "\n"))
+}
+
+// sideloadOptImages loads the carried images of the opts a node misses from the local container runtime, the
+// nodes of a provider image built before the opts were updated can't pull them offline
+func sideloadOptImages(ctx context.Context, cli docker.Runtime, out io.Writer, nodeClients []libssh.Client, sshPort uint16, refs []string) error {
+	if len(refs) == 0 {
+		return nil
+	}
+	script := nodeMissingImagesScript(refs)
+	missing := []string{}
+	nodeIdxs := []int{}
+	for i, c := range nodeClients {
+		name := nodeNameFromIndex(i + 1)
+		output, err := c.CommandWithNoStdOut(script)
+		if err != nil {
+			return fmt.Errorf("listing the images of %s failed: %w", name, err)
+		}
+		lines := strings.Fields(output)
+		if len(lines) == 0 {
+			continue
+		}
+		nodeIdxs = append(nodeIdxs, i+1)
+		missing = append(missing, lines...)
+	}
+	if len(nodeIdxs) == 0 {
+		return nil
+	}
+	slices.Sort(missing)
+	missing = slices.Compact(missing)
+
+	images, err := parseLoadImages(missing)
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp("", "gocli-offline-")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "images.tar")
+	if err := saveImages(ctx, cli, missing, path); err != nil {
+		return err
+	}
+	return loadIntoNodes(out, path, images, sshPort, nodeIdxs)
+}
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
+	k8s "kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/k8s"
+)
+
+const (
+	kubeRBACProxy    = "quay.io/brancz/kube-rbac-proxy@sha256:e6a323504999b2a4d2a6bf94f8580a050378eba0900fd31335cf9df5787d9a9b"
+	kubeRBACProxyTag = "quay.io/brancz/kube-rbac-proxy:sha256-e6a323504999b2a4d2a6bf94f8580a050378eba0900fd31335cf9df5787d9a9b"
+)
+
+var _ = Describe("Bundle", func() {
+	var (
+		runtime   *docker.FakeRuntime
+		k8sClient k8s.K8sDynamicClient
+		mu        sync.Mutex
+		files     map[int]*fakeNodeFiles
+		// missing is what the nodes report for the crictl check of run --offline
+		missing string
+		// checks are the crictl checks of run --offline
+		checks []string
+	)
+
+	BeforeEach(func() {
+		runtime = docker.NewFakeRuntime()
+		files = map[int]*fakeNodeFiles{}
+		missing = ""
+		checks = nil
+		// cnao waits for its operator to roll out
+		k8sClient = k8s.NewTestClient(k8s.NewReactorConfig("create", "deployments", k8s.RolloutReactor))
+		sshClient := setupFakeCluster(runtime, k8sClient)
+		sshClient.EXPECT().CommandWithNoStdOut(gomock.Any()).DoAndReturn(func(cmd string) (string, error) {
+			if strings.Contains(cmd, "crictl inspecti") {
+				mu.Lock()
+				defer mu.Unlock()
+				checks = append(checks, cmd)
+				return missing, nil
+			}
+			return "", nil
+		}).AnyTimes()
+		newNodeFiles = func(_ uint16, idx int) (nodeFiles, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			files[idx] = &fakeNodeFiles{idx: idx, files: map[string]fakeFile{}}
+			return files[idx], nil
+		}
+	})
+
+	// importBundle exports the images of k8s-1.30 and imports them into a new runtime the tests continue with
+	importBundle := func() {
+		out, err := gocli("bundle", "export", "k8s-1.30", "--output-file", "bundle.tar")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(MatchRegexp(`exported \d+ images to bundle.tar\n$`))
+		Expect(runtime.Saved).To(HaveLen(1))
+		Expect(runtime.Saved[0]).To(ContainElements(
+			"quay.io/kubevirtci/k8s-1.30:latest",
+			"quay.io/libpod/registry:2.8.2",
+			"quay.io/kubevirtci/gists-nfs-server:2.6.4",
+			"quay.io/kubevirt/cdi-operator:v1.65.0",
+			"quay.io/kubevirt/aaq-operator:v1.2.2",
+			"quay.io/kubevirtci/pilot:1.30.2",
+			kubeRBACProxyTag,
+		))
+		Expect(runtime.Saved[0]).NotTo(ContainElement(ContainSubstring("@sha256:")))
+		Expect(runtime.Pulled).To(ContainElement(kubeRBACProxy))
+		Expect(runtime.Tagged).To(ContainElement(kubeRBACProxyTag))
+		Expect(runtime.Pulled).To(HaveLen(len(runtime.Saved[0])))
+		_, err = os.Stat(".bundle.tar.tmp")
+		Expect(os.IsNotExist(err)).To(BeTrue())
+
+		runtime = docker.NewFakeRuntime()
+		newRuntime = func() (docker.Runtime, error) { return runtime, nil }
+		out, err = gocli("bundle", "import", "bundle.tar")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal("imported the images of bundle.tar into fake\n"))
+	}
+
+	It("should carry all images to another host", func() {
+		importBundle()
+		for _, ref := range []string{"quay.io/kubevirtci/k8s-1.30", "quay.io/libpod/registry:2.8.2", "docker.io/grafana/grafana:11.1.0"} {
+			exists, err := runtime.ImageExists(context.Background(), ref)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeTrue(), ref)
+		}
+	})
+
+	It("should run a cluster offline without pulling", func() {
+		importBundle()
+		_, err := gocli("run", "k8s-1.30", "--nodes", "2", "--background", "--offline", "--deploy-cdi", "--nfs-data", GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(runtime.Pulled).To(BeEmpty())
+		// the nodes have all images of the opts
+		Expect(files).To(BeEmpty())
+	})
+
+	It("should side-load the images of the opts the nodes miss", func() {
+		importBundle()
+		missing = "quay.io/kubevirt/cdi-operator:v1.65.0\n"
+		out, err := gocli("run", "k8s-1.30", "--nodes", "2", "--background", "--offline", "--deploy-cdi")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(ContainSubstring("loaded 1 images into node01\n"))
+		Expect(out).To(ContainSubstring("loaded 1 images into node02\n"))
+		Expect(runtime.Saved).To(Equal([][]string{{"quay.io/kubevirt/cdi-operator:v1.65.0"}}))
+		Expect(files).To(HaveLen(2))
+		Expect(files[1].files).To(HaveKey(fmt.Sprintf("/var/tmp/gocli-images-%d.tar", os.Getpid())))
+	})
+
+	It("should run cnao offline from the digest tags of its images", func() {
+		importBundle()
+		exists, err := runtime.ImageExists(context.Background(), kubeRBACProxyTag)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(exists).To(BeTrue())
+
+		// node01 misses the image, it can't tag the image it pulled by digest
+		missing = kubeRBACProxyTag + "\n"
+		out, err := gocli("run", "k8s-1.30", "--background", "--offline", "--enable-cnao")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(runtime.Pulled).To(BeEmpty())
+		Expect(checks).To(HaveLen(1))
+		Expect(checks[0]).To(ContainSubstring(fmt.Sprintf("has %[2]s || { has %[1]s && tag %[1]s %[2]s; } || echo %[2]s", kubeRBACProxy, kubeRBACProxyTag)))
+		Expect(out).To(ContainSubstring("loaded 1 images into node01\n"))
+		Expect(runtime.Saved).To(Equal([][]string{{kubeRBACProxyTag}}))
+
+		operator, err := k8sClient.Get(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, "cluster-network-addons-operator", "cluster-network-addons")
+		Expect(err).NotTo(HaveOccurred())
+		containers, _, err := unstructured.NestedSlice(operator.Object, "spec", "template", "spec", "containers")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(containers).To(ContainElement(HaveKeyWithValue("image", kubeRBACProxyTag)))
+		Expect(fmt.Sprint(containers)).NotTo(ContainSubstring("@sha256:"))
+	})
+
+	It("should refuse unknown opts", func() {
+		_, err := gocli("bundle", "export", "k8s-1.30", "-o", "bundle.tar", "--opts", "kubevirt")
+		Expect(err).To(MatchError(`unknown opt "kubevirt"`))
+		Expect(runtime.Pulled).To(BeEmpty())
+	})
+
+	It("should only export the images of the given opts", func() {
+		_, err := gocli("bundle", "export", "k8s-1.30", "-o", "bundle.tar", "--opts", "cdi")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(runtime.Saved).To(HaveLen(1))
+		Expect(runtime.Saved[0]).To(ContainElement("quay.io/kubevirt/cdi-operator:v1.65.0"))
+		Expect(runtime.Saved[0]).NotTo(ContainElement("quay.io/kubevirt/aaq-operator:v1.2.2"))
+	})
+
+	It("should fail at once if images are missing offline", func() {
+		_, err := gocli("run", "k8s-1.30", "--background", "--offline", "--deploy-cdi")
+		Expect(err).To(MatchError(ContainSubstring("the images quay.io/kubevirtci/k8s-1.30, quay.io/libpod/registry:2.8.2, quay.io/kubevirt/cdi-apiserver:v1.65.0")))
+		Expect(err).To(MatchError(ContainSubstring("are missing in fake")))
+		Expect(runtime.Pulled).To(BeEmpty())
+		_, ok := runtime.Container("k8s-1.30-dnsmasq")
+		Expect(ok).To(BeFalse())
+	})
+})
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
+)
+
+// cleanupSignals are the signals on which run and provision remove what they created
+var cleanupSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP}
+
+// NewCleanupCommand returns the command to remove what interrupted runs left behind
+func NewCleanupCommand() *cobra.Command {
+	cleanup := &cobra.Command{
+		Use:   "cleanup",
+		Short: "cleanup shows and removes what interrupted runs of gocli left behind",
+		Long: `cleanup shows and removes what interrupted runs of gocli left behind
+
+run and provision record the containers and volumes they create in a ledger, which is deleted once
+they cleaned up or handed the cluster over. A running gocli holds a lock on its ledger, a ledger
+nobody holds the lock of is stale, the run was killed before it could clean up. Without flags the ledgers are listed, --stale removes the
+containers and volumes of the stale ones. The ledgers are kept in $` + docker.LedgerDirEnv + `, or
+in the user cache directory. gocli in a container has to share the directory with the host, cluster-up
+mounts it from $KUBEVIRTCI_CONFIG_PATH/ledger.`,
+		RunE: cleanup,
+		Args: cobra.NoArgs,
+	}
+	cleanup.Flags().Bool("stale", false, "remove the containers and volumes of interrupted runs")
+	return cleanup
+}
+
+func cleanup(cmd *cobra.Command, _ []string) error {
+	stale, err := cmd.Flags().GetBool("stale")
+	if err != nil {
+		return err
+	}
+
+	ledgers, err := docker.LoadLedgers()
+	if err != nil {
+		return err
+	}
+
+	if !stale {
+		tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "PREFIX\tSTARTED\tCONTAINERS\tVOLUMES\tSTATE")
+		for _, l := range ledgers {
+			state := "running"
+			if l.Stale() {
+				state = "stale"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\n", l.Prefix, l.StartedAt.Format(time.RFC3339), len(l.Containers), len(l.Volumes), state)
+		}
+		return tw.Flush()
+	}
+
+	cli, err := newRuntime()
+	if err != nil {
+		return err
+	}
+	for _, l := range ledgers {
+		if !l.Stale() {
+			continue
+		}
+		if err := l.Reconcile(cli); err != nil {
+			return fmt.Errorf("failed to clean up the interrupted run of %s: %v", l.Prefix, err)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "removed %d containers and %d volumes of the interrupted run of %s\n", len(l.Containers), len(l.Volumes), l.Prefix)
+	}
+	return nil
+}
+
+// startLedger starts the ledger of a run for the cluster with the given prefix. It fails when another
+// gocli is creating the cluster or an interrupted run left a ledger behind
+func startLedger(prefix string) (*docker.Ledger, error) {
+	previous, err := docker.LoadLedger(prefix)
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil {
+		if !previous.Stale() {
+			return nil, fmt.Errorf("another gocli is creating the cluster %s since %s", prefix, previous.StartedAt.Format(time.RFC3339))
+		}
+		return nil, fmt.Errorf("an interrupted run of the cluster %s left %d containers and %d volumes behind, remove them with gocli cleanup --stale",
+			prefix, len(previous.Containers), len(previous.Volumes))
+	}
+	ledger, err := docker.NewLedger(prefix)
+	if errors.Is(err, docker.ErrLedgerLocked) {
+		return nil, fmt.Errorf("another gocli is creating the cluster %s", prefix)
+	}
+	return ledger, err
+}
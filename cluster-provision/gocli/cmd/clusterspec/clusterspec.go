@@ -0,0 +1,304 @@
+package clusterspec
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// APIVersion is the only spec version understood by this release of gocli
+	APIVersion = "gocli.kubevirt.io/v1alpha1"
+	// Kind is the kind every cluster spec file has to declare
+	Kind = "ClusterSpec"
+
+	nodeOverrideFlag = "node-override"
+)
+
+// ClusterSpec is the declarative counterpart of the `gocli run` flags.
+// Every field carrying a flag tag is translated into the flag of the same name,
+// fields left unset in the file keep the flag default.
+type ClusterSpec struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	// Provider is the cluster image to run, e.g. k8s-1.30. It is used when no positional argument is passed
+	Provider string `json:"provider,omitempty"`
+
+	Nodes                     *uint   `json:"nodes,omitempty" flag:"nodes"`
+	CPU                       *uint   `json:"cpu,omitempty" flag:"cpu"`
+	Memory                    *string `json:"memory,omitempty" flag:"memory"`
+	Numa                      *uint   `json:"numa,omitempty" flag:"numa"`
+	SecondaryNics             *uint   `json:"secondaryNics,omitempty" flag:"secondary-nics"`
+	QemuArgs                  *string `json:"qemuArgs,omitempty" flag:"qemu-args"`
+	KernelArgs                *string `json:"kernelArgs,omitempty" flag:"kernel-args"`
+	Hugepages2M               *uint   `json:"hugepages2M,omitempty" flag:"hugepages-2m"`
+	Hugepages1G               *uint   `json:"hugepages1G,omitempty" flag:"hugepages-1g"`
+	EnableSecondaryNicBridges *bool   `json:"enableSecondaryNicBridges,omitempty" flag:"enable-secondary-nic-bridges"`
+
+	Disks Disks       `json:"disks,omitempty"`
+	Linux LinuxConfig `json:"linux,omitempty"`
+	K8s   K8sConfig   `json:"k8s,omitempty"`
+
+	// NodeOverrides is keyed by node name, e.g. node03
+	NodeOverrides map[string]NodeOverride `json:"nodeOverrides,omitempty"`
+}
+
+// Disks holds the sizes of the emulated disks attached to every node
+type Disks struct {
+	NVMe   []string `json:"nvme,omitempty" flag:"nvme"`
+	SCSI   []string `json:"scsi,omitempty" flag:"scsi"`
+	USB    []string `json:"usb,omitempty" flag:"usb"`
+	Shared []string `json:"shared,omitempty" flag:"shared-block-device"`
+}
+
+// LinuxConfig mirrors nodesconfig.NodeLinuxConfig
+type LinuxConfig struct {
+	FipsEnabled           *bool   `json:"fipsEnabled,omitempty" flag:"enable-fips"`
+	DockerProxy           *string `json:"dockerProxy,omitempty" flag:"docker-proxy"`
+	EtcdInMemory          *bool   `json:"etcdInMemory,omitempty" flag:"run-etcd-on-memory"`
+	EtcdSize              *string `json:"etcdSize,omitempty" flag:"etcd-capacity"`
+	SingleStack           *bool   `json:"singleStack,omitempty" flag:"single-stack"`
+	Flannel               *bool   `json:"flannel,omitempty" flag:"flannel"`
+	NoEtcdFsync           *bool   `json:"noEtcdFsync,omitempty" flag:"no-etcd-fsync"`
+	EnableAudit           *bool   `json:"enableAudit,omitempty" flag:"enable-audit"`
+	GpuAddress            *string `json:"gpuAddress,omitempty" flag:"gpu"`
+	Realtime              *bool   `json:"realtime,omitempty" flag:"enable-realtime-scheduler"`
+	PSA                   *bool   `json:"psa,omitempty" flag:"enable-psa"`
+	KsmEnabled            *bool   `json:"ksmEnabled,omitempty" flag:"enable-ksm"`
+	KsmPageCount          *uint   `json:"ksmPageCount,omitempty" flag:"ksm-page-count"`
+	KsmScanInterval       *uint   `json:"ksmScanInterval,omitempty" flag:"ksm-scan-interval"`
+	SwapEnabled           *bool   `json:"swapEnabled,omitempty" flag:"enable-swap"`
+	Swappiness            *uint   `json:"swappiness,omitempty" flag:"swapiness"`
+	SwapBehavior          *string `json:"swapBehavior,omitempty" flag:"swap-behavior"`
+	SwapSize              *uint   `json:"swapSize,omitempty" flag:"swap-size"`
+	VsockChildNsMode      *string `json:"vsockChildNsMode,omitempty" flag:"vsock-child-ns-mode"`
+	TopologyManagerPolicy *string `json:"topologyManagerPolicy,omitempty" flag:"topology-manager-policy"`
+	ReservedSystemCPUs    *string `json:"reservedSystemCPUs,omitempty" flag:"reserved-system-cpus"`
+}
+
+// K8sConfig mirrors nodesconfig.NodeK8sConfig
+type K8sConfig struct {
+	Ceph                     *bool   `json:"ceph,omitempty" flag:"enable-ceph"`
+	Prometheus               *bool   `json:"prometheus,omitempty" flag:"enable-prometheus"`
+	Alertmanager             *bool   `json:"alertmanager,omitempty" flag:"enable-prometheus-alertmanager"`
+	Grafana                  *bool   `json:"grafana,omitempty" flag:"enable-grafana"`
+	Istio                    *bool   `json:"istio,omitempty" flag:"enable-istio"`
+	NfsCsi                   *bool   `json:"nfsCsi,omitempty" flag:"enable-nfs-csi"`
+	CNAO                     *bool   `json:"cnao,omitempty" flag:"enable-cnao"`
+	CNAOSkipCR               *bool   `json:"cnaoSkipCR,omitempty" flag:"skip-cnao-cr"`
+	Multus                   *bool   `json:"multus,omitempty" flag:"deploy-multus"`
+	CDI                      *bool   `json:"cdi,omitempty" flag:"deploy-cdi"`
+	CDIVersion               *string `json:"cdiVersion,omitempty" flag:"cdi-version"`
+	AAQ                      *bool   `json:"aaq,omitempty" flag:"deploy-aaq"`
+	AAQVersion               *string `json:"aaqVersion,omitempty" flag:"aaq-version"`
+	DNC                      *bool   `json:"dnc,omitempty" flag:"deploy-dnc"`
+	NetworkResourcesInjector *bool   `json:"networkResourcesInjector,omitempty" flag:"deploy-network-resources-injector"`
+	// AddonDirs are directories with an addon.yaml, relative paths are resolved against the working directory
+	AddonDirs []string `json:"addonDirs,omitempty" flag:"addon-dir"`
+}
+
+// LoadFile reads and validates a YAML or JSON cluster spec
+func LoadFile(path string) (*ClusterSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading cluster spec: %v", err)
+	}
+	spec, err := Load(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cluster spec %s: %v", path, err)
+	}
+	return spec, nil
+}
+
+// Load parses and validates a YAML or JSON cluster spec. Unknown fields are rejected
+func Load(data []byte) (*ClusterSpec, error) {
+	spec := &ClusterSpec{}
+	if err := yaml.UnmarshalStrict(data, spec); err != nil {
+		return nil, err
+	}
+	if errs := spec.Validate(); len(errs) > 0 {
+		return nil, errs.ToAggregate()
+	}
+	return spec, nil
+}
+
+// Validate checks every field of the spec and reports each failure with the path of the offending field
+func (s *ClusterSpec) Validate() field.ErrorList {
+	errs := field.ErrorList{}
+
+	if s.APIVersion != APIVersion {
+		errs = append(errs, field.NotSupported(field.NewPath("apiVersion"), s.APIVersion, []string{APIVersion}))
+	}
+	if s.Kind != Kind {
+		errs = append(errs, field.NotSupported(field.NewPath("kind"), s.Kind, []string{Kind}))
+	}
+
+	errs = append(errs, validateMin(field.NewPath("nodes"), s.Nodes, 1)...)
+	errs = append(errs, validateMin(field.NewPath("cpu"), s.CPU, 1)...)
+	errs = append(errs, validateMin(field.NewPath("numa"), s.Numa, 1)...)
+	errs = append(errs, validateQuantity(field.NewPath("memory"), s.Memory)...)
+
+	disksPath := field.NewPath("disks")
+	errs = append(errs, validateQuantities(disksPath.Child("nvme"), s.Disks.NVMe)...)
+	errs = append(errs, validateQuantities(disksPath.Child("scsi"), s.Disks.SCSI)...)
+	errs = append(errs, validateQuantities(disksPath.Child("usb"), s.Disks.USB)...)
+	errs = append(errs, validateQuantities(disksPath.Child("shared"), s.Disks.Shared)...)
+
+	linuxPath := field.NewPath("linux")
+	errs = append(errs, validateQuantity(linuxPath.Child("etcdSize"), s.Linux.EtcdSize)...)
+	errs = append(errs, validateEnum(linuxPath.Child("vsockChildNsMode"), s.Linux.VsockChildNsMode, "global", "local")...)
+	errs = append(errs, validateEnum(linuxPath.Child("topologyManagerPolicy"), s.Linux.TopologyManagerPolicy, "none", "best-effort", "restricted", "single-numa-node")...)
+
+	overridesPath := field.NewPath("nodeOverrides")
+	for _, nodeName := range s.overriddenNodes() {
+		nodeIdx, err := NodeIndex(nodeName)
+		if err != nil {
+			errs = append(errs, field.Invalid(overridesPath.Key(nodeName), nodeName, err.Error()))
+			continue
+		}
+		if s.Nodes != nil && uint(nodeIdx) > *s.Nodes {
+			errs = append(errs, field.Invalid(overridesPath.Key(nodeName), nodeName, fmt.Sprintf("the cluster has only %d nodes", *s.Nodes)))
+		}
+		o := s.NodeOverrides[nodeName]
+		errs = append(errs, o.Validate(overridesPath.Key(nodeName))...)
+	}
+
+	return errs
+}
+
+// ApplyToFlags copies every field set in the spec onto its flag.
+// Flags the user passed explicitly on the command line are left untouched so they override the file
+func (s *ClusterSpec) ApplyToFlags(flags *pflag.FlagSet) error {
+	if err := applyToFlags(reflect.ValueOf(s).Elem(), flags); err != nil {
+		return err
+	}
+
+	if len(s.NodeOverrides) == 0 {
+		return nil
+	}
+	flag := flags.Lookup(nodeOverrideFlag)
+	if flag == nil {
+		return fmt.Errorf("cluster spec field NodeOverrides refers to unknown flag --%s", nodeOverrideFlag)
+	}
+	if flag.Changed {
+		return nil
+	}
+	for _, nodeName := range s.overriddenNodes() {
+		o := s.NodeOverrides[nodeName]
+		if err := flags.Set(nodeOverrideFlag, o.String(nodeName)); err != nil {
+			return fmt.Errorf("failed setting --%s from cluster spec: %v", nodeOverrideFlag, err)
+		}
+	}
+	return nil
+}
+
+func (s *ClusterSpec) overriddenNodes() []string {
+	nodeNames := []string{}
+	for nodeName := range s.NodeOverrides {
+		nodeNames = append(nodeNames, nodeName)
+	}
+	sort.Strings(nodeNames)
+	return nodeNames
+}
+
+func applyToFlags(v reflect.Value, flags *pflag.FlagSet) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		fieldValue := v.Field(i)
+		flagName, hasFlag := t.Field(i).Tag.Lookup("flag")
+
+		if !hasFlag {
+			if fieldValue.Kind() == reflect.Struct {
+				if err := applyToFlags(fieldValue, flags); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		values := []reflect.Value{}
+		switch fieldValue.Kind() {
+		case reflect.Ptr:
+			if !fieldValue.IsNil() {
+				values = append(values, fieldValue.Elem())
+			}
+		case reflect.Slice:
+			for j := 0; j < fieldValue.Len(); j++ {
+				values = append(values, fieldValue.Index(j))
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+
+		flag := flags.Lookup(flagName)
+		if flag == nil {
+			return fmt.Errorf("cluster spec field %s refers to unknown flag --%s", t.Field(i).Name, flagName)
+		}
+		if flag.Changed {
+			continue
+		}
+
+		for _, value := range values {
+			if err := flags.Set(flagName, formatValue(value)); err != nil {
+				return fmt.Errorf("failed setting --%s from cluster spec: %v", flagName, err)
+			}
+		}
+	}
+	return nil
+}
+
+func formatValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Uint:
+		return strconv.FormatUint(v.Uint(), 10)
+	default:
+		return v.String()
+	}
+}
+
+func validateMin(path *field.Path, value *uint, min uint) field.ErrorList {
+	if value != nil && *value < min {
+		return field.ErrorList{field.Invalid(path, *value, fmt.Sprintf("must be at least %d", min))}
+	}
+	return nil
+}
+
+func validateQuantity(path *field.Path, value *string) field.ErrorList {
+	if value == nil {
+		return nil
+	}
+	if _, err := resource.ParseQuantity(*value); err != nil {
+		return field.ErrorList{field.Invalid(path, *value, err.Error())}
+	}
+	return nil
+}
+
+func validateQuantities(path *field.Path, values []string) field.ErrorList {
+	errs := field.ErrorList{}
+	for i := range values {
+		errs = append(errs, validateQuantity(path.Index(i), &values[i])...)
+	}
+	return errs
+}
+
+func validateEnum(path *field.Path, value *string, supported ...string) field.ErrorList {
+	if value == nil || *value == "" {
+		return nil
+	}
+	for _, s := range supported {
+		if *value == s {
+			return nil
+		}
+	}
+	return field.ErrorList{field.NotSupported(path, *value, supported)}
+}
@@ -0,0 +1,169 @@
+package clusterspec
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/pflag"
+)
+
+func TestClusterSpec(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "ClusterSpec Suite")
+}
+
+var _ = Describe("ClusterSpec", func() {
+	Describe("Load", func() {
+		It("should parse a YAML spec", func() {
+			spec, err := Load([]byte(`
+apiVersion: gocli.kubevirt.io/v1alpha1
+kind: ClusterSpec
+provider: k8s-1.30
+nodes: 2
+memory: 8G
+disks:
+  nvme: [10G, 20G]
+linux:
+  swapEnabled: true
+k8s:
+  ceph: true
+`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(spec.Provider).To(Equal("k8s-1.30"))
+			Expect(*spec.Nodes).To(BeEquivalentTo(2))
+			Expect(*spec.Memory).To(Equal("8G"))
+			Expect(spec.Disks.NVMe).To(Equal([]string{"10G", "20G"}))
+			Expect(*spec.Linux.SwapEnabled).To(BeTrue())
+			Expect(*spec.K8s.Ceph).To(BeTrue())
+			Expect(spec.K8s.CDI).To(BeNil())
+		})
+
+		It("should parse a JSON spec", func() {
+			spec, err := Load([]byte(`{"apiVersion": "gocli.kubevirt.io/v1alpha1", "kind": "ClusterSpec", "cpu": 4}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*spec.CPU).To(BeEquivalentTo(4))
+		})
+
+		It("should reject unknown fields", func() {
+			_, err := Load([]byte(`
+apiVersion: gocli.kubevirt.io/v1alpha1
+kind: ClusterSpec
+nodez: 2
+`))
+			Expect(err).To(MatchError(ContainSubstring(`unknown field "nodez"`)))
+		})
+
+		DescribeTable("should point at the invalid field",
+			func(body, path string) {
+				_, err := Load([]byte("apiVersion: gocli.kubevirt.io/v1alpha1\nkind: ClusterSpec\n" + body))
+				Expect(err).To(MatchError(ContainSubstring(path)))
+			},
+			Entry("memory", "memory: 3x", "memory: Invalid value"),
+			Entry("disk size", "disks:\n  nvme: [1G, huge]", "disks.nvme[1]: Invalid value"),
+			Entry("node count", "nodes: 0", "nodes: Invalid value"),
+			Entry("vsock mode", "linux:\n  vsockChildNsMode: other", "linux.vsockChildNsMode: Unsupported value"),
+		)
+
+		It("should reject an unsupported version", func() {
+			_, err := Load([]byte("apiVersion: v2\nkind: ClusterSpec\n"))
+			Expect(err).To(MatchError(ContainSubstring("apiVersion: Unsupported value")))
+		})
+	})
+
+	Describe("ParseNodeOverride", func() {
+		It("should parse the node and its settings", func() {
+			nodeIdx, o, err := ParseNodeOverride("node03:memory=8G,cpu=6,nvme=10G,nvme=20G,hugepages-1g=4,swap=true")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(nodeIdx).To(Equal(3))
+			Expect(*o.Memory).To(Equal("8G"))
+			Expect(*o.CPU).To(BeEquivalentTo(6))
+			Expect(o.NVMe).To(Equal([]string{"10G", "20G"}))
+			Expect(*o.Hugepages1G).To(BeEquivalentTo(4))
+			Expect(*o.SwapEnabled).To(BeTrue())
+			Expect(o.LinuxConfigFuncs()).To(HaveLen(1))
+		})
+
+		It("should round trip through String", func() {
+			value := "node02:memory=4G,cpu=2,scsi=1G,realtime=false"
+			_, o, err := ParseNodeOverride(value)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(o.String("node02")).To(Equal(value))
+		})
+
+		It("should keep the commas of list values", func() {
+			value := "node02:reserved-system-cpus=0,1,cpu=4,topology-manager-policy=single-numa-node"
+			_, o, err := ParseNodeOverride(value)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*o.ReservedSystemCPUs).To(Equal("0,1"))
+			Expect(*o.CPU).To(BeEquivalentTo(4))
+
+			_, roundTripped, err := ParseNodeOverride(o.String("node02"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(roundTripped).To(Equal(o))
+			Expect(o.String("node02")).To(Equal("node02:cpu=4,topology-manager-policy=single-numa-node,reserved-system-cpus=0,1"))
+		})
+
+		DescribeTable("should reject invalid overrides",
+			func(value, message string) {
+				_, _, err := ParseNodeOverride(value)
+				Expect(err).To(MatchError(ContainSubstring(message)))
+			},
+			Entry("missing node", "memory=8G", "expected <node>"),
+			Entry("bad node name", "worker:cpu=2", `invalid node name "worker"`),
+			Entry("unknown key", "node02:gpu=1", `unknown key "gpu"`),
+			Entry("bad quantity", "node02:nvme=big", "node02.nvme[0]: Invalid value"),
+		)
+	})
+
+	Describe("ApplyToFlags", func() {
+		var flags *pflag.FlagSet
+
+		BeforeEach(func() {
+			flags = pflag.NewFlagSet("run", pflag.ContinueOnError)
+			flags.UintP("nodes", "n", 1, "")
+			flags.StringP("memory", "m", "3096M", "")
+			flags.StringArray("nvme", []string{}, "")
+			flags.Bool("enable-ceph", false, "")
+			flags.StringArray("node-override", []string{}, "")
+		})
+
+		It("should set the flags which are not set explicitly", func() {
+			Expect(flags.Parse([]string{"--memory", "4G"})).To(Succeed())
+
+			nodes := uint(3)
+			memory := "8G"
+			ceph := true
+			spec := &ClusterSpec{
+				Nodes:  &nodes,
+				Memory: &memory,
+				Disks:  Disks{NVMe: []string{"1G", "2G"}},
+				K8s:    K8sConfig{Ceph: &ceph},
+			}
+			Expect(spec.ApplyToFlags(flags)).To(Succeed())
+
+			Expect(flags.GetUint("nodes")).To(BeEquivalentTo(3))
+			Expect(flags.GetString("memory")).To(Equal("4G"))
+			Expect(flags.GetStringArray("nvme")).To(Equal([]string{"1G", "2G"}))
+			Expect(flags.GetBool("enable-ceph")).To(BeTrue())
+		})
+
+		It("should set the node overrides", func() {
+			memory := "8G"
+			spec := &ClusterSpec{
+				NodeOverrides: map[string]NodeOverride{
+					"node02": {NVMe: []string{"10G"}},
+					"node01": {Memory: &memory},
+				},
+			}
+			Expect(spec.ApplyToFlags(flags)).To(Succeed())
+			Expect(flags.GetStringArray("node-override")).To(Equal([]string{"node01:memory=8G", "node02:nvme=10G"}))
+		})
+
+		It("should fail on a field without a matching flag", func() {
+			cpu := uint(2)
+			spec := &ClusterSpec{CPU: &cpu}
+			Expect(spec.ApplyToFlags(flags)).To(MatchError(ContainSubstring("--cpu")))
+		})
+	})
+})
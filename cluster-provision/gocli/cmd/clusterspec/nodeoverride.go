@@ -0,0 +1,263 @@
+package clusterspec
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/cmd/nodesconfig"
+)
+
+var nodeNameRegex = regexp.MustCompile(`^node([0-9]+)$`)
+
+// settingRegex matches the start of a setting, commas not followed by one belong to a list value like 0,1
+var settingRegex = regexp.MustCompile(`^[a-z0-9-]+=`)
+
+// NodeOverride holds the settings of a single node which deviate from the cluster wide ones
+type NodeOverride struct {
+	Memory                *string  `json:"memory,omitempty"`
+	CPU                   *uint    `json:"cpu,omitempty"`
+	Numa                  *uint    `json:"numa,omitempty"`
+	NVMe                  []string `json:"nvme,omitempty"`
+	SCSI                  []string `json:"scsi,omitempty"`
+	USB                   []string `json:"usb,omitempty"`
+	Hugepages2M           *uint    `json:"hugepages2M,omitempty"`
+	Hugepages1G           *uint    `json:"hugepages1G,omitempty"`
+	Realtime              *bool    `json:"realtime,omitempty"`
+	KsmEnabled            *bool    `json:"ksmEnabled,omitempty"`
+	SwapEnabled           *bool    `json:"swapEnabled,omitempty"`
+	TopologyManagerPolicy *string  `json:"topologyManagerPolicy,omitempty"`
+	ReservedSystemCPUs    *string  `json:"reservedSystemCPUs,omitempty"`
+}
+
+// ParseNodeOverride parses the value of --node-override, e.g. node03:memory=8G,cpu=6,nvme=10G.
+// Disk keys can be repeated to attach several disks, values may be lists like reserved-system-cpus=0,1.
+// It returns the index of the node it applies to
+func ParseNodeOverride(value string) (int, *NodeOverride, error) {
+	nodeName, settings, found := strings.Cut(value, ":")
+	if !found {
+		return 0, nil, fmt.Errorf("invalid node override %q, expected <node>:<key>=<value>[,<key>=<value>...]", value)
+	}
+
+	nodeIdx, err := NodeIndex(nodeName)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	o := &NodeOverride{}
+	for _, setting := range splitSettings(settings) {
+		key, val, found := strings.Cut(setting, "=")
+		if !found {
+			return 0, nil, fmt.Errorf("invalid setting %q in node override for %s, expected <key>=<value>", setting, nodeName)
+		}
+		if err := o.set(key, val); err != nil {
+			return 0, nil, fmt.Errorf("invalid setting %q in node override for %s: %v", setting, nodeName, err)
+		}
+	}
+
+	if errs := o.Validate(field.NewPath(nodeName)); len(errs) > 0 {
+		return 0, nil, errs.ToAggregate()
+	}
+	return nodeIdx, o, nil
+}
+
+// splitSettings splits the settings of an override at the commas which start a new setting
+func splitSettings(settings string) []string {
+	split := []string{}
+	for _, s := range strings.Split(settings, ",") {
+		if len(split) > 0 && !settingRegex.MatchString(s) {
+			split[len(split)-1] += "," + s
+			continue
+		}
+		split = append(split, s)
+	}
+	return split
+}
+
+// NodeIndex returns the index of a node name in the nodeNN format
+func NodeIndex(nodeName string) (int, error) {
+	submatches := nodeNameRegex.FindStringSubmatch(nodeName)
+	if len(submatches) != 2 {
+		return 0, fmt.Errorf("invalid node name %q, expected nodeNN", nodeName)
+	}
+	idx, err := strconv.Atoi(submatches[1])
+	if err != nil || idx < 1 {
+		return 0, fmt.Errorf("invalid node name %q, expected nodeNN", nodeName)
+	}
+	return idx, nil
+}
+
+func (o *NodeOverride) set(key, value string) error {
+	switch key {
+	case "memory":
+		o.Memory = &value
+	case "cpu":
+		return setUint(&o.CPU, value)
+	case "numa":
+		return setUint(&o.Numa, value)
+	case "nvme":
+		o.NVMe = append(o.NVMe, value)
+	case "scsi":
+		o.SCSI = append(o.SCSI, value)
+	case "usb":
+		o.USB = append(o.USB, value)
+	case "hugepages-2m":
+		return setUint(&o.Hugepages2M, value)
+	case "hugepages-1g":
+		return setUint(&o.Hugepages1G, value)
+	case "realtime":
+		return setBool(&o.Realtime, value)
+	case "ksm":
+		return setBool(&o.KsmEnabled, value)
+	case "swap":
+		return setBool(&o.SwapEnabled, value)
+	case "topology-manager-policy":
+		o.TopologyManagerPolicy = &value
+	case "reserved-system-cpus":
+		o.ReservedSystemCPUs = &value
+	default:
+		return fmt.Errorf("unknown key %q", key)
+	}
+	return nil
+}
+
+// Merge copies every setting of other over the settings of o, disks are appended
+func (o *NodeOverride) Merge(other *NodeOverride) {
+	if other.Memory != nil {
+		o.Memory = other.Memory
+	}
+	if other.CPU != nil {
+		o.CPU = other.CPU
+	}
+	if other.Numa != nil {
+		o.Numa = other.Numa
+	}
+	o.NVMe = append(o.NVMe, other.NVMe...)
+	o.SCSI = append(o.SCSI, other.SCSI...)
+	o.USB = append(o.USB, other.USB...)
+	if other.Hugepages2M != nil {
+		o.Hugepages2M = other.Hugepages2M
+	}
+	if other.Hugepages1G != nil {
+		o.Hugepages1G = other.Hugepages1G
+	}
+	if other.Realtime != nil {
+		o.Realtime = other.Realtime
+	}
+	if other.KsmEnabled != nil {
+		o.KsmEnabled = other.KsmEnabled
+	}
+	if other.SwapEnabled != nil {
+		o.SwapEnabled = other.SwapEnabled
+	}
+	if other.TopologyManagerPolicy != nil {
+		o.TopologyManagerPolicy = other.TopologyManagerPolicy
+	}
+	if other.ReservedSystemCPUs != nil {
+		o.ReservedSystemCPUs = other.ReservedSystemCPUs
+	}
+}
+
+// Validate checks the override, reporting failures relative to path
+func (o *NodeOverride) Validate(path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	errs = append(errs, validateQuantity(path.Child("memory"), o.Memory)...)
+	errs = append(errs, validateMin(path.Child("cpu"), o.CPU, 1)...)
+	errs = append(errs, validateMin(path.Child("numa"), o.Numa, 1)...)
+	errs = append(errs, validateQuantities(path.Child("nvme"), o.NVMe)...)
+	errs = append(errs, validateQuantities(path.Child("scsi"), o.SCSI)...)
+	errs = append(errs, validateQuantities(path.Child("usb"), o.USB)...)
+	errs = append(errs, validateEnum(path.Child("topologyManagerPolicy"), o.TopologyManagerPolicy, "none", "best-effort", "restricted", "single-numa-node")...)
+	return errs
+}
+
+// LinuxConfigFuncs returns the node linux config settings of the override.
+// They are meant to be appended after the cluster wide ones
+func (o *NodeOverride) LinuxConfigFuncs() []nodesconfig.LinuxConfigFunc {
+	funcs := []nodesconfig.LinuxConfigFunc{}
+	if o.Realtime != nil {
+		funcs = append(funcs, nodesconfig.WithRealtime(*o.Realtime))
+	}
+	if o.KsmEnabled != nil {
+		funcs = append(funcs, nodesconfig.WithKsm(*o.KsmEnabled))
+	}
+	if o.SwapEnabled != nil {
+		funcs = append(funcs, nodesconfig.WithSwap(*o.SwapEnabled))
+	}
+	if o.TopologyManagerPolicy != nil {
+		funcs = append(funcs, nodesconfig.WithTopologyManagerPolicy(*o.TopologyManagerPolicy))
+	}
+	if o.ReservedSystemCPUs != nil {
+		funcs = append(funcs, nodesconfig.WithReservedSystemCPUs(*o.ReservedSystemCPUs))
+	}
+	return funcs
+}
+
+// String formats the override for the given node the way ParseNodeOverride expects it
+func (o *NodeOverride) String(nodeName string) string {
+	settings := []string{}
+	add := func(key, value string) {
+		settings = append(settings, key+"="+value)
+	}
+	if o.Memory != nil {
+		add("memory", *o.Memory)
+	}
+	if o.CPU != nil {
+		add("cpu", strconv.FormatUint(uint64(*o.CPU), 10))
+	}
+	if o.Numa != nil {
+		add("numa", strconv.FormatUint(uint64(*o.Numa), 10))
+	}
+	for _, d := range o.NVMe {
+		add("nvme", d)
+	}
+	for _, d := range o.SCSI {
+		add("scsi", d)
+	}
+	for _, d := range o.USB {
+		add("usb", d)
+	}
+	if o.Hugepages2M != nil {
+		add("hugepages-2m", strconv.FormatUint(uint64(*o.Hugepages2M), 10))
+	}
+	if o.Hugepages1G != nil {
+		add("hugepages-1g", strconv.FormatUint(uint64(*o.Hugepages1G), 10))
+	}
+	if o.Realtime != nil {
+		add("realtime", strconv.FormatBool(*o.Realtime))
+	}
+	if o.KsmEnabled != nil {
+		add("ksm", strconv.FormatBool(*o.KsmEnabled))
+	}
+	if o.SwapEnabled != nil {
+		add("swap", strconv.FormatBool(*o.SwapEnabled))
+	}
+	if o.TopologyManagerPolicy != nil {
+		add("topology-manager-policy", *o.TopologyManagerPolicy)
+	}
+	if o.ReservedSystemCPUs != nil {
+		add("reserved-system-cpus", *o.ReservedSystemCPUs)
+	}
+	return nodeName + ":" + strings.Join(settings, ",")
+}
+
+func setUint(target **uint, value string) error {
+	v, err := strconv.ParseUint(value, 10, 0)
+	if err != nil {
+		return err
+	}
+	u := uint(v)
+	*target = &u
+	return nil
+}
+
+func setBool(target **bool, value string) error {
+	v, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	*target = &v
+	return nil
+}
@@ -1,13 +1,72 @@
 package cmd
 
 import (
+	"bytes"
+	"os"
 	"testing"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
+	k8s "kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/k8s"
+	kubevirtcimocks "kubevirt.io/kubevirtci/cluster-provision/gocli/utils/mock"
 )
 
 func TestCmd(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Provision Manager Suite")
 }
+
+var _ = BeforeEach(func() {
+	// runs record what they create in a ledger, keep it out of the cache of the user
+	ledgerDir := GinkgoT().TempDir()
+	Expect(os.Setenv(docker.LedgerDirEnv, ledgerDir)).To(Succeed())
+	DeferCleanup(os.Unsetenv, docker.LedgerDirEnv)
+})
+
+// setupFakeCluster lets the commands of the running spec talk to runtime and k8sClient instead of a container
+// runtime and a cluster, and runs the spec in a temporary directory. Every API server gets a new client without
+// reactors if k8sClient is nil. The returned SSH client accepts every call, expectations the spec sets replace
+// those of the same method. The spec may replace the other clients of the commands as well, they are all restored
+func setupFakeCluster(runtime *docker.FakeRuntime, k8sClient k8s.K8sDynamicClient) *kubevirtcimocks.MockSSHClient {
+	sshClient := kubevirtcimocks.NewMockSSHClient(gomock.NewController(GinkgoT(), gomock.WithOverridableExpectations()))
+	sshClient.EXPECT().Command(gomock.Any()).AnyTimes()
+	sshClient.EXPECT().CommandWithNoStdOut(gomock.Any()).AnyTimes()
+	sshClient.EXPECT().CopyRemoteFile(gomock.Any(), gomock.Any()).AnyTimes()
+	sshClient.EXPECT().SCP(gomock.Any(), gomock.Any()).AnyTimes()
+
+	origRuntime, origSSHClient, origK8sClient := newRuntime, newSSHClient, newK8sClient
+	origNodeFiles, origNodeShell, origRegistryClient := newNodeFiles, newNodeShell, newRegistryClient
+	newRuntime = func() (docker.Runtime, error) { return runtime, nil }
+	newSSHClient = func(uint16, int, bool) (nodeSSHClient, error) { return outputSSHClient{sshClient}, nil }
+	newK8sClient = func(string, uint16) (k8s.K8sDynamicClient, error) {
+		if k8sClient == nil {
+			return k8s.NewTestClient(), nil
+		}
+		return k8sClient, nil
+	}
+
+	wd, err := os.Getwd()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(os.Chdir(GinkgoT().TempDir())).To(Succeed())
+
+	DeferCleanup(func() {
+		newRuntime, newSSHClient, newK8sClient = origRuntime, origSSHClient, origK8sClient
+		newNodeFiles, newNodeShell, newRegistryClient = origNodeFiles, origNodeShell, origRegistryClient
+		Expect(os.Chdir(wd)).To(Succeed())
+	})
+	return sshClient
+}
+
+// gocli runs a command on the cluster k8s-1.30, a later --prefix selects another cluster. It returns what the
+// command wrote to stdout
+func gocli(args ...string) (string, error) {
+	out := &bytes.Buffer{}
+	root := NewRootCommand()
+	root.SetOut(out)
+	root.SetArgs(append([]string{"--prefix", "k8s-1.30"}, args...))
+	err := root.Execute()
+	return out.String(), err
+}
@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/docker/go-connections/nat"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/cmd/utils"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/ipam"
+)
+
+// clusterEnv is what gocli env reports about a cluster, the ports are the ones published on the host
+type clusterEnv struct {
+	Prefix        string    `json:"prefix"`
+	Kubeconfig    string    `json:"kubeconfig,omitempty"`
+	APIServer     string    `json:"apiServer"`
+	Registry      string    `json:"registry,omitempty"`
+	SSHPort       uint16    `json:"sshPort"`
+	PrometheusURL string    `json:"prometheusURL,omitempty"`
+	GrafanaURL    string    `json:"grafanaURL,omitempty"`
+	DNSPort       uint16    `json:"dnsPort,omitempty"`
+	Nodes         []nodeEnv `json:"nodes"`
+	// Exposed are the host ports of the ports exposed with run --expose and gocli expose by their names
+	Exposed map[string]uint16 `json:"exposed,omitempty"`
+}
+
+// nodeEnv holds the addresses of a node, SSHPort is only set when the node publishes an SSH port of its own,
+// the others are reached through node01 with SSHPort of the cluster
+type nodeEnv struct {
+	Name    string `json:"name"`
+	IPv4    string `json:"ipv4"`
+	IPv6    string `json:"ipv6"`
+	SSHPort uint16 `json:"sshPort,omitempty"`
+}
+
+// NewEnvCommand returns the command to print the connection details of a cluster
+func NewEnvCommand() *cobra.Command {
+	env := &cobra.Command{
+		Use:   "env PREFIX",
+		Short: "env prints the connection details of a cluster as shell variables",
+		Long: `env prints the connection details of a cluster as shell variables
+
+The variables are meant to be evaluated by a shell, eval "$(gocli env PREFIX)", --json prints
+the same details as a single JSON document. With --kubeconfig, env writes the kubeconfig of
+gocli kubeconfig to the given path and points KUBECONFIG to it, otherwise nothing is written.
+Ports the cluster doesn't publish are left out.`,
+		RunE: env,
+		Args: cobra.ExactArgs(1),
+	}
+	env.Flags().Bool("json", false, "print the details as JSON")
+	env.Flags().String("kubeconfig", "", "write the kubeconfig to this path and export KUBECONFIG")
+	return env
+}
+
+func env(cmd *cobra.Command, args []string) error {
+	asJSON, err := cmd.Flags().GetBool("json")
+	if err != nil {
+		return err
+	}
+	kubeconfigPath, err := cmd.Flags().GetString("kubeconfig")
+	if err != nil {
+		return err
+	}
+	prefix := args[0]
+
+	cli, err := newRuntime()
+	if err != nil {
+		return err
+	}
+	dnsmasq, nodes, err := clusterContainers(cli, prefix)
+	if err != nil {
+		return err
+	}
+	dm, err := cli.ContainerInspect(context.Background(), dnsmasq.ID)
+	if err != nil {
+		return err
+	}
+	ports := dm.NetworkSettings.Ports
+
+	config, err := clusterKubeconfig(cli, prefix)
+	if err != nil {
+		return err
+	}
+
+	e := clusterEnv{Prefix: prefix, APIServer: config.Clusters[prefix].Server, Nodes: []nodeEnv{}}
+	if kubeconfigPath != "" {
+		if e.Kubeconfig, err = filepath.Abs(kubeconfigPath); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(e.Kubeconfig), 0o700); err != nil {
+			return err
+		}
+		if err := clientcmd.WriteToFile(*config, e.Kubeconfig); err != nil {
+			return err
+		}
+	}
+	if e.SSHPort, err = utils.GetPublicPort(utils.PortSSH, ports); err != nil {
+		return err
+	}
+	if port, ok := publishedPort(utils.PortRegistry, ports); ok {
+		e.Registry = fmt.Sprintf("127.0.0.1:%d", port)
+	}
+	if port, ok := publishedPort(utils.PortPrometheus, ports); ok {
+		e.PrometheusURL = fmt.Sprintf("http://127.0.0.1:%d", port)
+	}
+	if port, ok := publishedPort(utils.PortGrafana, ports); ok {
+		e.GrafanaURL = fmt.Sprintf("http://127.0.0.1:%d", port)
+	}
+	e.DNSPort, _ = publishedPort(utils.PortDNS, ports)
+	if e.Exposed, err = clusterExposedPorts(cli, prefix); err != nil {
+		return err
+	}
+
+	for _, idx := range slices.Sorted(maps.Keys(nodes)) {
+		addresses, err := ipam.NodeAddresses(idx)
+		if err != nil {
+			return err
+		}
+		node := nodeEnv{Name: addresses.Hostname, IPv4: addresses.IPv4.String(), IPv6: addresses.IPv6.String()}
+		node.SSHPort, _ = publishedPort(utils.NodeSSHPort(idx), ports)
+		e.Nodes = append(e.Nodes, node)
+	}
+
+	if asJSON {
+		return writeJSON(cmd.OutOrStdout(), e)
+	}
+	writeShellEnv(cmd.OutOrStdout(), e)
+	return nil
+}
+
+// publishedPort returns the host port a container port is published on, if it is
+func publishedPort(port uint16, ports nat.PortMap) (uint16, bool) {
+	p, err := utils.GetPublicPort(port, ports)
+	return p, err == nil
+}
+
+// writeShellEnv writes the details as export statements, the variables of a node are named after it
+func writeShellEnv(w io.Writer, e clusterEnv) {
+	export := func(name string, value any) {
+		fmt.Fprintf(w, "export %s=%s\n", name, shellescape.Quote(fmt.Sprint(value)))
+	}
+	export("KUBEVIRTCI_PREFIX", e.Prefix)
+	if e.Kubeconfig != "" {
+		export("KUBECONFIG", e.Kubeconfig)
+	}
+	export("KUBEVIRTCI_API_SERVER", e.APIServer)
+	if e.Registry != "" {
+		export("KUBEVIRTCI_REGISTRY", e.Registry)
+	}
+	export("KUBEVIRTCI_SSH_PORT", e.SSHPort)
+	if e.PrometheusURL != "" {
+		export("KUBEVIRTCI_PROMETHEUS_URL", e.PrometheusURL)
+	}
+	if e.GrafanaURL != "" {
+		export("KUBEVIRTCI_GRAFANA_URL", e.GrafanaURL)
+	}
+	if e.DNSPort != 0 {
+		export("KUBEVIRTCI_DNS_PORT", e.DNSPort)
+	}
+
+	names := []string{}
+	for _, n := range e.Nodes {
+		names = append(names, n.Name)
+		node := "KUBEVIRTCI_" + strings.ToUpper(n.Name)
+		export(node+"_IP", n.IPv4)
+		export(node+"_IPV6", n.IPv6)
+		if n.SSHPort != 0 {
+			export(node+"_SSH_PORT", n.SSHPort)
+		}
+	}
+	export("KUBEVIRTCI_NODES", strings.Join(names, " "))
+
+	for _, name := range slices.Sorted(maps.Keys(e.Exposed)) {
+		export("KUBEVIRTCI_EXPOSE_"+strings.ToUpper(strings.ReplaceAll(name, "-", "_"))+"_PORT", e.Exposed[name])
+	}
+}
@@ -0,0 +1,298 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/cmd/utils"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/ipam"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/libssh"
+)
+
+// exposeSpecRegex matches name=nodePort[/proto], the name has to be usable in a label key and an env var
+var exposeSpecRegex = regexp.MustCompile(`^([a-z0-9]([-a-z0-9]*[a-z0-9])?)=(\d+)(/(tcp|udp))?$`)
+
+// exposedPort is a port of node01 exposed on the host under a name of the user, usually a NodePort
+type exposedPort struct {
+	Name     string
+	NodePort int
+	Proto    string
+}
+
+func (p exposedPort) port() nat.Port {
+	return nat.Port(fmt.Sprintf("%d/%s", p.NodePort, p.Proto))
+}
+
+func (p exposedPort) label() (string, string) {
+	return labelExposePrefix + p.Name, string(p.port())
+}
+
+// parseExpose parses name=nodePort[/proto], the protocol defaults to tcp
+func parseExpose(spec string) (exposedPort, error) {
+	m := exposeSpecRegex.FindStringSubmatch(spec)
+	if m == nil {
+		return exposedPort{}, fmt.Errorf("invalid port %q, expected name=nodePort[/tcp|udp] with a lower case name", spec)
+	}
+	nodePort, err := strconv.Atoi(m[3])
+	if err != nil || nodePort < 1 || nodePort > 65535 {
+		return exposedPort{}, fmt.Errorf("invalid port %q, the port has to be between 1 and 65535", spec)
+	}
+	if _, ok := portByName(m[1]); ok {
+		return exposedPort{}, fmt.Errorf("invalid port %q, %s is the name of a port gocli exposes", spec, m[1])
+	}
+	if name, ok := portNames[nodePort]; ok {
+		return exposedPort{}, fmt.Errorf("invalid port %q, %d is exposed as %s already", spec, nodePort, name)
+	}
+	p := exposedPort{Name: m[1], NodePort: nodePort, Proto: m[5]}
+	if p.Proto == "" {
+		p.Proto = "tcp"
+	}
+	return p, nil
+}
+
+// parseExposes parses the ports given with --expose and makes sure their names and ports are unique
+func parseExposes(specs []string) ([]exposedPort, error) {
+	ports := []exposedPort{}
+	names := map[string]bool{}
+	nodePorts := map[nat.Port]bool{}
+	for _, spec := range specs {
+		p, err := parseExpose(spec)
+		if err != nil {
+			return nil, err
+		}
+		if names[p.Name] || nodePorts[p.port()] {
+			return nil, fmt.Errorf("the port %s is exposed twice", spec)
+		}
+		names[p.Name], nodePorts[p.port()] = true, true
+		ports = append(ports, p)
+	}
+	return ports, nil
+}
+
+// exposedPortsFromLabels returns the ports a container carries labels for, sorted by name
+func exposedPortsFromLabels(labels map[string]string) []exposedPort {
+	ports := []exposedPort{}
+	for _, key := range slices.Sorted(maps.Keys(labels)) {
+		name, ok := strings.CutPrefix(key, labelExposePrefix)
+		if !ok {
+			continue
+		}
+		if p, err := parseExpose(name + "=" + labels[key]); err == nil {
+			ports = append(ports, p)
+		}
+	}
+	return ports
+}
+
+// exposeForwardScript forwards the ports from the network namespace of dnsmasq to node01, like vm.sh does for the
+// ports gocli exposes. Rules which exist already are kept, the script is run again whenever dnsmasq starts
+func exposeForwardScript(ports []exposedPort) string {
+	lines := []string{
+		`chain="PREROUTING -i eth0"`,
+		// rootless podman forwards the published ports from the loopback device
+		`if [ "$(sed -n 's/^rootless=//p' /run/.containerenv 2>/dev/null)" = 1 ]; then chain=OUTPUT; fi`,
+	}
+	for _, p := range ports {
+		rule := fmt.Sprintf("-p %[1]s -m %[1]s --dport %[2]d -j DNAT --to-destination %[3]s:%[2]d", p.Proto, p.NodePort, ipam.ControlPlane().IPv4)
+		lines = append(lines, fmt.Sprintf("iptables -t nat -C $chain %[1]s 2>/dev/null || iptables -t nat -A $chain %[1]s", rule))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// forwardExposedPorts adds the forwards of the ports exposed with run --expose to the network namespace of dnsmasq
+func forwardExposedPorts(cli docker.Runtime, dnsmasqID string, labels map[string]string) error {
+	ports := exposedPortsFromLabels(labels)
+	if len(ports) == 0 {
+		return nil
+	}
+	return _cmd(cli, dnsmasqID, exposeForwardScript(ports), "forwarding the exposed ports to node01")
+}
+
+// NewExposeCommand returns the command to expose a port of node01 on the host of a running cluster
+func NewExposeCommand() *cobra.Command {
+	expose := &cobra.Command{
+		Use:   "expose NAME=NODEPORT",
+		Short: "expose makes a port of node01 reachable on localhost while the cluster runs",
+		Long: `expose makes a port of node01 reachable on localhost while the cluster runs
+
+Ports can't be added to the dnsmasq container once it is created, run --expose publishes
+them along with the other ports. expose starts a proxy container in the network namespace of the
+host instead, which tunnels --host-port on localhost to the port of node01 through the SSH port of
+the cluster. Only TCP can be tunneled. gocli ports NAME prints the host port, gocli rm removes the
+proxy with the cluster.`,
+		RunE: exposeRun,
+		Args: cobra.ExactArgs(1),
+	}
+	expose.Flags().Int("host-port", 0, "the port on localhost, defaults to the port of node01")
+	return expose
+}
+
+func exposeRun(cmd *cobra.Command, args []string) error {
+	prefix, err := cmd.Flags().GetString("prefix")
+	if err != nil {
+		return err
+	}
+	hostPort, err := cmd.Flags().GetInt("host-port")
+	if err != nil {
+		return err
+	}
+
+	p, err := parseExpose(args[0])
+	if err != nil {
+		return err
+	}
+	if p.Proto != "tcp" {
+		return fmt.Errorf("only TCP ports can be exposed on a running cluster, publish %s with run --expose", args[0])
+	}
+	if hostPort == 0 {
+		hostPort = p.NodePort
+	}
+
+	cli, err := newRuntime()
+	if err != nil {
+		return err
+	}
+	exposed, err := clusterExposedPorts(cli, prefix)
+	if err != nil {
+		return err
+	}
+	if _, ok := exposed[p.Name]; ok {
+		return fmt.Errorf("the cluster %s exposes a port named %s already", prefix, p.Name)
+	}
+
+	dnsmasq, _, err := clusterContainers(cli, prefix)
+	if err != nil {
+		return err
+	}
+	if err := startExposeProxy(cli, prefix, dnsmasq.ID, p, hostPort); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "%s -> 127.0.0.1:%d\n", p.Name, hostPort)
+	return nil
+}
+
+// startExposeProxy creates and starts the proxy container of a port exposed with gocli expose, it connects to
+// the SSH port dnsmasq currently publishes
+func startExposeProxy(cli docker.Runtime, prefix string, dnsmasqID string, p exposedPort, hostPort int) error {
+	ctx := context.Background()
+	dm, err := cli.ContainerInspect(ctx, dnsmasqID)
+	if err != nil {
+		return err
+	}
+	sshPort, err := utils.GetPublicPort(utils.PortSSH, dm.NetworkSettings.Ports)
+	if err != nil {
+		return err
+	}
+
+	labels := clusterLabels(dm.Config.Labels[labelClusterID], prefix, roleExpose, 0)
+	key, value := p.label()
+	labels[key] = value
+	labels[labelHostPort] = strconv.Itoa(hostPort)
+
+	// the cluster image has the SSH client and the key of the nodes
+	id, err := cli.ContainerCreate(ctx, nodeContainer(prefix, roleExpose+"-"+p.Name), &container.Config{
+		Image: dm.Config.Image,
+		Cmd: []string{
+			"ssh", "-N", "-i", "/vagrant.key",
+			"-o", "UserKnownHostsFile=/dev/null", "-o", "StrictHostKeyChecking=no",
+			"-o", "ExitOnForwardFailure=yes", "-o", "ServerAliveInterval=10",
+			"-p", strconv.Itoa(int(sshPort)),
+			"-L", fmt.Sprintf("127.0.0.1:%d:%s:%d", hostPort, ipam.ControlPlane().IPv4, p.NodePort),
+			libssh.GetSSHUser() + "@127.0.0.1",
+		},
+		Labels: labels,
+	}, &container.HostConfig{
+		NetworkMode: container.NetworkMode("host"),
+	})
+	if err != nil {
+		return err
+	}
+	return cli.ContainerStart(ctx, id)
+}
+
+// restartExposeProxies recreates the proxies of gocli expose, the SSH port of the cluster may have changed
+func restartExposeProxies(cli docker.Runtime, prefix string, dnsmasqID string) error {
+	containers, err := clusterContainerList(cli, prefix)
+	if err != nil {
+		return err
+	}
+	for _, c := range containers {
+		if role, _ := containerRole(prefix, c); role != roleExpose {
+			continue
+		}
+		ports := exposedPortsFromLabels(c.Labels)
+		hostPort, err := strconv.Atoi(c.Labels[labelHostPort])
+		if len(ports) != 1 || err != nil {
+			logrus.Warnf("skipping %s, it has no valid exposed port", containerName(c))
+			continue
+		}
+		if err := cli.ContainerRemove(context.Background(), c.ID, true); err != nil {
+			return err
+		}
+		if err := startExposeProxy(cli, prefix, dnsmasqID, ports[0], hostPort); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stopExposeProxies stops the proxies of gocli expose, they can't reach the cluster without dnsmasq
+func stopExposeProxies(cli docker.Runtime, prefix string) error {
+	containers, err := clusterContainerList(cli, prefix)
+	if err != nil {
+		return err
+	}
+	for _, c := range containers {
+		if role, _ := containerRole(prefix, c); role == roleExpose {
+			if err := cli.ContainerStop(context.Background(), c.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// clusterExposedPorts returns the host ports of the ports exposed with run --expose and gocli expose by their names
+func clusterExposedPorts(cli docker.Runtime, prefix string) (map[string]uint16, error) {
+	containers, err := clusterContainerList(cli, prefix)
+	if err != nil {
+		return nil, err
+	}
+	exposed := map[string]uint16{}
+	for _, c := range containers {
+		ports := exposedPortsFromLabels(c.Labels)
+		if len(ports) == 0 {
+			continue
+		}
+		// the proxies of gocli expose listen on the host
+		if hostPort, err := strconv.ParseUint(c.Labels[labelHostPort], 10, 16); err == nil {
+			exposed[ports[0].Name] = uint16(hostPort)
+			continue
+		}
+		inspect, err := cli.ContainerInspect(context.Background(), c.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range ports {
+			if bindings := inspect.NetworkSettings.Ports[p.port()]; len(bindings) > 0 && bindings[0].HostPort != "" {
+				hostPort, err := strconv.ParseUint(bindings[0].HostPort, 10, 16)
+				if err != nil {
+					return nil, err
+				}
+				exposed[p.Name] = uint16(hostPort)
+			}
+		}
+	}
+	return exposed, nil
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/docker/go-connections/nat"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
+	k8s "kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/k8s"
+)
+
+var _ = Describe("Expose", func() {
+	var runtime *docker.FakeRuntime
+
+	BeforeEach(func() {
+		runtime = docker.NewFakeRuntime()
+		// the node containers end with their VMs
+		runtime.ExecHandler = func(c *docker.FakeContainer, cmd []string, _ io.Writer) int {
+			if strings.Contains(strings.Join(cmd, " "), "system_powerdown") {
+				Expect(runtime.Stop(c.ID)).To(Succeed())
+			}
+			return 0
+		}
+		k8sClient := k8s.NewTestClient(k8s.NewReactorConfig("create", "nodes", k8s.NewConditionReactor("Ready")))
+		node := &unstructured.Unstructured{}
+		node.SetAPIVersion("v1")
+		node.SetKind("Node")
+		node.SetName("node01")
+		Expect(k8sClient.Apply(node)).To(Succeed())
+
+		setupFakeCluster(runtime, k8sClient)
+	})
+
+	forwards := func() int {
+		count := 0
+		for _, e := range runtime.Execs {
+			if e.Container == "k8s-1.30-dnsmasq" && strings.Contains(strings.Join(e.Cmd, " "), "--dport 30080 -j DNAT --to-destination 192.168.66.101:30080") {
+				count++
+			}
+		}
+		return count
+	}
+
+	It("should publish the ports of run --expose and resolve their names", func() {
+		_, err := gocli("run", "k8s-1.30", "--nodes", "2", "--background", "--expose", "web=30080", "--expose", "syslog=30514/udp")
+		Expect(err).NotTo(HaveOccurred())
+
+		dnsmasq, ok := runtime.Container("k8s-1.30-dnsmasq")
+		Expect(ok).To(BeTrue())
+		Expect(dnsmasq.Config.ExposedPorts).To(HaveKey(nat.Port("30080/tcp")))
+		Expect(dnsmasq.Config.Labels).To(HaveKeyWithValue("io.kubevirtci.expose.web", "30080/tcp"))
+		Expect(dnsmasq.Config.Labels).To(HaveKeyWithValue("io.kubevirtci.expose.syslog", "30514/udp"))
+		Expect(dnsmasq.Ports).To(HaveKey(nat.Port("30514/udp")))
+		Expect(forwards()).To(Equal(1))
+
+		out, err := gocli("ports", "web")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal(dnsmasq.Ports["30080/tcp"][0].HostPort + "\n"))
+
+		out, err = gocli("ports", "syslog")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal(dnsmasq.Ports["30514/udp"][0].HostPort + "\n"))
+
+		_, err = gocli("ports", "unknown")
+		Expect(err).To(MatchError("unknown port name unknown"))
+	})
+
+	It("should refuse invalid ports", func() {
+		_, err := gocli("run", "k8s-1.30", "--background", "--expose", "Web=30080")
+		Expect(err).To(MatchError(ContainSubstring("lower case name")))
+		_, err = gocli("run", "k8s-1.30", "--background", "--expose", "k8s=30080")
+		Expect(err).To(MatchError(ContainSubstring("k8s is the name of a port gocli exposes")))
+		_, err = gocli("run", "k8s-1.30", "--background", "--expose", "api=6443")
+		Expect(err).To(MatchError(ContainSubstring("6443 is exposed as k8s already")))
+		_, err = gocli("run", "k8s-1.30", "--background", "--expose", "a=30080", "--expose", "b=30080")
+		Expect(err).To(MatchError(ContainSubstring("exposed twice")))
+	})
+
+	It("should expose a port of a running cluster through a proxy and bring it back after a restart", func() {
+		_, err := gocli("run", "k8s-1.30", "--nodes", "2", "--background", "--expose", "web=30080")
+		Expect(err).NotTo(HaveOccurred())
+
+		out, err := gocli("expose", "metrics=30090", "--host-port", "40090")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal("metrics -> 127.0.0.1:40090\n"))
+		_, err = gocli("expose", "metrics=30091")
+		Expect(err).To(MatchError("the cluster k8s-1.30 exposes a port named metrics already"))
+		_, err = gocli("expose", "dns2=30053/udp")
+		Expect(err).To(MatchError(ContainSubstring("only TCP ports")))
+
+		proxy, ok := runtime.Container("k8s-1.30-expose-metrics")
+		Expect(ok).To(BeTrue())
+		Expect(proxy.Running).To(BeTrue())
+		Expect(proxy.HostConfig.NetworkMode.IsHost()).To(BeTrue())
+		Expect(proxy.Config.Labels).To(HaveKeyWithValue(labelRole, roleExpose))
+		dnsmasq, _ := runtime.Container("k8s-1.30-dnsmasq")
+		sshPort := dnsmasq.Ports["2201/tcp"][0].HostPort
+		Expect(strings.Join(proxy.Config.Cmd, " ")).To(ContainSubstring("-p " + sshPort + " -L 127.0.0.1:40090:192.168.66.101:30090 cloud-user@127.0.0.1"))
+
+		out, err = gocli("ports", "metrics")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal("40090\n"))
+
+		_, err = gocli("stop")
+		Expect(err).NotTo(HaveOccurred())
+		proxy, _ = runtime.Container("k8s-1.30-expose-metrics")
+		Expect(proxy.Running).To(BeFalse())
+
+		_, err = gocli("start")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(forwards()).To(Equal(2))
+		restarted, ok := runtime.Container("k8s-1.30-expose-metrics")
+		Expect(ok).To(BeTrue())
+		Expect(restarted.ID).NotTo(Equal(proxy.ID))
+		Expect(restarted.Running).To(BeTrue())
+
+		_, err = gocli("rm")
+		Expect(err).NotTo(HaveOccurred())
+		names := []string{}
+		containers, err := runtime.ContainerList(GinkgoT().Context())
+		Expect(err).NotTo(HaveOccurred())
+		for _, c := range containers {
+			names = append(names, containerName(c))
+		}
+		Expect(slices.Contains(names, "k8s-1.30-expose-metrics")).To(BeFalse())
+	})
+})
@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/events"
+)
+
+// gatherResources are dumped from the cluster with kubectl get -A -o yaml
+var gatherResources = []string{
+	"nodes", "namespaces", "pods", "deployments", "daemonsets", "statefulsets", "replicasets", "jobs",
+	"services", "endpoints", "persistentvolumes", "persistentvolumeclaims", "storageclasses", "events",
+}
+
+// gatherNodeCommands collect the logs of a VM, they run in its node container
+var gatherNodeCommands = []struct{ file, command string }{
+	{"journal.log", "ssh.sh sudo journalctl --no-pager -b"},
+	{"dmesg.log", "ssh.sh sudo dmesg -T"},
+	{"kubelet.log", "ssh.sh sudo journalctl --no-pager -b -u kubelet"},
+	{"crio.log", "ssh.sh sudo journalctl --no-pager -b -u crio"},
+	{"serial.log", "cat /var/log/vm-serial.log"},
+}
+
+const gatherKubectl = "ssh.sh sudo kubectl --kubeconfig /etc/kubernetes/admin.conf"
+
+// NewGatherCommand returns the command to collect the diagnostics of a cluster
+func NewGatherCommand() *cobra.Command {
+	gather := &cobra.Command{
+		Use:   "gather PREFIX",
+		Short: "gather collects the logs and the state of a cluster into a tarball",
+		Long: `gather collects the logs and the state of a cluster into a tarball
+
+The bundle contains the logs and the inspect output of the cluster containers, the journal,
+dmesg, kubelet, cri-o and serial console logs of every VM, and kubectl get -A -o yaml dumps of
+the cluster. Whatever can't be collected is listed in errors.txt, a broken cluster still gets
+a bundle. run gathers a bundle on its own when it fails and --gather-dir is set.`,
+		RunE: gather,
+		Args: cobra.ExactArgs(1),
+	}
+	gather.Flags().StringP("output-file", "o", "", "path of the bundle, defaults to PREFIX-gather-TIMESTAMP.tar.gz")
+	return gather
+}
+
+func gather(cmd *cobra.Command, args []string) error {
+	output, err := cmd.Flags().GetString("output-file")
+	if err != nil {
+		return err
+	}
+	prefix := args[0]
+	if output == "" {
+		output = gatherFileName(prefix)
+	}
+
+	cli, err := newRuntime()
+	if err != nil {
+		return err
+	}
+	if err := gatherBundle(cli, prefix, output, nil); err != nil {
+		return err
+	}
+	fmt.Fprintln(cmd.OutOrStdout(), output)
+	return nil
+}
+
+func gatherFileName(prefix string) string {
+	return fmt.Sprintf("%s-gather-%s.tar.gz", prefix, time.Now().Format("20060102-150405"))
+}
+
+// gatherBundle writes the diagnostics of the cluster with the given prefix to a gzipped tarball at path.
+// eventLog holds the provisioning events of a failed run, they are added as events.jsonl
+func gatherBundle(cli docker.Runtime, prefix string, path string, eventLog []events.Event) (retErr error) {
+	containers, err := clusterContainerList(cli, prefix)
+	if err != nil {
+		return err
+	}
+	if len(containers) == 0 && len(eventLog) == 0 {
+		return fmt.Errorf("no containers found for the cluster %s", prefix)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := f.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+	b := newBundle(f)
+	defer func() {
+		if err := b.close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	ctx := context.Background()
+	if len(eventLog) > 0 {
+		log := &bytes.Buffer{}
+		enc := json.NewEncoder(log)
+		for _, e := range eventLog {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		b.add("events.jsonl", log.Bytes())
+	}
+
+	for _, c := range containers {
+		name := containerName(c)
+		if inspect, err := cli.ContainerInspect(ctx, c.ID); err != nil {
+			b.failed("inspect "+name, err)
+		} else if data, err := json.MarshalIndent(inspect, "", "  "); err != nil {
+			b.failed("inspect "+name, err)
+		} else {
+			b.add(fmt.Sprintf("containers/%s.json", name), data)
+		}
+
+		logs, err := cli.ContainerLogs(ctx, c.ID)
+		if err != nil {
+			b.failed("logs of "+name, err)
+			continue
+		}
+		data, err := io.ReadAll(logs)
+		_ = logs.Close()
+		if err != nil {
+			b.failed("logs of "+name, err)
+		}
+		b.add(fmt.Sprintf("containers/%s.log", name), data)
+	}
+
+	var node01 string
+	for _, c := range containers {
+		role, idx := containerRole(prefix, c)
+		if role != roleNode || c.State != "running" {
+			continue
+		}
+		name := containerName(c)
+		if idx == 1 {
+			node01 = name
+		}
+		nodeName := nodeNameFromIndex(idx)
+		b.exec(cli, name, diagnosticsCommand(nodeName, "gather"), fmt.Sprintf("nodes/%s/resources.txt", nodeName))
+		for _, g := range gatherNodeCommands {
+			b.exec(cli, name, g.command, fmt.Sprintf("nodes/%s/%s", nodeName, g.file))
+		}
+	}
+
+	if node01 != "" {
+		for _, resource := range gatherResources {
+			b.exec(cli, node01, fmt.Sprintf("%s get -A -o yaml %s", gatherKubectl, resource), fmt.Sprintf("k8s/%s.yaml", resource))
+		}
+	} else {
+		b.failed("kubectl dumps", fmt.Errorf("node01 of %s is not running", prefix))
+	}
+
+	if len(b.errors) > 0 {
+		b.add("errors.txt", []byte(strings.Join(b.errors, "\n")+"\n"))
+	}
+	return b.err
+}
+
+// bundle is a gzipped tarball which keeps track of what could not be collected
+type bundle struct {
+	gz     *gzip.Writer
+	tw     *tar.Writer
+	errors []string
+	// err is the first error writing the tarball, everything added after it is dropped
+	err error
+}
+
+func newBundle(w io.Writer) *bundle {
+	gz := gzip.NewWriter(w)
+	return &bundle{gz: gz, tw: tar.NewWriter(gz)}
+}
+
+func (b *bundle) add(name string, data []byte) {
+	if b.err != nil {
+		return
+	}
+	hdr := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), ModTime: time.Now()}
+	if err := b.tw.WriteHeader(hdr); err != nil {
+		b.err = err
+		return
+	}
+	_, b.err = b.tw.Write(data)
+}
+
+// exec adds the output of a command run in a container, the output of failed commands is kept as well
+func (b *bundle) exec(cli docker.Runtime, container string, command string, name string) {
+	out := &bytes.Buffer{}
+	success, err := docker.Exec(cli, container, []string{"/bin/bash", "-c", command}, out)
+	if err == nil && !success {
+		err = fmt.Errorf("%s failed", command)
+	}
+	if err != nil {
+		b.failed(name, err)
+	}
+	if out.Len() > 0 || err == nil {
+		b.add(name, out.Bytes())
+	}
+}
+
+func (b *bundle) failed(what string, err error) {
+	logrus.WithError(err).Warnf("failed to gather %s", what)
+	b.errors = append(b.errors, fmt.Sprintf("%s: %v", what, err))
+}
+
+func (b *bundle) close() error {
+	if err := b.tw.Close(); err != nil {
+		return err
+	}
+	return b.gz.Close()
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
+)
+
+// bundleFiles returns the files of a gathered bundle by their name
+func bundleFiles(path string) map[string]string {
+	f, err := os.Open(path)
+	Expect(err).NotTo(HaveOccurred())
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	Expect(err).NotTo(HaveOccurred())
+
+	files := map[string]string{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return files
+		}
+		Expect(err).NotTo(HaveOccurred())
+		data, err := io.ReadAll(tr)
+		Expect(err).NotTo(HaveOccurred())
+		files[hdr.Name] = string(data)
+	}
+}
+
+var _ = Describe("Gather", func() {
+	var runtime *docker.FakeRuntime
+
+	BeforeEach(func() {
+		runtime = docker.NewFakeRuntime()
+		setupFakeCluster(runtime, nil)
+	})
+
+	It("should collect the logs and the state of a cluster", func() {
+		_, err := gocli("run", "k8s-1.30", "--nodes", "2", "--background")
+		Expect(err).NotTo(HaveOccurred())
+		runtime.ExecHandler = func(c *docker.FakeContainer, cmd []string, out io.Writer) int {
+			command := strings.Join(cmd, " ")
+			switch {
+			case strings.Contains(command, "vm-serial.log"):
+				return 1
+			case strings.Contains(command, "-u kubelet"):
+				fmt.Fprintf(out, "kubelet of %s", c.Name)
+			case strings.Contains(command, "get -A -o yaml pods"):
+				fmt.Fprint(out, "kind: List")
+			}
+			return 0
+		}
+
+		out, err := gocli("gather", "k8s-1.30", "-o", "bundle.tar.gz")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal("bundle.tar.gz\n"))
+
+		files := bundleFiles("bundle.tar.gz")
+		Expect(files).To(HaveKey("containers/k8s-1.30-dnsmasq.json"))
+		Expect(files).To(HaveKey("containers/k8s-1.30-registry.log"))
+		Expect(files).To(HaveKeyWithValue("nodes/node02/kubelet.log", "kubelet of k8s-1.30-node02"))
+		Expect(files).To(HaveKey("nodes/node01/resources.txt"))
+		Expect(files).To(HaveKeyWithValue("k8s/pods.yaml", "kind: List"))
+		Expect(files).NotTo(HaveKey("nodes/node01/serial.log"))
+		Expect(files).NotTo(HaveKey("events.jsonl"))
+		Expect(files["errors.txt"]).To(ContainSubstring("nodes/node01/serial.log: cat /var/log/vm-serial.log failed"))
+	})
+
+	It("should fail for an unknown cluster", func() {
+		_, err := gocli("gather", "k8s-1.30")
+		Expect(err).To(MatchError("no containers found for the cluster k8s-1.30"))
+	})
+})
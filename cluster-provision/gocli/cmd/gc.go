@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/spf13/cobra"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
+)
+
+// NewGCCommand returns the command to remove what crashed runs left behind
+func NewGCCommand() *cobra.Command {
+	gc := &cobra.Command{
+		Use:   "gc",
+		Short: "gc removes containers and volumes of clusters which do not exist anymore",
+		Long: `gc removes containers and volumes of clusters which do not exist anymore
+
+A container or volume is an orphan when the dnsmasq container of its cluster is gone, or when the
+cluster never got a node because run or provision crashed early. Resources younger than --min-age
+are kept, they may belong to a cluster which is still coming up. Resources of clusters created
+before gocli labelled them are never touched.`,
+		RunE: gc,
+		Args: cobra.NoArgs,
+	}
+	gc.Flags().Bool("dry-run", false, "only print the orphans")
+	gc.Flags().Duration("min-age", 10*time.Minute, "age a resource needs to have to be removed")
+	return gc
+}
+
+func gc(cmd *cobra.Command, _ []string) error {
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+	minAge, err := cmd.Flags().GetDuration("min-age")
+	if err != nil {
+		return err
+	}
+
+	cli, err := newRuntime()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	containers, volumes, err := findOrphans(cli, time.Now().Add(-minAge))
+	if err != nil {
+		return err
+	}
+
+	for _, c := range containers {
+		fmt.Fprintf(cmd.OutOrStdout(), "container %s\n", containerName(c))
+		if dryRun {
+			continue
+		}
+		if err := cli.ContainerRemove(ctx, c.ID, true); err != nil {
+			return err
+		}
+	}
+	for _, v := range volumes {
+		fmt.Fprintf(cmd.OutOrStdout(), "volume %s\n", v)
+		if dryRun {
+			continue
+		}
+		if err := cli.VolumeRemove(ctx, v, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findOrphans returns the labelled containers and volumes created before the given time whose cluster is
+// gone or never got a node. dnsmasq containers come last, the other containers live in their network namespace
+func findOrphans(cli docker.Runtime, before time.Time) ([]container.Summary, []string, error) {
+	ctx := context.Background()
+	containers, err := cli.ContainerList(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	volumes, err := cli.VolumeList(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// clusters are alive as long as their dnsmasq exists and they have nodes, or are young enough to get them
+	alive := map[string]bool{}
+	for _, c := range containers {
+		if c.Labels[labelRole] != roleDNSMasq {
+			continue
+		}
+		id := c.Labels[labelClusterID]
+		hasNodes := slices.ContainsFunc(containers, func(n container.Summary) bool {
+			return n.Labels[labelClusterID] == id && n.Labels[labelRole] == roleNode
+		})
+		if hasNodes || time.Unix(c.Created, 0).After(before) {
+			alive[id] = true
+		}
+	}
+	orphaned := func(labels map[string]string, created time.Time) bool {
+		id, ok := labels[labelClusterID]
+		return ok && !alive[id] && !created.After(before)
+	}
+
+	orphanContainers := []container.Summary{}
+	for _, c := range containers {
+		if orphaned(c.Labels, time.Unix(c.Created, 0)) {
+			orphanContainers = append(orphanContainers, c)
+		}
+	}
+	slices.SortStableFunc(orphanContainers, func(a, b container.Summary) int {
+		return boolToInt(a.Labels[labelRole] == roleDNSMasq) - boolToInt(b.Labels[labelRole] == roleDNSMasq)
+	})
+
+	orphanVolumes := []string{}
+	for _, v := range volumes {
+		// volumes with an unknown creation time count as old
+		created, _ := time.Parse(time.RFC3339, v.CreatedAt)
+		if orphaned(v.Labels, created) {
+			orphanVolumes = append(orphanVolumes, v.Name)
+		}
+	}
+	return orphanContainers, orphanVolumes, nil
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
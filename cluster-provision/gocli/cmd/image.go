@@ -0,0 +1,284 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/distribution/reference"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/cmd/utils"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/registry"
+)
+
+// clusterRegistry is the name the nodes pull the images of the registry container with
+const clusterRegistry = "registry:5000"
+
+const (
+	loadToRegistry = "registry"
+	loadToNodes    = "nodes"
+)
+
+// NewImageCommand returns the command to side-load locally built images into a running cluster
+func NewImageCommand() *cobra.Command {
+	image := &cobra.Command{
+		Use:   "image",
+		Short: "image side-loads images of the local container runtime into a running cluster",
+		Args:  cobra.NoArgs,
+	}
+
+	load := &cobra.Command{
+		Use:   "load IMAGE...",
+		Short: "load copies images of the local docker or podman into the cluster",
+		Long: `load copies images of the local docker or podman into the cluster
+
+With --to registry the images are pushed into the registry container of the cluster through
+its published port, the nodes pull them as registry:5000/REPOSITORY:TAG. Layers the registry
+has already and layers shared by the images are uploaded once.
+
+With --to nodes the images are streamed into the cri-o storage of every node over SSH and keep
+their names, pods can use them with imagePullPolicy IfNotPresent. The images are saved into a
+single archive, so shared layers are copied once per node, and the nodes load it concurrently.
+The nodes need podman or skopeo to load it.`,
+		RunE: imageLoad,
+		Args: cobra.MinimumNArgs(1),
+	}
+	load.Flags().String("to", loadToRegistry, "where to load the images into, registry or nodes")
+
+	image.AddCommand(load)
+	return image
+}
+
+// loadImage is an image given to gocli image load
+type loadImage struct {
+	ref   string
+	named reference.NamedTagged
+}
+
+// local is the name the runtimes list the image with, docker keeps images of docker.io without registry
+func (i loadImage) local() string {
+	return reference.FamiliarString(i.named)
+}
+
+func imageLoad(cmd *cobra.Command, args []string) error {
+	prefix, err := cmd.Flags().GetString("prefix")
+	if err != nil {
+		return err
+	}
+	to, err := cmd.Flags().GetString("to")
+	if err != nil {
+		return err
+	}
+	if to != loadToRegistry && to != loadToNodes {
+		return fmt.Errorf("invalid --to %q, possible values: %s, %s", to, loadToRegistry, loadToNodes)
+	}
+
+	images, err := parseLoadImages(args)
+	if err != nil {
+		return err
+	}
+
+	cli, err := newRuntime()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	for _, img := range images {
+		exists, err := cli.ImageExists(ctx, img.local())
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("the image %s does not exist in %s", img.ref, cli.Name())
+		}
+	}
+
+	dnsmasq, nodes, err := clusterContainers(cli, prefix)
+	if err != nil {
+		return err
+	}
+	dm, err := cli.ContainerInspect(ctx, dnsmasq.ID)
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "gocli-image-")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	refs := []string{}
+	for _, img := range images {
+		refs = append(refs, img.local())
+	}
+
+	if to == loadToRegistry {
+		registryPort, err := utils.GetPublicPort(utils.PortRegistry, dm.NetworkSettings.Ports)
+		if err != nil {
+			return fmt.Errorf("the registry port of the cluster %s is not published, load the images with --to nodes", prefix)
+		}
+		archive, err := cli.ImageSave(ctx, refs)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = archive.Close() }()
+		return loadIntoRegistry(ctx, cmd.OutOrStdout(), archive, dir, images, newRegistryClient(fmt.Sprintf("127.0.0.1:%d", registryPort)))
+	}
+
+	sshPort, err := utils.GetPublicPort(utils.PortSSH, dm.NetworkSettings.Ports)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, "images.tar")
+	if err := saveImages(ctx, cli, refs, path); err != nil {
+		return err
+	}
+	return loadIntoNodes(cmd.OutOrStdout(), path, images, sshPort, slices.Sorted(maps.Keys(nodes)))
+}
+
+// saveImages writes a docker-archive of the images to path
+func saveImages(ctx context.Context, cli docker.Runtime, refs []string, path string) error {
+	archive, err := cli.ImageSave(ctx, refs)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = archive.Close() }()
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, archive); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// parseLoadImages normalizes the image references like the runtimes do, images without tag are the latest
+func parseLoadImages(args []string) ([]loadImage, error) {
+	images := []loadImage{}
+	for _, arg := range args {
+		named, err := reference.ParseNormalizedNamed(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid image %q: %v", arg, err)
+		}
+		if _, ok := named.(reference.Digested); ok {
+			return nil, fmt.Errorf("invalid image %q, images are loaded by tag", arg)
+		}
+		images = append(images, loadImage{ref: arg, named: reference.TagNameOnly(named).(reference.NamedTagged)})
+	}
+	return images, nil
+}
+
+// clusterImageName is the name the nodes pull an image pushed to the registry container with, it keeps the
+// repository path of the image and drops its registry
+func clusterImageName(named reference.NamedTagged) string {
+	return fmt.Sprintf("%s/%s:%s", clusterRegistry, reference.Path(named), named.Tag())
+}
+
+// loadIntoRegistry pushes the images of the archive into the registry container of the cluster
+func loadIntoRegistry(ctx context.Context, out io.Writer, archive io.Reader, dir string, images []loadImage, client *registry.Client) error {
+	saved, err := registry.ExtractArchive(archive, dir)
+	if err != nil {
+		return err
+	}
+	// docker names the images of docker.io without registry, podman fully qualified
+	byName := map[string]registry.Image{}
+	for _, img := range saved {
+		for _, tag := range img.RepoTags {
+			if named, err := reference.ParseNormalizedNamed(tag); err == nil {
+				byName[named.String()] = img
+			}
+		}
+	}
+
+	for _, img := range images {
+		saved, ok := byName[img.named.String()]
+		if !ok {
+			return fmt.Errorf("the image %s is missing in the archive of the container runtime", img.ref)
+		}
+		result, err := client.Push(ctx, saved, reference.Path(img.named), img.named.Tag())
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s -> %s (%d of %d blobs uploaded)\n", img.ref, clusterImageName(img.named), result.Uploaded, result.Blobs)
+	}
+	return nil
+}
+
+// nodeLoadScript loads the archive into the containers storage cri-o runs the pods from and removes it.
+// podman loads all images at once, skopeo copies them one by one
+func nodeLoadScript(archive string, images []loadImage) string {
+	copies := []string{}
+	for _, img := range images {
+		name := shellescape.Quote(img.named.String())
+		copies = append(copies, fmt.Sprintf(`skopeo copy -q "docker-archive:$archive:"%s containers-storage:%s`, name, name))
+	}
+	return fmt.Sprintf(`set -e
+archive=%[1]s
+trap 'rm -f "$archive"' EXIT
+if command -v podman >/dev/null; then
+  podman load -q -i "$archive"
+elif command -v skopeo >/dev/null; then
+  %[2]s
+else
+  echo "neither podman nor skopeo is installed on $(hostname), load the images with --to registry" >&2
+  exit 1
+fi`, shellescape.Quote(archive), strings.Join(copies, "\n  "))
+}
+
+// loadIntoNodes copies the archive to all nodes and loads it there concurrently
+func loadIntoNodes(out io.Writer, path string, images []loadImage, sshPort uint16, nodeIdxs []int) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	remote := fmt.Sprintf("/var/tmp/gocli-images-%d.tar", os.Getpid())
+
+	g := errgroup.Group{}
+	for _, idx := range nodeIdxs {
+		g.Go(func() error {
+			name := nodeNameFromIndex(idx)
+			nodeOut := newNodeOutput(name)
+			defer flushNodeOutput(nodeOut)
+
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = f.Close() }()
+			files, err := newNodeFiles(sshPort, idx)
+			if err != nil {
+				return err
+			}
+			if err := files.Upload(f, info.Size(), remote, 0o600, nil); err != nil {
+				return fmt.Errorf("copying the images to %s failed: %w", name, err)
+			}
+
+			sshClient, err := newSSHClient(sshPort, idx, true)
+			if err != nil {
+				return err
+			}
+			sshClient.SetOutput(nodeOut.stdout, nodeOut.stderr)
+			if err := sshClient.Command(nodeLoadScript(remote, images)); err != nil {
+				return fmt.Errorf("loading the images on %s failed: %w", name, err)
+			}
+			outputMutex.Lock()
+			defer outputMutex.Unlock()
+			fmt.Fprintf(out, "loaded %d images into %s\n", len(images), name)
+			return nil
+		})
+	}
+	return g.Wait()
+}
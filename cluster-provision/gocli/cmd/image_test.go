@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/registry"
+)
+
+var _ = Describe("Image load", func() {
+	var (
+		runtime  *docker.FakeRuntime
+		mu       sync.Mutex
+		files    map[int]*fakeNodeFiles
+		commands []string
+	)
+
+	BeforeEach(func() {
+		runtime = docker.NewFakeRuntime("quay.io/kubevirt/virt-api:devel", "busybox")
+		files = map[int]*fakeNodeFiles{}
+		commands = []string{}
+		sshClient := setupFakeCluster(runtime, nil)
+		sshClient.EXPECT().Command(gomock.Any()).DoAndReturn(func(cmd string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			commands = append(commands, cmd)
+			return nil
+		}).AnyTimes()
+		newNodeFiles = func(_ uint16, idx int) (nodeFiles, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			files[idx] = &fakeNodeFiles{idx: idx, files: map[string]fakeFile{}}
+			return files[idx], nil
+		}
+
+		_, err := gocli("run", "k8s-1.30", "--nodes", "2", "--background")
+		Expect(err).NotTo(HaveOccurred())
+		commands = []string{}
+	})
+
+	It("should push the images into the registry of the cluster", func() {
+		manifests := []string{}
+		mounts := []string{}
+		uploads := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == http.MethodHead:
+				w.WriteHeader(http.StatusNotFound)
+			case r.Method == http.MethodPost:
+				if mount := r.URL.Query().Get("from"); mount != "" {
+					mounts = append(mounts, mount)
+				}
+				w.Header().Set("Location", r.URL.Path+"upload")
+				w.WriteHeader(http.StatusAccepted)
+			case strings.Contains(r.URL.Path, "/manifests/"):
+				manifests = append(manifests, r.URL.Path)
+				w.WriteHeader(http.StatusCreated)
+			default:
+				uploads++
+				w.WriteHeader(http.StatusCreated)
+			}
+		}))
+		DeferCleanup(server.Close)
+		u, err := url.Parse(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+
+		dnsmasq, _ := runtime.Container("k8s-1.30-dnsmasq")
+		newRegistryClient = func(host string) *registry.Client {
+			Expect(host).To(Equal("127.0.0.1:" + dnsmasq.Ports["5000/tcp"][0].HostPort))
+			return registry.NewClient(u.Host)
+		}
+
+		out, err := gocli("image", "load", "quay.io/kubevirt/virt-api:devel", "busybox")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal("quay.io/kubevirt/virt-api:devel -> registry:5000/kubevirt/virt-api:devel (3 of 3 blobs uploaded)\n" +
+			"busybox -> registry:5000/library/busybox:latest (3 of 3 blobs uploaded)\n"))
+		Expect(runtime.Saved).To(Equal([][]string{{"quay.io/kubevirt/virt-api:devel", "busybox:latest"}}))
+		Expect(manifests).To(Equal([]string{"/v2/kubevirt/virt-api/manifests/devel", "/v2/library/busybox/manifests/latest"}))
+		// the registry is asked to mount the shared base layer, this one uploads it again
+		Expect(mounts).To(Equal([]string{"kubevirt/virt-api"}))
+		Expect(uploads).To(Equal(6))
+	})
+
+	It("should load the images into every node", func() {
+		out, err := gocli("image", "load", "--to", "nodes", "quay.io/kubevirt/virt-api:devel", "busybox")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(ContainSubstring("loaded 2 images into node01\n"))
+		Expect(out).To(ContainSubstring("loaded 2 images into node02\n"))
+
+		Expect(files).To(HaveLen(2))
+		remote := fmt.Sprintf("/var/tmp/gocli-images-%d.tar", os.Getpid())
+		for idx, node := range files {
+			Expect(node.files).To(HaveKey(remote), fmt.Sprintf("node%02d", idx))
+			Expect(node.files[remote].mode).To(Equal(os.FileMode(0o600)))
+			Expect(node.files[remote].data).To(ContainSubstring("manifest.json"))
+		}
+		Expect(commands).To(HaveLen(2))
+		Expect(commands[0]).To(ContainSubstring(`podman load -q -i "$archive"`))
+		Expect(commands[0]).To(ContainSubstring(`skopeo copy -q "docker-archive:$archive:"docker.io/library/busybox:latest containers-storage:docker.io/library/busybox:latest`))
+	})
+
+	It("should refuse images which don't exist locally", func() {
+		_, err := gocli("image", "load", "quay.io/kubevirt/virt-handler:devel")
+		Expect(err).To(MatchError("the image quay.io/kubevirt/virt-handler:devel does not exist in fake"))
+		_, err = gocli("image", "load", "--to", "cluster", "busybox")
+		Expect(err).To(MatchError(`invalid --to "cluster", possible values: registry, nodes`))
+		_, err = gocli("image", "load", "busybox@sha256:"+strings.Repeat("0", 64))
+		Expect(err).To(MatchError(ContainSubstring("images are loaded by tag")))
+		Expect(runtime.Saved).To(BeEmpty())
+	})
+})
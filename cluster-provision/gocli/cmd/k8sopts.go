@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/Masterminds/semver/v3"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/cmd/nodesconfig"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/aaq"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/addon"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/cdi"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/cnao"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/istio"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/multus"
+	network_resources_injector "kubevirt.io/kubevirtci/cluster-provision/gocli/opts/network_resources_injector"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/nfscsi"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/prometheus"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/rookceph"
+	k8s "kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/k8s"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/libssh"
+)
+
+const kubevirtProviderEnv = "KUBEVIRT_PROVIDER"
+
+var clusterVersionRegex = regexp.MustCompile(`([0-9]+\.[0-9]+)`)
+
+// k8sOpt is an opt deployed on the running cluster, it is named after its package like the events report it
+type k8sOpt struct {
+	opts.Descriptor
+	enabled func(n *nodesconfig.NodeK8sConfig) bool
+	new     func(k8sClient k8s.K8sDynamicClient, sshClient libssh.Client, n *nodesconfig.NodeK8sConfig) opts.Opt
+}
+
+// k8sOpts is the registry of all opts deployed on the running cluster
+var k8sOpts = []k8sOpt{
+	{
+		Descriptor: opts.Descriptor{Name: "rookceph"},
+		enabled:    func(n *nodesconfig.NodeK8sConfig) bool { return n.Ceph },
+		new: func(c k8s.K8sDynamicClient, sc libssh.Client, _ *nodesconfig.NodeK8sConfig) opts.Opt {
+			return rookceph.NewCephOpt(c, sc)
+		},
+	},
+	{
+		Descriptor: opts.Descriptor{Name: "nfscsi"},
+		enabled:    func(n *nodesconfig.NodeK8sConfig) bool { return n.NfsCsi },
+		new: func(c k8s.K8sDynamicClient, _ libssh.Client, _ *nodesconfig.NodeK8sConfig) opts.Opt {
+			return nfscsi.NewNfsCsiOpt(c)
+		},
+	},
+	{
+		Descriptor: opts.Descriptor{Name: "multus"},
+		enabled:    func(n *nodesconfig.NodeK8sConfig) bool { return n.Multus },
+		new: func(c k8s.K8sDynamicClient, sc libssh.Client, _ *nodesconfig.NodeK8sConfig) opts.Opt {
+			return multus.NewMultusOpt(c, sc)
+		},
+	},
+	{
+		// CNAO leaves out its own multus if multus is deployed separately
+		Descriptor: opts.Descriptor{Name: "cnao", After: []string{"multus"}},
+		enabled:    func(n *nodesconfig.NodeK8sConfig) bool { return n.CNAO },
+		new: func(c k8s.K8sDynamicClient, sc libssh.Client, n *nodesconfig.NodeK8sConfig) opts.Opt {
+			return cnao.NewCnaoOpt(c, sc, n.Multus, n.DNC, n.CNAOSkipCR, n.Images)
+		},
+	},
+	{
+		Descriptor: opts.Descriptor{Name: "istio", After: []string{"cnao"}},
+		enabled:    func(n *nodesconfig.NodeK8sConfig) bool { return n.Istio },
+		new: func(c k8s.K8sDynamicClient, sc libssh.Client, n *nodesconfig.NodeK8sConfig) opts.Opt {
+			return istio.NewIstioOpt(sc, c, n.CNAO)
+		},
+	},
+	{
+		Descriptor: opts.Descriptor{Name: "prometheus"},
+		enabled:    func(n *nodesconfig.NodeK8sConfig) bool { return n.Prometheus },
+		new: func(c k8s.K8sDynamicClient, _ libssh.Client, n *nodesconfig.NodeK8sConfig) opts.Opt {
+			return prometheus.NewPrometheusOpt(c, n.Grafana, n.Alertmanager)
+		},
+	},
+	{
+		Descriptor: opts.Descriptor{Name: "cdi"},
+		enabled:    func(n *nodesconfig.NodeK8sConfig) bool { return n.CDI },
+		new: func(c k8s.K8sDynamicClient, sc libssh.Client, n *nodesconfig.NodeK8sConfig) opts.Opt {
+			return cdi.NewCdiOpt(c, sc, n.CDIVersion)
+		},
+	},
+	{
+		Descriptor: opts.Descriptor{Name: "aaq", After: []string{"cdi"}, K8sVersions: "1.30.x"},
+		enabled:    func(n *nodesconfig.NodeK8sConfig) bool { return n.AAQ },
+		new: func(c k8s.K8sDynamicClient, sc libssh.Client, n *nodesconfig.NodeK8sConfig) opts.Opt {
+			return aaq.NewAaqOpt(c, sc, n.CDIVersion)
+		},
+	},
+	{
+		Descriptor: opts.Descriptor{Name: "network_resources_injector", After: []string{"multus"}},
+		enabled:    func(n *nodesconfig.NodeK8sConfig) bool { return n.NetworkResourcesInjector },
+		new: func(c k8s.K8sDynamicClient, sc libssh.Client, _ *nodesconfig.NodeK8sConfig) opts.Opt {
+			return network_resources_injector.NewNetworkResourcesInjectorOpt(sc, c)
+		},
+	},
+}
+
+// k8sOptSettings are flags changing how an opt is deployed. They deploy nothing themselves, the opt they
+// belong to has to be enabled as well
+var k8sOptSettings = []k8sOpt{
+	{
+		Descriptor: opts.Descriptor{Name: "dnc", DependsOn: []string{"cnao"}},
+		enabled:    func(n *nodesconfig.NodeK8sConfig) bool { return n.DNC },
+	},
+	{
+		Descriptor: opts.Descriptor{Name: "cnao-skip-cr", DependsOn: []string{"cnao"}},
+		enabled:    func(n *nodesconfig.NodeK8sConfig) bool { return n.CNAOSkipCR },
+	},
+	{
+		Descriptor: opts.Descriptor{Name: "grafana", DependsOn: []string{"prometheus"}},
+		enabled:    func(n *nodesconfig.NodeK8sConfig) bool { return n.Grafana },
+	},
+	{
+		Descriptor: opts.Descriptor{Name: "alertmanager", DependsOn: []string{"prometheus"}},
+		enabled:    func(n *nodesconfig.NodeK8sConfig) bool { return n.Alertmanager },
+	},
+}
+
+// loadAddons reads the add-ons of the given directories
+func loadAddons(dirs []string) ([]*addon.Addon, error) {
+	addons := []*addon.Addon{}
+	for _, dir := range dirs {
+		a, err := addon.Load(dir)
+		if err != nil {
+			return nil, err
+		}
+		addons = append(addons, a)
+	}
+	return addons, nil
+}
+
+// addonK8sOpts turns add-ons into opts which are always enabled. nodes holds a root client per node starting
+// with node01 to run the node scripts, it can be nil if the opts are only ordered but not executed
+func addonK8sOpts(addons []*addon.Addon, nodes []libssh.Client) []k8sOpt {
+	addonOpts := []k8sOpt{}
+	for _, a := range addons {
+		addonOpts = append(addonOpts, k8sOpt{
+			Descriptor: a.Descriptor(),
+			enabled:    func(_ *nodesconfig.NodeK8sConfig) bool { return true },
+			new: func(c k8s.K8sDynamicClient, sc libssh.Client, _ *nodesconfig.NodeK8sConfig) opts.Opt {
+				return addon.NewAddonOpt(a, c, sc, nodes)
+			},
+		})
+	}
+	return addonOpts
+}
+
+// newK8sOptGraph orders the enabled opts together with the add-on opts, failing for combinations
+// which can't be deployed on the cluster
+func newK8sOptGraph(n *nodesconfig.NodeK8sConfig, cluster string, addonOpts ...k8sOpt) (*opts.Graph, map[string]k8sOpt, error) {
+	enabled := []opts.Descriptor{}
+	byName := map[string]k8sOpt{}
+	for _, o := range k8sOpts {
+		if o.enabled(n) {
+			enabled = append(enabled, o.Descriptor)
+		}
+		byName[o.Name] = o
+	}
+	for _, o := range addonOpts {
+		if _, ok := byName[o.Name]; ok {
+			return nil, nil, fmt.Errorf("add-on %s can't be deployed, an opt of the same name is already registered", o.Name)
+		}
+		enabled = append(enabled, o.Descriptor)
+		byName[o.Name] = o
+	}
+
+	// the settings are only checked along with the opts, they are left out of the graph the opts run in
+	checked := append([]opts.Descriptor{}, enabled...)
+	for _, o := range k8sOptSettings {
+		if o.enabled(n) {
+			checked = append(checked, o.Descriptor)
+		}
+	}
+	if _, err := opts.NewGraph(checked, clusterK8sVersion(cluster)); err != nil {
+		return nil, nil, err
+	}
+
+	g, err := opts.NewGraph(enabled, clusterK8sVersion(cluster))
+	if err != nil {
+		return nil, nil, err
+	}
+	return g, byName, nil
+}
+
+// clusterK8sVersion reads the K8s version from a cluster name like k8s-1.30, falling back to the
+// KUBEVIRT_PROVIDER environment variable. It returns nil if neither contains a version
+func clusterK8sVersion(cluster string) *semver.Version {
+	for _, name := range []string{cluster, os.Getenv(kubevirtProviderEnv)} {
+		submatches := clusterVersionRegex.FindStringSubmatch(name)
+		if len(submatches) != 2 {
+			continue
+		}
+		if version, err := semver.NewVersion(submatches[1]); err == nil {
+			return version
+		}
+	}
+	return nil
+}
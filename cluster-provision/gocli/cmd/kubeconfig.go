@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/cmd/utils"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
+	k8s "kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/k8s"
+)
+
+// adminKubeconfig is the kubeconfig kubeadm init writes on the control plane node
+const adminKubeconfig = "/etc/kubernetes/admin.conf"
+
+// NewKubeconfigCommand returns the command to export the kubeconfig of a cluster
+func NewKubeconfigCommand() *cobra.Command {
+	kubeconfig := &cobra.Command{
+		Use:   "kubeconfig PREFIX",
+		Short: "kubeconfig prints the kubeconfig of a cluster or merges it into the kubeconfig of the user",
+		Long: `kubeconfig prints the kubeconfig of a cluster or merges it into the kubeconfig of the user
+
+The kubeconfig talks to the API server port published on 127.0.0.1 and verifies its certificate
+against the cluster CA. Clusters provisioned from provider images whose API server certificate is not
+valid for 127.0.0.1 get a kubeconfig which skips the verification, with a warning. The cluster, the user and the context are named after PREFIX. With --merge
+they are added to the file kubectl reads, $KUBECONFIG or ~/.kube/config, and the context becomes
+the current one.`,
+		RunE: kubeconfig,
+		Args: cobra.ExactArgs(1),
+	}
+	kubeconfig.Flags().Bool("merge", false, "merge the kubeconfig into the kubeconfig of the user instead of printing it")
+	kubeconfig.Flags().String("kubeconfig", "", "the kubeconfig to merge into, defaults to $KUBECONFIG or ~/.kube/config")
+	return kubeconfig
+}
+
+func kubeconfig(cmd *cobra.Command, args []string) error {
+	merge, err := cmd.Flags().GetBool("merge")
+	if err != nil {
+		return err
+	}
+	path, err := cmd.Flags().GetString("kubeconfig")
+	if err != nil {
+		return err
+	}
+	prefix := args[0]
+
+	cli, err := newRuntime()
+	if err != nil {
+		return err
+	}
+	config, err := clusterKubeconfig(cli, prefix)
+	if err != nil {
+		return err
+	}
+
+	if !merge {
+		out, err := clientcmd.Write(*config)
+		if err != nil {
+			return err
+		}
+		_, err = cmd.OutOrStdout().Write(out)
+		return err
+	}
+
+	if path == "" {
+		path = clientcmd.NewDefaultPathOptions().GetDefaultFilename()
+	}
+	merged, err := clientcmd.LoadFromFile(path)
+	if os.IsNotExist(err) {
+		merged, err = clientcmdapi.NewConfig(), nil
+	}
+	if err != nil {
+		return err
+	}
+	merged.Clusters[prefix] = config.Clusters[prefix]
+	merged.AuthInfos[prefix] = config.AuthInfos[prefix]
+	merged.Contexts[prefix] = config.Contexts[prefix]
+	merged.CurrentContext = prefix
+	if err := clientcmd.WriteToFile(*merged, path); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "merged the context %s into %s\n", prefix, path)
+	return nil
+}
+
+// clusterKubeconfig returns the admin kubeconfig of the cluster with the given prefix, pointed at the API server
+// port published on localhost, with the cluster, the user and the context named after the prefix
+func clusterKubeconfig(cli docker.Runtime, prefix string) (*clientcmdapi.Config, error) {
+	dnsmasq, _, err := clusterContainers(cli, prefix)
+	if err != nil {
+		return nil, err
+	}
+	dm, err := cli.ContainerInspect(context.Background(), dnsmasq.ID)
+	if err != nil {
+		return nil, err
+	}
+	sshPort, err := utils.GetPublicPort(utils.PortSSH, dm.NetworkSettings.Ports)
+	if err != nil {
+		return nil, err
+	}
+	apiServerPort, err := utils.GetPublicPort(utils.PortAPI, dm.NetworkSettings.Ports)
+	if err != nil {
+		return nil, err
+	}
+
+	sshClient, err := newSSHClient(sshPort, 1, true)
+	if err != nil {
+		return nil, err
+	}
+	admin := &bytes.Buffer{}
+	if err := sshClient.CopyRemoteFile(adminKubeconfig, admin); err != nil {
+		return nil, err
+	}
+	adminConfig, err := clientcmd.Load(admin.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s of the cluster %s: %v", adminKubeconfig, prefix, err)
+	}
+	current, ok := adminConfig.Contexts[adminConfig.CurrentContext]
+	if !ok || adminConfig.Clusters[current.Cluster] == nil || adminConfig.AuthInfos[current.AuthInfo] == nil {
+		return nil, fmt.Errorf("%s of the cluster %s has no current context", adminKubeconfig, prefix)
+	}
+
+	cluster := adminConfig.Clusters[current.Cluster].DeepCopy()
+	cluster.Server = k8s.LocalServer(apiServerPort)
+	if !k8s.LocalServerVerifiable(apiServerPort) {
+		cluster.InsecureSkipTLSVerify = true
+		cluster.CertificateAuthorityData = nil
+		cluster.CertificateAuthority = ""
+	}
+	kubeContext := clientcmdapi.NewContext()
+	kubeContext.Cluster = prefix
+	kubeContext.AuthInfo = prefix
+
+	config := clientcmdapi.NewConfig()
+	config.Clusters[prefix] = cluster
+	config.AuthInfos[prefix] = adminConfig.AuthInfos[current.AuthInfo].DeepCopy()
+	config.Contexts[prefix] = kubeContext
+	config.CurrentContext = prefix
+	return config, nil
+}
@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/go-connections/nat"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/cmd/utils"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
+)
+
+var _ = Describe("Kubeconfig and env", func() {
+	var runtime *docker.FakeRuntime
+
+	BeforeEach(func() {
+		admin := clientcmdapi.NewConfig()
+		admin.Clusters["kubernetes"] = &clientcmdapi.Cluster{Server: "https://192.168.66.101:6443", CertificateAuthorityData: []byte("ca")}
+		admin.AuthInfos["kubernetes-admin"] = &clientcmdapi.AuthInfo{ClientCertificateData: []byte("cert"), ClientKeyData: []byte("key")}
+		admin.Contexts["kubernetes-admin@kubernetes"] = &clientcmdapi.Context{Cluster: "kubernetes", AuthInfo: "kubernetes-admin"}
+		admin.CurrentContext = "kubernetes-admin@kubernetes"
+		adminConf, err := clientcmd.Write(*admin)
+		Expect(err).NotTo(HaveOccurred())
+
+		runtime = docker.NewFakeRuntime()
+		sshClient := setupFakeCluster(runtime, nil)
+		sshClient.EXPECT().CopyRemoteFile(gomock.Any(), gomock.Any()).DoAndReturn(func(path string, out io.Writer) error {
+			Expect(path).To(Equal(adminKubeconfig))
+			_, err := out.Write(adminConf)
+			return err
+		}).AnyTimes()
+
+		_, err = gocli("run", "k8s-1.30", "--nodes", "2", "--background")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	expectContext := func(config *clientcmdapi.Config) {
+		Expect(config.Contexts).To(HaveKeyWithValue("k8s-1.30", And(
+			HaveField("Cluster", "k8s-1.30"),
+			HaveField("AuthInfo", "k8s-1.30"),
+		)))
+		Expect(config.Clusters).To(HaveKey("k8s-1.30"))
+		Expect(config.Clusters["k8s-1.30"].Server).To(MatchRegexp(`^https://127\.0\.0\.1:\d+$`))
+		Expect(config.Clusters["k8s-1.30"].CertificateAuthorityData).To(BeEquivalentTo("ca"))
+		Expect(config.Clusters["k8s-1.30"].InsecureSkipTLSVerify).To(BeFalse())
+		Expect(config.AuthInfos).To(HaveKey("k8s-1.30"))
+		Expect(config.AuthInfos["k8s-1.30"].ClientKeyData).To(BeEquivalentTo("key"))
+	}
+
+	It("should print a kubeconfig named after the prefix which verifies the API server", func() {
+		Expect(".kubeconfig").NotTo(BeAnExistingFile())
+
+		out, err := gocli("kubeconfig", "k8s-1.30")
+		Expect(err).NotTo(HaveOccurred())
+		config, err := clientcmd.Load([]byte(out))
+		Expect(err).NotTo(HaveOccurred())
+		expectContext(config)
+		Expect(config.CurrentContext).To(Equal("k8s-1.30"))
+	})
+
+	It("should merge the kubeconfig and keep the other contexts", func() {
+		path := filepath.Join("kube", "config")
+		other := clientcmdapi.NewConfig()
+		other.Clusters["other"] = &clientcmdapi.Cluster{Server: "https://other:6443"}
+		other.AuthInfos["other"] = &clientcmdapi.AuthInfo{Token: "token"}
+		other.Contexts["other"] = &clientcmdapi.Context{Cluster: "other", AuthInfo: "other"}
+		other.CurrentContext = "other"
+		Expect(clientcmd.WriteToFile(*other, path)).To(Succeed())
+
+		out, err := gocli("kubeconfig", "k8s-1.30", "--merge", "--kubeconfig", path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal("merged the context k8s-1.30 into kube/config\n"))
+
+		config, err := clientcmd.LoadFromFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		expectContext(config)
+		Expect(config.Contexts).To(HaveKey("other"))
+		Expect(config.CurrentContext).To(Equal("k8s-1.30"))
+	})
+
+	It("should fail for clusters which don't exist", func() {
+		_, err := gocli("kubeconfig", "k8s-1.29")
+		Expect(err).To(HaveOccurred())
+		_, err = gocli("env", "k8s-1.29", "--kubeconfig", "kubeconfig")
+		Expect(err).To(HaveOccurred())
+	})
+
+	hostPort := func(port string) string {
+		dnsmasq, ok := runtime.Container("k8s-1.30-dnsmasq")
+		Expect(ok).To(BeTrue())
+		Expect(dnsmasq.Ports).To(HaveKey(nat.Port(port)))
+		return dnsmasq.Ports[nat.Port(port)][0].HostPort
+	}
+
+	It("should print the connection details of the cluster as shell variables", func() {
+		out, err := gocli("env", "k8s-1.30", "--kubeconfig", "kubeconfig")
+		Expect(err).NotTo(HaveOccurred())
+
+		path, err := filepath.Abs("kubeconfig")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.Split(strings.TrimSuffix(out, "\n"), "\n")).To(Equal([]string{
+			"export KUBEVIRTCI_PREFIX=k8s-1.30",
+			"export KUBECONFIG=" + path,
+			"export KUBEVIRTCI_API_SERVER=https://127.0.0.1:" + hostPort("6443/tcp"),
+			"export KUBEVIRTCI_REGISTRY=127.0.0.1:" + hostPort("5000/tcp"),
+			"export KUBEVIRTCI_SSH_PORT=" + hostPort("2201/tcp"),
+			"export KUBEVIRTCI_PROMETHEUS_URL=http://127.0.0.1:" + hostPort("30007/tcp"),
+			"export KUBEVIRTCI_GRAFANA_URL=http://127.0.0.1:" + hostPort("30008/tcp"),
+			"export KUBEVIRTCI_DNS_PORT=" + hostPort("31111/udp"),
+			"export KUBEVIRTCI_NODE01_IP=192.168.66.101",
+			"export KUBEVIRTCI_NODE01_IPV6=fd00::101",
+			"export KUBEVIRTCI_NODE01_SSH_PORT=" + hostPort("2201/tcp"),
+			"export KUBEVIRTCI_NODE02_IP=192.168.66.102",
+			"export KUBEVIRTCI_NODE02_IPV6=fd00::102",
+			"export KUBEVIRTCI_NODES='node01 node02'",
+		}))
+
+		config, err := clientcmd.LoadFromFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		expectContext(config)
+	})
+
+	It("should only write the kubeconfig when --kubeconfig asks for it", func() {
+		out, err := gocli("env", "k8s-1.30")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(HavePrefix("export KUBEVIRTCI_PREFIX=k8s-1.30\nexport KUBEVIRTCI_API_SERVER="))
+		Expect(out).NotTo(ContainSubstring("KUBECONFIG"))
+		Expect(os.ReadDir(".")).To(BeEmpty())
+	})
+
+	It("should name the SSH ports of the nodes like vm.sh does", func() {
+		Expect(utils.NodeSSHPort(1)).To(BeEquivalentTo(utils.PortSSH))
+		Expect(utils.NodeSSHPort(2)).To(BeEquivalentTo(utils.PortSSHWorker))
+		Expect(utils.NodeSSHPort(12)).To(BeEquivalentTo(2212))
+		Expect(utils.NodeSSHPort(100)).To(BeEquivalentTo(22100))
+	})
+
+	It("should print the connection details of the cluster as JSON", func() {
+		out, err := gocli("env", "k8s-1.30", "--kubeconfig", "kubeconfig", "--json")
+		Expect(err).NotTo(HaveOccurred())
+
+		e := clusterEnv{}
+		Expect(json.Unmarshal([]byte(out), &e)).To(Succeed())
+		Expect(e.Prefix).To(Equal("k8s-1.30"))
+		Expect(e.Kubeconfig).To(HaveSuffix("/kubeconfig"))
+		Expect(e.APIServer).To(Equal("https://127.0.0.1:" + hostPort("6443/tcp")))
+		Expect(fmt.Sprint(e.SSHPort)).To(Equal(hostPort("2201/tcp")))
+		Expect(e.Nodes).To(Equal([]nodeEnv{
+			{Name: "node01", IPv4: "192.168.66.101", IPv6: "fd00::101", SSHPort: e.SSHPort},
+			{Name: "node02", IPv4: "192.168.66.102", IPv6: "fd00::102"},
+		}))
+	})
+})
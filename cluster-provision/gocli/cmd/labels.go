@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/cmd/clusterspec"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/cmd/nodesconfig"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/images"
+)
+
+// Labels on the containers and volumes gocli creates, the commands select the resources of a cluster by them
+// instead of by their names, which start with the prefix of other clusters just as well
+const (
+	labelClusterID = "io.kubevirtci.cluster-id"
+	labelPrefix    = "io.kubevirtci.prefix"
+	labelRole      = "io.kubevirtci.role"
+	labelNodeIndex = "io.kubevirtci.node-index"
+	labelVersion   = "io.kubevirtci.gocli-version"
+	// labelExposePrefix is followed by the name of a port exposed with run --expose or gocli expose,
+	// the value is the port of node01, e.g. 30080/tcp
+	labelExposePrefix = "io.kubevirtci.expose."
+	// labelHostPort is the port on localhost a proxy of gocli expose listens on
+	labelHostPort = "io.kubevirtci.host-port"
+	// labelLinuxConfig holds the linux settings a node was provisioned with, node add provisions new nodes
+	// with those of the last node
+	labelLinuxConfig = "io.kubevirtci.linux-config"
+	// labelVM holds the virtual hardware and the arguments the VM of a node was started with, node add starts
+	// new nodes with those of the last node
+	labelVM = "io.kubevirtci.vm"
+)
+
+// Roles of the containers and volumes of a cluster
+const (
+	roleDNSMasq  = "dnsmasq"
+	roleNode     = "node"
+	roleRegistry = "registry"
+	roleNFS      = "nfs"
+	roleShared   = "shared"
+	roleExpose   = "expose"
+)
+
+// newClusterID returns the ID which tells the resources of a cluster apart from those of an earlier
+// cluster with the same prefix
+func newClusterID() (string, error) {
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate the cluster ID: %v", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// gocliVersion is the tag gocli was built with, development builds have none
+func gocliVersion() string {
+	if version := strings.TrimPrefix(images.SUFFIX, ":"); version != "" {
+		return version
+	}
+	return "devel"
+}
+
+// clusterLabels returns the labels of a container or volume of the cluster, nodeIdx is only set for nodes.
+// Nodes added to clusters which were created before gocli labelled them have no cluster ID
+func clusterLabels(clusterID string, prefix string, role string, nodeIdx int) map[string]string {
+	labels := map[string]string{
+		labelPrefix:  prefix,
+		labelRole:    role,
+		labelVersion: gocliVersion(),
+	}
+	if clusterID != "" {
+		labels[labelClusterID] = clusterID
+	}
+	if nodeIdx > 0 {
+		labels[labelNodeIndex] = strconv.Itoa(nodeIdx)
+	}
+	return labels
+}
+
+// encodeLinuxConfig returns the value of labelLinuxConfig for the linux settings of a node
+func encodeLinuxConfig(n *nodesconfig.NodeLinuxConfig) (string, error) {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode the linux settings of node %d: %v", n.NodeIdx, err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// encodeNodeVM returns the value of labelVM for the VM of the node with the given index
+func encodeNodeVM(nodeIdx int, vm *nodeVM) (string, error) {
+	data, err := json.Marshal(vm)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode the VM of node %d: %v", nodeIdx, err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeNodeVM reads the VM of a node from its labels, nodes created before gocli labelled them with their VM
+// have none
+func decodeNodeVM(labels map[string]string) (*nodeVM, bool) {
+	encoded, ok := labels[labelVM]
+	if !ok {
+		return nil, false
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, false
+	}
+	vm := &nodeVM{}
+	if err := json.Unmarshal(data, vm); err != nil {
+		return nil, false
+	}
+	return vm, true
+}
+
+// decodeLinuxConfig reads the linux settings of a node from its labels, nodes created before gocli labelled
+// them with their settings have none
+func decodeLinuxConfig(labels map[string]string) (*nodesconfig.NodeLinuxConfig, bool) {
+	encoded, ok := labels[labelLinuxConfig]
+	if !ok {
+		return nil, false
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, false
+	}
+	n := &nodesconfig.NodeLinuxConfig{}
+	if err := json.Unmarshal(data, n); err != nil {
+		return nil, false
+	}
+	return n, true
+}
+
+// ownedBy returns whether the container or volume belongs to the cluster with the given prefix. Resources
+// without labels are from clusters created by older gocli versions, they are recognized by their exact names
+func ownedBy(prefix string, name string, labels map[string]string) bool {
+	if p, ok := labels[labelPrefix]; ok {
+		return p == prefix
+	}
+	suffix, ok := strings.CutPrefix(strings.TrimPrefix(name, "/"), prefix+"-")
+	if !ok {
+		return false
+	}
+	if _, err := clusterspec.NodeIndex(suffix); err == nil {
+		return true
+	}
+	return suffix == roleDNSMasq || suffix == roleShared || slices.Contains(clusterAuxiliaryContainers, suffix)
+}
+
+// containerRole returns the role of a container of the cluster and its node index if it is a node
+func containerRole(prefix string, c container.Summary) (string, int) {
+	if role, ok := c.Labels[labelRole]; ok {
+		idx, _ := strconv.Atoi(c.Labels[labelNodeIndex])
+		return role, idx
+	}
+	suffix := strings.TrimPrefix(containerName(c), prefix+"-")
+	if idx, err := clusterspec.NodeIndex(suffix); err == nil {
+		return roleNode, idx
+	}
+	return suffix, 0
+}
+
+func containerName(c container.Summary) string {
+	if len(c.Names) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(c.Names[0], "/")
+}
+
+// clusterContainerList returns all containers of the cluster with the given prefix, including the stopped ones
+func clusterContainerList(cli docker.Runtime, prefix string) ([]container.Summary, error) {
+	containers, err := cli.ContainerList(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	owned := []container.Summary{}
+	for _, c := range containers {
+		if ownedBy(prefix, containerName(c), c.Labels) {
+			owned = append(owned, c)
+		}
+	}
+	return owned, nil
+}
+
+// clusterVolumeList returns the names of the volumes of the cluster with the given prefix
+func clusterVolumeList(cli docker.Runtime, prefix string) ([]string, error) {
+	volumes, err := cli.VolumeList(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	owned := []string{}
+	for _, v := range volumes {
+		if ownedBy(prefix, v.Name, v.Labels) {
+			owned = append(owned, v.Name)
+		}
+	}
+	return owned, nil
+}
+
+// clusterContainer returns the container of the cluster with the given name, e.g. dnsmasq or node01
+func clusterContainer(cli docker.Runtime, prefix string, name string) (container.Summary, error) {
+	containers, err := clusterContainerList(cli, prefix)
+	if err != nil {
+		return container.Summary{}, err
+	}
+	for _, c := range containers {
+		if containerName(c) == nodeContainer(prefix, name) {
+			return c, nil
+		}
+	}
+	return container.Summary{}, fmt.Errorf("failed to find the container %s of the cluster %s", nodeContainer(prefix, name), prefix)
+}
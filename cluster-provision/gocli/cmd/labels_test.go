@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
+)
+
+var _ = Describe("Cluster labels", func() {
+	var runtime *docker.FakeRuntime
+
+	BeforeEach(func() {
+		runtime = docker.NewFakeRuntime()
+		expectJoinToken(setupFakeCluster(runtime, nil))
+	})
+
+	volumeLabels := func(name string) map[string]string {
+		volumes, err := runtime.VolumeList(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		for _, v := range volumes {
+			if v.Name == name {
+				return v.Labels
+			}
+		}
+		Fail("volume " + name + " does not exist")
+		return nil
+	}
+
+	It("should label the containers and volumes of the cluster", func() {
+		_, err := gocli("run", "k8s-1.30", "--nodes", "2")
+		Expect(err).NotTo(HaveOccurred())
+
+		dnsmasq, _ := runtime.Container("k8s-1.30-dnsmasq")
+		id := dnsmasq.Config.Labels[labelClusterID]
+		Expect(id).To(HaveLen(12))
+		Expect(dnsmasq.Config.Labels).To(Equal(map[string]string{
+			labelClusterID: id, labelPrefix: "k8s-1.30", labelRole: roleDNSMasq, labelVersion: "devel",
+		}))
+		node02, _ := runtime.Container("k8s-1.30-node02")
+		Expect(node02.Config.Labels).To(HaveKeyWithValue(labelClusterID, id))
+		Expect(node02.Config.Labels).To(HaveKeyWithValue(labelRole, roleNode))
+		Expect(node02.Config.Labels).To(HaveKeyWithValue(labelNodeIndex, "2"))
+		Expect(volumeLabels("k8s-1.30-registry")).To(HaveKeyWithValue(labelRole, roleRegistry))
+
+		_, err = gocli("node", "add")
+		Expect(err).NotTo(HaveOccurred())
+		node03, _ := runtime.Container("k8s-1.30-node03")
+		Expect(node03.Config.Labels).To(HaveKeyWithValue(labelClusterID, id))
+		Expect(node03.Config.Labels).To(HaveKeyWithValue(labelNodeIndex, "3"))
+	})
+
+	It("should only remove the cluster with the given prefix", func() {
+		_, err := gocli("run", "k8s-1.30")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = gocli("run", "k8s-1.30", "--prefix", "k8s-1.30-2")
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = gocli("rm")
+		Expect(err).NotTo(HaveOccurred())
+		_, ok := runtime.Container("k8s-1.30-dnsmasq")
+		Expect(ok).To(BeFalse())
+		for _, name := range []string{"k8s-1.30-2-dnsmasq", "k8s-1.30-2-registry", "k8s-1.30-2-node01"} {
+			_, ok := runtime.Container(name)
+			Expect(ok).To(BeTrue(), name)
+		}
+		Expect(runtime.Volumes()).To(ConsistOf("k8s-1.30-2-registry"))
+	})
+
+	It("should remove containers and volumes of clusters created before labels by their names", func() {
+		Expect(runtime.VolumeCreate(context.Background(), "k8s-1.30-registry", nil)).To(Succeed())
+		Expect(runtime.VolumeCreate(context.Background(), "k8s-1.30-2-registry", nil)).To(Succeed())
+
+		_, err := gocli("rm")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(runtime.Volumes()).To(ConsistOf("k8s-1.30-2-registry"))
+	})
+
+	It("should collect the resources of crashed runs", func() {
+		_, err := gocli("run", "k8s-1.30")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = gocli("run", "k8s-1.30", "--prefix", "k8s-1.30-2")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = gocli("run", "k8s-1.30", "--prefix", "k8s-1.30-3")
+		Expect(err).NotTo(HaveOccurred())
+		ctx := context.Background()
+
+		By("losing the dnsmasq of one cluster and the nodes of another")
+		Expect(runtime.ContainerRemove(ctx, "k8s-1.30-2-dnsmasq", true)).To(Succeed())
+		Expect(runtime.ContainerRemove(ctx, "k8s-1.30-3-node01", true)).To(Succeed())
+		Expect(runtime.VolumeCreate(ctx, "unrelated", nil)).To(Succeed())
+
+		out, err := gocli("gc", "--dry-run", "--min-age", "0s")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal(`container k8s-1.30-2-registry
+container k8s-1.30-2-node01
+container k8s-1.30-3-registry
+container k8s-1.30-3-dnsmasq
+volume k8s-1.30-2-registry
+volume k8s-1.30-3-registry
+`))
+		_, ok := runtime.Container("k8s-1.30-3-dnsmasq")
+		Expect(ok).To(BeTrue())
+
+		By("keeping young resources")
+		out, err = gocli("gc")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(BeEmpty())
+
+		_, err = gocli("gc", "--min-age", "0s")
+		Expect(err).NotTo(HaveOccurred())
+		for _, name := range []string{"k8s-1.30-2-registry", "k8s-1.30-2-node01", "k8s-1.30-3-dnsmasq"} {
+			_, ok := runtime.Container(name)
+			Expect(ok).To(BeFalse(), name)
+		}
+		for _, name := range []string{"k8s-1.30-dnsmasq", "k8s-1.30-registry", "k8s-1.30-node01"} {
+			_, ok := runtime.Container(name)
+			Expect(ok).To(BeTrue(), name)
+		}
+		Expect(runtime.Volumes()).To(ConsistOf("k8s-1.30-registry", "unrelated"))
+	})
+
+	It("should refuse to run over an interrupted run until it is cleaned up", func() {
+		_, err := gocli("run", "k8s-1.30", "--background")
+		Expect(err).NotTo(HaveOccurred())
+		ledgers, err := docker.LoadLedgers()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ledgers).To(BeEmpty())
+
+		By("leaving the ledger of a killed run behind")
+		created := []string{}
+		for _, name := range []string{"k8s-1.30-dnsmasq", "k8s-1.30-registry", "k8s-1.30-node01"} {
+			c, _ := runtime.Container(name)
+			created = append(created, c.ID)
+		}
+		ledger, err := json.Marshal(docker.Ledger{
+			Prefix: "k8s-1.30", Containers: created, Volumes: []string{"k8s-1.30-registry"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.WriteFile(filepath.Join(docker.LedgerDir(), "k8s-1.30.json"), ledger, 0o644)).To(Succeed())
+
+		_, err = gocli("run", "k8s-1.30")
+		Expect(err).To(MatchError(ContainSubstring("gocli cleanup --stale")))
+		out, err := gocli("cleanup")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(MatchRegexp(`k8s-1.30\s+\S+\s+3\s+1\s+stale`))
+
+		out, err = gocli("cleanup", "--stale")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal("removed 3 containers and 1 volumes of the interrupted run of k8s-1.30\n"))
+		_, ok := runtime.Container("k8s-1.30-dnsmasq")
+		Expect(ok).To(BeFalse())
+		Expect(runtime.Volumes()).To(BeEmpty())
+
+		_, err = gocli("run", "k8s-1.30")
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
+
+var _ = Describe("ownedBy", func() {
+	DescribeTable("should match resources by label and unlabelled ones by their exact name",
+		func(name string, labels map[string]string, owned bool) {
+			Expect(ownedBy("kubevirt", name, labels)).To(Equal(owned))
+		},
+		Entry("labelled", "anything", map[string]string{labelPrefix: "kubevirt"}, true),
+		Entry("labelled for another cluster", "kubevirt-registry", map[string]string{labelPrefix: "kubevirt2"}, false),
+		Entry("unlabelled node", "/kubevirt-node01", nil, true),
+		Entry("unlabelled registry", "kubevirt-registry", nil, true),
+		Entry("unlabelled volume of a longer prefix", "kubevirt2-registry", nil, false),
+		Entry("unlabelled container of a longer prefix", "kubevirt-2-node01", nil, false),
+	)
+})
@@ -0,0 +1,229 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+	"github.com/spf13/cobra"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/cmd/utils"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
+)
+
+const (
+	clusterRunning  = "running"
+	clusterStopped  = "stopped"
+	clusterDegraded = "degraded"
+)
+
+// portNames names the ports the cluster containers publish, as accepted by gocli ports
+var portNames = map[int]string{
+	utils.PortSSH:                  utils.PortNameSSH,
+	utils.PortSSHWorker:            utils.PortNameSSHWorker,
+	utils.PortAPI:                  utils.PortNameAPI,
+	utils.PortRegistry:             utils.PortNameRegistry,
+	utils.PortOCP:                  utils.PortNameOCP,
+	utils.PortVNC:                  utils.PortNameVNC,
+	utils.PortHTTP:                 utils.PortNameHTTP,
+	utils.PortHTTPS:                utils.PortNameHTTPS,
+	utils.PortPrometheus:           utils.PortNamePrometheus,
+	utils.PortGrafana:              utils.PortNameGrafana,
+	utils.PortUploadProxy:          utils.PortNameUploadProxy,
+	utils.PortUploadProxyLowerBand: utils.PortNameUploadProxyLowerBand,
+	utils.PortDNS:                  utils.PortNameDNS,
+}
+
+// clusterSummary is what gocli list reports about a cluster
+type clusterSummary struct {
+	Prefix    string        `json:"prefix"`
+	Image     string        `json:"image"`
+	State     string        `json:"state"`
+	Nodes     int           `json:"nodes"`
+	StartedAt *time.Time    `json:"startedAt,omitempty"`
+	Ports     []clusterPort `json:"ports,omitempty"`
+	Volumes   []string      `json:"volumes,omitempty"`
+}
+
+// clusterPort is a port of the cluster published on the host
+type clusterPort struct {
+	Name     string `json:"name,omitempty"`
+	Port     string `json:"port"`
+	HostPort string `json:"hostPort"`
+}
+
+// NewListCommand returns the command to list the clusters on the host
+func NewListCommand() *cobra.Command {
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "list shows all clusters on the host",
+		Long: `list shows all clusters on the host
+
+Clusters are found by the labels of their dnsmasq containers, the global --prefix flag is
+ignored. A cluster is degraded when only some of its containers are running.`,
+		RunE: list,
+		Args: cobra.NoArgs,
+	}
+	list.Flags().String("output", outputText, "output format, text or json")
+	return list
+}
+
+func list(cmd *cobra.Command, _ []string) error {
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	if output != outputText && output != outputJSON {
+		return fmt.Errorf("unsupported output %q, possible values: %s, %s", output, outputText, outputJSON)
+	}
+
+	cli, err := newRuntime()
+	if err != nil {
+		return err
+	}
+
+	clusters, err := listClusters(cli)
+	if err != nil {
+		return err
+	}
+
+	if output == outputJSON {
+		return writeJSON(cmd.OutOrStdout(), clusters)
+	}
+	return writeClusterTable(cmd.OutOrStdout(), clusters)
+}
+
+// listClusters returns the clusters on the host sorted by their prefix
+func listClusters(cli docker.Runtime) ([]clusterSummary, error) {
+	ctx := context.Background()
+	containers, err := cli.ContainerList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	volumes, err := cli.VolumeList(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	prefixes := []string{}
+	for _, c := range containers {
+		if role, ok := c.Labels[labelRole]; ok {
+			if role == roleDNSMasq {
+				prefixes = append(prefixes, c.Labels[labelPrefix])
+			}
+		} else if prefix, ok := strings.CutSuffix(containerName(c), "-dnsmasq"); ok {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	slices.Sort(prefixes)
+
+	clusters := []clusterSummary{}
+	for _, prefix := range prefixes {
+		cluster := clusterSummary{Prefix: prefix, Volumes: []string{}}
+		var dnsmasq container.Summary
+		running, total := 0, 0
+		for _, c := range containers {
+			if !ownedBy(prefix, containerName(c), c.Labels) {
+				continue
+			}
+			total++
+			if c.State == "running" {
+				running++
+			}
+			switch role, _ := containerRole(prefix, c); role {
+			case roleNode:
+				cluster.Nodes++
+			case roleDNSMasq:
+				dnsmasq = c
+			}
+		}
+
+		switch running {
+		case total:
+			cluster.State = clusterRunning
+		case 0:
+			cluster.State = clusterStopped
+		default:
+			cluster.State = clusterDegraded
+		}
+
+		dm, err := cli.ContainerInspect(ctx, dnsmasq.ID)
+		if err != nil {
+			return nil, err
+		}
+		cluster.Image = dm.Config.Image
+		if dm.State.Running {
+			startedAt, err := time.Parse(time.RFC3339Nano, dm.State.StartedAt)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read when %s was started: %v", nodeContainer(prefix, "dnsmasq"), err)
+			}
+			cluster.StartedAt = &startedAt
+		}
+		cluster.Ports = publicPorts(dm.NetworkSettings.Ports)
+
+		for _, v := range volumes {
+			if ownedBy(prefix, v.Name, v.Labels) {
+				cluster.Volumes = append(cluster.Volumes, v.Name)
+			}
+		}
+		clusters = append(clusters, cluster)
+	}
+	return clusters, nil
+}
+
+// publicPorts returns the ports published on the host, sorted by their container port
+func publicPorts(portMap nat.PortMap) []clusterPort {
+	ports := []nat.Port{}
+	for p := range portMap {
+		ports = append(ports, p)
+	}
+	slices.SortFunc(ports, func(a, b nat.Port) int {
+		if a.Int() != b.Int() {
+			return a.Int() - b.Int()
+		}
+		return strings.Compare(a.Proto(), b.Proto())
+	})
+
+	published := []clusterPort{}
+	for _, p := range ports {
+		// the same host port is bound for IPv4 and IPv6
+		if bindings := portMap[p]; len(bindings) > 0 && bindings[0].HostPort != "" {
+			published = append(published, clusterPort{Name: portNames[p.Int()], Port: string(p), HostPort: bindings[0].HostPort})
+		}
+	}
+	return published
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func writeClusterTable(w io.Writer, clusters []clusterSummary) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PREFIX\tIMAGE\tSTATE\tNODES\tUPTIME\tPORTS")
+	for _, c := range clusters {
+		uptime := "-"
+		if c.StartedAt != nil {
+			uptime = time.Since(*c.StartedAt).Round(time.Second).String()
+		}
+		ports := []string{}
+		for _, p := range c.Ports {
+			name := p.Name
+			if name == "" {
+				name = p.Port
+			}
+			ports = append(ports, name+":"+p.HostPort)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\n", c.Prefix, c.Image, c.State, c.Nodes, uptime, strings.Join(ports, ","))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
+	k8s "kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/k8s"
+)
+
+var _ = Describe("List and status", func() {
+	var (
+		runtime   *docker.FakeRuntime
+		k8sClient k8s.K8sDynamicClient
+		// podStatus is set on the pods when they are created, apply drops the status
+		podStatus map[string]map[string]interface{}
+	)
+
+	BeforeEach(func() {
+		runtime = docker.NewFakeRuntime()
+		podStatus = map[string]map[string]interface{}{}
+		k8sClient = k8s.NewTestClient(
+			k8s.NewReactorConfig("create", "nodes", k8s.NewConditionReactor("Ready")),
+			k8s.NewReactorConfig("create", "pods", func(action k8stesting.Action) (bool, k8sruntime.Object, error) {
+				obj := action.(k8stesting.CreateAction).GetObject().(*unstructured.Unstructured)
+				obj.Object["status"] = podStatus[obj.GetName()]
+				return false, obj, nil
+			}),
+		)
+
+		setupFakeCluster(runtime, k8sClient)
+	})
+
+	apply := func(kind, ns, name string) {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("v1")
+		obj.SetKind(kind)
+		obj.SetNamespace(ns)
+		obj.SetName(name)
+		Expect(k8sClient.Apply(obj)).To(Succeed())
+	}
+
+	It("should list the clusters and tell their volumes apart", func() {
+		_, err := gocli("run", "k8s-1.30", "--nodes", "2")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = gocli("run", "k8s-1.30", "--prefix", "k8s-1.30-sriov")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = gocli("stop", "--timeout", "10ms", "--prefix", "k8s-1.30-sriov")
+		Expect(err).NotTo(HaveOccurred())
+
+		out, err := gocli("list", "--output", "json")
+		Expect(err).NotTo(HaveOccurred())
+		clusters := []clusterSummary{}
+		Expect(json.Unmarshal([]byte(out), &clusters)).To(Succeed())
+		Expect(clusters).To(HaveLen(2))
+
+		Expect(clusters[0].Prefix).To(Equal("k8s-1.30"))
+		Expect(clusters[0].State).To(Equal(clusterRunning))
+		Expect(clusters[0].Nodes).To(Equal(2))
+		Expect(clusters[0].Image).To(ContainSubstring("k8s-1.30"))
+		Expect(clusters[0].StartedAt).NotTo(BeNil())
+		Expect(clusters[0].Volumes).To(ConsistOf("k8s-1.30-registry"))
+		Expect(clusters[0].Ports).To(ContainElement(HaveField("Name", "k8s")))
+
+		Expect(clusters[1].Prefix).To(Equal("k8s-1.30-sriov"))
+		Expect(clusters[1].State).To(Equal(clusterStopped))
+		Expect(clusters[1].Nodes).To(Equal(1))
+		Expect(clusters[1].StartedAt).To(BeNil())
+		Expect(clusters[1].Volumes).To(ConsistOf("k8s-1.30-sriov-registry"))
+
+		out, err = gocli("list")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(MatchRegexp(`(?m)^PREFIX\s+IMAGE\s+STATE\s+NODES\s+UPTIME\s+PORTS$`))
+		Expect(out).To(MatchRegexp(`(?m)^k8s-1.30-sriov\s+\S+\s+stopped\s+1\s+-`))
+	})
+
+	It("should report a cluster as degraded when some of its containers are stopped", func() {
+		_, err := gocli("run", "k8s-1.30", "--nodes", "2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(runtime.Stop("k8s-1.30-node02")).To(Succeed())
+
+		out, err := gocli("status", "k8s-1.30", "--output", "json")
+		Expect(err).NotTo(HaveOccurred())
+		s := clusterStatus{}
+		Expect(json.Unmarshal([]byte(out), &s)).To(Succeed())
+		Expect(s.State).To(Equal(clusterDegraded))
+		Expect(s.Pods).To(BeNil())
+	})
+
+	It("should report the readiness of the nodes and the unhealthy pods", func() {
+		_, err := gocli("run", "k8s-1.30", "--nodes", "2")
+		Expect(err).NotTo(HaveOccurred())
+		podStatus["etcd-node01"] = map[string]interface{}{
+			"phase":             "Running",
+			"containerStatuses": []interface{}{map[string]interface{}{"name": "etcd", "ready": true}},
+		}
+		podStatus["coredns-1"] = map[string]interface{}{
+			"phase":             "Running",
+			"containerStatuses": []interface{}{map[string]interface{}{"name": "coredns", "ready": false}},
+		}
+		podStatus["job-1"] = map[string]interface{}{"phase": "Succeeded"}
+		podStatus["web"] = map[string]interface{}{"phase": "Pending", "reason": "Unschedulable"}
+		apply("Node", "", "node01")
+		apply("Node", "", "node02")
+		apply("Pod", "kube-system", "etcd-node01")
+		apply("Pod", "kube-system", "coredns-1")
+		apply("Pod", "default", "job-1")
+		apply("Pod", "default", "web")
+
+		out, err := gocli("status", "k8s-1.30", "--output", "json")
+		Expect(err).NotTo(HaveOccurred())
+		s := clusterStatus{}
+		Expect(json.Unmarshal([]byte(out), &s)).To(Succeed())
+		Expect(s.Prefix).To(Equal("k8s-1.30"))
+		Expect(s.State).To(Equal(clusterRunning))
+		Expect(s.NodeStatus).To(Equal([]nodeStatus{{Name: "node01", Ready: true}, {Name: "node02", Ready: true}}))
+		Expect(s.Pods).To(Equal(&podHealth{
+			Total: 4, Running: 2, Succeeded: 1, Pending: 1,
+			Unhealthy: []unhealthyPod{
+				{Namespace: "default", Name: "web", Phase: "Pending", Reason: "Unschedulable"},
+				{Namespace: "kube-system", Name: "coredns-1", Phase: "Running", Reason: "containers not ready: coredns"},
+			},
+		}))
+
+		out, err = gocli("status", "k8s-1.30")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(MatchRegexp(`(?m)^node01\s+true$`))
+		Expect(out).To(ContainSubstring("4 pods: 2 running, 1 succeeded, 1 pending, 0 failed"))
+		Expect(out).To(MatchRegexp(`(?m)^kube-system/coredns-1\s+Running\s+containers not ready: coredns$`))
+	})
+
+	It("should fail on unknown clusters and outputs", func() {
+		_, err := gocli("status", "k8s-1.30")
+		Expect(err).To(MatchError("no cluster found, the k8s-1.30-dnsmasq container does not exist"))
+		_, err = gocli("list", "--output", "yaml")
+		Expect(err).To(MatchError(ContainSubstring("unsupported output")))
+	})
+})
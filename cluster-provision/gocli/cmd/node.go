@@ -0,0 +1,416 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/cmd/clusterspec"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/cmd/utils"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/drainnode"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/ipam"
+	k8s "kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/k8s"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/libssh"
+)
+
+// dhcpHostsFile is read by dnsmasq on SIGHUP, see dnsmasq.sh
+const dhcpHostsFile = "/etc/dnsmasq-dhcp-hosts"
+
+// joinTokenCommand creates the bootstrap token a node added to the running cluster joins with
+const joinTokenCommand = "kubeadm token create --ttl 1h"
+
+var joinTokenRegex = regexp.MustCompile(`^[a-z0-9]{6}\.[a-z0-9]{16}$`)
+
+// NewNodeCommand returns command to add nodes to or remove nodes from a running cluster
+func NewNodeCommand() *cobra.Command {
+	node := &cobra.Command{
+		Use:   "node",
+		Short: "node adds nodes to or removes nodes from a running cluster",
+		Args:  cobra.NoArgs,
+	}
+
+	add := &cobra.Command{
+		Use:   "add",
+		Short: "add starts a new node and joins it to the running cluster",
+		Long: `add starts a new node and joins it to the running cluster
+
+The node gets the next free index. Its VM is started like the one of the last node, with the same
+memory, CPUs, NUMA nodes, disks, secondary NICs, shared block devices and qemu and kernel arguments, and
+it gets the linux settings of run, e.g. --enable-fips or --enable-ksm. --set overrides them and accepts
+the same keys as --node-override of run, e.g. --set memory=8G,cpu=6,nvme=10G`,
+		RunE: nodeAdd,
+		Args: cobra.NoArgs,
+	}
+	add.Flags().String("set", "", "node settings deviating from the last node, e.g. memory=8G,cpu=6,nvme=10G")
+
+	remove := &cobra.Command{
+		Use:   "remove NODE",
+		Short: "remove drains and deletes a worker node and removes its container",
+		RunE:  nodeRemove,
+		Args:  cobra.ExactArgs(1),
+	}
+
+	node.AddCommand(add, remove)
+	return node
+}
+
+func nodeAdd(cmd *cobra.Command, _ []string) (retErr error) {
+	prefix, err := cmd.Flags().GetString("prefix")
+	if err != nil {
+		return err
+	}
+
+	settings, err := cmd.Flags().GetString("set")
+	if err != nil {
+		return err
+	}
+
+	cli, err := newRuntime()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	dnsmasq, nodes, err := clusterContainers(cli, prefix)
+	if err != nil {
+		return err
+	}
+
+	lastIdx := 0
+	for idx := range nodes {
+		lastIdx = max(lastIdx, idx)
+	}
+	nodeIdx := lastIdx + 1
+	addresses, err := ipam.NodeAddresses(nodeIdx)
+	if err != nil {
+		return fmt.Errorf("can't add a node to the cluster: %w", err)
+	}
+	nodeName := nodeNameFromIndex(nodeIdx)
+
+	override := &clusterspec.NodeOverride{}
+	if settings != "" {
+		if _, override, err = clusterspec.ParseNodeOverride(nodeName + ":" + settings); err != nil {
+			return err
+		}
+	}
+
+	lastNode, err := cli.ContainerInspect(ctx, nodes[lastIdx].ID)
+	if err != nil {
+		return err
+	}
+	// the new node gets the VM and the linux settings of the last node, the PCI device assigned to it stays with it
+	lastVM, ok := decodeNodeVM(lastNode.Config.Labels)
+	if !ok {
+		return fmt.Errorf("can't add a node to the cluster %s, %s does not record the VM it was started with, recreate the cluster with a newer gocli", prefix, nodeNameFromIndex(lastIdx))
+	}
+	vm := *lastVM
+	vm.nodeShape = vm.withOverride(override)
+
+	lastConfig, ok := decodeLinuxConfig(lastNode.Config.Labels)
+	if !ok {
+		return fmt.Errorf("can't add a node to the cluster %s, %s does not record the linux settings it was provisioned with, recreate the cluster with a newer gocli", prefix, nodeNameFromIndex(lastIdx))
+	}
+	n := *lastConfig
+	n.NodeIdx = nodeIdx
+	n.GpuAddress = ""
+	for _, conf := range override.LinuxConfigFuncs() {
+		conf(&n)
+	}
+
+	sshPort, err := clusterSSHPort(cli, dnsmasq.ID)
+	if err != nil {
+		return err
+	}
+	joinToken, err := createJoinToken(sshPort)
+	if err != nil {
+		return err
+	}
+	n.JoinToken = joinToken
+
+	// dnsmasq.sh names the taps of the secondary NICs after the node index
+	vmCmd, err := vm.command(nodeIdx-1, "")
+	if err != nil {
+		return err
+	}
+
+	labels := clusterLabels(dnsmasq.Labels[labelClusterID], prefix, roleNode, nodeIdx)
+	if labels[labelLinuxConfig], err = encodeLinuxConfig(&n); err != nil {
+		return err
+	}
+	if labels[labelVM], err = encodeNodeVM(nodeIdx, &vm); err != nil {
+		return err
+	}
+	vmContainerConfig := &container.Config{
+		Image: lastNode.Config.Image,
+		Env: append(append([]string{
+			fmt.Sprintf("NODE_NUM=%02d", nodeIdx),
+		}, nodeAddressEnv(addresses)...), utils.ForwardEnv("PROW_JOB_ID", "CI")...),
+		Cmd:    vmCmd,
+		Labels: labels,
+	}
+	if slices.Contains(lastNode.Config.Env, vmMigratableEnv) {
+		vmContainerConfig.Env = append(vmContainerConfig.Env, vmMigratableEnv)
+	}
+	hostConfig := &container.HostConfig{
+		Privileged:  true,
+		NetworkMode: container.NetworkMode("container:" + dnsmasq.ID),
+	}
+	vmContainerConfig.Volumes, hostConfig.Mounts = vm.volumes(prefix + "-shared")
+
+	if err = _cmd(cli, nodeContainer(prefix, "dnsmasq"), addNodeNetworkScript(addresses), fmt.Sprintf("adding %s to the cluster network", nodeName)); err != nil {
+		return err
+	}
+
+	// a node which failed to join is taken out of the cluster network again, like run removes the cluster it failed to bring up
+	node := ""
+	defer func() {
+		if retErr == nil {
+			return
+		}
+		if node != "" {
+			if err := cli.ContainerRemove(ctx, node, true); err != nil {
+				logrus.WithError(err).Warnf("removing the container of %s failed", nodeName)
+			}
+		}
+		if err := _cmd(cli, nodeContainer(prefix, "dnsmasq"), removeNodeNetworkScript(nodeIdx), fmt.Sprintf("removing %s from the cluster network", nodeName)); err != nil {
+			logrus.WithError(err).Warnf("removing %s from the cluster network failed", nodeName)
+		}
+	}()
+
+	node, err = cli.ContainerCreate(ctx, nodeContainer(prefix, nodeName), vmContainerConfig, hostConfig)
+	if err != nil {
+		return err
+	}
+	if err := cli.ContainerStart(ctx, node); err != nil {
+		return err
+	}
+
+	return bootstrapNode(cli, prefix, sshPort, nodeBootstrap{name: nodeName, rootKeyIdx: nodeIdx, config: &n}, nil, stdOutput)
+}
+
+// createJoinToken creates a bootstrap token on node01 for a new node, the one the kubeadm config of node01
+// creates expires a day after the cluster came up
+func createJoinToken(sshPort uint16) (string, error) {
+	sshClient, err := newSSHClient(sshPort, 1, true)
+	if err != nil {
+		return "", err
+	}
+	out, err := sshClient.CommandWithNoStdOut(joinTokenCommand)
+	if err != nil {
+		return "", fmt.Errorf("creating a join token on node01 failed: %w", err)
+	}
+	token := strings.TrimSpace(out)
+	if !joinTokenRegex.MatchString(token) {
+		return "", fmt.Errorf("creating a join token on node01 failed, %s printed %q", joinTokenCommand, out)
+	}
+	return token, nil
+}
+
+func nodeRemove(cmd *cobra.Command, args []string) error {
+	prefix, err := cmd.Flags().GetString("prefix")
+	if err != nil {
+		return err
+	}
+
+	nodeName := args[0]
+	nodeIdx, err := clusterspec.NodeIndex(nodeName)
+	if err != nil {
+		return err
+	}
+	if nodeIdx == 1 {
+		return fmt.Errorf("node01 runs the control plane and can't be removed")
+	}
+
+	cli, err := newRuntime()
+	if err != nil {
+		return err
+	}
+
+	dnsmasq, nodes, err := clusterContainers(cli, prefix)
+	if err != nil {
+		return err
+	}
+
+	node, ok := nodes[nodeIdx]
+	if !ok {
+		return fmt.Errorf("no container found for %s", nodeName)
+	}
+
+	sshPort, err := clusterSSHPort(cli, dnsmasq.ID)
+	if err != nil {
+		return err
+	}
+
+	sshClient, err := newSSHClient(sshPort, 1, true)
+	if err != nil {
+		return err
+	}
+
+	if err = drainnode.NewDrainNodeOpt(sshClient, nodeName).Exec(); err != nil {
+		return err
+	}
+
+	if err = cli.ContainerRemove(context.Background(), node.ID, true); err != nil {
+		return err
+	}
+
+	return _cmd(cli, nodeContainer(prefix, "dnsmasq"), removeNodeNetworkScript(nodeIdx), fmt.Sprintf("removing %s from the cluster network", nodeName))
+}
+
+// clusterAuxiliaryContainers run along with dnsmasq and the nodes if the cluster was started with them
+var clusterAuxiliaryContainers = []string{"registry", "nfs"}
+
+// clusterContainers returns the dnsmasq container of the cluster and its node containers keyed by node index
+func clusterContainers(cli docker.Runtime, prefix string) (*container.Summary, map[int]container.Summary, error) {
+	containers, err := clusterContainerList(cli, prefix)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var dnsmasq *container.Summary
+	nodes := map[int]container.Summary{}
+	for i, c := range containers {
+		switch role, idx := containerRole(prefix, c); role {
+		case roleDNSMasq:
+			dnsmasq = &containers[i]
+		case roleNode:
+			nodes[idx] = c
+		}
+	}
+
+	if dnsmasq == nil {
+		return nil, nil, fmt.Errorf("no running cluster found, the %s-dnsmasq container does not exist", prefix)
+	}
+	if len(nodes) == 0 {
+		return nil, nil, fmt.Errorf("no node containers found for prefix %s", prefix)
+	}
+	return dnsmasq, nodes, nil
+}
+
+func clusterSSHPort(cli docker.Runtime, dnsmasqID string) (uint16, error) {
+	dm, err := cli.ContainerInspect(context.Background(), dnsmasqID)
+	if err != nil {
+		return 0, err
+	}
+	return utils.GetPublicPort(utils.PortSSH, dm.NetworkSettings.Ports)
+}
+
+// clusterK8sClient returns a client for the API server of the running cluster and the host port it is published on
+func clusterK8sClient(cli docker.Runtime, dnsmasqID string) (k8s.K8sDynamicClient, uint16, error) {
+	dm, err := cli.ContainerInspect(context.Background(), dnsmasqID)
+	if err != nil {
+		return nil, 0, err
+	}
+	sshPort, err := utils.GetPublicPort(utils.PortSSH, dm.NetworkSettings.Ports)
+	if err != nil {
+		return nil, 0, err
+	}
+	apiServerPort, err := utils.GetPublicPort(utils.PortAPI, dm.NetworkSettings.Ports)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sshClient, err := newSSHClient(sshPort, 1, true)
+	if err != nil {
+		return nil, 0, err
+	}
+	k8sClient, err := nodeK8sClient(sshClient, apiServerPort)
+	if err != nil {
+		return nil, 0, err
+	}
+	return k8sClient, apiServerPort, nil
+}
+
+// nodeK8sClient returns a client for the API server published on apiServerPort with the admin kubeconfig of
+// the control plane node sshClient is connected to. The kubeconfig only lives in a temporary file
+func nodeK8sClient(sshClient libssh.Client, apiServerPort uint16) (k8s.K8sDynamicClient, error) {
+	kubeconfig, err := os.CreateTemp("", "kubeconfig")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(kubeconfig.Name())
+	err = sshClient.CopyRemoteFile(adminKubeconfig, kubeconfig)
+	kubeconfig.Close()
+	if err != nil {
+		return nil, err
+	}
+	return newK8sClient(kubeconfig.Name(), apiServerPort)
+}
+
+// nodeAddressEnv passes the addresses of a node to vm.sh
+func nodeAddressEnv(n ipam.Node) []string {
+	return []string{
+		fmt.Sprintf("NODE_IP=%s", n.IPv4),
+		fmt.Sprintf("NODE_MAC=%s", n.MAC),
+		fmt.Sprintf("NODE_SRIOV_MAC=%s", n.SRIOVMAC),
+	}
+}
+
+// addNodeNetworkScript creates the tap devices of a node in the dnsmasq container and
+// registers its static address the same way dnsmasq.sh does for the initial nodes
+func addNodeNetworkScript(node ipam.Node) string {
+	lines := []string{
+		"set -e",
+		`tr '\0' ' ' < /proc/$(pidof dnsmasq)/cmdline | grep -q -- --dhcp-hostsfile || { echo "the dnsmasq of the cluster does not support adding nodes, recreate the cluster with a newer image" >&2; exit 1; }`,
+	}
+	lines = append(lines, nodeTapCommands(node.Index)...)
+	lines = append(lines,
+		fmt.Sprintf("echo '%s' >> %s", node.DHCPHost(), dhcpHostsFile),
+		"pkill -HUP dnsmasq",
+	)
+	return strings.Join(lines, "\n")
+}
+
+// nodeTapCommands create the tap devices the VM of a node connects to the cluster networks with. The number
+// of secondary NICs is taken from the environment of the dnsmasq container like dnsmasq.sh does
+func nodeTapCommands(nodeIdx int) []string {
+	n := fmt.Sprintf("%02d", nodeIdx)
+	return []string{
+		fmt.Sprintf("ip tuntap add dev tap%s mode tap user $(whoami)", n),
+		fmt.Sprintf("ip link set tap%s master br0", n),
+		fmt.Sprintf("ip link set dev tap%s up", n),
+		fmt.Sprintf("ip tuntap add dev tap-sriov%s mode tap user $(whoami)", n),
+		fmt.Sprintf("ip link set tap-sriov%s master br-sriov", n),
+		fmt.Sprintf("ip link set dev tap-sriov%s up", n),
+		fmt.Sprintf("for s in $(seq 1 ${NUM_SECONDARY_NICS:-0}); do ip tuntap add dev stap%d-$((s - 1)) mode tap user $(whoami); ip link set stap%d-$((s - 1)) master br${s}; ip link set dev stap%d-$((s - 1)) up; done", nodeIdx-1, nodeIdx-1, nodeIdx-1),
+	}
+}
+
+// removeNodeNetworkScript reverts addNodeNetworkScript, it is also safe for the initial nodes
+func removeNodeNetworkScript(nodeIdx int) string {
+	n := fmt.Sprintf("%02d", nodeIdx)
+	return strings.Join([]string{
+		fmt.Sprintf("ip link del tap%s || true", n),
+		fmt.Sprintf("ip link del tap-sriov%s || true", n),
+		fmt.Sprintf("for s in $(seq 1 ${NUM_SECONDARY_NICS:-0}); do ip link del stap%d-$((s - 1)) || true; done", nodeIdx-1),
+		fmt.Sprintf("sed -i '/,node%s,/d' %s || true", n, dhcpHostsFile),
+		"pkill -HUP dnsmasq",
+	}, "\n")
+}
+
+// restoreNodeNetworkScript recreates the tap devices of the nodes which were added to the running cluster once
+// dnsmasq.sh is done with the initial nodes, e.g. after dnsmasq was restarted. Their static leases are kept in
+// the hosts file of the dnsmasq container
+func restoreNodeNetworkScript(nodeIdxs []int) string {
+	lines := []string{
+		"set -e",
+		"for i in $(seq 1 300); do pidof dnsmasq >/dev/null && break; sleep 0.1; done",
+		"pidof dnsmasq >/dev/null",
+	}
+	for _, idx := range nodeIdxs {
+		lines = append(lines, fmt.Sprintf("if ! ip link show tap%02d >/dev/null 2>&1; then", idx))
+		for _, c := range nodeTapCommands(idx) {
+			lines = append(lines, "  "+c)
+		}
+		lines = append(lines, "fi")
+	}
+	return strings.Join(lines, "\n")
+}
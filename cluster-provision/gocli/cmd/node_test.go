@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"io"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/rookceph"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/ipam"
+	k8s "kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/k8s"
+	kubevirtcimocks "kubevirt.io/kubevirtci/cluster-provision/gocli/utils/mock"
+)
+
+// expectJoinToken lets kubeadm on the control plane create the join token of added nodes
+func expectJoinToken(sshClient *kubevirtcimocks.MockSSHClient) {
+	sshClient.EXPECT().CommandWithNoStdOut(gomock.Any()).DoAndReturn(func(cmd string) (string, error) {
+		if cmd == joinTokenCommand {
+			return "abcdef.0123456789abcdef\n", nil
+		}
+		return "", nil
+	}).AnyTimes()
+}
+
+var _ = Describe("Node", func() {
+	Describe("labelVM", func() {
+		It("should record the VM of a node", func() {
+			vm := &nodeVM{
+				nodeShape:     nodeShape{Memory: "8G", CPU: 6, NUMA: 2, NVMeDisks: []string{"10G"}, Hugepages1G: 2},
+				QemuArgs:      "-smbios type=1",
+				SecondaryNICs: 2,
+				SharedDisks:   []string{"1G"},
+				Ceph:          true,
+			}
+			encoded, err := encodeNodeVM(2, vm)
+			Expect(err).NotTo(HaveOccurred())
+
+			decoded, ok := decodeNodeVM(map[string]string{labelVM: encoded})
+			Expect(ok).To(BeTrue())
+			Expect(decoded).To(Equal(vm))
+		})
+	})
+
+	Describe("diskArgs", func() {
+		It("should attach the disks in the order vm.sh creates them", func() {
+			shape := nodeShape{NVMeDisks: []string{"1G"}, SCSIDisks: []string{"2G"}, USBDisks: []string{"3G"}}
+			qemuArgs, vmArgs := shape.diskArgs("")
+			Expect(qemuArgs).To(ContainSubstring("-device nvme,drive=NVME0,serial=nvme-0"))
+			Expect(qemuArgs).To(ContainSubstring("scsi-hd,drive=drive0"))
+			Expect(qemuArgs).To(ContainSubstring("usb-storage,bus=bus0.0,drive=stick0"))
+			Expect(vmArgs).To(Equal([]string{"--scsi-device-size 2G", "--nvme-device-size 1G", " --usb-device-size 3G"}))
+		})
+	})
+
+	Describe("addNodeNetworkScript", func() {
+		It("should register the static address of the node", func() {
+			node, err := ipam.NodeAddresses(4)
+			Expect(err).NotTo(HaveOccurred())
+			script := addNodeNetworkScript(node)
+			Expect(script).To(ContainSubstring("ip tuntap add dev tap04 mode tap"))
+			Expect(script).To(ContainSubstring("52:55:00:d1:55:04,192.168.66.104,[fd00::104],node04,infinite"))
+			Expect(removeNodeNetworkScript(4)).To(ContainSubstring("/,node04,/d"))
+		})
+	})
+
+	Describe("add", func() {
+		var (
+			runtime  *docker.FakeRuntime
+			commands []string
+		)
+
+		BeforeEach(func() {
+			runtime = docker.NewFakeRuntime()
+			commands = nil
+			sshClient := setupFakeCluster(runtime, nil)
+			sshClient.EXPECT().Command(gomock.Any()).Do(func(cmd string) { commands = append(commands, cmd) }).AnyTimes()
+			expectJoinToken(sshClient)
+		})
+
+		It("should join the node with a new token and the linux settings of the cluster", func() {
+			Expect(gocli("run", "k8s-1.30", "--nodes", "2", "--enable-fips", "--enable-ksm", "--background")).Error().To(Succeed())
+			commands = nil
+
+			Expect(gocli("node", "add", "--set", "realtime=true")).Error().To(Succeed())
+			node03, _ := runtime.Container("k8s-1.30-node03")
+			Expect(strings.Join(node03.Config.Cmd, " ")).To(ContainSubstring("fips=1"))
+			Expect(commands).To(ContainElements(
+				"sudo fips-mode-setup --enable",
+				"kubeadm join --token abcdef.0123456789abcdef 192.168.66.101:6443 --ignore-preflight-errors=all --discovery-token-unsafe-skip-ca-verification=true",
+			))
+
+			n, ok := decodeLinuxConfig(node03.Config.Labels)
+			Expect(ok).To(BeTrue())
+			Expect(n.NodeIdx).To(Equal(3))
+			Expect(n.FipsEnabled).To(BeTrue())
+			Expect(n.KsmEnabled).To(BeTrue())
+			Expect(n.Realtime).To(BeTrue())
+			Expect(n.JoinToken).To(BeEmpty())
+		})
+
+		It("should start the VM of the node like the one of the node it copies", func() {
+			expectJoinToken(setupFakeCluster(runtime, k8s.NewTestClient(k8s.NewReactorConfig("create", "cephblockpools", rookceph.CephReactor))))
+			Expect(gocli("run", "k8s-1.30", "--nodes", "2", "--background", "--cpu", "4", "--numa", "2", "--secondary-nics", "2",
+				"--usb", "1G", "--nvme", "2G", "--shared-block-device", "3G", "--qemu-args", "-smbios type=1", "--kernel-args", "quiet",
+				"--enable-ceph", "--allow-snapshots")).Error().To(Succeed())
+			Expect(gocli("node", "add")).Error().To(Succeed())
+
+			node02, _ := runtime.Container("k8s-1.30-node02")
+			node03, _ := runtime.Container("k8s-1.30-node03")
+			// the secondary NICs of the new node get their own taps and MACs
+			replacements := []string{"net1-", "net2-", "stap1-", "stap2-"}
+			for i := range 2 {
+				copied, err := ipam.SecondaryNICMAC(2 + i)
+				Expect(err).NotTo(HaveOccurred())
+				added, err := ipam.SecondaryNICMAC(4 + i)
+				Expect(err).NotTo(HaveOccurred())
+				replacements = append(replacements, copied.String(), added.String())
+			}
+			Expect(node03.Config.Cmd[2]).To(Equal(strings.NewReplacer(replacements...).Replace(node02.Config.Cmd[2])))
+			Expect(node03.Config.Cmd[2]).To(ContainSubstring("--block-device-size"))
+			Expect(node03.Config.Volumes).To(Equal(node02.Config.Volumes))
+			Expect(node03.HostConfig.Mounts).To(Equal(node02.HostConfig.Mounts))
+			Expect(node03.Config.Env).To(ContainElement(vmMigratableEnv))
+
+			By("creating the taps of the secondary NICs in the dnsmasq container")
+			node, err := ipam.NodeAddresses(3)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(runtime.Execs).To(ContainElement(docker.FakeExec{
+				Container: "k8s-1.30-dnsmasq",
+				Cmd:       []string{"/bin/bash", "-c", addNodeNetworkScript(node)},
+			}))
+			Expect(addNodeNetworkScript(node)).To(ContainSubstring("ip link set stap2-$((s - 1)) master br${s}"))
+		})
+
+		It("should refuse clusters whose nodes do not record their VM", func() {
+			Expect(gocli("run", "k8s-1.30", "--nodes", "2", "--background")).Error().To(Succeed())
+			node02, _ := runtime.Container("k8s-1.30-node02")
+			delete(node02.Config.Labels, labelVM)
+
+			_, err := gocli("node", "add")
+			Expect(err).To(MatchError(ContainSubstring("node02 does not record the VM it was started with")))
+		})
+
+		It("should refuse clusters whose nodes do not record their linux settings", func() {
+			Expect(gocli("run", "k8s-1.30", "--nodes", "2", "--background")).Error().To(Succeed())
+			node02, _ := runtime.Container("k8s-1.30-node02")
+			delete(node02.Config.Labels, labelLinuxConfig)
+
+			_, err := gocli("node", "add")
+			Expect(err).To(MatchError(ContainSubstring("node02 does not record the linux settings it was provisioned with")))
+			_, ok := runtime.Container("k8s-1.30-node03")
+			Expect(ok).To(BeFalse())
+		})
+
+		It("should take the node out of the cluster network if it fails to come up", func() {
+			Expect(gocli("run", "k8s-1.30", "--nodes", "2", "--background")).Error().To(Succeed())
+			runtime.ExecHandler = func(c *docker.FakeContainer, cmd []string, _ io.Writer) int {
+				if c.Name == "k8s-1.30-node03" && strings.Contains(strings.Join(cmd, " "), "/ssh_ready") {
+					return 1
+				}
+				return 0
+			}
+
+			_, err := gocli("node", "add")
+			Expect(err).To(MatchError("checking for ssh.sh script for node node03 failed"))
+			_, ok := runtime.Container("k8s-1.30-node03")
+			Expect(ok).To(BeFalse())
+			Expect(runtime.Execs).To(ContainElement(docker.FakeExec{
+				Container: "k8s-1.30-dnsmasq",
+				Cmd:       []string{"/bin/bash", "-c", removeNodeNetworkScript(3)},
+			}))
+		})
+	})
+})
@@ -26,6 +26,8 @@ type NodeLinuxConfig struct {
 	VsockChildNsMode      string
 	TopologyManagerPolicy string
 	ReservedSystemCPUs    string
+	// JoinToken is only valid for a while, it is not kept along with the other settings
+	JoinToken string `json:"-"`
 }
 
 // NodeK8sConfig type holds the config k8s options for kubevirt cluster
@@ -45,6 +47,8 @@ type NodeK8sConfig struct {
 	AAQVersion               string
 	DNC                      bool
 	NetworkResourcesInjector bool
+	// Images replaces the images the opts deploy, run --offline deploys the images pinned by digest by their digest tags
+	Images map[string]string
 }
 
 func NewNodeK8sConfig(confs []K8sConfigFunc) *NodeK8sConfig {
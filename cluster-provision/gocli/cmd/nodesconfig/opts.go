@@ -154,6 +154,12 @@ func WithReservedSystemCPUs(cpuset string) LinuxConfigFunc {
 	}
 }
 
+func WithJoinToken(joinToken string) LinuxConfigFunc {
+	return func(n *NodeLinuxConfig) {
+		n.JoinToken = joinToken
+	}
+}
+
 func WithCeph(ceph bool) K8sConfigFunc {
 	return func(n *NodeK8sConfig) {
 		n.Ceph = ceph
@@ -0,0 +1,280 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/docker/docker/api/types/mount"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/cmd/clusterspec"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/cmd/nodesconfig"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/ipam"
+)
+
+// nodeShape holds the virtual hardware a node VM is started with
+type nodeShape struct {
+	Memory      string   `json:"memory"`
+	CPU         uint     `json:"cpu"`
+	NUMA        uint     `json:"numa"`
+	NVMeDisks   []string `json:"nvme,omitempty"`
+	SCSIDisks   []string `json:"scsi,omitempty"`
+	USBDisks    []string `json:"usb,omitempty"`
+	Hugepages2M uint     `json:"hugepages2M,omitempty"`
+	Hugepages1G uint     `json:"hugepages1G,omitempty"`
+}
+
+// withOverride returns a copy of the shape with the node specific settings applied.
+// Disks of an override replace the cluster wide disks of the same type
+func (s nodeShape) withOverride(o *clusterspec.NodeOverride) nodeShape {
+	if o == nil {
+		return s
+	}
+	if o.Memory != nil {
+		s.Memory = *o.Memory
+	}
+	if o.CPU != nil {
+		s.CPU = *o.CPU
+	}
+	if o.Numa != nil {
+		s.NUMA = *o.Numa
+	}
+	if len(o.NVMe) > 0 {
+		s.NVMeDisks = o.NVMe
+	}
+	if len(o.SCSI) > 0 {
+		s.SCSIDisks = o.SCSI
+	}
+	if len(o.USB) > 0 {
+		s.USBDisks = o.USB
+	}
+	if o.Hugepages2M != nil {
+		s.Hugepages2M = *o.Hugepages2M
+	}
+	if o.Hugepages1G != nil {
+		s.Hugepages1G = *o.Hugepages1G
+	}
+	return s
+}
+
+// parseNodeOverrides parses all --node-override values, keyed by node index
+func parseNodeOverrides(values []string, nodes uint) (map[int]*clusterspec.NodeOverride, error) {
+	overrides := map[int]*clusterspec.NodeOverride{}
+	for _, value := range values {
+		nodeIdx, o, err := clusterspec.ParseNodeOverride(value)
+		if err != nil {
+			return nil, err
+		}
+		if nodeIdx > int(nodes) {
+			return nil, fmt.Errorf("node override %q targets %s but the cluster has only %d nodes", value, nodeNameFromIndex(nodeIdx), nodes)
+		}
+		if existing, ok := overrides[nodeIdx]; ok {
+			existing.Merge(o)
+			continue
+		}
+		overrides[nodeIdx] = o
+	}
+	return overrides, nil
+}
+
+// nodeLinuxConfigFuncs appends the node specific linux settings to the cluster wide ones
+func nodeLinuxConfigFuncs(clusterFuncs []nodesconfig.LinuxConfigFunc, o *clusterspec.NodeOverride) []nodesconfig.LinuxConfigFunc {
+	funcs := append([]nodesconfig.LinuxConfigFunc{}, clusterFuncs...)
+	if o != nil {
+		funcs = append(funcs, o.LinuxConfigFuncs()...)
+	}
+	return funcs
+}
+
+// diskArgs returns the qemu arguments attaching the disks of the shape and the vm.sh arguments creating them
+func (s nodeShape) diskArgs(pcieBus string) (string, []string) {
+	qemuArgs := ""
+	var vmArgsNvmeDisks []string
+	for i, size := range s.NVMeDisks {
+		resource.MustParse(size)
+		disk := fmt.Sprintf("%s-%d.img", nvmeDiskImagePrefix, i)
+		qemuArgs = fmt.Sprintf("%s -drive file=%s,format=raw,id=NVME%d,if=none -device nvme,drive=NVME%d,serial=nvme-%d%s", qemuArgs, disk, i, i, i, pcieBus)
+		vmArgsNvmeDisks = append(vmArgsNvmeDisks, fmt.Sprintf("--nvme-device-size %s", size))
+	}
+
+	var vmArgsSCSIDisks []string
+	if len(s.SCSIDisks) > 0 {
+		qemuArgs = fmt.Sprintf("%s -device virtio-scsi-pci,id=scsi0%s", qemuArgs, pcieBus)
+		for i, size := range s.SCSIDisks {
+			resource.MustParse(size)
+			disk := fmt.Sprintf("%s-%d.img", scsiDiskImagePrefix, i)
+			qemuArgs = fmt.Sprintf("%s -drive file=%s,if=none,id=drive%d -device scsi-hd,drive=drive%d,bus=scsi0.0,channel=0,scsi-id=0,lun=%d", qemuArgs, disk, i, i, i)
+			vmArgsSCSIDisks = append(vmArgsSCSIDisks, fmt.Sprintf("--scsi-device-size %s", size))
+		}
+	}
+
+	var vmArgsUSBDisks []string
+	bus := " -device qemu-xhci,id=bus%d" + pcieBus
+	const drive = " -drive if=none,id=stick%d,format=raw,file=/usb-%d.img"
+	const dev = " -device usb-storage,bus=bus%d.0,drive=stick%d"
+	const usbSizefmt = " --usb-device-size %s"
+	for i, size := range s.USBDisks {
+		resource.MustParse(size)
+		if i%2 == 0 {
+			qemuArgs += fmt.Sprintf(bus, i/2)
+		}
+		qemuArgs += fmt.Sprintf(drive, i, i)
+		qemuArgs += fmt.Sprintf(dev, i/2, i)
+		vmArgsUSBDisks = append(vmArgsUSBDisks, fmt.Sprintf(usbSizefmt, size))
+	}
+
+	vmArgs := append(append(vmArgsSCSIDisks, vmArgsNvmeDisks...), vmArgsUSBDisks...)
+	return qemuArgs, vmArgs
+}
+
+// kernelArgs returns the kernel arguments reserving the hugepages of the shape
+func (s nodeShape) kernelArgs() string {
+	args := ""
+	if s.Hugepages2M > 0 {
+		args += fmt.Sprintf(" hugepagesz=2M hugepages=%d", s.Hugepages2M)
+	}
+	if s.Hugepages1G > 0 {
+		args += fmt.Sprintf(" hugepagesz=1G hugepages=%d", s.Hugepages1G)
+	}
+	return args
+}
+
+// vmCommand returns the command a node container starts the VM of the shape with
+func (s nodeShape) vmCommand(args ...string) []string {
+	return []string{"/bin/bash", "-c", fmt.Sprintf("/vm.sh -n /var/run/disk/disk.qcow2 --memory %s --cpu %s --numa %s %s",
+		s.Memory,
+		strconv.Itoa(int(s.CPU)),
+		strconv.Itoa(int(s.NUMA)),
+		strings.Join(args, " "),
+	)}
+}
+
+// nodeVM holds everything the VM of a node is started with. run records it on the node containers, node add
+// starts new nodes with the one of the last node
+type nodeVM struct {
+	nodeShape
+	// QemuArgs and KernelArgs are the ones of the whole cluster, the shape and the devices add their own
+	QemuArgs      string   `json:"qemuArgs,omitempty"`
+	KernelArgs    string   `json:"kernelArgs,omitempty"`
+	SecondaryNICs uint     `json:"secondaryNICs,omitempty"`
+	SharedDisks   []string `json:"sharedDisks,omitempty"`
+	Ceph          bool     `json:"ceph,omitempty"`
+	Fips          bool     `json:"fips,omitempty"`
+}
+
+// command returns the command a node container starts the VM with. netIdx names the taps of the secondary NICs
+// and picks their MACs, deviceQemuArgs attach the devices which stay with the node, e.g. an assigned GPU
+func (vm nodeVM) command(netIdx int, deviceQemuArgs string) ([]string, error) {
+	qemuNetDevice := getNetDeviceByArch()
+	pcieBus := ""
+	if qemuNetDevice != QEMU_DEVICE_S390X {
+		pcieBus = ",bus=pcie.0"
+	}
+	numaNodes := int(vm.NUMA)
+
+	qemuArgs := vm.QemuArgs
+	qemuMonitorArgs := ""
+	for i := 0; i < int(vm.SecondaryNICs); i++ {
+		netSuffix := fmt.Sprintf("%d-%d", netIdx, i)
+		mac, err := ipam.SecondaryNICMAC(netIdx*int(vm.SecondaryNICs) + i)
+		if err != nil {
+			return nil, err
+		}
+		// Secondary network devices are added after VM is started (hot-plug) using qemu monitor to avoid
+		// primary network interface to be named other than eth0. This is mainly required for s390x, as
+		// otherwise if primary interface is other than eth0, it can't get the IP from dhcp server.
+		if qemuNetDevice == QEMU_DEVICE_S390X {
+			qemuMonitorArgs = fmt.Sprintf("%s netdev_add tap,id=secondarynet%s,ifname=stap%s,script=no,downscript=no; device_add %s,netdev=secondarynet%s,mac=%s;", qemuMonitorArgs, netSuffix, netSuffix, qemuNetDevice, netSuffix, mac)
+		} else { //devices like virtio-net-pci doesn't support hot-plug
+			rootPortArgs := ""
+			bus := "pcie.0"
+			if numaNodes > 1 {
+				numaNode := i % numaNodes
+				bus = fmt.Sprintf("secondaryrp%d", i)
+				slot := secondaryNicRootPortBaseSlot + i/numaNodes
+				rootPortArgs = fmt.Sprintf(" -device pcie-root-port,id=%s,slot=%d,chassis=%d,bus=secondarypxb%d",
+					bus,
+					slot,
+					secondaryNicRootPortBaseChass+i,
+					numaNode)
+			}
+			qemuArgs = fmt.Sprintf("%s%s -device %s,netdev=secondarynet%s,mac=%s,bus=%s -netdev tap,id=secondarynet%s,ifname=stap%s,script=no,downscript=no",
+				qemuArgs,
+				rootPortArgs,
+				qemuNetDevice,
+				netSuffix,
+				mac,
+				bus,
+				netSuffix,
+				netSuffix)
+		}
+	}
+	qemuArgs += deviceQemuArgs
+
+	diskQemuArgs, vmArgsDisks := vm.diskArgs(pcieBus)
+	qemuArgs += diskQemuArgs
+
+	var vmArgsSharedDisks []string
+	for i, size := range vm.SharedDisks {
+		pciOffset := i + 1
+		resource.MustParse(size)
+		disk := fmt.Sprintf("/shared/disk%d.img", i)
+		blockDev := fmt.Sprintf("-blockdev file,filename=%s,node-name=shared-disk-%d,read-only=off,cache.direct=on,cache.no-flush=off", disk, i)
+		device1 := fmt.Sprintf("-device pcie-root-port,id=pci.%d,bus=pcie.0", pciOffset)
+		device2 := fmt.Sprintf("-device virtio-blk-pci,bus=pci.%d,drive=shared-disk-%d,id=shared-disk-%d,share-rw=on,write-cache=on,werror=stop,rerror=stop", pciOffset, i, i)
+		qemuArgs = fmt.Sprintf("%s %s %s %s", qemuArgs, blockDev, device1, device2)
+		vmArgsSharedDisks = append(vmArgsSharedDisks, fmt.Sprintf("--shared-device-size %s", size))
+	}
+
+	additionalArgs := []string{}
+	if len(qemuArgs) > 0 {
+		additionalArgs = append(additionalArgs, "--qemu-args", shellescape.Quote(qemuArgs))
+	}
+	if len(qemuMonitorArgs) > 0 {
+		additionalArgs = append(additionalArgs, "--qemu-monitor-args", shellescape.Quote(qemuMonitorArgs))
+	}
+
+	kernelArgs := vm.KernelArgs + vm.kernelArgs()
+	if vm.Fips {
+		kernelArgs += " fips=1"
+	}
+	if kernelArgs = strings.TrimSpace(kernelArgs); kernelArgs != "" {
+		additionalArgs = append(additionalArgs, "--additional-kernel-args", shellescape.Quote(kernelArgs))
+	}
+
+	blockDev := ""
+	if vm.Ceph {
+		blockDev = "--block-device /var/run/disk/blockdev.qcow2 --block-device-size 32212254720"
+	}
+
+	return vm.vmCommand(
+		blockDev,
+		strings.Join(vmArgsDisks, " "),
+		strings.Join(vmArgsSharedDisks, " "),
+		strings.Join(additionalArgs, " "),
+	), nil
+}
+
+// volumes returns the volumes of the node container, the anonymous one Ceph keeps its OSDs in and the mount of
+// the volume the nodes share their disks in
+func (vm nodeVM) volumes(sharedVolume string) (map[string]struct{}, []mount.Mount) {
+	volumes := map[string]struct{}{}
+	var mounts []mount.Mount
+	if vm.Ceph {
+		volumes["/var/lib/rook"] = struct{}{}
+	}
+	if len(vm.SharedDisks) > 0 {
+		volumes["/shared"] = struct{}{}
+		mounts = append(mounts, mount.Mount{
+			Type:   mount.TypeVolume,
+			Source: sharedVolume,
+			Target: "/shared",
+		})
+	}
+	if len(volumes) == 0 {
+		return nil, nil
+	}
+	return volumes, mounts
+}
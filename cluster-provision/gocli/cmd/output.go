@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/events"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// emitter receives the provisioning events of the running invocation of run or provision
+var emitter = events.Discard()
+
+// setupOutput configures the format selected with --output for one invocation of run or provision and returns
+// the emitter of its events. With json the events are the only thing written to the stdout of the command,
+// all other output goes to its stderr. resetOutput restores the defaults once the command is done
+func setupOutput(cmd *cobra.Command) (events.Emitter, error) {
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return nil, err
+	}
+
+	switch output {
+	case outputText:
+		stdOutput = nodeOutput{stdout: cmd.OutOrStdout(), stderr: cmd.ErrOrStderr()}
+		return events.Discard(), nil
+	case outputJSON:
+		stdOutput = nodeOutput{stdout: cmd.ErrOrStderr(), stderr: cmd.ErrOrStderr()}
+		return events.NewJSONEmitter(cmd.OutOrStdout()), nil
+	default:
+		return nil, fmt.Errorf("unsupported output %q, possible values: %s, %s", output, outputText, outputJSON)
+	}
+}
+
+// resetOutput drops the emitter and the writers of the last invocation of run or provision
+func resetOutput() {
+	emitter = events.Discard()
+	stdOutput = nodeOutput{stdout: os.Stdout, stderr: os.Stderr}
+}
@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/cmd/nodesconfig"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/rootkey"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/events"
+)
+
+// outputMutex serializes the lines written by concurrently provisioned nodes
+var outputMutex sync.Mutex
+
+// nodeOutput holds the writers the output of a single node is sent to
+type nodeOutput struct {
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// stdOutput is where run and provision write to, see setupOutput
+var stdOutput = nodeOutput{stdout: os.Stdout, stderr: os.Stderr}
+
+// newNodeOutput prefixes every line of the node output with the node name
+func newNodeOutput(nodeName string) nodeOutput {
+	prefix := fmt.Sprintf("[%s] ", nodeName)
+	return nodeOutput{
+		stdout: newPrefixWriter(stdOutput.stdout, prefix),
+		stderr: newPrefixWriter(stdOutput.stderr, prefix),
+	}
+}
+
+// prefixWriter buffers partial lines and writes complete lines with a prefix,
+// so lines of different nodes are never interleaved
+type prefixWriter struct {
+	out    io.Writer
+	prefix []byte
+	mu     sync.Mutex
+	buf    []byte
+}
+
+func newPrefixWriter(out io.Writer, prefix string) *prefixWriter {
+	return &prefixWriter{out: out, prefix: []byte(prefix)}
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := w.writeLine(w.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush writes out a trailing line which was not terminated by a newline
+func (w *prefixWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) == 0 {
+		return nil
+	}
+	err := w.writeLine(append(w.buf, '\n'))
+	w.buf = nil
+	return err
+}
+
+func (w *prefixWriter) writeLine(line []byte) error {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+
+	_, err := w.out.Write(append(append([]byte{}, w.prefix...), line...))
+	return err
+}
+
+// joinGate holds back the kubeadm join of the worker nodes until node01 ran kubeadm init
+type joinGate struct {
+	ctx         context.Context
+	once        sync.Once
+	initialized chan struct{}
+	err         error
+}
+
+func newJoinGate(ctx context.Context) *joinGate {
+	return &joinGate{ctx: ctx, initialized: make(chan struct{})}
+}
+
+// release unblocks all waiting workers, a non nil err makes them fail instead of joining.
+// Only the first call has an effect
+func (g *joinGate) release(err error) {
+	g.once.Do(func() {
+		g.err = err
+		close(g.initialized)
+	})
+}
+
+func (g *joinGate) wait() error {
+	select {
+	case <-g.initialized:
+		if g.err != nil {
+			return fmt.Errorf("control plane initialization failed: %w", g.err)
+		}
+		return nil
+	case <-g.ctx.Done():
+		return g.ctx.Err()
+	}
+}
+
+// initOpt releases the gate once the wrapped control plane opt finished. A nil gate returns the opt unchanged
+func (g *joinGate) initOpt(o opts.Opt) opts.Opt {
+	if g == nil {
+		return o
+	}
+	return &gatedOpt{opt: o, exec: func() error {
+		err := o.Exec()
+		g.release(err)
+		return err
+	}}
+}
+
+// joinOpt makes the wrapped worker opt wait for the gate. A nil gate returns the opt unchanged
+func (g *joinGate) joinOpt(o opts.Opt) opts.Opt {
+	if g == nil {
+		return o
+	}
+	return &gatedOpt{opt: o, exec: func() error {
+		if err := g.wait(); err != nil {
+			return err
+		}
+		return o.Exec()
+	}}
+}
+
+// gatedOpt runs an opt ordered by a joinGate, events report it under the name of the wrapped opt
+type gatedOpt struct {
+	opt  opts.Opt
+	exec func() error
+}
+
+func (g *gatedOpt) Exec() error {
+	return g.exec()
+}
+
+func (g *gatedOpt) Name() string {
+	return events.OptName(g.opt)
+}
+
+// nodeBootstrap holds what is needed to bring up a node once its container is started
+type nodeBootstrap struct {
+	name string
+	// rootKeyIdx is the node index used to configure root access
+	rootKeyIdx int
+	config     *nodesconfig.NodeLinuxConfig
+}
+
+// bootstrapNode waits for the VM of a started node container, configures root access and provisions the node
+func bootstrapNode(cli docker.Runtime, prefix string, sshPort uint16, b nodeBootstrap, gate *joinGate, out nodeOutput) error {
+	err := events.Phase(emitter, b.config.NodeIdx, "boot", func() error {
+		// Wait for vm start
+		success, err := docker.Exec(cli, nodeContainer(prefix, b.name), []string{"/bin/bash", "-c", "while [ ! -f /ssh_ready ] ; do sleep 1; done"}, out.stdout)
+		if err != nil {
+			return err
+		}
+
+		if !success {
+			return fmt.Errorf("checking for ssh.sh script for node %s failed", b.name)
+		}
+
+		return waitForVMToBeUp(cli, prefix, b.name, out)
+	})
+	if err != nil {
+		return err
+	}
+
+	sshClient, err := newSSHClient(sshPort, b.rootKeyIdx, false)
+	if err != nil {
+		return err
+	}
+	sshClient.SetOutput(out.stdout, out.stderr)
+
+	rootkey := events.WrapOpt(emitter, b.config.NodeIdx, rootkey.NewRootKey(events.WrapSSHClient(emitter, b.config.NodeIdx, sshClient)))
+	if err = rootkey.Exec(); err != nil {
+		return err
+	}
+
+	rootClient, err := newSSHClient(sshPort, b.config.NodeIdx, true)
+	if err != nil {
+		return err
+	}
+	rootClient.SetOutput(out.stdout, out.stderr)
+
+	return events.Phase(emitter, b.config.NodeIdx, "provision", func() error {
+		return provisionNodeWithGate(cli, rootClient, b.config, gate, out)
+	})
+}
+
+// bootstrapNodesConcurrently brings up at most parallelism nodes at once. The linux opts of all nodes run
+// concurrently, the kubeadm join of the workers is ordered after the kubeadm init of node01
+func bootstrapNodesConcurrently(ctx context.Context, cli docker.Runtime, prefix string, sshPort uint16, nodes []nodeBootstrap, parallelism int) error {
+	// node01 has to be scheduled first, otherwise the workers may take all slots waiting for it
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].config.NodeIdx == 1 && nodes[j].config.NodeIdx != 1
+	})
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(parallelism)
+	gate := newJoinGate(ctx)
+
+	for _, b := range nodes {
+		g.Go(func() error {
+			out := newNodeOutput(b.name)
+			err := bootstrapNode(cli, prefix, sshPort, b, gate, out)
+			flushNodeOutput(out)
+			if b.config.NodeIdx == 1 {
+				gate.release(err)
+			}
+			if err != nil {
+				return fmt.Errorf("provisioning %s failed: %w", b.name, err)
+			}
+			return nil
+		})
+	}
+
+	return g.Wait()
+}
+
+func flushNodeOutput(out nodeOutput) {
+	for _, w := range []io.Writer{out.stdout, out.stderr} {
+		if pw, ok := w.(*prefixWriter); ok {
+			_ = pw.Flush()
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Parallel provisioning", func() {
+	Describe("prefixWriter", func() {
+		It("should prefix complete lines only", func() {
+			out := &bytes.Buffer{}
+			w := newPrefixWriter(out, "[node02] ")
+
+			_, err := w.Write([]byte("first\nsec"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out.String()).To(Equal("[node02] first\n"))
+
+			_, err = w.Write([]byte("ond\nthird"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(w.Flush()).To(Succeed())
+			Expect(out.String()).To(Equal("[node02] first\n[node02] second\n[node02] third\n"))
+		})
+	})
+
+	Describe("joinGate", func() {
+		It("should hold back the join until the control plane is initialized", func() {
+			gate := newJoinGate(context.Background())
+			order := make(chan string, 2)
+
+			join := gate.joinOpt(optFunc(func() error {
+				order <- "join"
+				return nil
+			}))
+			done := make(chan error)
+			go func() { done <- join.Exec() }()
+
+			Consistently(done).ShouldNot(Receive())
+
+			initOpt := gate.initOpt(optFunc(func() error {
+				order <- "init"
+				return nil
+			}))
+			Expect(initOpt.Exec()).To(Succeed())
+			Eventually(done).Should(Receive(BeNil()))
+			Expect(<-order).To(Equal("init"))
+			Expect(<-order).To(Equal("join"))
+		})
+
+		It("should fail the join when the control plane failed", func() {
+			gate := newJoinGate(context.Background())
+			gate.release(fmt.Errorf("kubeadm init failed"))
+
+			join := gate.joinOpt(optFunc(func() error {
+				Fail("join should not run")
+				return nil
+			}))
+			Expect(join.Exec()).To(MatchError(ContainSubstring("kubeadm init failed")))
+		})
+
+		It("should stop waiting when the context is canceled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			gate := newJoinGate(ctx)
+			cancel()
+			Expect(gate.wait()).To(MatchError(context.Canceled))
+		})
+
+		It("should pass the opts through without a gate", func() {
+			var gate *joinGate
+			o := optFunc(func() error { return nil })
+			Expect(gate.joinOpt(o)).NotTo(BeNil())
+			Expect(gate.initOpt(o).Exec()).To(Succeed())
+		})
+	})
+})
+
+type optFunc func() error
+
+func (f optFunc) Exec() error {
+	return f()
+}
@@ -4,11 +4,9 @@ import (
 	"context"
 	"fmt"
 
-	"github.com/docker/docker/client"
 	"github.com/spf13/cobra"
 
 	"kubevirt.io/kubevirtci/cluster-provision/gocli/cmd/utils"
-	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
 )
 
 // NewPortCommand returns new command to expose public ports for the cluster
@@ -22,22 +20,15 @@ func NewPortCommand() *cobra.Command {
 If no port name is specified, all exposed ports are printed.
 If an extra port name is specified, only the exposed port is printed.
 
-Known port names are 'ssh', 'registry', 'ocp', 'k8s', 'prometheus' and 'grafana'.
+Known port names are 'ssh', 'registry', 'ocp', 'k8s', 'prometheus' and 'grafana',
+along with the names of the ports exposed with run --expose and gocli expose.
+gocli env prints all connection details of a cluster at once.
 `,
 		RunE: ports,
 		Args: func(cmd *cobra.Command, args []string) error {
 			if len(args) > 1 {
 				return fmt.Errorf("only one port name can be specified at once")
 			}
-
-			if len(args) == 1 {
-				switch args[0] {
-				case utils.PortNameSSH, utils.PortNameSSHWorker, utils.PortNameAPI, utils.PortNameOCP, utils.PortNameOCPConsole, utils.PortNameRegistry, utils.PortNameVNC, utils.PortNameHTTP, utils.PortNameHTTPS, utils.PortNamePrometheus, utils.PortNameGrafana, utils.PortNameUploadProxy, utils.PortNameDNS, utils.PortNameUploadProxyLowerBand:
-					return nil
-				default:
-					return fmt.Errorf("unknown port name %s", args[0])
-				}
-			}
 			return nil
 		},
 	}
@@ -59,73 +50,66 @@ func ports(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	cli, err := client.NewClientWithOpts(client.FromEnv)
+	cli, err := newRuntime()
 	if err != nil {
 		return err
 	}
 
-	containers, err := docker.GetPrefixedContainers(cli, prefix+"-"+containerName)
+	c, err := clusterContainer(cli, prefix, containerName)
 	if err != nil {
 		return err
 	}
 
-	if len(containers) != 1 {
-		return fmt.Errorf("failed to found the container with name %s", prefix+"-"+containerName)
-	}
-
 	portName := ""
 	if len(args) > 0 {
 		portName = args[0]
 	}
-	container, err := cli.ContainerInspect(context.Background(), containers[0].ID)
+	container, err := cli.ContainerInspect(context.Background(), c.ID)
 	if err != nil {
 		return err
 	}
 
 	if portName != "" {
-		err = nil
-		switch portName {
-		case utils.PortNameSSH:
-			err = utils.PrintPublicPort(utils.PortSSH, container.NetworkSettings.Ports)
-		case utils.PortNameSSHWorker:
-			err = utils.PrintPublicPort(utils.PortSSHWorker, container.NetworkSettings.Ports)
-		case utils.PortNameAPI:
-			err = utils.PrintPublicPort(utils.PortAPI, container.NetworkSettings.Ports)
-		case utils.PortNameRegistry:
-			err = utils.PrintPublicPort(utils.PortRegistry, container.NetworkSettings.Ports)
-		case utils.PortNameOCP:
-			err = utils.PrintPublicPort(utils.PortOCP, container.NetworkSettings.Ports)
-		case utils.PortNameOCPConsole:
-			err = utils.PrintPublicPort(utils.PortOCPConsole, container.NetworkSettings.Ports)
-		case utils.PortNameVNC:
-			err = utils.PrintPublicPort(utils.PortVNC, container.NetworkSettings.Ports)
-		case utils.PortNameHTTP:
-			err = utils.PrintPublicPort(utils.PortHTTP, container.NetworkSettings.Ports)
-		case utils.PortNameHTTPS:
-			err = utils.PrintPublicPort(utils.PortHTTPS, container.NetworkSettings.Ports)
-		case utils.PortNamePrometheus:
-			err = utils.PrintPublicPort(utils.PortPrometheus, container.NetworkSettings.Ports)
-		case utils.PortNameGrafana:
-			err = utils.PrintPublicPort(utils.PortGrafana, container.NetworkSettings.Ports)
-		case utils.PortNameUploadProxy:
-			err = utils.PrintPublicPort(utils.PortUploadProxy, container.NetworkSettings.Ports)
-		case utils.PortNameUploadProxyLowerBand:
-			err = utils.PrintPublicPort(utils.PortUploadProxyLowerBand, container.NetworkSettings.Ports)
-		case utils.PortNameDNS:
-			err = utils.PrintPublicPort(utils.PortDNS, container.NetworkSettings.Ports)
+		port, ok := portByName(portName)
+		if !ok {
+			exposed, err := clusterExposedPorts(cli, prefix)
+			if err != nil {
+				return err
+			}
+			hostPort, ok := exposed[portName]
+			if !ok {
+				return fmt.Errorf("unknown port name %s", portName)
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), hostPort)
+			return nil
 		}
-
+		hostPort, err := utils.GetPublicPort(uint16(port), container.NetworkSettings.Ports)
 		if err != nil {
 			return err
 		}
+		fmt.Fprintln(cmd.OutOrStdout(), hostPort)
 
 	} else {
 		for k, pp := range container.NetworkSettings.Ports {
 			for _, p := range pp {
-				fmt.Printf("%s -> %s:%s\n", k, p.HostIP, p.HostPort)
+				fmt.Fprintf(cmd.OutOrStdout(), "%s -> %s:%s\n", k, p.HostIP, p.HostPort)
 			}
 		}
 	}
 
 	return nil
 }
+
+// portByName returns the container port of a port name accepted by gocli ports
+func portByName(name string) (int, bool) {
+	// the OCP console shares the port of HTTPS
+	if name == utils.PortNameOCPConsole {
+		return utils.PortOCPConsole, true
+	}
+	for port, n := range portNames {
+		if n == name {
+			return port, true
+		}
+	}
+	return 0, false
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -12,10 +13,7 @@ import (
 
 	"github.com/alessio/shellescape"
 	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/mount"
-	"github.com/docker/docker/api/types/volume"
-	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/archive"
 	"github.com/docker/go-connections/nat"
 	"github.com/sirupsen/logrus"
@@ -24,6 +22,8 @@ import (
 
 	"kubevirt.io/kubevirtci/cluster-provision/gocli/cmd/utils"
 	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/events"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/ipam"
 	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/libssh"
 )
 
@@ -45,6 +45,7 @@ func NewProvisionCommand() *cobra.Command {
 	provision.Flags().Uint("ssh-port", 0, "port on localhost for ssh server")
 	provision.Flags().String("container-suffix", "", "use additional suffix for the provisioned container image")
 	provision.Flags().String("phases", "linux,k8s", "phases to run, possible values: linux,k8s linux k8s")
+	provision.Flags().String("output", outputText, "output format, json emits machine readable provisioning events on stdout")
 	provision.Flags().StringArray("additional-persistent-kernel-arguments", []string{}, "additional persistent kernel arguments applied after provision")
 
 	return provision
@@ -73,6 +74,11 @@ func provisionCluster(cmd *cobra.Command, args []string) (retErr error) {
 		return err
 	}
 
+	if emitter, err = setupOutput(cmd); err != nil {
+		return err
+	}
+	defer resetOutput()
+
 	if strings.Contains(phases, "linux") {
 		base = fmt.Sprintf("quay.io/kubevirtci/centos%s", centosVersion)
 	} else {
@@ -139,14 +145,19 @@ func provisionCluster(cmd *cobra.Command, args []string) (retErr error) {
 		return err
 	}
 
-	cli, err := client.NewClientWithOpts(client.FromEnv)
+	cli, err := newRuntime()
 	if err != nil {
 		return err
 	}
 	ctx := context.Background()
 
+	ledger, err := startLedger(prefix)
+	if err != nil {
+		return err
+	}
+
 	stop := make(chan error, 10)
-	containers, volumes, done := docker.NewCleanupHandler(cli, stop, cmd.OutOrStderr(), true)
+	containers, volumes, done := docker.NewCleanupHandler(cli, stop, cmd.ErrOrStderr(), true, ledger)
 
 	defer func() {
 		stop <- retErr
@@ -155,17 +166,24 @@ func provisionCluster(cmd *cobra.Command, args []string) (retErr error) {
 
 	go func() {
 		interrupt := make(chan os.Signal, 1)
-		signal.Notify(interrupt, os.Interrupt)
-		<-interrupt
-		stop <- fmt.Errorf("interrupt received, clean up")
+		signal.Notify(interrupt, cleanupSignals...)
+		sig := <-interrupt
+		stop <- fmt.Errorf("%s received, clean up", sig)
 	}()
 
 	// Pull the base image
-	err = docker.ImagePull(cli, ctx, base, image.PullOptions{})
+	err = events.Phase(emitter, 0, "image-pull", func() error {
+		return docker.ImagePull(cli, ctx, base, stdOutput.stdout)
+	})
 	if err != nil {
 		panic(err)
 	}
 
+	clusterID, err := newClusterID()
+	if err != nil {
+		return err
+	}
+
 	// Start dnsmasq
 	dnsmasq, err := containers2.DNSMasq(cli, ctx, &containers2.DNSMasqOptions{
 		ClusterImage:       base,
@@ -174,81 +192,79 @@ func provisionCluster(cmd *cobra.Command, args []string) (retErr error) {
 		PortMap:            portMap,
 		Prefix:             prefix,
 		NodeCount:          1,
+		Labels:             clusterLabels(clusterID, prefix, roleDNSMasq, 0),
 	})
 	if err != nil {
 		return err
 	}
-	containers <- dnsmasq.ID
+	containers <- dnsmasq
 
-	err = copyDirectory(ctx, cli, dnsmasq.ID, centosScriptsPath, "/")
+	err = copyDirectory(ctx, cli, dnsmasq, centosScriptsPath, "/")
 	if err != nil {
 		return fmt.Errorf("failed copying centos scripts into dnsmasq container: %v", err)
 	}
-	if err := cli.ContainerStart(ctx, dnsmasq.ID, container.StartOptions{}); err != nil {
+	if err := cli.ContainerStart(ctx, dnsmasq); err != nil {
 		return err
 	}
 
 	nodeName := nodeNameFromIndex(1)
 	nodeNum := fmt.Sprintf("%02d", 1)
 
-	vol, err := cli.VolumeCreate(ctx, volume.CreateOptions{
-		Name: fmt.Sprintf("%s-%s", prefix, nodeName),
-	})
-	if err != nil {
+	vol := fmt.Sprintf("%s-%s", prefix, nodeName)
+	if err := cli.VolumeCreate(ctx, vol, clusterLabels(clusterID, prefix, roleNode, 1)); err != nil {
 		return err
 	}
-	volumes <- vol.Name
-	registryVol, err := cli.VolumeCreate(ctx, volume.CreateOptions{
-		Name: fmt.Sprintf("%s-%s", prefix, "registry"),
-	})
-	if err != nil {
+	volumes <- vol
+	registryVol := fmt.Sprintf("%s-%s", prefix, "registry")
+	if err := cli.VolumeCreate(ctx, registryVol, clusterLabels(clusterID, prefix, roleRegistry, 0)); err != nil {
 		return err
 	}
 
 	if len(qemuArgs) > 0 {
 		qemuArgs = "--qemu-args " + qemuArgs
 	}
-	node, err := cli.ContainerCreate(ctx, &container.Config{
+	node, err := cli.ContainerCreate(ctx, nodeContainer(prefix, nodeName), &container.Config{
 		Image: base,
-		Env: append([]string{
+		Env: append(append([]string{
 			fmt.Sprintf("NODE_NUM=%s", nodeNum),
-		}, utils.ForwardEnv("PROW_JOB_ID", "CI")...),
+		}, nodeAddressEnv(ipam.ControlPlane())...), utils.ForwardEnv("PROW_JOB_ID", "CI")...),
 		Volumes: map[string]struct{}{
 			"/var/run/disk":     {},
 			"/var/lib/registry": {},
 		},
-		Cmd: []string{"/bin/bash", "-c", fmt.Sprintf("/vm.sh --memory %s --cpu %s %s", memory, strconv.Itoa(int(cpu)), qemuArgs)},
+		Cmd:    []string{"/bin/bash", "-c", fmt.Sprintf("/vm.sh --memory %s --cpu %s %s", memory, strconv.Itoa(int(cpu)), qemuArgs)},
+		Labels: clusterLabels(clusterID, prefix, roleNode, 1),
 	}, &container.HostConfig{
 		Mounts: []mount.Mount{
 			{
 				Type:   "volume",
-				Source: vol.Name,
+				Source: vol,
 				Target: "/var/run/disk",
 			},
 			{
 				Type:   "volume",
-				Source: registryVol.Name,
+				Source: registryVol,
 				Target: "/var/lib/registry",
 			},
 		},
 		Privileged:  true,
-		NetworkMode: container.NetworkMode("container:" + dnsmasq.ID),
-	}, nil, nil, nodeContainer(prefix, nodeName))
+		NetworkMode: container.NetworkMode("container:" + dnsmasq),
+	})
 	if err != nil {
 		return err
 	}
-	containers <- node.ID
+	containers <- node
 
-	err = copyDirectory(ctx, cli, node.ID, centosScriptsPath, "/")
+	err = copyDirectory(ctx, cli, node, centosScriptsPath, "/")
 	if err != nil {
 		return fmt.Errorf("failed copying centos scripts into node container: %v", err)
 	}
-	if err := cli.ContainerStart(ctx, node.ID, container.StartOptions{}); err != nil {
+	if err := cli.ContainerStart(ctx, node); err != nil {
 		return err
 	}
 
 	// copy provider scripts
-	err = copyDirectory(ctx, cli, node.ID, scripts, "/scripts")
+	err = copyDirectory(ctx, cli, node, scripts, "/scripts")
 	if err != nil {
 		return err
 	}
@@ -260,44 +276,49 @@ func provisionCluster(cmd *cobra.Command, args []string) (retErr error) {
 		return err
 	}
 
-	err = waitForVMToBeUp(cli, prefix, nodeName)
+	err = waitForVMToBeUp(cli, prefix, nodeName, stdOutput)
 	if err != nil {
 		return err
 	}
 
 	envVars := fmt.Sprintf("version=%s slim=%t", version, slim)
 	if strings.Contains(phases, "linux") {
-		err = performPhase(cli, nodeContainer(prefix, nodeName), "/scripts/provision.sh", envVars)
+		err = events.Phase(emitter, 1, "linux", func() error {
+			return performPhase(cli, nodeContainer(prefix, nodeName), "/scripts/provision.sh", envVars)
+		})
 		if err != nil {
 			return err
 		}
 	}
 	if strings.Contains(phases, "k8s") {
+		controlPlaneIP := ipam.ControlPlane().IPv4
 		// copy provider scripts
-		err = copyDirectory(ctx, cli, node.ID, scripts, "/scripts")
+		err = copyDirectory(ctx, cli, node, scripts, "/scripts")
 		if err != nil {
 			return err
 		}
-		err = _cmd(cli, nodeContainer(prefix, nodeName), fmt.Sprintf("if [ -f /scripts/extra-pre-pull-images ]; then scp -o UserKnownHostsFile=/dev/null -o StrictHostKeyChecking=no -i vagrant.key -P 22 /scripts/extra-pre-pull-images %s@192.168.66.101:/tmp/extra-pre-pull-images; fi", sshUser), "copying /scripts/extra-pre-pull-images if existing")
+		err = _cmd(cli, nodeContainer(prefix, nodeName), fmt.Sprintf("if [ -f /scripts/extra-pre-pull-images ]; then scp -o UserKnownHostsFile=/dev/null -o StrictHostKeyChecking=no -i vagrant.key -P 22 /scripts/extra-pre-pull-images %s@%s:/tmp/extra-pre-pull-images; fi", sshUser, controlPlaneIP), "copying /scripts/extra-pre-pull-images if existing")
 		if err != nil {
 			return err
 		}
-		err = _cmd(cli, nodeContainer(prefix, nodeName), fmt.Sprintf("if [ -f /scripts/pre-pull-images ]; then scp -o UserKnownHostsFile=/dev/null -o StrictHostKeyChecking=no -i vagrant.key -P 22 /scripts/pre-pull-images %s@192.168.66.101:/tmp/pre-pull-images; fi", sshUser), "copying /scripts/pre-pull-images if existing")
+		err = _cmd(cli, nodeContainer(prefix, nodeName), fmt.Sprintf("if [ -f /scripts/pre-pull-images ]; then scp -o UserKnownHostsFile=/dev/null -o StrictHostKeyChecking=no -i vagrant.key -P 22 /scripts/pre-pull-images %s@%s:/tmp/pre-pull-images; fi", sshUser, controlPlaneIP), "copying /scripts/pre-pull-images if existing")
 		if err != nil {
 			return err
 		}
 
-		err = _cmd(cli, nodeContainer(prefix, nodeName), fmt.Sprintf("ssh -o UserKnownHostsFile=/dev/null -o StrictHostKeyChecking=no -i vagrant.key %s@192.168.66.101 'mkdir -p /tmp/ceph /tmp/cnao /tmp/nfs-csi /tmp/nodeports /tmp/prometheus /tmp/whereabouts /tmp/kwok'", sshUser), "Create required manifest directories before copy")
+		err = _cmd(cli, nodeContainer(prefix, nodeName), fmt.Sprintf("ssh -o UserKnownHostsFile=/dev/null -o StrictHostKeyChecking=no -i vagrant.key %s@%s 'mkdir -p /tmp/ceph /tmp/cnao /tmp/nfs-csi /tmp/nodeports /tmp/prometheus /tmp/whereabouts /tmp/kwok'", sshUser, controlPlaneIP), "Create required manifest directories before copy")
 		if err != nil {
 			return err
 		}
 		// Copy manifests to the VM
-		err = _cmd(cli, nodeContainer(prefix, nodeName), fmt.Sprintf("scp -r -o UserKnownHostsFile=/dev/null -o StrictHostKeyChecking=no -i vagrant.key -P 22 /scripts/manifests/* %s@192.168.66.101:/tmp", sshUser), "copying manifests to the VM")
+		err = _cmd(cli, nodeContainer(prefix, nodeName), fmt.Sprintf("scp -r -o UserKnownHostsFile=/dev/null -o StrictHostKeyChecking=no -i vagrant.key -P 22 /scripts/manifests/* %s@%s:/tmp", sshUser, controlPlaneIP), "copying manifests to the VM")
 		if err != nil {
 			return err
 		}
 
-		err = performPhase(cli, nodeContainer(prefix, nodeName), "/scripts/k8s_provision.sh", envVars)
+		err = events.Phase(emitter, 1, "k8s", func() error {
+			return performPhase(cli, nodeContainer(prefix, nodeName), "/scripts/k8s_provision.sh", envVars)
+		})
 		if err != nil {
 			return err
 		}
@@ -322,17 +343,13 @@ func provisionCluster(cmd *cobra.Command, args []string) (retErr error) {
 	waitCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
 
-	okChan, errChan := cli.ContainerWait(waitCtx, nodeContainer(prefix, nodeName), container.WaitConditionNotRunning)
-	select {
-	case <-okChan:
-		logrus.Info("node stopped successfully")
-	case err := <-errChan:
-		if err != nil {
-			return fmt.Errorf("error: waiting for the node to stop failed: %v", err)
+	if _, err := cli.ContainerWait(waitCtx, nodeContainer(prefix, nodeName)); err != nil {
+		if waitCtx.Err() != nil {
+			return fmt.Errorf("error: timeout waiting for node to stop")
 		}
-	case <-waitCtx.Done():
-		return fmt.Errorf("error: timeout waiting for node to stop")
+		return fmt.Errorf("error: waiting for the node to stop failed: %v", err)
 	}
+	logrus.Info("node stopped successfully")
 
 	logrus.Info("preparing additional persistent kernel arguments after initial provision")
 	additionalKernelArguments, err := cmd.Flags().GetStringArray("additional-persistent-kernel-arguments")
@@ -348,12 +365,12 @@ func provisionCluster(cmd *cobra.Command, args []string) (retErr error) {
 	if err := os.WriteFile(filepath.Join(dir, "additional.kernel.args"), []byte(shellescape.QuoteCommand(additionalKernelArguments)), 0666); err != nil {
 		return fmt.Errorf("failed creating additional.kernel.args file: %v", err)
 	}
-	if err := copyDirectory(ctx, cli, node.ID, dir, "/"); err != nil {
+	if err := copyDirectory(ctx, cli, node, dir, "/"); err != nil {
 		return fmt.Errorf("failed copying additional kernel arguments into the container: %v", err)
 	}
 
 	logrus.Infof("Commiting the node as %s", target)
-	_, err = cli.ContainerCommit(ctx, node.ID, container.CommitOptions{
+	_, err = cli.ContainerCommit(ctx, node, container.CommitOptions{
 		Reference: target,
 		Comment:   "PROVISION SUCCEEDED",
 		Author:    "gocli",
@@ -368,7 +385,7 @@ func provisionCluster(cmd *cobra.Command, args []string) (retErr error) {
 	return nil
 }
 
-func copyDirectory(ctx context.Context, cli *client.Client, containerID string, sourceDirectory string, targetDirectory string) error {
+func copyDirectory(ctx context.Context, cli docker.Runtime, containerID string, sourceDirectory string, targetDirectory string) error {
 	srcInfo, err := archive.CopyInfoSourcePath(sourceDirectory, false)
 	if err != nil {
 		return err
@@ -388,25 +405,27 @@ func copyDirectory(ctx context.Context, cli *client.Client, containerID string,
 	}
 	defer func() { _ = preparedArchive.Close() }()
 
-	err = cli.CopyToContainer(ctx, containerID, dstDir, preparedArchive, container.CopyToContainerOptions{AllowOverwriteDirWithFile: false})
-	if err != nil {
-		return err
-	}
-	return nil
+	return cli.CopyToContainer(ctx, containerID, dstDir, preparedArchive)
 }
 
-func _cmd(cli *client.Client, container string, cmd string, description string) error {
+func _cmd(cli docker.Runtime, container string, cmd string, description string) error {
+	return _cmdWithOutput(cli, container, cmd, description, stdOutput.stdout)
+}
+
+func _cmdWithOutput(cli docker.Runtime, container string, cmd string, description string, out io.Writer) error {
 	logrus.Info(description)
-	success, err := docker.Exec(cli, container, []string{"/bin/bash", "-c", cmd}, os.Stdout)
-	if err != nil {
-		return fmt.Errorf("%s failed: %v", description, err)
-	} else if !success {
-		return fmt.Errorf("%s failed", cmd)
-	}
-	return nil
+	return events.TrackCommand(emitter, 0, cmd, func() error {
+		success, err := docker.Exec(cli, container, []string{"/bin/bash", "-c", cmd}, out)
+		if err != nil {
+			return fmt.Errorf("%s failed: %v", description, err)
+		} else if !success {
+			return fmt.Errorf("%s failed", cmd)
+		}
+		return nil
+	})
 }
 
-func performPhase(cli *client.Client, container string, script string, envVars string) error {
+func performPhase(cli docker.Runtime, container string, script string, envVars string) error {
 	err := _cmd(cli, container, fmt.Sprintf("test -f %s", script), "checking provision scripts")
 	if err != nil {
 		return err
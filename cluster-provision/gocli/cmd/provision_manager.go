@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"bytes"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -293,7 +292,6 @@ func matcher(rulesDB map[string][]string, fileName string, status string) ([]str
 func getKubevirtciTag() (string, error) {
 	const kubevirtciTagUrl = "https://storage.googleapis.com/kubevirt-prow/release/kubevirt/kubevirtci/latest?ignoreCache=1"
 
-	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
 	resp, err := http.Get(kubevirtciTagUrl)
 	if err != nil {
 		return "", fmt.Errorf("getting latest kubevirtci tag failed: %v", err)
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/timing"
+)
+
+// NewReportCommand returns command to print or compare timing reports written by run --timing-report
+func NewReportCommand() *cobra.Command {
+	report := &cobra.Command{
+		Use:   "report REPORT [NEW-REPORT]",
+		Short: "report prints a timing report of run or compares two of them",
+		Long: `report prints a timing report written by run --timing-report
+
+If a second report is given, the durations of all steps are compared and the command fails
+if a step became slower than allowed by both --threshold-percent and --threshold-seconds.`,
+		RunE: report,
+		Args: cobra.RangeArgs(1, 2),
+	}
+	report.Flags().Float64("threshold-percent", 20, "relative slowdown of a step which counts as regression")
+	report.Flags().Float64("threshold-seconds", 10, "absolute slowdown of a step which counts as regression")
+
+	return report
+}
+
+func report(cmd *cobra.Command, args []string) error {
+	oldReport, err := timing.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 1 {
+		return oldReport.WriteTable(cmd.OutOrStdout())
+	}
+
+	newReport, err := timing.ReadFile(args[1])
+	if err != nil {
+		return err
+	}
+
+	percent, err := cmd.Flags().GetFloat64("threshold-percent")
+	if err != nil {
+		return err
+	}
+
+	seconds, err := cmd.Flags().GetFloat64("threshold-seconds")
+	if err != nil {
+		return err
+	}
+
+	diffs := timing.Compare(oldReport, newReport, timing.Thresholds{Percent: percent, Seconds: seconds})
+	if err := timing.WriteComparison(cmd.OutOrStdout(), diffs); err != nil {
+		return err
+	}
+
+	regressions := 0
+	for _, d := range diffs {
+		if d.Regressed {
+			regressions++
+		}
+	}
+	if regressions > 0 {
+		return fmt.Errorf("%d steps regressed", regressions)
+	}
+	return nil
+}
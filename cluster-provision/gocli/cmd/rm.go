@@ -2,10 +2,8 @@ package cmd
 
 import (
 	"context"
-	"strings"
 
 	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/client"
 	"github.com/spf13/cobra"
 	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
 )
@@ -29,26 +27,28 @@ func rm(cmd *cobra.Command, _ []string) error {
 		return err
 	}
 
-	cli, err := client.NewClientWithOpts(client.FromEnv)
+	cli, err := newRuntime()
 	if err != nil {
 		return err
 	}
 
-	containers, err := docker.GetPrefixedContainers(cli, prefix+"-")
+	return removeCluster(cli, prefix)
+}
+
+// removeCluster removes all containers and volumes labelled with the prefix of the cluster
+func removeCluster(cli docker.Runtime, prefix string) error {
+	containers, err := clusterContainerList(cli, prefix)
 	if err != nil {
 		return err
 	}
 
 	var dnsmasq *container.Summary
-nodnsmasq:
 	for i, c := range containers {
-		for _, name := range c.Names {
-			if strings.HasSuffix(name, "dnsmasq") {
-				dnsmasq = &containers[i]
-				continue nodnsmasq
-			}
+		if role, _ := containerRole(prefix, c); role == roleDNSMasq {
+			dnsmasq = &containers[i]
+			continue
 		}
-		err := cli.ContainerRemove(context.Background(), c.ID, container.RemoveOptions{Force: true})
+		err := cli.ContainerRemove(context.Background(), c.ID, true)
 		if err != nil {
 			return err
 		}
@@ -56,19 +56,19 @@ nodnsmasq:
 
 	// delete dnsmasq at the end since other containers rely on ints network namespace
 	if dnsmasq != nil {
-		err := cli.ContainerRemove(context.Background(), dnsmasq.ID, container.RemoveOptions{Force: true})
+		err := cli.ContainerRemove(context.Background(), dnsmasq.ID, true)
 		if err != nil {
 			return err
 		}
 	}
 
-	volumes, err := docker.GetPrefixedVolumes(cli, prefix)
+	volumes, err := clusterVolumeList(cli, prefix)
 	if err != nil {
 		return err
 	}
 
 	for _, v := range volumes {
-		err := cli.VolumeRemove(context.Background(), v.Name, true)
+		err := cli.VolumeRemove(context.Background(), v, true)
 		if err != nil {
 			return err
 		}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
@@ -23,12 +24,27 @@ func NewRootCommand() *cobra.Command {
 	root.PersistentFlags().StringP("prefix", "p", "kubevirt", "Prefix to identify docker containers")
 
 	root.AddCommand(
+		NewBundleCommand(),
+		NewCleanupCommand(),
+		NewEnvCommand(),
+		NewExposeCommand(),
+		NewGatherCommand(),
+		NewGCCommand(),
+		NewImageCommand(),
+		NewKubeconfigCommand(),
+		NewListCommand(),
 		NewPortCommand(),
 		NewProvisionCommand(),
 		NewRemoveCommand(),
+		NewReportCommand(),
+		NewNodeCommand(),
 		NewRunCommand(),
 		NewSSHCommand(),
 		NewSCPCommand(),
+		NewSnapshotCommand(),
+		NewStartCommand(),
+		NewStatusCommand(),
+		NewStopCommand(),
 		NewProvisionManagerCommand(),
 	)
 
@@ -39,6 +55,11 @@ func NewRootCommand() *cobra.Command {
 // Execute executes root command
 func Execute() {
 	if err := NewRootCommand().Execute(); err != nil {
+		// the command run on a node already told why it failed
+		var exitErr exitCodeError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code)
+		}
 		fmt.Println(err)
 		os.Exit(1)
 	}
@@ -4,55 +4,44 @@ import (
 	"bufio"
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"path"
 	"path/filepath"
 	"runtime"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/mount"
-	"github.com/docker/docker/api/types/volume"
-	"github.com/docker/docker/client"
 	"github.com/docker/go-connections/nat"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"k8s.io/apimachinery/pkg/api/resource"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/cmd/clusterspec"
 	"kubevirt.io/kubevirtci/cluster-provision/gocli/cmd/nodesconfig"
 	"kubevirt.io/kubevirtci/cluster-provision/gocli/cmd/utils"
 	containers2 "kubevirt.io/kubevirtci/cluster-provision/gocli/containers"
 	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
 	"kubevirt.io/kubevirtci/cluster-provision/gocli/images"
 	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts"
-	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/aaq"
 	bindvfio "kubevirt.io/kubevirtci/cluster-provision/gocli/opts/bind-vfio"
-	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/cdi"
-	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/cnao"
 	dockerproxy "kubevirt.io/kubevirtci/cluster-provision/gocli/opts/docker-proxy"
 	etcdinmemory "kubevirt.io/kubevirtci/cluster-provision/gocli/opts/etcd"
-	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/istio"
 	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/ksm"
-	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/multus"
-	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/network_resources_injector"
-	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/nfscsi"
 	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/node01"
 	nodesprovision "kubevirt.io/kubevirtci/cluster-provision/gocli/opts/nodes"
-	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/prometheus"
 	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/psa"
 	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/realtime"
-	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/rookceph"
-	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/rootkey"
 	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/swap"
 	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/vsock"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/events"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/ipam"
 	k8s "kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/k8s"
 	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/libssh"
-
-	"github.com/alessio/shellescape"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/timing"
 )
 
 const (
@@ -95,7 +84,7 @@ var soundcardPCIIDs = []string{
 	// Intel HD Audio Controller (ich9) (aka -device ich9-intel-hda)
 	"8086:293e",
 }
-var cli *client.Client
+var cli docker.Runtime
 var nvmeDisks []string
 var scsiDisks []string
 var usbDisks []string
@@ -109,8 +98,9 @@ func NewRunCommand() *cobra.Command {
 		Use:   "run",
 		Short: "run starts a given cluster",
 		RunE:  run,
-		Args:  cobra.ExactArgs(1),
+		Args:  cobra.MaximumNArgs(1),
 	}
+	run.Flags().String("config", "", "path to a YAML or JSON cluster spec, flags passed explicitly take precedence over it")
 	run.Flags().UintP("nodes", "n", 1, "number of cluster nodes to start")
 	run.Flags().UintP("numa", "u", 1, "number of NUMA nodes per node")
 	run.Flags().StringP("memory", "m", "3096M", "amount of ram per node")
@@ -132,10 +122,15 @@ func NewRunCommand() *cobra.Command {
 	run.Flags().Uint("prometheus-port", 0, "port on localhost for prometheus server")
 	run.Flags().Uint("grafana-port", 0, "port on localhost for grafana server")
 	run.Flags().Uint("dns-port", 0, "port on localhost for dns server")
+	run.Flags().StringArray("expose", nil, "expose a port of node01 on a random localhost port under a name for gocli ports, name=nodePort[/tcp|udp]")
 	run.Flags().String("nfs-data", "", "path to data which should be exposed via nfs to the nodes")
 	run.Flags().Bool("enable-ceph", false, "enables dynamic storage provisioning using Ceph")
 	run.Flags().Bool("enable-istio", false, "deploys Istio service mesh")
 	run.Flags().Bool("reverse", false, "reverse node setup order")
+	run.Flags().String("output", outputText, "output format, json emits machine readable provisioning events on stdout")
+	run.Flags().String("timing-report", "", "write the durations of all provisioning steps as JSON to this file, see gocli report")
+	run.Flags().String("gather-dir", "", "directory a diagnostics bundle is written to when the run fails, see gocli gather, off when empty")
+	run.Flags().Uint("parallelism", 0, "number of nodes to boot and provision concurrently, 0 provisions one node after the other")
 	run.Flags().Bool("enable-cnao", false, "enable network extensions with istio")
 	run.Flags().Bool("skip-cnao-cr", false, "skip deploying cnao custom resource. if true, only cnao CRDS will be deployed")
 	run.Flags().Bool("deploy-dnc", false, "deploy the dynamic networks controller with CNAO")
@@ -156,10 +151,12 @@ func NewRunCommand() *cobra.Command {
 	run.Flags().Uint("swap-size", 0, "swap memory size in GB")
 	run.Flags().Uint("swapiness", 0, "swapiness")
 	run.Flags().String("docker-proxy", "", "sets network proxy for docker daemon")
+	run.Flags().Bool("offline", false, "never pull images, fail at once if an image is missing locally, see gocli bundle")
 	run.Flags().String("container-registry", "quay.io", "the registry to pull cluster container from")
 	run.Flags().String("container-org", "kubevirtci", "the organization at the registry to pull the container from")
 	run.Flags().String("container-suffix", "", "Override container suffix stored at the cli binary")
 	run.Flags().String("gpu", "", "pci address of a GPU to assign to a node")
+	run.Flags().Bool("allow-snapshots", false, "start the VMs with a CPU model QEMU can save, gocli snapshot save requires it")
 	run.Flags().StringArrayVar(&nvmeDisks, "nvme", []string{}, "size of the emulate NVMe disk to pass to the node")
 	run.Flags().StringArrayVar(&scsiDisks, "scsi", []string{}, "size of the emulate SCSI disk to pass to the node")
 	run.Flags().Bool("run-etcd-on-memory", false, "configure etcd to run on RAM memory, etcd data will not be persistent")
@@ -176,15 +173,58 @@ func NewRunCommand() *cobra.Command {
 	run.Flags().StringArrayVar(&usbDisks, "usb", []string{}, "size of the emulate USB disk to pass to the node")
 	run.Flags().StringArrayVar(&sharedDisks, "shared-block-device", []string{}, "size of block device to share between all nodes")
 	run.Flags().Bool("deploy-network-resources-injector", false, "deploys Network Resources Injector")
+	run.Flags().StringArray("addon-dir", []string{}, "directory with an addon.yaml describing an add-on to deploy after the built-in opts it depends on, can be repeated")
 	run.Flags().String("vsock-child-ns-mode", "", "vsock child namespace mode (global or local)")
 	run.Flags().String("topology-manager-policy", "", "kubelet topology manager policy (e.g. single-numa-node)")
 	run.Flags().String("reserved-system-cpus", "", "kubelet reserved system cpuset (e.g. 4 or 4-5)")
+	run.Flags().StringArray("node-override", []string{}, "per node settings overriding the cluster wide ones, e.g. node03:memory=8G,cpu=6,nvme=10G,hugepages-1g=4.\nsupported keys: memory, cpu, numa, nvme, scsi, usb, hugepages-2m, hugepages-1g, realtime, ksm, swap, topology-manager-policy, reserved-system-cpus")
 
 	return run
 }
 
 func run(cmd *cobra.Command, args []string) (retErr error) {
 
+	cluster, err := loadClusterSpec(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	output, err := setupOutput(cmd)
+	if err != nil {
+		return err
+	}
+	defer resetOutput()
+
+	timingReport, err := cmd.Flags().GetString("timing-report")
+	if err != nil {
+		return err
+	}
+
+	gatherDir, err := cmd.Flags().GetString("gather-dir")
+	if err != nil {
+		return err
+	}
+	timings := timing.NewCollector()
+	eventLog := events.NewRecorder()
+	emitter = events.Multi(output, timings, eventLog)
+	reportTimings := func() {
+		report := timings.Summary(cluster)
+		if err := report.WriteTable(stdOutput.stdout); err != nil {
+			logrus.WithError(err).Warn("printing the timing report failed")
+		}
+		if timingReport != "" {
+			if err := report.WriteFile(timingReport); err != nil {
+				logrus.WithError(err).Warnf("writing the timing report to %s failed", timingReport)
+			}
+		}
+	}
+	// on success the timings are reported as soon as the cluster is up
+	defer func() {
+		if retErr != nil {
+			reportTimings()
+		}
+	}()
+
 	prefix, err := cmd.Flags().GetString("prefix")
 	if err != nil {
 		return err
@@ -194,6 +234,9 @@ func run(cmd *cobra.Command, args []string) (retErr error) {
 	if err != nil {
 		return err
 	}
+	if nodes > uint(ipam.MaxNodes) {
+		return fmt.Errorf("the cluster network has addresses for at most %d nodes", ipam.MaxNodes)
+	}
 
 	memory, err := cmd.Flags().GetString("memory")
 	if err != nil {
@@ -206,6 +249,14 @@ func run(cmd *cobra.Command, args []string) (retErr error) {
 		return err
 	}
 
+	parallelism, err := cmd.Flags().GetUint("parallelism")
+	if err != nil {
+		return err
+	}
+	if parallelism > 0 && reverse {
+		return fmt.Errorf("--parallelism and --reverse can't be used together")
+	}
+
 	randomPorts, err := cmd.Flags().GetBool("random-ports")
 	if err != nil {
 		return err
@@ -248,6 +299,20 @@ func run(cmd *cobra.Command, args []string) (retErr error) {
 	if err := utils.AppendUDPIfExplicit(portMap, utils.PortDNS, cmd.Flags(), "dns-port"); err != nil {
 		return err
 	}
+	exposeSpecs, err := cmd.Flags().GetStringArray("expose")
+	if err != nil {
+		return err
+	}
+	exposed, err := parseExposes(exposeSpecs)
+	if err != nil {
+		return err
+	}
+	extraPorts := []nat.Port{}
+	for _, p := range exposed {
+		extraPorts = append(extraPorts, p.port())
+		// the exposed ports are published even without --random-ports
+		portMap[p.port()] = []nat.PortBinding{{HostIP: "127.0.0.1"}}
+	}
 
 	qemuArgs, err := cmd.Flags().GetString("qemu-args")
 	if err != nil {
@@ -327,8 +392,6 @@ func run(cmd *cobra.Command, args []string) (retErr error) {
 		return err
 	}
 
-	cluster := args[0]
-
 	background, err := cmd.Flags().GetBool("background")
 	if err != nil {
 		return err
@@ -343,6 +406,11 @@ func run(cmd *cobra.Command, args []string) (retErr error) {
 		return err
 	}
 
+	allowSnapshots, err := cmd.Flags().GetBool("allow-snapshots")
+	if err != nil {
+		return err
+	}
+
 	containerOrg, err := cmd.Flags().GetString("container-org")
 	if err != nil {
 		return err
@@ -353,6 +421,11 @@ func run(cmd *cobra.Command, args []string) (retErr error) {
 		return err
 	}
 
+	offline, err := cmd.Flags().GetBool("offline")
+	if err != nil {
+		return err
+	}
+
 	runEtcdOnMemory, err := cmd.Flags().GetBool("run-etcd-on-memory")
 	if err != nil {
 		return err
@@ -484,7 +557,64 @@ func run(cmd *cobra.Command, args []string) (retErr error) {
 		return err
 	}
 
-	cli, err = client.NewClientWithOpts(client.FromEnv)
+	addonDirs, err := cmd.Flags().GetStringArray("addon-dir")
+	if err != nil {
+		return err
+	}
+	addons, err := loadAddons(addonDirs)
+	if err != nil {
+		return err
+	}
+
+	nodeOverrideFlags, err := cmd.Flags().GetStringArray("node-override")
+	if err != nil {
+		return err
+	}
+	nodeOverrides, err := parseNodeOverrides(nodeOverrideFlags, nodes)
+	if err != nil {
+		return err
+	}
+
+	k8sConfs := []nodesconfig.K8sConfigFunc{
+		nodesconfig.WithCeph(cephEnabled),
+		nodesconfig.WithPrometheus(prometheusEnabled),
+		nodesconfig.WithAlertmanager(prometheusAlertmanagerEnabled),
+		nodesconfig.WithGrafana(grafanaEnabled),
+		nodesconfig.WithIstio(istioEnabled),
+		nodesconfig.WithNfsCsi(nfsCsiEnabled),
+		nodesconfig.WithCnao(cnaoEnabled),
+		nodesconfig.WithCNAOSkipCR(cnaoSkipCR),
+		nodesconfig.WithDNC(deployDNC),
+		nodesconfig.WithMultus(deployMultus),
+		nodesconfig.WithCdi(deployCdi),
+		nodesconfig.WithCdiVersion(cdiVersion),
+		nodesconfig.WithAAQ(deployAaq),
+		nodesconfig.WithAAQVersion(aaqVersion),
+		nodesconfig.WithNetworkResourcesInjector(deployNetworkResourcesInjector),
+	}
+	k8sConfig := nodesconfig.NewNodeK8sConfig(k8sConfs)
+	// reject opts which can't be deployed together before any VM boots
+	if _, _, err := newK8sOptGraph(k8sConfig, cluster, addonK8sOpts(addons, nil)...); err != nil {
+		return err
+	}
+
+	clusterShape := nodeShape{
+		Memory:      memory,
+		CPU:         cpu,
+		NUMA:        numa,
+		NVMeDisks:   nvmeDisks,
+		SCSIDisks:   scsiDisks,
+		USBDisks:    usbDisks,
+		Hugepages2M: hugepages2Mcount,
+		Hugepages1G: hugepages1Gcount,
+	}
+
+	cli, err = newRuntime()
+	if err != nil {
+		return err
+	}
+
+	ledger, err := startLedger(prefix)
 	if err != nil {
 		return err
 	}
@@ -493,82 +623,117 @@ func run(cmd *cobra.Command, args []string) (retErr error) {
 	ctx, cancel := context.WithCancel(b)
 
 	stop := make(chan error, 10)
-	containers, volumes, done := docker.NewCleanupHandler(cli, stop, cmd.OutOrStderr(), false)
+	containers, volumes, done := docker.NewCleanupHandler(cli, stop, cmd.ErrOrStderr(), false, ledger)
 
 	defer func() {
+		// gather what is needed to understand the failure before the cleanup removes it, interrupted runs clean up at once
+		if retErr != nil && ctx.Err() == nil && gatherDir != "" {
+			bundle := filepath.Join(gatherDir, gatherFileName(prefix))
+			err := os.MkdirAll(gatherDir, 0755)
+			if err == nil {
+				err = gatherBundle(cli, prefix, bundle, eventLog.Events())
+			}
+			if err != nil {
+				logrus.WithError(err).Warn("gathering the diagnostics of the failed run failed")
+			} else {
+				logrus.Infof("the diagnostics of the failed run are in %s", bundle)
+			}
+		}
 		stop <- retErr
 		<-done
 	}()
 
 	go func() {
 		interrupt := make(chan os.Signal, 1)
-		signal.Notify(interrupt, os.Interrupt)
-		<-interrupt
+		signal.Notify(interrupt, cleanupSignals...)
+		sig := <-interrupt
 		cancel()
-		stop <- fmt.Errorf("interrupt received, clean up")
+		stop <- fmt.Errorf("%s received, clean up", sig)
 	}()
 
-	// Check if cluster container suffix has not being override
-	// in that case use the default prefix stored at the binary
-	if containerSuffix == "" {
-		containerSuffix = images.SUFFIX
-	}
-	var clusterImage string
-	if containerSuffix != "" {
-		clusterImage = fmt.Sprintf("%s/%s%s", containerOrg, cluster, containerSuffix)
-	} else {
-		clusterImage = path.Join(containerOrg, cluster)
-	}
-
-	if slim {
-		clusterImage += "-slim"
+	clusterImage := providerImage(cluster, containerRegistry, containerOrg, containerSuffix, slim)
+	var offlineOptImages []string
+	if offline {
+		offlineOptImages, err = optImages(k8sConfig)
+		if err != nil {
+			return err
+		}
+		// fail before anything is started instead of retrying pulls which can't succeed
+		if err := checkLocalImages(ctx, cli, offlineImages(clusterImage, nfsData != "", carriedImages(offlineOptImages))); err != nil {
+			return err
+		}
+		// the images pinned by digest are carried by their digest tags, the opts deploy those
+		k8sConfig.Images = digestTags(offlineOptImages)
 	}
 
 	if len(containerRegistry) > 0 {
-		clusterImage = path.Join(containerRegistry, clusterImage)
-		fmt.Printf("Download the image %s\n", clusterImage)
-		err = docker.ImagePull(cli, ctx, clusterImage, image.PullOptions{})
+		fmt.Fprintf(stdOutput.stdout, "Download the image %s\n", clusterImage)
+		err = events.Phase(emitter, 0, "image-pull", func() error {
+			return docker.ImagePull(cli, ctx, clusterImage, stdOutput.stdout)
+		})
 		if err != nil {
 			panic(fmt.Sprintf("Failed to download cluster image %s, %s", clusterImage, err))
 		}
 	}
 
-	var dnsmasq *container.CreateResponse
-	for i := 0; i <= 3; i++ {
-		if i == 3 {
-			fmt.Printf("dnsmasq container failed to start 3 times")
-			return err
-		}
-		dnsmasq, err = containers2.DNSMasq(cli, ctx, &containers2.DNSMasqOptions{
-			ClusterImage:       clusterImage,
-			SecondaryNicsCount: secondaryNics,
-			RandomPorts:        randomPorts,
-			PortMap:            portMap,
-			Prefix:             prefix,
-			NodeCount:          nodes,
-		})
-		if err != nil {
-			return err
-		}
+	clusterID, err := newClusterID()
+	if err != nil {
+		return err
+	}
+
+	dnsmasqLabels := clusterLabels(clusterID, prefix, roleDNSMasq, 0)
+	for _, p := range exposed {
+		key, value := p.label()
+		dnsmasqLabels[key] = value
+	}
 
-		if err := cli.ContainerStart(ctx, dnsmasq.ID, container.StartOptions{}); err != nil {
-			fmt.Printf("Failed to start dnsmasq container: %s\n", err)
-			fmt.Printf("Retry creating and starting dnsmasq container\n")
-			if err := cli.ContainerRemove(ctx, dnsmasq.ID, container.RemoveOptions{}); err != nil {
+	var dnsmasq string
+	err = events.Phase(emitter, 0, "dnsmasq", func() error {
+		for i := 0; i <= 3; i++ {
+			if i == 3 {
+				fmt.Fprintf(stdOutput.stdout, "dnsmasq container failed to start 3 times")
+				return err
+			}
+			dnsmasq, err = containers2.DNSMasq(cli, ctx, &containers2.DNSMasqOptions{
+				ClusterImage:       clusterImage,
+				SecondaryNicsCount: secondaryNics,
+				RandomPorts:        randomPorts,
+				PortMap:            portMap,
+				Prefix:             prefix,
+				NodeCount:          nodes,
+				Labels:             dnsmasqLabels,
+				ExtraPorts:         extraPorts,
+			})
+			if err != nil {
 				return err
 			}
-			time.Sleep(2 * time.Second)
 
-		} else {
-			containers <- dnsmasq.ID
-			break
+			if err = cli.ContainerStart(ctx, dnsmasq); err != nil {
+				fmt.Fprintf(stdOutput.stdout, "Failed to start dnsmasq container: %s\n", err)
+				fmt.Fprintf(stdOutput.stdout, "Retry creating and starting dnsmasq container\n")
+				if err := cli.ContainerRemove(ctx, dnsmasq, false); err != nil {
+					return err
+				}
+				time.Sleep(2 * time.Second)
+
+			} else {
+				containers <- dnsmasq
+				return nil
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	dm, err := cli.ContainerInspect(context.Background(), dnsmasq.ID)
+	dm, err := cli.ContainerInspect(context.Background(), dnsmasq)
 	if err != nil {
 		return err
 	}
+	if err := forwardExposedPorts(cli, dnsmasq, dnsmasqLabels); err != nil {
+		return err
+	}
 
 	sshPort, err := utils.GetPublicPort(utils.PortSSH, dm.NetworkSettings.Ports)
 	if err != nil {
@@ -579,24 +744,39 @@ func run(cmd *cobra.Command, args []string) (retErr error) {
 		return err
 	}
 
-	// Pull the registry image
-	err = docker.ImagePull(cli, ctx, utils.DockerRegistryImage, image.PullOptions{})
+	// Pull the registry image, the phases of the pulls are named apart to keep the steps of timing reports distinct
+	err = events.Phase(emitter, 0, "registry-image-pull", func() error {
+		return docker.ImagePull(cli, ctx, utils.DockerRegistryImage, stdOutput.stdout)
+	})
 	if err != nil {
 		panic(err)
 	}
 
-	// Start registry
-	registry, err := cli.ContainerCreate(ctx, &container.Config{
-		Image: utils.DockerRegistryImage,
+	// Start registry, its data is kept in a named volume to be part of snapshots
+	registryVol := prefix + "-registry"
+	if err := cli.VolumeCreate(ctx, registryVol, clusterLabels(clusterID, prefix, roleRegistry, 0)); err != nil {
+		return err
+	}
+	volumes <- registryVol
+	registry, err := cli.ContainerCreate(ctx, prefix+"-registry", &container.Config{
+		Image:  utils.DockerRegistryImage,
+		Labels: clusterLabels(clusterID, prefix, roleRegistry, 0),
 	}, &container.HostConfig{
 		Privileged:  true, // fixme we just need proper selinux volume labeling
-		NetworkMode: container.NetworkMode("container:" + dnsmasq.ID),
-	}, nil, nil, prefix+"-registry")
+		NetworkMode: container.NetworkMode("container:" + dnsmasq),
+		Mounts: []mount.Mount{
+			{
+				Type:   mount.TypeVolume,
+				Source: registryVol,
+				Target: "/var/lib/registry",
+			},
+		},
+	})
 	if err != nil {
 		return err
 	}
-	containers <- registry.ID
-	if err := cli.ContainerStart(ctx, registry.ID, container.StartOptions{}); err != nil {
+	containers <- registry
+	if err := cli.ContainerStart(ctx, registry); err != nil {
 		return err
 	}
 
@@ -606,18 +786,21 @@ func run(cmd *cobra.Command, args []string) (retErr error) {
 			return err
 		}
 		// Pull the nfs image
-		err = docker.ImagePull(cli, ctx, utils.NFSServerImage, image.PullOptions{})
+		err = events.Phase(emitter, 0, "nfs-image-pull", func() error {
+			return docker.ImagePull(cli, ctx, utils.NFSServerImage, stdOutput.stdout)
+		})
 		if err != nil {
 			panic(err)
 		}
 
 		// Start the nfs container
-		nfsServer, err := cli.ContainerCreate(ctx, &container.Config{
+		nfsServer, err := cli.ContainerCreate(ctx, prefix+"-nfs", &container.Config{
 			Image: utils.NFSServerImage,
 			Env: []string{
 				"NFS_DIR=/data/nfs",
 				"NFS_OPTION=fsid=0,rw,sync,insecure,no_root_squash,no_subtree_check,nohide",
 			},
+			Labels: clusterLabels(clusterID, prefix, roleNFS, 0),
 		}, &container.HostConfig{
 			Mounts: []mount.Mount{
 				{
@@ -627,94 +810,85 @@ func run(cmd *cobra.Command, args []string) (retErr error) {
 				},
 			},
 			Privileged:  true,
-			NetworkMode: container.NetworkMode("container:" + dnsmasq.ID),
-		}, nil, nil, prefix+"-nfs")
+			NetworkMode: container.NetworkMode("container:" + dnsmasq),
+		})
 		if err != nil {
 			return err
 		}
-		containers <- nfsServer.ID
-		if err := cli.ContainerStart(ctx, nfsServer.ID, container.StartOptions{}); err != nil {
+		containers <- nfsServer
+		if err := cli.ContainerStart(ctx, nfsServer); err != nil {
 			return err
 		}
 	}
 
 	sharedVolumeName := prefix + "-shared"
 	if len(sharedDisks) > 0 {
-		sharedVolume, err := cli.VolumeCreate(ctx, volume.CreateOptions{Name: sharedVolumeName})
-		if err != nil {
+		if err := cli.VolumeCreate(ctx, sharedVolumeName, clusterLabels(clusterID, prefix, roleShared, 0)); err != nil {
 			return err
 		}
-		volumes <- sharedVolume.Name
+		volumes <- sharedVolumeName
 	}
 
-	var qemuNetDevice = getNetDeviceByArch()
-	numaNodes := int(numa)
 	pcieBus := ""
-	if qemuNetDevice != QEMU_DEVICE_S390X {
+	if getNetDeviceByArch() != QEMU_DEVICE_S390X {
 		pcieBus = ",bus=pcie.0"
 	}
 
 	wg := sync.WaitGroup{}
 	wg.Add(int(nodes))
-	// start one vm after each other
-	macCounter := 0
+	linuxConfigFuncs := []nodesconfig.LinuxConfigFunc{
+		nodesconfig.WithFipsEnabled(fipsEnabled),
+		nodesconfig.WithDockerProxy(dockerProxy),
+		nodesconfig.WithEtcdInMemory(runEtcdOnMemory),
+		nodesconfig.WithEtcdSize(etcdDataMountSize),
+		nodesconfig.WithSingleStack(singleStack),
+		nodesconfig.WithFlannel(flannel),
+		nodesconfig.WithNoEtcdFsync(noEtcdFsync),
+		nodesconfig.WithEnableAudit(enableAudit),
+		nodesconfig.WithGpuAddress(gpuAddress),
+		nodesconfig.WithRealtime(realtimeSchedulingEnabled),
+		nodesconfig.WithPSA(psaEnabled),
+		nodesconfig.WithKsm(enableKsm),
+		nodesconfig.WithKsmPageCount(int(ksmPageCount)),
+		nodesconfig.WithKsmScanInterval(int(ksmScanInterval)),
+		nodesconfig.WithSwap(enableSwap),
+		nodesconfig.WithSwapiness(int(swapiness)),
+		nodesconfig.WithSwapBehavior(swapBehavior),
+		nodesconfig.WithSwapSize(int(swapSize)),
+		nodesconfig.WithSecondaryNicBridges(secondaryNicBridges),
+		nodesconfig.WithVsockChildNsMode(vsockChildNsMode),
+		nodesconfig.WithTopologyManagerPolicy(topologyManagerPolicy),
+		nodesconfig.WithReservedSystemCPUs(reservedSystemCPUs),
+	}
+
+	// start one vm after each other, or all of them at once in parallel mode
+	bootstraps := []nodeBootstrap{}
 	for x := 0; x < int(nodes); x++ {
 
-		nodeQemuArgs := qemuArgs
-		nodeQemuMonitorArgs := ""
-
-		for i := 0; i < int(secondaryNics); i++ {
-			netSuffix := fmt.Sprintf("%d-%d", x, i)
-			macSuffix := fmt.Sprintf("%02x", macCounter)
-			macCounter++
-			// Secondary network devices are added after VM is started (hot-plug) using qemu monitor to avoid
-			// primary network interface to be named other than eth0. This is mainly required for s390x, as
-			// otherwise if primary interface is other than eth0, it can't get the IP from dhcp server.
-			if qemuNetDevice == QEMU_DEVICE_S390X {
-				nodeQemuMonitorArgs = fmt.Sprintf("%s netdev_add tap,id=secondarynet%s,ifname=stap%s,script=no,downscript=no; device_add %s,netdev=secondarynet%s,mac=52:55:00:d1:56:%s;", nodeQemuMonitorArgs, netSuffix, netSuffix, qemuNetDevice, netSuffix, macSuffix)
-			} else { //devices like virtio-net-pci doesn't support hot-plug
-				rootPortArgs := ""
-				bus := "pcie.0"
-				if numaNodes > 1 {
-					numaNode := i % numaNodes
-					bus = fmt.Sprintf("secondaryrp%d", i)
-					slot := secondaryNicRootPortBaseSlot + i/numaNodes
-					rootPortArgs = fmt.Sprintf(" -device pcie-root-port,id=%s,slot=%d,chassis=%d,bus=secondarypxb%d",
-						bus,
-						slot,
-						secondaryNicRootPortBaseChass+i,
-						numaNode)
-				}
-				nodeQemuArgs = fmt.Sprintf("%s%s -device %s,netdev=secondarynet%s,mac=52:55:00:d1:56:%s,bus=%s -netdev tap,id=secondarynet%s,ifname=stap%s,script=no,downscript=no",
-					nodeQemuArgs,
-					rootPortArgs,
-					qemuNetDevice,
-					netSuffix,
-					macSuffix,
-					bus,
-					netSuffix,
-					netSuffix)
-			}
+		nodeIdx := x + 1
+		if reverse {
+			nodeIdx = int(nodes) - x
+		}
+		vm := nodeVM{
+			nodeShape:     clusterShape.withOverride(nodeOverrides[nodeIdx]),
+			QemuArgs:      qemuArgs,
+			KernelArgs:    kernelArgs,
+			SecondaryNICs: secondaryNics,
+			SharedDisks:   sharedDisks,
+			Ceph:          cephEnabled,
+			Fips:          fipsEnabled,
 		}
 
-		nodeName := nodeNameFromIndex(x + 1)
-		nodeNum := fmt.Sprintf("%02d", x+1)
-		sshClient, err = libssh.NewSSHClient(sshPort, x+1, false)
+		nodeName := nodeNameFromIndex(nodeIdx)
+		nodeNum := fmt.Sprintf("%02d", nodeIdx)
+		addresses, err := ipam.NodeAddresses(nodeIdx)
 		if err != nil {
 			return err
 		}
-		if reverse {
-			nodeName = nodeNameFromIndex((int(nodes) - x))
-			nodeNum = fmt.Sprintf("%02d", (int(nodes) - x))
-			sshClient, err = libssh.NewSSHClient(sshPort, (int(nodes) - x), false)
-
-			if err != nil {
-				return err
-			}
-		}
 
 		// assign a GPU to one node
 		var deviceMappings []container.DeviceMapping
+		gpuQemuArgs := ""
 		if gpuAddress != "" && x == int(nodes)-1 {
 			iommu_group, err := getPCIDeviceIOMMUGroup(gpuAddress)
 			if err != nil {
@@ -733,252 +907,107 @@ func run(cmd *cobra.Command, args []string) (retErr error) {
 					CgroupPermissions: "mrw",
 				},
 			}
-			nodeQemuArgs = fmt.Sprintf("%s -device vfio-pci,host=%s%s", nodeQemuArgs, gpuAddress, pcieBus)
+			gpuQemuArgs = fmt.Sprintf(" -device vfio-pci,host=%s%s", gpuAddress, pcieBus)
 		}
 
-		var vmArgsNvmeDisks []string
-		if len(nvmeDisks) > 0 {
-			for i, size := range nvmeDisks {
-				resource.MustParse(size)
-				disk := fmt.Sprintf("%s-%d.img", nvmeDiskImagePrefix, i)
-				nodeQemuArgs = fmt.Sprintf("%s -drive file=%s,format=raw,id=NVME%d,if=none -device nvme,drive=NVME%d,serial=nvme-%d%s", nodeQemuArgs, disk, i, i, i, pcieBus)
-				vmArgsNvmeDisks = append(vmArgsNvmeDisks, fmt.Sprintf("--nvme-device-size %s", size))
-			}
-		}
-		var vmArgsSCSIDisks []string
-		if len(scsiDisks) > 0 {
-			nodeQemuArgs = fmt.Sprintf("%s -device virtio-scsi-pci,id=scsi0%s", nodeQemuArgs, pcieBus)
-			for i, size := range scsiDisks {
-				resource.MustParse(size)
-				disk := fmt.Sprintf("%s-%d.img", scsiDiskImagePrefix, i)
-				nodeQemuArgs = fmt.Sprintf("%s -drive file=%s,if=none,id=drive%d -device scsi-hd,drive=drive%d,bus=scsi0.0,channel=0,scsi-id=0,lun=%d", nodeQemuArgs, disk, i, i, i)
-				vmArgsSCSIDisks = append(vmArgsSCSIDisks, fmt.Sprintf("--scsi-device-size %s", size))
-			}
-		}
-
-		var vmArgsUSBDisks []string
-		bus := " -device qemu-xhci,id=bus%d" + pcieBus
-		const drive = " -drive if=none,id=stick%d,format=raw,file=/usb-%d.img"
-		const dev = " -device usb-storage,bus=bus%d.0,drive=stick%d"
-		const usbSizefmt = " --usb-device-size %s"
-		if len(usbDisks) > 0 {
-			for i, size := range usbDisks {
-				resource.MustParse(size)
-				if i%2 == 0 {
-					nodeQemuArgs += fmt.Sprintf(bus, i/2)
-				}
-				nodeQemuArgs += fmt.Sprintf(drive, i, i)
-				nodeQemuArgs += fmt.Sprintf(dev, i/2, i)
-				vmArgsUSBDisks = append(vmArgsUSBDisks, fmt.Sprintf(usbSizefmt, size))
-			}
-		}
-
-		var vmArgsSharedDisks []string
-		if len(sharedDisks) > 0 {
-			for i, size := range sharedDisks {
-				pciOffset := i + 1
-				resource.MustParse(size)
-				disk := fmt.Sprintf("/shared/disk%d.img", i)
-				blockDev := fmt.Sprintf("-blockdev file,filename=%s,node-name=shared-disk-%d,read-only=off,cache.direct=on,cache.no-flush=off", disk, i)
-				device1 := fmt.Sprintf("-device pcie-root-port,id=pci.%d,bus=pcie.0", pciOffset)
-				device2 := fmt.Sprintf("-device virtio-blk-pci,bus=pci.%d,drive=shared-disk-%d,id=shared-disk-%d,share-rw=on,write-cache=on,werror=stop,rerror=stop", pciOffset, i, i)
-				nodeQemuArgs = fmt.Sprintf("%s %s %s %s", nodeQemuArgs, blockDev, device1, device2)
-				vmArgsSharedDisks = append(vmArgsSCSIDisks, fmt.Sprintf("--shared-device-size %s", size))
-			}
-		}
-
-		additionalArgs := []string{}
-		if len(nodeQemuArgs) > 0 {
-			additionalArgs = append(additionalArgs, "--qemu-args", shellescape.Quote(nodeQemuArgs))
-		}
-
-		if len(nodeQemuMonitorArgs) > 0 {
-			additionalArgs = append(additionalArgs, "--qemu-monitor-args", shellescape.Quote(nodeQemuMonitorArgs))
-		}
-
-		if hugepages2Mcount > 0 {
-			kernelArgs += fmt.Sprintf(" hugepagesz=2M hugepages=%d", hugepages2Mcount)
-		}
-
-		if hugepages1Gcount > 0 {
-			kernelArgs += fmt.Sprintf(" hugepagesz=1G hugepages=%d", hugepages1Gcount)
-		}
-
-		if fipsEnabled {
-			kernelArgs += " fips=1"
+		vmCmd, err := vm.command(x, gpuQemuArgs)
+		if err != nil {
+			return err
 		}
 
-		blockDev := ""
-		if cephEnabled {
-			blockDev = "--block-device /var/run/disk/blockdev.qcow2 --block-device-size 32212254720"
+		n := nodesconfig.NewNodeLinuxConfig(nodeIdx, prefix, nodeLinuxConfigFuncs(linuxConfigFuncs, nodeOverrides[nodeIdx]))
+		labels := clusterLabels(clusterID, prefix, roleNode, nodeIdx)
+		if labels[labelLinuxConfig], err = encodeLinuxConfig(n); err != nil {
+			return err
 		}
-
-		kernelArgs = strings.TrimSpace(kernelArgs)
-		if kernelArgs != "" {
-			additionalArgs = append(additionalArgs, "--additional-kernel-args", shellescape.Quote(kernelArgs))
+		if labels[labelVM], err = encodeNodeVM(nodeIdx, &vm); err != nil {
+			return err
 		}
 
 		vmContainerConfig := &container.Config{
 			Image: clusterImage,
-			Env: append([]string{
+			Env: append(append([]string{
 				fmt.Sprintf("NODE_NUM=%s", nodeNum),
-			}, utils.ForwardEnv("PROW_JOB_ID", "CI")...),
-			Cmd: []string{"/bin/bash", "-c", fmt.Sprintf("/vm.sh -n /var/run/disk/disk.qcow2 --memory %s --cpu %s --numa %s %s %s %s %s %s %s",
-				memory,
-				strconv.Itoa(int(cpu)),
-				strconv.Itoa(int(numa)),
-				blockDev,
-				strings.Join(vmArgsSCSIDisks, " "),
-				strings.Join(vmArgsNvmeDisks, " "),
-				strings.Join(vmArgsUSBDisks, " "),
-				strings.Join(vmArgsSharedDisks, " "),
-				strings.Join(additionalArgs, " "),
-			)},
+			}, nodeAddressEnv(addresses)...), utils.ForwardEnv("PROW_JOB_ID", "CI")...),
+			Cmd:    vmCmd,
+			Labels: labels,
+		}
+
+		if allowSnapshots {
+			vmContainerConfig.Env = append(vmContainerConfig.Env, vmMigratableEnv)
 		}
 
 		hostConfig := &container.HostConfig{
 			Privileged:  true,
-			NetworkMode: container.NetworkMode("container:" + dnsmasq.ID),
+			NetworkMode: container.NetworkMode("container:" + dnsmasq),
 			Resources: container.Resources{
 				Devices: deviceMappings,
 			},
 		}
+		vmContainerConfig.Volumes, hostConfig.Mounts = vm.volumes(sharedVolumeName)
 
-		if cephEnabled {
-			vmContainerConfig.Volumes = map[string]struct{}{
-				"/var/lib/rook": {},
-			}
-		}
-
-		if len(sharedDisks) > 0 {
-			if vmContainerConfig.Volumes == nil {
-				vmContainerConfig.Volumes = map[string]struct{}{}
-			}
-			vmContainerConfig.Volumes["/shared"] = struct{}{}
-			hostConfig.Mounts = append(hostConfig.Mounts, mount.Mount{
-				Type:   mount.TypeVolume,
-				Source: sharedVolumeName,
-				Target: "/shared",
-			})
-		}
-
-		node, err := cli.ContainerCreate(ctx, vmContainerConfig, hostConfig, nil, nil, prefix+"-"+nodeName)
+		node, err := cli.ContainerCreate(ctx, prefix+"-"+nodeName, vmContainerConfig, hostConfig)
 		if err != nil {
 			return err
 		}
-		containers <- node.ID
-		if err := cli.ContainerStart(ctx, node.ID, container.StartOptions{}); err != nil {
-			return err
-		}
-
-		// Wait for vm start
-		success, err := docker.Exec(cli, nodeContainer(prefix, nodeName), []string{"/bin/bash", "-c", "while [ ! -f /ssh_ready ] ; do sleep 1; done"}, os.Stdout)
-		if err != nil {
+		containers <- node
+		if err := cli.ContainerStart(ctx, node); err != nil {
 			return err
 		}
 
-		if !success {
-			return fmt.Errorf("checking for ssh.sh script for node %s failed", nodeName)
-		}
-
-		err = waitForVMToBeUp(cli, prefix, nodeName)
-		if err != nil {
-			return err
-		}
+		b := nodeBootstrap{name: nodeName, rootKeyIdx: nodeIdx, config: n}
 
-		rootkey := rootkey.NewRootKey(sshClient)
-		if err = rootkey.Exec(); err != nil {
+		if parallelism > 0 {
+			bootstraps = append(bootstraps, b)
+		} else if err = bootstrapNode(cli, prefix, sshPort, b, nil, stdOutput); err != nil {
 			return err
 		}
-		sshClient, err = libssh.NewSSHClient(sshPort, x+1, true)
-		if err != nil {
-			return err
-		}
-
-		linuxConfigFuncs := []nodesconfig.LinuxConfigFunc{
-			nodesconfig.WithFipsEnabled(fipsEnabled),
-			nodesconfig.WithDockerProxy(dockerProxy),
-			nodesconfig.WithEtcdInMemory(runEtcdOnMemory),
-			nodesconfig.WithEtcdSize(etcdDataMountSize),
-			nodesconfig.WithSingleStack(singleStack),
-			nodesconfig.WithFlannel(flannel),
-			nodesconfig.WithNoEtcdFsync(noEtcdFsync),
-			nodesconfig.WithEnableAudit(enableAudit),
-			nodesconfig.WithGpuAddress(gpuAddress),
-			nodesconfig.WithRealtime(realtimeSchedulingEnabled),
-			nodesconfig.WithPSA(psaEnabled),
-			nodesconfig.WithKsm(enableKsm),
-			nodesconfig.WithKsmPageCount(int(ksmPageCount)),
-			nodesconfig.WithKsmScanInterval(int(ksmScanInterval)),
-			nodesconfig.WithSwap(enableSwap),
-			nodesconfig.WithSwapiness(int(swapiness)),
-			nodesconfig.WithSwapBehavior(swapBehavior),
-			nodesconfig.WithSwapSize(int(swapSize)),
-			nodesconfig.WithSecondaryNicBridges(secondaryNicBridges),
-			nodesconfig.WithVsockChildNsMode(vsockChildNsMode),
-			nodesconfig.WithTopologyManagerPolicy(topologyManagerPolicy),
-			nodesconfig.WithReservedSystemCPUs(reservedSystemCPUs),
-		}
 
-		n := nodesconfig.NewNodeLinuxConfig(x+1, prefix, linuxConfigFuncs)
+		go func(id string) {
+			_, _ = cli.ContainerWait(ctx, id)
+			wg.Done()
+		}(node)
+	}
 
-		if err = provisionNode(sshClient, n); err != nil {
+	if parallelism > 0 {
+		if err = bootstrapNodesConcurrently(ctx, cli, prefix, sshPort, bootstraps, int(parallelism)); err != nil {
 			return err
 		}
-
-		go func(id string) {
-			cli.ContainerWait(ctx, id, container.WaitConditionNotRunning)
-			wg.Done()
-		}(node.ID)
 	}
 
-	sshClient, err := libssh.NewSSHClient(sshPort, 1, true)
+	sshClient, err := newSSHClient(sshPort, 1, true)
 	if err != nil {
 		return err
 	}
+	sshClient.SetOutput(stdOutput.stdout, stdOutput.stderr)
 
-	k8sConfs := []nodesconfig.K8sConfigFunc{
-		nodesconfig.WithCeph(cephEnabled),
-		nodesconfig.WithPrometheus(prometheusEnabled),
-		nodesconfig.WithAlertmanager(prometheusAlertmanagerEnabled),
-		nodesconfig.WithGrafana(grafanaEnabled),
-		nodesconfig.WithIstio(istioEnabled),
-		nodesconfig.WithNfsCsi(nfsCsiEnabled),
-		nodesconfig.WithCnao(cnaoEnabled),
-		nodesconfig.WithCNAOSkipCR(cnaoSkipCR),
-		nodesconfig.WithDNC(deployDNC),
-		nodesconfig.WithMultus(deployMultus),
-		nodesconfig.WithCdi(deployCdi),
-		nodesconfig.WithCdiVersion(cdiVersion),
-		nodesconfig.WithAAQ(deployAaq),
-		nodesconfig.WithAAQVersion(aaqVersion),
-		nodesconfig.WithNetworkResourcesInjector(deployNetworkResourcesInjector),
-	}
-	n := nodesconfig.NewNodeK8sConfig(k8sConfs)
-
-	kubeConfFile, err := os.Create(".kubeconfig")
+	k8sClient, err := nodeK8sClient(sshClient, apiServerPort)
 	if err != nil {
 		return err
 	}
 
-	err = sshClient.CopyRemoteFile("/etc/kubernetes/admin.conf", kubeConfFile)
+	nodeClients, err := rootSSHClients(sshPort, int(nodes))
 	if err != nil {
 		return err
 	}
 
-	config, err := k8s.NewConfig(".kubeconfig", apiServerPort)
-	if err != nil {
-		return err
+	if offline {
+		err = events.Phase(emitter, 0, "offline-images", func() error {
+			return sideloadOptImages(ctx, cli, cmd.OutOrStdout(), nodeClients, sshPort, offlineOptImages)
+		})
+		if err != nil {
+			return err
+		}
 	}
 
-	k8sClient, err := k8s.NewDynamicClient(config)
+	err = events.Phase(emitter, 0, "k8s", func() error {
+		return provisionK8sOptions(sshClient, k8sClient, k8sConfig, cluster, addonK8sOpts(addons, nodeClients)...)
+	})
 	if err != nil {
 		return err
 	}
 
-	if err = provisionK8sOptions(sshClient, k8sClient, n, prefix); err != nil {
-		return err
-	}
+	reportTimings()
 
 	// If background flag was specified, we don't want to clean up if we reach that state
 	if !background {
@@ -989,69 +1018,73 @@ func run(cmd *cobra.Command, args []string) (retErr error) {
 	return nil
 }
 
-func provisionK8sOptions(sshClient libssh.Client, k8sClient k8s.K8sDynamicClient, n *nodesconfig.NodeK8sConfig, k8sVersion string) error {
-	opts := []opts.Opt{}
-
-	if n.Ceph {
-		cephOpt := rookceph.NewCephOpt(k8sClient, sshClient)
-		opts = append(opts, cephOpt)
+// loadClusterSpec applies the optional cluster spec to the flags which were not set explicitly
+// and returns the cluster to run, taken from the positional argument or the spec provider
+func loadClusterSpec(cmd *cobra.Command, args []string) (string, error) {
+	cluster := ""
+	if len(args) > 0 {
+		cluster = args[0]
 	}
 
-	if n.NfsCsi {
-		nfsCsiOpt := nfscsi.NewNfsCsiOpt(k8sClient)
-		opts = append(opts, nfsCsiOpt)
-	}
-
-	if n.Multus {
-		multusOpt := multus.NewMultusOpt(k8sClient, sshClient)
-		opts = append(opts, multusOpt)
-	}
-
-	if n.CNAO {
-		cnaoOpt := cnao.NewCnaoOpt(k8sClient, sshClient, n.Multus, n.DNC, n.CNAOSkipCR)
-		opts = append(opts, cnaoOpt)
-	}
-
-	if n.Istio {
-		istioOpt := istio.NewIstioOpt(sshClient, k8sClient, n.CNAO)
-		opts = append(opts, istioOpt)
+	configFile, err := cmd.Flags().GetString("config")
+	if err != nil {
+		return "", err
 	}
 
-	if n.Prometheus {
-		prometheusOpt := prometheus.NewPrometheusOpt(k8sClient, n.Grafana, n.Alertmanager)
-		opts = append(opts, prometheusOpt)
+	if configFile != "" {
+		spec, err := clusterspec.LoadFile(configFile)
+		if err != nil {
+			return "", err
+		}
+		if err := spec.ApplyToFlags(cmd.Flags()); err != nil {
+			return "", err
+		}
+		if cluster == "" {
+			cluster = spec.Provider
+		}
 	}
 
-	if n.CDI {
-		cdi := cdi.NewCdiOpt(k8sClient, sshClient, n.CDIVersion)
-		opts = append(opts, cdi)
+	if cluster == "" {
+		return "", fmt.Errorf("no cluster to run was specified, pass it as an argument or set provider in the cluster spec")
 	}
+	return cluster, nil
+}
 
-	if n.AAQ {
-		if k8sVersion == "k8s-1.30" {
-			aaq := aaq.NewAaqOpt(k8sClient, sshClient, n.CDIVersion)
-			opts = append(opts, aaq)
-		} else {
-			logrus.Info("AAQ was requested but k8s version is not k8s-1.30, skipping")
-		}
+func provisionK8sOptions(sshClient libssh.Client, k8sClient k8s.K8sDynamicClient, n *nodesconfig.NodeK8sConfig, cluster string, addonOpts ...k8sOpt) error {
+	g, k8sOpts, err := newK8sOptGraph(n, cluster, addonOpts...)
+	if err != nil {
+		return err
 	}
+	sshClient = events.WrapSSHClient(emitter, 1, sshClient)
 
-	if n.NetworkResourcesInjector {
-		networkResourcesInjectorOpt := network_resources_injector.NewNetworkResourcesInjectorOpt(sshClient, k8sClient)
-		opts = append(opts, networkResourcesInjectorOpt)
-	}
+	return g.Run(func(d opts.Descriptor) opts.Opt {
+		return events.WrapOpt(emitter, 0, k8sOpts[d.Name].new(k8sClient, sshClient, n))
+	})
+}
 
-	for _, opt := range opts {
-		if err := opt.Exec(); err != nil {
-			return err
+// rootSSHClients returns a root client for every node starting with node01, add-ons run their node scripts through them
+func rootSSHClients(sshPort uint16, nodes int) ([]libssh.Client, error) {
+	clients := []libssh.Client{}
+	for nodeIdx := 1; nodeIdx <= nodes; nodeIdx++ {
+		c, err := newSSHClient(sshPort, nodeIdx, true)
+		if err != nil {
+			return nil, err
 		}
+		c.SetOutput(stdOutput.stdout, stdOutput.stderr)
+		clients = append(clients, events.WrapSSHClient(emitter, nodeIdx, c))
 	}
-
-	return nil
+	return clients, nil
 }
 
 func provisionNode(sshClient libssh.Client, n *nodesconfig.NodeLinuxConfig) error {
+	return provisionNodeWithGate(cli, sshClient, n, nil, stdOutput)
+}
+
+// provisionNodeWithGate provisions a node, ordering the kubeadm join of workers after the kubeadm init of node01
+// through gate. A nil gate runs the opts without any ordering, as nodes are then provisioned one after the other
+func provisionNodeWithGate(cli docker.Runtime, sshClient libssh.Client, n *nodesconfig.NodeLinuxConfig, gate *joinGate, out nodeOutput) error {
 	opts := []opts.Opt{}
+	sshClient = events.WrapSSHClient(emitter, n.NodeIdx, sshClient)
 	nodeName := nodeNameFromIndex(n.NodeIdx)
 
 	if n.FipsEnabled {
@@ -1060,7 +1093,7 @@ func provisionNode(sshClient libssh.Client, n *nodesconfig.NodeLinuxConfig) erro
 				return fmt.Errorf("starting fips mode failed: %s", err)
 			}
 		}
-		err := waitForVMToBeUp(cli, n.K8sVersion, nodeName)
+		err := waitForVMToBeUp(cli, n.K8sVersion, nodeName, out)
 		if err != nil {
 			return err
 		}
@@ -1105,7 +1138,7 @@ func provisionNode(sshClient libssh.Client, n *nodesconfig.NodeLinuxConfig) erro
 
 	if n.NodeIdx == 1 {
 		n := node01.NewNode01Provisioner(sshClient, n.SingleStack, n.Flannel, n.NoEtcdFsync, n.SecondaryNicBridges)
-		opts = append(opts, n)
+		opts = append(opts, gate.initOpt(n))
 
 	} else {
 		if n.GpuAddress != "" {
@@ -1117,8 +1150,8 @@ func provisionNode(sshClient libssh.Client, n *nodesconfig.NodeLinuxConfig) erro
 			bindVfioOpt := bindvfio.NewBindVfioOpt(sshClient, gpuDeviceID)
 			opts = append(opts, bindVfioOpt)
 		}
-		n := nodesprovision.NewNodesProvisioner(n.K8sVersion, sshClient, n.SingleStack, n.SecondaryNicBridges, n.TopologyManagerPolicy, n.ReservedSystemCPUs)
-		opts = append(opts, n)
+		n := nodesprovision.NewNodesProvisioner(n.K8sVersion, sshClient, n.SingleStack, n.SecondaryNicBridges, n.TopologyManagerPolicy, n.ReservedSystemCPUs, n.JoinToken)
+		opts = append(opts, gate.joinOpt(n))
 	}
 
 	if n.KsmEnabled {
@@ -1140,7 +1173,7 @@ func provisionNode(sshClient libssh.Client, n *nodesconfig.NodeLinuxConfig) erro
 	}
 
 	for _, o := range opts {
-		if err := o.Exec(); err != nil {
+		if err := events.WrapOpt(emitter, n.NodeIdx, o).Exec(); err != nil {
 			return err
 		}
 	}
@@ -1148,16 +1181,16 @@ func provisionNode(sshClient libssh.Client, n *nodesconfig.NodeLinuxConfig) erro
 	return nil
 }
 
-func waitForVMToBeUp(cli *client.Client, prefix string, nodeName string) error {
-	logContainerDiagnostics(cli, prefix, nodeName, "pre-ssh")
+func waitForVMToBeUp(cli docker.Runtime, prefix string, nodeName string, out nodeOutput) error {
+	logContainerDiagnostics(cli, prefix, nodeName, "pre-ssh", out.stderr)
 	var err error
 	for x := 0; x < 5; x++ {
-		err = _cmd(cli, nodeContainer(prefix, nodeName), "ssh.sh echo VM is up", "waiting for node to come up")
+		err = _cmdWithOutput(cli, nodeContainer(prefix, nodeName), "ssh.sh echo VM is up", "waiting for node to come up", out.stdout)
 		if err == nil {
 			break
 		}
 		logrus.WithError(err).Warningf("Could not establish a ssh connection to the VM, retrying ...")
-		logContainerDiagnostics(cli, prefix, nodeName, fmt.Sprintf("retry-%d", x+1))
+		logContainerDiagnostics(cli, prefix, nodeName, fmt.Sprintf("retry-%d", x+1), out.stderr)
 		time.Sleep(1 * time.Second)
 	}
 
@@ -1165,11 +1198,16 @@ func waitForVMToBeUp(cli *client.Client, prefix string, nodeName string) error {
 		return fmt.Errorf("could not establish a connection to the node after a generous timeout: %v", err)
 	}
 
-	logContainerDiagnostics(cli, prefix, nodeName, "ssh-ok")
+	logContainerDiagnostics(cli, prefix, nodeName, "ssh-ok", out.stderr)
 	return nil
 }
 
-func logContainerDiagnostics(cli *client.Client, prefix string, nodeName string, phase string) {
+func logContainerDiagnostics(cli docker.Runtime, prefix string, nodeName string, phase string, out io.Writer) {
+	docker.Exec(cli, nodeContainer(prefix, nodeName), []string{"/bin/bash", "-c", diagnosticsCommand(nodeName, phase)}, out)
+}
+
+// diagnosticsCommand prints the resource usage of a node container and its QEMU
+func diagnosticsCommand(nodeName string, phase string) string {
 	diagCmd := `echo "=== resource snapshot (%s, %s) ===" && date -Iseconds && ` +
 		`echo "--- loadavg ---" && cat /proc/loadavg && ` +
 		`echo "--- memory ---" && free -m && ` +
@@ -1179,8 +1217,7 @@ func logContainerDiagnostics(cli *client.Client, prefix string, nodeName string,
 		`echo "--- top cpu consumers ---" && ps -eo pid,pcpu,pmem,comm --sort=-pcpu 2>/dev/null | head -10 && ` +
 		`echo "--- qemu process ---" && (ps aux 2>/dev/null | grep qemu-system | grep -v grep || echo "QEMU NOT RUNNING") && ` +
 		`echo "--- oom kills ---" && (dmesg 2>/dev/null | grep -i -E 'oom|killed|out.of.memory' | tail -5 || true)`
-	cmd := fmt.Sprintf(diagCmd, nodeName, phase)
-	docker.Exec(cli, nodeContainer(prefix, nodeName), []string{"/bin/bash", "-c", cmd}, os.Stderr)
+	return fmt.Sprintf(diagCmd, nodeName, phase)
 }
 
 func nodeNameFromIndex(x int) string {
@@ -1229,3 +1266,23 @@ func getNetDeviceByArch() string {
 		return QEMU_DEVICE_X86_64
 	}
 }
+
+// providerImage returns the image of a provider cluster, it has no registry if containerRegistry is empty
+func providerImage(cluster string, containerRegistry string, containerOrg string, containerSuffix string, slim bool) string {
+	// Check if cluster container suffix has not being override
+	// in that case use the default prefix stored at the binary
+	if containerSuffix == "" {
+		containerSuffix = images.SUFFIX
+	}
+	var clusterImage string
+	if containerSuffix != "" {
+		clusterImage = fmt.Sprintf("%s/%s%s", containerOrg, cluster, containerSuffix)
+	} else {
+		clusterImage = path.Join(containerOrg, cluster)
+	}
+
+	if slim {
+		clusterImage += "-slim"
+	}
+	return path.Join(containerRegistry, clusterImage)
+}
@@ -1,11 +1,23 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"go.uber.org/mock/gomock"
 	"kubevirt.io/kubevirtci/cluster-provision/gocli/cmd/nodesconfig"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/cmd/utils"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
 	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/aaq"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/addon"
 	bindvfio "kubevirt.io/kubevirtci/cluster-provision/gocli/opts/bind-vfio"
 	etcdinmemory "kubevirt.io/kubevirtci/cluster-provision/gocli/opts/etcd"
 	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/istio"
@@ -14,6 +26,7 @@ import (
 	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/psa"
 	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/rookceph"
 	k8s "kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/k8s"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/timing"
 	kubevirtcimocks "kubevirt.io/kubevirtci/cluster-provision/gocli/utils/mock"
 )
 
@@ -32,6 +45,7 @@ var _ = Describe("Node Provisioning", func() {
 			k8s.NewReactorConfig("create", "istiooperators", istio.IstioReactor),
 			k8s.NewReactorConfig("create", "cephblockpools", rookceph.CephReactor),
 			k8s.NewReactorConfig("create", "persistentvolumeclaims", nfscsi.NfsCsiReactor),
+			k8s.NewReactorConfig("create", "aaqs", aaq.AaqReactor),
 		}
 
 		k8sClient = k8s.NewTestClient(reactors...)
@@ -64,6 +78,27 @@ var _ = Describe("Node Provisioning", func() {
 		})
 	})
 
+	Describe("NodeOverrides", func() {
+		It("should apply the override to the node shape only", func() {
+			overrides, err := parseNodeOverrides([]string{"node02:memory=8G,nvme=10G", "node02:hugepages-1g=2"}, 3)
+			Expect(err).NotTo(HaveOccurred())
+
+			clusterShape := nodeShape{Memory: "3096M", CPU: 2, NUMA: 1, Hugepages2M: 64}
+			Expect(clusterShape.withOverride(overrides[1])).To(Equal(clusterShape))
+
+			worker := clusterShape.withOverride(overrides[2])
+			Expect(worker.Memory).To(Equal("8G"))
+			Expect(worker.NVMeDisks).To(Equal([]string{"10G"}))
+			Expect(worker.Hugepages1G).To(BeEquivalentTo(2))
+			Expect(worker.Hugepages2M).To(BeEquivalentTo(64))
+		})
+
+		It("should reject overrides for nodes which do not exist", func() {
+			_, err := parseNodeOverrides([]string{"node04:cpu=4"}, 3)
+			Expect(err).To(MatchError(ContainSubstring("only 3 nodes")))
+		})
+	})
+
 	Describe("ProvisionNodeK8sOpts", func() {
 		It("should execute the correct K8s option commands", func() {
 			k8sConfs := []nodesconfig.K8sConfigFunc{
@@ -78,11 +113,242 @@ var _ = Describe("Node Provisioning", func() {
 			n := nodesconfig.NewNodeK8sConfig(k8sConfs)
 
 			rookceph.AddExpectCalls(sshClient)
-			istio.AddExpectCalls(sshClient)
-			aaq.AddExpectCalls(sshClient)
+			Expect(istio.AddExpectCalls(sshClient, k8sClient)).To(Succeed())
 
 			err := provisionK8sOptions(sshClient, k8sClient, n, "k8s-1.30")
 			Expect(err).NotTo(HaveOccurred())
 		})
+
+		It("should reject opts the K8s version does not support", func() {
+			n := nodesconfig.NewNodeK8sConfig([]nodesconfig.K8sConfigFunc{nodesconfig.WithAAQ(true)})
+
+			err := provisionK8sOptions(sshClient, k8sClient, n, "k8s-1.31")
+			Expect(err).To(MatchError(ContainSubstring("aaq requires K8s 1.30.x but the cluster runs 1.31.0")))
+		})
+
+		It("should order add-ons after the built-in opts they depend on", func() {
+			n := nodesconfig.NewNodeK8sConfig([]nodesconfig.K8sConfigFunc{nodesconfig.WithMultus(true)})
+			addons := []*addon.Addon{{Name: "sriov", DependsOn: []string{"multus"}}}
+
+			g, _, err := newK8sOptGraph(n, "k8s-1.30", addonK8sOpts(addons, nil)...)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(g.Levels()).To(Equal([][]string{{"multus"}, {"sriov"}}))
+		})
+
+		It("should reject settings of opts which are not enabled", func() {
+			n := nodesconfig.NewNodeK8sConfig([]nodesconfig.K8sConfigFunc{
+				nodesconfig.WithDNC(true),
+				nodesconfig.WithCNAOSkipCR(true),
+				nodesconfig.WithGrafana(true),
+				nodesconfig.WithAlertmanager(true),
+			})
+
+			_, _, err := newK8sOptGraph(n, "k8s-1.30")
+			Expect(err).To(MatchError("invalid opt combination: dnc requires cnao to be enabled, cnao-skip-cr requires cnao to be enabled, " +
+				"grafana requires prometheus to be enabled, alertmanager requires prometheus to be enabled"))
+		})
+
+		It("should leave the settings out of the opts which run", func() {
+			n := nodesconfig.NewNodeK8sConfig([]nodesconfig.K8sConfigFunc{
+				nodesconfig.WithCnao(true),
+				nodesconfig.WithDNC(true),
+				nodesconfig.WithPrometheus(true),
+				nodesconfig.WithGrafana(true),
+			})
+
+			g, _, err := newK8sOptGraph(n, "k8s-1.30")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(g.Levels()).To(Equal([][]string{{"cnao", "prometheus"}}))
+		})
+
+		It("should reject add-ons named like a built-in opt", func() {
+			n := nodesconfig.NewNodeK8sConfig([]nodesconfig.K8sConfigFunc{})
+			addons := []*addon.Addon{{Name: "cdi"}}
+
+			_, _, err := newK8sOptGraph(n, "k8s-1.30", addonK8sOpts(addons, nil)...)
+			Expect(err).To(MatchError(ContainSubstring("add-on cdi can't be deployed")))
+		})
+	})
+})
+
+// outputSSHClient adds the output redirection of libssh clients to the mock
+type outputSSHClient struct {
+	*kubevirtcimocks.MockSSHClient
+}
+
+func (outputSSHClient) SetOutput(_, _ io.Writer) {}
+
+var _ = Describe("Run", func() {
+	var runtime *docker.FakeRuntime
+
+	BeforeEach(func() {
+		runtime = docker.NewFakeRuntime()
+		setupFakeCluster(runtime, nil)
+	})
+
+	// the prefix names the provider, the node opts take the K8s version from it
+	runCluster := func(args ...string) error {
+		_, err := gocli(append([]string{"run", "k8s-1.30"}, args...)...)
+		return err
+	}
+
+	It("should only write the events to the stdout of the command with --output json", func() {
+		stdout := os.Stdout
+		out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+		root := NewRootCommand()
+		root.SetOut(out)
+		root.SetErr(errOut)
+		root.SetArgs([]string{"run", "k8s-1.30", "--prefix", "k8s-1.30", "--output", "json"})
+		Expect(root.Execute()).To(Succeed())
+
+		Expect(os.Stdout).To(BeIdenticalTo(stdout))
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		Expect(lines).To(ContainElement(ContainSubstring(`"phase":"dnsmasq"`)))
+		for _, line := range lines {
+			Expect(json.Valid([]byte(line))).To(BeTrue(), line)
+		}
+		Expect(errOut.String()).To(ContainSubstring("Critical path:"))
+
+		By("not emitting the events of the next invocation to the same writer")
+		received := out.Len()
+		Expect(runCluster("--prefix", "k8s-1.30-2")).To(Succeed())
+		Expect(out.Len()).To(Equal(received))
+	})
+
+	It("should report the time spent pulling every image", func() {
+		Expect(runCluster("--nfs-data", GinkgoT().TempDir(), "--timing-report", "timings.json")).To(Succeed())
+
+		data, err := os.ReadFile("timings.json")
+		Expect(err).NotTo(HaveOccurred())
+		report := &timing.Summary{}
+		Expect(json.Unmarshal(data, report)).To(Succeed())
+		keys := []string{}
+		for _, step := range report.Steps {
+			keys = append(keys, step.Key())
+		}
+		Expect(keys).To(ContainElements("phase image-pull", "phase registry-image-pull", "phase nfs-image-pull"))
+
+		By("printing the report to the stdout of the command")
+		out, err := gocli("report", "timings.json")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(ContainSubstring("phase registry-image-pull"))
+		out, err = gocli("report", "timings.json", "timings.json")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(HavePrefix("STEP"))
+	})
+
+	It("should reject settings of opts which are not enabled before creating any container", func() {
+		Expect(runCluster("--deploy-dnc")).To(MatchError(ContainSubstring("dnc requires cnao to be enabled")))
+		Expect(runCluster("--enable-grafana")).To(MatchError(ContainSubstring("grafana requires prometheus to be enabled")))
+		Expect(runtime.Pulled).To(BeEmpty())
+		containers, err := runtime.ContainerList(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(containers).To(BeEmpty())
+	})
+
+	DescribeTable("should accept the flags cluster-up passes", func(env ...string) {
+		// the opts wait for their operators to roll out
+		setupFakeCluster(runtime, k8s.NewTestClient(
+			k8s.NewReactorConfig("create", "deployments", k8s.RolloutReactor),
+			k8s.NewReactorConfig("create", "daemonsets", k8s.RolloutReactor),
+		))
+		Expect(gocli(append([]string{"run"}, clusterUpParams(env...)...)...)).Error().To(Succeed())
+	},
+		Entry("by default"),
+		Entry("with CNAO and its settings", "KUBEVIRT_WITH_CNAO=true", "KUBEVIRT_WITH_DYN_NET_CTRL=true", "KUBVIRT_WITH_CNAO_SKIP_CONFIG=true"),
+		Entry("with CNAO from the extra args", "KUBEVIRT_PROVIDER_EXTRA_ARGS=--enable-cnao", "KUBEVIRT_WITH_DYN_NET_CTRL=true"),
+		Entry("with the settings of CNAO but without it", "KUBEVIRT_WITH_DYN_NET_CTRL=true", "KUBVIRT_WITH_CNAO_SKIP_CONFIG=true"),
+		Entry("with Prometheus and its add-ons", "KUBEVIRT_DEPLOY_PROMETHEUS=true", "KUBEVIRT_DEPLOY_PROMETHEUS_ALERTMANAGER=true", "KUBEVIRT_DEPLOY_GRAFANA=true"),
+		Entry("with the add-ons of Prometheus but without it", "KUBEVIRT_DEPLOY_PROMETHEUS_ALERTMANAGER=true", "KUBEVIRT_DEPLOY_GRAFANA=true"),
+	)
+
+	It("should bring up the cluster containers", func() {
+		Expect(runCluster("--nodes", "2")).To(Succeed())
+
+		Expect(runtime.Pulled).To(ConsistOf("quay.io/kubevirtci/k8s-1.30:latest", utils.DockerRegistryImage))
+		dnsmasq, ok := runtime.Container("k8s-1.30-dnsmasq")
+		Expect(ok).To(BeTrue())
+		for _, name := range []string{"k8s-1.30-registry", "k8s-1.30-node01", "k8s-1.30-node02"} {
+			c, ok := runtime.Container(name)
+			Expect(ok).To(BeTrue(), name)
+			Expect(c.Running).To(BeTrue(), name)
+			Expect(c.HostConfig.NetworkMode.ConnectedContainer()).To(Equal(dnsmasq.ID), name)
+		}
+
+		node02, _ := runtime.Container("k8s-1.30-node02")
+		Expect(node02.Config.Env).To(ContainElements("NODE_NUM=02", "NODE_IP=192.168.66.102"))
+		Expect(runtime.Execs).To(ContainElement(docker.FakeExec{
+			Container: "k8s-1.30-node02",
+			Cmd:       []string{"/bin/bash", "-c", "ssh.sh echo VM is up"},
+		}))
+	})
+
+	It("should attach the linux settings of a node to its own container with --reverse", func() {
+		Expect(runCluster("--nodes", "2", "--reverse")).To(Succeed())
+
+		for idx, name := range map[int]string{1: "k8s-1.30-node01", 2: "k8s-1.30-node02"} {
+			c, _ := runtime.Container(name)
+			n, ok := decodeLinuxConfig(c.Config.Labels)
+			Expect(ok).To(BeTrue(), name)
+			Expect(n.NodeIdx).To(Equal(idx), name)
+		}
+	})
+
+	It("should remove the cluster containers if a node does not come up", func() {
+		runtime.ExecHandler = func(c *docker.FakeContainer, cmd []string, _ io.Writer) int {
+			if c.Name == "k8s-1.30-node01" && strings.Contains(strings.Join(cmd, " "), "/ssh_ready") {
+				return 1
+			}
+			return 0
+		}
+
+		Expect(runCluster("--gather-dir", "gather")).To(MatchError(ContainSubstring("checking for ssh.sh script for node node01 failed")))
+		containers, err := runtime.ContainerList(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(containers).To(BeEmpty())
+
+		By("gathering the diagnostics before the cleanup")
+		bundles, err := filepath.Glob("gather/k8s-1.30-gather-*.tar.gz")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bundles).To(HaveLen(1))
+		files := bundleFiles(bundles[0])
+		Expect(files).To(HaveKey("containers/k8s-1.30-node01.log"))
+		Expect(files["events.jsonl"]).To(ContainSubstring(`"phase":"dnsmasq"`))
+	})
+
+	It("should not gather the diagnostics of a failed run without --gather-dir", func() {
+		runtime.ExecHandler = func(c *docker.FakeContainer, cmd []string, _ io.Writer) int {
+			if c.Name == "k8s-1.30-node01" && strings.Contains(strings.Join(cmd, " "), "/ssh_ready") {
+				return 1
+			}
+			return 0
+		}
+
+		Expect(runCluster()).NotTo(Succeed())
+		bundles, err := filepath.Glob("k8s-1.30-gather-*.tar.gz")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bundles).To(BeEmpty())
+	})
+
+	It("should gather the diagnostics of failed cluster-up runs into the CI artifacts", func() {
+		Expect(strings.Join(clusterUpParams(), " ")).NotTo(ContainSubstring("--gather-dir"))
+		Expect(strings.Join(clusterUpParams("ARTIFACTS="+GinkgoT().TempDir()), " ")).To(ContainSubstring("--gather-dir /kubevirtci_artifacts"))
 	})
 })
+
+// clusterUpDir is resolved before the specs change into their temporary directories
+var clusterUpDir, _ = filepath.Abs("../../../cluster-up")
+
+// clusterUpParams returns the flags cluster-up passes to gocli run for the provider k8s-1.30 with the given
+// environment variables set
+func clusterUpParams(env ...string) []string {
+	script := exec.Command("bash", "-c", "source hack/common.sh && source cluster/ephemeral-provider-common.sh && _add_common_params")
+	script.Dir = clusterUpDir
+	script.Env = append(os.Environ(), "KUBEVIRT_PROVIDER=k8s-1.30", "KUBEVIRTCI_TAG=latest", "KUBEVIRTCI_RUNTIME=docker",
+		"KUBEVIRTCI_CONFIG_PATH="+GinkgoT().TempDir(), "JOB_NAME=gocli-test", "ARTIFACTS=")
+	script.Env = append(script.Env, env...)
+	script.Stderr = GinkgoWriter
+	out, err := script.Output()
+	Expect(err).NotTo(HaveOccurred())
+	return strings.Fields(string(out))
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
+	k8s "kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/k8s"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/libssh"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/registry"
+)
+
+// nodeSSHClient is a libssh.Client whose output can be redirected, nodes provisioned concurrently write to their own output
+type nodeSSHClient interface {
+	libssh.Client
+	SetOutput(stdout, stderr io.Writer)
+}
+
+// nodeShell is an interactive SSH session to a node which can forward ports through it
+type nodeShell interface {
+	Shell(ctx context.Context, cmd string, stdin *os.File, stdout, stderr io.Writer) (int, error)
+	LocalForward(ctx context.Context, local string, remote string) error
+	RemoteForward(ctx context.Context, remote string, local string) error
+}
+
+// nodeFiles copies files from and to a node
+type nodeFiles interface {
+	List(pattern string) ([]libssh.RemoteFile, error)
+	IsDir(path string) (bool, error)
+	Mkdir(path string, mode os.FileMode) error
+	Download(remotePath string, w io.Writer, passThru libssh.PassThru) error
+	Upload(r io.Reader, size int64, remotePath string, mode os.FileMode, passThru libssh.PassThru) error
+}
+
+// The clients the commands talk to the container runtime and to the cluster with, tests replace them with fakes
+var (
+	newRuntime = docker.NewRuntime
+
+	newSSHClient = func(port uint16, idx int, root bool) (nodeSSHClient, error) {
+		return libssh.NewSSHClient(port, idx, root)
+	}
+
+	newNodeShell = func(port uint16, idx int) (nodeShell, error) {
+		return libssh.NewSSHClient(port, idx, false)
+	}
+
+	newNodeFiles = func(port uint16, idx int) (nodeFiles, error) {
+		return libssh.NewSSHClient(port, idx, false)
+	}
+
+	newRegistryClient = registry.NewClient
+
+	newK8sClient = func(kubeconfig string, apiServerPort uint16) (k8s.K8sDynamicClient, error) {
+		config, err := k8s.NewConfig(kubeconfig, apiServerPort)
+		if err != nil {
+			return nil, err
+		}
+		return k8s.NewDynamicClient(config)
+	}
+)
@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/libssh"
+)
+
+type fakeFile struct {
+	dir  bool
+	mode os.FileMode
+	data string
+}
+
+// fakeNodeFiles is the file system of a node, keyed by absolute path
+type fakeNodeFiles struct {
+	idx   int
+	files map[string]fakeFile
+}
+
+func (f *fakeNodeFiles) List(pattern string) ([]libssh.RemoteFile, error) {
+	paths := slices.Sorted(maps.Keys(f.files))
+	found := []libssh.RemoteFile{}
+	for _, root := range paths {
+		if ok, _ := path.Match(pattern, root); !ok {
+			continue
+		}
+		for _, p := range paths {
+			if p != root && !strings.HasPrefix(p, root+"/") {
+				continue
+			}
+			file := f.files[p]
+			rel := strings.TrimPrefix(strings.TrimPrefix(p, root), "/")
+			found = append(found, libssh.RemoteFile{Root: root, Rel: rel, Dir: file.dir, Mode: file.mode, Size: int64(len(file.data))})
+		}
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("no such file or directory: %s", pattern)
+	}
+	return found, nil
+}
+
+func (f *fakeNodeFiles) IsDir(p string) (bool, error) {
+	return f.files[p].dir, nil
+}
+
+func (f *fakeNodeFiles) Mkdir(p string, mode os.FileMode) error {
+	f.files[p] = fakeFile{dir: true, mode: mode.Perm()}
+	return nil
+}
+
+func (f *fakeNodeFiles) Download(p string, w io.Writer, passThru libssh.PassThru) error {
+	var r io.Reader = strings.NewReader(f.files[p].data)
+	if passThru != nil {
+		r = passThru(r, int64(len(f.files[p].data)))
+	}
+	_, err := io.Copy(w, r)
+	return err
+}
+
+func (f *fakeNodeFiles) Upload(r io.Reader, _ int64, p string, mode os.FileMode, _ libssh.PassThru) error {
+	data, err := io.ReadAll(r)
+	f.files[p] = fakeFile{mode: mode.Perm(), data: string(data)}
+	return err
+}
+
+var _ = Describe("SCP", func() {
+	var files *fakeNodeFiles
+
+	BeforeEach(func() {
+		runtime := docker.NewFakeRuntime()
+		files = &fakeNodeFiles{files: map[string]fakeFile{
+			"/etc/kubevirt":          {dir: true, mode: 0o755},
+			"/etc/kubevirt/a.yaml":   {mode: 0o640, data: "a"},
+			"/etc/kubevirt/sub":      {dir: true, mode: 0o750},
+			"/etc/kubevirt/sub/b.sh": {mode: 0o755, data: "b"},
+			"/tmp":                   {dir: true, mode: 0o777},
+		}}
+
+		setupFakeCluster(runtime, nil)
+		newNodeFiles = func(_ uint16, idx int) (nodeFiles, error) {
+			files.idx = idx
+			return files, nil
+		}
+
+		_, err := gocli("run", "k8s-1.30", "--nodes", "2", "--background")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	expectFile := func(p string, mode os.FileMode, data string) {
+		info, err := os.Stat(p)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(mode), p)
+		if !info.IsDir() {
+			Expect(os.ReadFile(p)).To(BeEquivalentTo(data), p)
+		}
+	}
+
+	It("should download directories recursively and keep the permissions", func() {
+		_, err := gocli("scp", "node02:/etc/kubevirt", "out")
+		Expect(err).To(MatchError("node02:/etc/kubevirt is a directory, copy it with -r"))
+
+		_, err = gocli("scp", "-r", "node02:/etc/kubevirt", "out")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files.idx).To(Equal(2))
+		expectFile("out", 0o755, "")
+		expectFile("out/a.yaml", 0o640, "a")
+		expectFile("out/sub", 0o750, "")
+		expectFile("out/sub/b.sh", 0o755, "b")
+	})
+
+	It("should fill read-only directories before setting their mode", func() {
+		files.files["/usr/bin"] = fakeFile{dir: true, mode: 0o555}
+		files.files["/usr/bin/tool"] = fakeFile{mode: 0o755, data: "tool"}
+		files.files["/usr/bin/private"] = fakeFile{dir: true, mode: 0o500}
+		files.files["/usr/bin/private/key"] = fakeFile{mode: 0o400, data: "key"}
+		// let the temporary directory be removed
+		DeferCleanup(func() {
+			Expect(os.Chmod(filepath.Join("out", "private"), 0o700)).To(Succeed())
+			Expect(os.Chmod("out", 0o700)).To(Succeed())
+		})
+
+		_, err := gocli("scp", "-r", "node01:/usr/bin", "out")
+		Expect(err).NotTo(HaveOccurred())
+		expectFile("out", 0o555, "")
+		expectFile("out/tool", 0o755, "tool")
+		expectFile("out/private", 0o500, "")
+		expectFile("out/private/key", 0o400, "key")
+	})
+
+	It("should download the matches of a glob into a directory", func() {
+		Expect(os.Mkdir("out", 0o755)).To(Succeed())
+		_, err := gocli("scp", "node02:/etc/kubevirt/*.yaml", "node02:/etc/kubevirt/sub/b.sh", "out")
+		Expect(err).NotTo(HaveOccurred())
+		expectFile("out/a.yaml", 0o640, "a")
+		expectFile("out/b.sh", 0o755, "b")
+	})
+
+	It("should write a file of the control plane to stdout like older versions", func() {
+		out, err := gocli("scp", "/etc/kubevirt/a.yaml", "-")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal("a"))
+		Expect(files.idx).To(Equal(1))
+	})
+
+	It("should upload files and directories", func() {
+		Expect(os.MkdirAll(filepath.Join("src", "conf"), 0o750)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join("src", "conf", "c.yaml"), []byte("c"), 0o600)).To(Succeed())
+		Expect(os.WriteFile("d.sh", []byte("d"), 0o755)).To(Succeed())
+
+		_, err := gocli("scp", "-r", "-q", "src", "d.sh", "node01:/tmp")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files.idx).To(Equal(1))
+		Expect(files.files).To(HaveKeyWithValue("/tmp/src", fakeFile{dir: true, mode: 0o750}))
+		Expect(files.files).To(HaveKeyWithValue("/tmp/src/conf", fakeFile{dir: true, mode: 0o750}))
+		Expect(files.files).To(HaveKeyWithValue("/tmp/src/conf/c.yaml", fakeFile{mode: 0o600, data: "c"}))
+		Expect(files.files).To(HaveKeyWithValue("/tmp/d.sh", fakeFile{mode: 0o755, data: "d"}))
+
+		_, err = gocli("scp", "d.sh", "node01:/tmp/e.sh")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files.files).To(HaveKeyWithValue("/tmp/e.sh", fakeFile{mode: 0o755, data: "d"}))
+	})
+
+	It("should refuse copies between nodes", func() {
+		_, err := gocli("scp", "node01:/etc/kubevirt/a.yaml", "node02:/tmp")
+		Expect(err).To(MatchError("copying between nodes is not supported"))
+		_, err = gocli("scp", "node01:/etc/kubevirt/a.yaml", "node03:/etc/hosts", "out")
+		Expect(err).To(MatchError("all sources have to be on the same node, got node01 and node03"))
+	})
+})
@@ -0,0 +1,533 @@
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/go-connections/nat"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/cmd/clusterspec"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
+)
+
+const (
+	// vmMigratableEnv makes vm.sh start the VM with a CPU model QEMU can save, the invariant TSC
+	// of the default CPU model blocks saving the VM
+	vmMigratableEnv = "VM_MIGRATABLE=true"
+	// vmStateFile receives the memory of a saved VM, vm.sh resumes the VM from it instead of booting
+	vmStateFile = "/vm-memory.state"
+
+	// snapshotLabel carries the manifest of a snapshot on the image of its dnsmasq container
+	snapshotLabel      = "io.kubevirtci.snapshot"
+	snapshotRepository = "kubevirtci-snapshot"
+)
+
+var snapshotNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+// snapshotManifest describes how to recreate the containers and volumes of a snapshot
+type snapshotManifest struct {
+	// Containers starts with dnsmasq, the other containers join its network namespace
+	Containers []snapshotContainer `json:"containers"`
+	// Volumes maps the volumes of the cluster to the volumes holding their copies
+	Volumes map[string]string `json:"volumes,omitempty"`
+	// VolumeLabels are the labels the volumes of the cluster are restored with
+	VolumeLabels map[string]map[string]string `json:"volumeLabels,omitempty"`
+}
+
+// snapshotContainer is a cluster container committed to Image
+type snapshotContainer struct {
+	// Name is the name of the container without the prefix, e.g. dnsmasq or node01
+	Name  string `json:"name"`
+	Image string `json:"image"`
+	// Config and HostConfig are the ones the container was created with. The anonymous volumes, e.g. the one
+	// Ceph keeps its OSDs in, are mounted from volumes of the cluster holding their copies instead
+	Config     *container.Config     `json:"config"`
+	HostConfig *container.HostConfig `json:"hostConfig"`
+}
+
+// NewSnapshotCommand returns the command to save a running cluster and to bring it back
+func NewSnapshotCommand() *cobra.Command {
+	snapshot := &cobra.Command{
+		Use:   "snapshot",
+		Short: "snapshot saves a running cluster and brings it back later",
+		Args:  cobra.NoArgs,
+	}
+
+	save := &cobra.Command{
+		Use:   "save NAME",
+		Short: "save commits the containers of the running cluster including the disks and the memory of its VMs",
+		Long: `save commits the containers of the running cluster including the disks and the memory of its VMs
+
+All VMs are paused while they are saved and resume afterwards. The containers are committed to
+kubevirtci-snapshot/PREFIX:NAME-CONTAINER images and the volumes of the cluster, like the data of the
+registry, are copied to gocli-snapshot-NAME-VOLUME volumes. So are the anonymous volumes of the containers,
+like the one of Ceph. Saving an existing snapshot replaces it.
+
+QEMU can only save VMs of clusters started with --allow-snapshots. The data directory passed
+with --nfs-data is not part of the snapshot.`,
+		RunE: snapshotSave,
+		Args: cobra.ExactArgs(1),
+	}
+
+	restore := &cobra.Command{
+		Use:   "restore NAME",
+		Short: "restore replaces the cluster with the snapshot and resumes its VMs where they were saved",
+		RunE:  snapshotRestore,
+		Args:  cobra.ExactArgs(1),
+	}
+
+	snapshot.AddCommand(save, restore)
+	return snapshot
+}
+
+func snapshotSave(cmd *cobra.Command, args []string) (retErr error) {
+	prefix, err := cmd.Flags().GetString("prefix")
+	if err != nil {
+		return err
+	}
+
+	name := args[0]
+	if !snapshotNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid snapshot name %q, it may consist of up to 64 lowercase letters, digits, '_', '.' and '-'", name)
+	}
+
+	cli, err := newRuntime()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	dnsmasq, nodes, err := clusterContainers(cli, prefix)
+	if err != nil {
+		return err
+	}
+
+	nodeNames := []string{}
+	for _, idx := range slices.Sorted(maps.Keys(nodes)) {
+		nodeName := nodeNameFromIndex(idx)
+		node, err := cli.ContainerInspect(ctx, nodes[idx].ID)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(node.Config.Env, vmMigratableEnv) {
+			return fmt.Errorf("QEMU can't save the VM of %s, the cluster has to be started with --allow-snapshots", nodeName)
+		}
+		nodeNames = append(nodeNames, nodeName)
+	}
+
+	// all VMs are paused before the first one is saved, the snapshot captures the whole cluster at one moment
+	paused := []string{}
+	defer func() {
+		for _, nodeName := range paused {
+			err := _cmd(cli, nodeContainer(prefix, nodeName), resumeVMScript(), fmt.Sprintf("resuming the VM of %s", nodeName))
+			retErr = errors.Join(retErr, err)
+		}
+	}()
+	for _, nodeName := range nodeNames {
+		if err := _cmd(cli, nodeContainer(prefix, nodeName), qemuMonitorCommand("stop"), fmt.Sprintf("pausing the VM of %s", nodeName)); err != nil {
+			return err
+		}
+		paused = append(paused, nodeName)
+	}
+	for _, nodeName := range nodeNames {
+		if err := _cmd(cli, nodeContainer(prefix, nodeName), saveVMScript(), fmt.Sprintf("saving the memory of the VM of %s", nodeName)); err != nil {
+			return err
+		}
+	}
+
+	containers := slices.Clone(nodeNames)
+	for _, c := range clusterAuxiliaryContainers {
+		_, err := cli.ContainerInspect(ctx, nodeContainer(prefix, c))
+		if docker.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		containers = append(containers, c)
+	}
+
+	manifest := &snapshotManifest{Volumes: map[string]string{}, VolumeLabels: map[string]map[string]string{}}
+	// sources maps the volumes of the snapshot to the volumes they are copied from
+	sources := map[string]string{}
+	anonymousLabels := map[string]map[string]string{}
+	for _, c := range containers {
+		saved, savedSources, err := commitSnapshotContainer(ctx, cli, prefix, name, c, nil)
+		if err != nil {
+			return err
+		}
+		manifest.Containers = append(manifest.Containers, saved)
+		for volume, source := range savedSources {
+			manifest.Volumes[volume] = snapshotVolume(name, volume)
+			sources[volume] = source
+			if volume != source {
+				anonymousLabels[volume] = anonymousVolumeLabels(saved.Config.Labels)
+			}
+		}
+	}
+
+	dm, err := cli.ContainerInspect(ctx, dnsmasq.ID)
+	if err != nil {
+		return err
+	}
+	volumes, err := cli.VolumeList(ctx)
+	if err != nil {
+		return err
+	}
+	existing := map[string]map[string]string{}
+	for _, v := range volumes {
+		existing[v.Name] = v.Labels
+	}
+	for _, volume := range slices.Sorted(maps.Keys(manifest.Volumes)) {
+		manifest.VolumeLabels[volume] = existing[volume]
+		if labels, ok := anonymousLabels[volume]; ok {
+			manifest.VolumeLabels[volume] = labels
+		}
+		if _, ok := existing[manifest.Volumes[volume]]; ok {
+			if err := cli.VolumeRemove(ctx, manifest.Volumes[volume], true); err != nil {
+				return err
+			}
+		}
+		// the copies carry no cluster labels, they are kept when the cluster is removed
+		if err := copyVolume(ctx, cli, dm.Config.Image, sources[volume], manifest.Volumes[volume], nil); err != nil {
+			return err
+		}
+	}
+
+	// dnsmasq is committed last, the manifest on its image makes the snapshot known to restore
+	_, _, err = commitSnapshotContainer(ctx, cli, prefix, name, "dnsmasq", manifest)
+	return err
+}
+
+func snapshotRestore(cmd *cobra.Command, args []string) error {
+	prefix, err := cmd.Flags().GetString("prefix")
+	if err != nil {
+		return err
+	}
+	name := args[0]
+
+	cli, err := newRuntime()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	manifest, err := loadSnapshotManifest(ctx, cli, prefix, name)
+	if err != nil {
+		return err
+	}
+	// the running cluster is only removed if the snapshot can replace it
+	if err := checkSnapshot(ctx, cli, prefix, name, manifest); err != nil {
+		return err
+	}
+
+	if err := removeCluster(cli, prefix); err != nil {
+		return err
+	}
+
+	dnsmasqImage := snapshotImage(prefix, name, "dnsmasq")
+	for _, volume := range slices.Sorted(maps.Keys(manifest.Volumes)) {
+		if err := copyVolume(ctx, cli, dnsmasqImage, manifest.Volumes[volume], volume, manifest.VolumeLabels[volume]); err != nil {
+			return err
+		}
+	}
+
+	nodeIdxs := []int{}
+	for _, c := range manifest.Containers {
+		if idx, err := clusterspec.NodeIndex(c.Name); err == nil {
+			nodeIdxs = append(nodeIdxs, idx)
+		}
+	}
+
+	dnsmasq := ""
+	for _, c := range manifest.Containers {
+		id, err := cli.ContainerCreate(ctx, nodeContainer(prefix, c.Name), c.config(), c.hostConfig(dnsmasq))
+		if err != nil {
+			return err
+		}
+		if err := cli.ContainerStart(ctx, id); err != nil {
+			return err
+		}
+		if c.Name == "dnsmasq" {
+			dnsmasq = id
+			if err := _cmd(cli, id, restoreNodeNetworkScript(nodeIdxs), "restoring the network of the nodes"); err != nil {
+				return err
+			}
+			dm, err := cli.ContainerInspect(ctx, id)
+			if err != nil {
+				return err
+			}
+			if err := forwardExposedPorts(cli, id, dm.Config.Labels); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, idx := range nodeIdxs {
+		if err := waitForVMToBeUp(cli, prefix, nodeNameFromIndex(idx), stdOutput); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commitSnapshotContainer commits a cluster container to the image of the snapshot. If manifest is set, the
+// container is put first into it and the manifest is attached to the image. It returns the volumes of the cluster
+// the container mounts mapped to the volumes they are copied from
+func commitSnapshotContainer(ctx context.Context, cli docker.Runtime, prefix, name, containerName string, manifest *snapshotManifest) (snapshotContainer, map[string]string, error) {
+	inspect, err := cli.ContainerInspect(ctx, nodeContainer(prefix, containerName))
+	if err != nil {
+		return snapshotContainer{}, nil, err
+	}
+	saved, sources := newSnapshotContainer(prefix, snapshotImage(prefix, name, containerName), containerName, inspect)
+
+	options := container.CommitOptions{
+		Reference: saved.Image,
+		Comment:   fmt.Sprintf("snapshot %s of %s", name, nodeContainer(prefix, containerName)),
+	}
+	if manifest != nil {
+		manifest.Containers = append([]snapshotContainer{saved}, manifest.Containers...)
+		data, err := json.Marshal(manifest)
+		if err != nil {
+			return snapshotContainer{}, nil, err
+		}
+		// the encoding keeps the label free of characters the LABEL instruction would have to escape
+		options.Changes = []string{fmt.Sprintf("LABEL %s=%s", snapshotLabel, base64.RawURLEncoding.EncodeToString(data))}
+	}
+
+	logrus.Infof("committing %s to %s", nodeContainer(prefix, containerName), saved.Image)
+	if _, err := cli.ContainerCommit(ctx, inspect.ID, options); err != nil {
+		return snapshotContainer{}, nil, fmt.Errorf("committing %s failed: %w", nodeContainer(prefix, containerName), err)
+	}
+	return saved, sources, nil
+}
+
+// newSnapshotContainer records the configuration a container has to be recreated with. Only dnsmasq publishes
+// ports, they are kept even if they were picked at random. The volumes of the cluster carry its prefix, the
+// anonymous volumes get a name of the cluster and are returned with them, mapped to the volumes they replace
+func newSnapshotContainer(prefix, image, containerName string, inspect container.InspectResponse) (snapshotContainer, map[string]string) {
+	config := container.Config{}
+	if inspect.Config != nil {
+		config = *inspect.Config
+	}
+	config.Image = image
+	hostConfig := container.HostConfig{}
+	if inspect.HostConfig != nil {
+		hostConfig = *inspect.HostConfig
+	}
+	hostConfig.Mounts = slices.Clone(hostConfig.Mounts)
+	if containerName == "dnsmasq" && inspect.NetworkSettings != nil {
+		hostConfig.PortBindings = publishedPorts(inspect.NetworkSettings.Ports)
+	}
+
+	sources := map[string]string{}
+	for _, m := range hostConfig.Mounts {
+		if m.Type == mount.TypeVolume && strings.HasPrefix(m.Source, prefix+"-") {
+			sources[m.Source] = m.Source
+		}
+	}
+	for _, m := range inspect.Mounts {
+		if _, ok := config.Volumes[m.Destination]; !ok || m.Type != mount.TypeVolume || mountedAt(hostConfig, m.Destination) {
+			continue
+		}
+		volume := fmt.Sprintf("%s-%s%s", prefix, containerName, strings.ReplaceAll(m.Destination, "/", "-"))
+		hostConfig.Mounts = append(hostConfig.Mounts, mount.Mount{Type: mount.TypeVolume, Source: volume, Target: m.Destination})
+		sources[volume] = m.Name
+	}
+	return snapshotContainer{Name: containerName, Image: image, Config: &config, HostConfig: &hostConfig}, sources
+}
+
+// mountedAt returns whether a mount or a bind of the host config targets the path
+func mountedAt(hostConfig container.HostConfig, path string) bool {
+	if slices.ContainsFunc(hostConfig.Mounts, func(m mount.Mount) bool { return m.Target == path }) {
+		return true
+	}
+	return slices.ContainsFunc(hostConfig.Binds, func(b string) bool {
+		parts := strings.Split(b, ":")
+		return len(parts) > 1 && parts[1] == path
+	})
+}
+
+// anonymousVolumeLabels returns the labels an anonymous volume is restored with, it belongs to the cluster like
+// the container with the given labels
+func anonymousVolumeLabels(containerLabels map[string]string) map[string]string {
+	labels := map[string]string{}
+	for _, l := range []string{labelClusterID, labelPrefix, labelRole, labelNodeIndex, labelVersion} {
+		if v, ok := containerLabels[l]; ok {
+			labels[l] = v
+		}
+	}
+	return labels
+}
+
+func (c snapshotContainer) config() *container.Config {
+	config := *c.Config
+	config.Image = c.Image
+	if c.Name != "dnsmasq" {
+		// the containers in the network namespace of dnsmasq can't have a hostname or expose ports of their own
+		config.Hostname = ""
+		config.Domainname = ""
+		config.ExposedPorts = nil
+	}
+	return &config
+}
+
+func (c snapshotContainer) hostConfig(dnsmasq string) *container.HostConfig {
+	hostConfig := *c.HostConfig
+	if c.Name != "dnsmasq" {
+		hostConfig.NetworkMode = container.NetworkMode("container:" + dnsmasq)
+	}
+	return &hostConfig
+}
+
+// publishedPorts turns the ports a container publishes into bindings of the same host ports,
+// a port published on all IPv4 and IPv6 addresses is bound once without an address
+func publishedPorts(ports nat.PortMap) nat.PortMap {
+	bindings := nat.PortMap{}
+	for port, published := range ports {
+		for _, p := range published {
+			b := nat.PortBinding{HostIP: p.HostIP, HostPort: p.HostPort}
+			if b.HostIP == "0.0.0.0" || b.HostIP == "::" {
+				b.HostIP = ""
+			}
+			if !slices.Contains(bindings[port], b) {
+				bindings[port] = append(bindings[port], b)
+			}
+		}
+	}
+	return bindings
+}
+
+func loadSnapshotManifest(ctx context.Context, cli docker.Runtime, prefix, name string) (*snapshotManifest, error) {
+	image, err := cli.ImageInspect(ctx, snapshotImage(prefix, name, "dnsmasq"))
+	if docker.IsNotFound(err) {
+		return nil, fmt.Errorf("there is no snapshot %s of the cluster %s", name, prefix)
+	} else if err != nil {
+		return nil, err
+	}
+
+	encoded := ""
+	if image.Config != nil {
+		encoded = image.Config.Labels[snapshotLabel]
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	manifest := &snapshotManifest{}
+	if err == nil && len(data) > 0 {
+		err = json.Unmarshal(data, manifest)
+	}
+	if err != nil || len(manifest.Containers) == 0 {
+		return nil, fmt.Errorf("the image %s does not carry a valid snapshot manifest", snapshotImage(prefix, name, "dnsmasq"))
+	}
+	return manifest, nil
+}
+
+// checkSnapshot fails if an image or a volume copy of the snapshot has been removed since it was saved
+func checkSnapshot(ctx context.Context, cli docker.Runtime, prefix, name string, manifest *snapshotManifest) error {
+	for _, c := range manifest.Containers {
+		_, err := cli.ImageInspect(ctx, c.Image)
+		if docker.IsNotFound(err) {
+			return fmt.Errorf("the snapshot %s of the cluster %s is incomplete, the image %s of %s is gone", name, prefix, c.Image, c.Name)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	volumes, err := cli.VolumeList(ctx)
+	if err != nil {
+		return err
+	}
+	existing := map[string]bool{}
+	for _, v := range volumes {
+		existing[v.Name] = true
+	}
+	for _, volume := range slices.Sorted(maps.Keys(manifest.Volumes)) {
+		if !existing[manifest.Volumes[volume]] {
+			return fmt.Errorf("the snapshot %s of the cluster %s is incomplete, the volume %s holding %s is gone", name, prefix, manifest.Volumes[volume], volume)
+		}
+	}
+	return nil
+}
+
+// copyVolume copies the content of the volume from into the new volume to with a container of the
+// given image, the cluster images come with cp
+func copyVolume(ctx context.Context, cli docker.Runtime, image string, from string, to string, labels map[string]string) error {
+	logrus.Infof("copying volume %s to %s", from, to)
+	if err := cli.VolumeCreate(ctx, to, labels); err != nil {
+		return err
+	}
+
+	id, err := cli.ContainerCreate(ctx, to+"-copy", &container.Config{
+		Image: image,
+		Cmd:   []string{"/bin/bash", "-c", "cp -a /from/. /to/"},
+	}, &container.HostConfig{
+		Mounts: []mount.Mount{
+			{Type: mount.TypeVolume, Source: from, Target: "/from", ReadOnly: true},
+			{Type: mount.TypeVolume, Source: to, Target: "/to"},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = cli.ContainerRemove(ctx, id, true) }()
+
+	if err := cli.ContainerStart(ctx, id); err != nil {
+		return err
+	}
+	exitCode, err := cli.ContainerWait(ctx, id)
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("copying volume %s to %s failed with exit code %d", from, to, exitCode)
+	}
+	return nil
+}
+
+func snapshotImage(prefix, name, containerName string) string {
+	return fmt.Sprintf("%s/%s:%s-%s", snapshotRepository, prefix, name, containerName)
+}
+
+// snapshotVolume names the copy of a volume, it must not carry the prefix of the cluster as rm removes those
+func snapshotVolume(name, volume string) string {
+	return fmt.Sprintf("gocli-snapshot-%s-%s", name, volume)
+}
+
+func qemuMonitorCommand(command string) string {
+	return fmt.Sprintf("echo %s | socat - UNIX-CONNECT:/tmp/qemu-monitor.sock", shellescape.Quote(command))
+}
+
+// saveVMScript writes the memory of the paused VM to vmStateFile and waits until QEMU is done with it
+func saveVMScript() string {
+	return strings.Join([]string{
+		"set -e",
+		fmt.Sprintf("rm -f %s", vmStateFile),
+		qemuMonitorCommand(fmt.Sprintf(`migrate -d "exec:cat > %s"`, vmStateFile)),
+		"while true; do",
+		fmt.Sprintf(`  status="$(%s | grep 'Migration status:' || true)"`, qemuMonitorCommand("info migrate")),
+		`  case "$status" in`,
+		`    *completed*) break ;;`,
+		`    ""|*failed*|*cancelled*) echo "QEMU could not save the VM: ${status:-no migration started}" >&2; exit 1 ;;`,
+		"  esac",
+		"  sleep 1",
+		"done",
+	}, "\n")
+}
+
+// resumeVMScript continues a paused VM, the saved memory is part of the committed image by then
+func resumeVMScript() string {
+	return strings.Join([]string{
+		qemuMonitorCommand("cont"),
+		fmt.Sprintf("rm -f %s", vmStateFile),
+	}, "\n")
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/docker/docker/api/types/mount"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/rookceph"
+	k8s "kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/k8s"
+)
+
+var _ = Describe("Snapshot", func() {
+	var runtime *docker.FakeRuntime
+
+	BeforeEach(func() {
+		runtime = docker.NewFakeRuntime()
+		// the containers copying volumes are done right away
+		runtime.RunHandler = func(c *docker.FakeContainer) (int, bool) {
+			return 0, strings.HasSuffix(c.Name, "-copy")
+		}
+		setupFakeCluster(runtime, nil)
+	})
+
+	// execIndex returns the position of the first command run in the container which contains cmd
+	execIndex := func(containerName string, cmd string) int {
+		return slices.IndexFunc(runtime.Execs, func(e docker.FakeExec) bool {
+			return e.Container == containerName && strings.Contains(strings.Join(e.Cmd, " "), cmd)
+		})
+	}
+
+	It("should refuse to save clusters not started with --allow-snapshots", func() {
+		Expect(gocli("run", "k8s-1.30")).Error().To(Succeed())
+
+		Expect(gocli("snapshot", "save", "before")).Error().To(MatchError(ContainSubstring("has to be started with --allow-snapshots")))
+		Expect(execIndex("k8s-1.30-node01", "stop")).To(Equal(-1))
+	})
+
+	It("should reject invalid snapshot names", func() {
+		Expect(gocli("snapshot", "save", "Before Upgrade")).Error().To(MatchError(ContainSubstring("invalid snapshot name")))
+	})
+
+	It("should fail to restore unknown snapshots", func() {
+		Expect(gocli("snapshot", "restore", "before")).Error().To(MatchError("there is no snapshot before of the cluster k8s-1.30"))
+	})
+
+	It("should save the cluster and restore it", func() {
+		Expect(gocli("run", "k8s-1.30", "--nodes", "2", "--allow-snapshots")).Error().To(Succeed())
+		dnsmasq, _ := runtime.Container("k8s-1.30-dnsmasq")
+		ports := dnsmasq.Ports
+
+		Expect(gocli("snapshot", "save", "before")).Error().To(Succeed())
+
+		By("pausing all VMs before the first one is saved")
+		for _, node := range []string{"k8s-1.30-node01", "k8s-1.30-node02"} {
+			stop := execIndex(node, "echo stop")
+			Expect(stop).NotTo(Equal(-1), node)
+			Expect(stop).To(BeNumerically("<", execIndex("k8s-1.30-node01", "migrate -d")), node)
+			Expect(execIndex(node, "echo cont")).To(BeNumerically(">", execIndex("k8s-1.30-node02", "migrate -d")), node)
+		}
+		for _, c := range []string{"dnsmasq", "registry", "node01", "node02"} {
+			Expect(runtime.ImageExists(context.Background(), "kubevirtci-snapshot/k8s-1.30:before-"+c)).To(BeTrue(), c)
+		}
+		Expect(runtime.Volumes()).To(ContainElement("gocli-snapshot-before-k8s-1.30-registry"))
+
+		By("replacing the changed cluster with the snapshot")
+		Expect(gocli("node", "remove", "node02")).Error().To(Succeed())
+		Expect(gocli("snapshot", "restore", "before")).Error().To(Succeed())
+
+		dnsmasq, ok := runtime.Container("k8s-1.30-dnsmasq")
+		Expect(ok).To(BeTrue())
+		Expect(dnsmasq.Config.Image).To(Equal("kubevirtci-snapshot/k8s-1.30:before-dnsmasq"))
+		Expect(dnsmasq.Ports).To(Equal(ports))
+		for _, c := range []string{"registry", "node01", "node02"} {
+			restored, ok := runtime.Container("k8s-1.30-" + c)
+			Expect(ok).To(BeTrue(), c)
+			Expect(restored.Running).To(BeTrue(), c)
+			Expect(restored.Config.Image).To(Equal("kubevirtci-snapshot/k8s-1.30:before-"+c), c)
+			Expect(restored.HostConfig.NetworkMode.ConnectedContainer()).To(Equal(dnsmasq.ID), c)
+		}
+		registry, _ := runtime.Container("k8s-1.30-registry")
+		Expect(registry.HostConfig.Mounts).To(ConsistOf(mount.Mount{Type: mount.TypeVolume, Source: "k8s-1.30-registry", Target: "/var/lib/registry"}))
+		Expect(runtime.Volumes()).To(ContainElements("k8s-1.30-registry", "gocli-snapshot-before-k8s-1.30-registry"))
+		Expect(execIndex("k8s-1.30-dnsmasq", "ip tuntap add dev tap02")).NotTo(Equal(-1))
+	})
+
+	It("should restore the nodes with their configuration and anonymous volumes", func() {
+		setupFakeCluster(runtime, k8s.NewTestClient(k8s.NewReactorConfig("create", "cephblockpools", rookceph.CephReactor)))
+		Expect(gocli("run", "k8s-1.30", "--nodes", "1", "--allow-snapshots", "--enable-ceph", "--qemu-args", "-smbios type=1")).Error().To(Succeed())
+		node01, _ := runtime.Container("k8s-1.30-node01")
+		rook := node01.AnonymousVolumes["/var/lib/rook"]
+		Expect(rook).NotTo(BeEmpty())
+
+		copied := map[string]string{}
+		runtime.RunHandler = func(c *docker.FakeContainer) (int, bool) {
+			if !strings.HasSuffix(c.Name, "-copy") {
+				return 0, false
+			}
+			copied[c.HostConfig.Mounts[1].Source] = c.HostConfig.Mounts[0].Source
+			return 0, true
+		}
+
+		Expect(gocli("snapshot", "save", "before")).Error().To(Succeed())
+		Expect(copied).To(HaveKeyWithValue("gocli-snapshot-before-k8s-1.30-node01-var-lib-rook", rook))
+
+		Expect(gocli("snapshot", "restore", "before")).Error().To(Succeed())
+		restored, _ := runtime.Container("k8s-1.30-node01")
+		Expect(restored.Config.Cmd).To(Equal(node01.Config.Cmd))
+		Expect(restored.Config.Env).To(Equal(node01.Config.Env))
+		Expect(restored.Config.Labels).To(HaveKeyWithValue(labelVM, node01.Config.Labels[labelVM]))
+		Expect(restored.HostConfig.Privileged).To(BeTrue())
+		Expect(restored.HostConfig.Mounts).To(ContainElement(mount.Mount{Type: mount.TypeVolume, Source: "k8s-1.30-node01-var-lib-rook", Target: "/var/lib/rook"}))
+		Expect(restored.AnonymousVolumes).To(BeEmpty())
+		Expect(runtime.Volumes()).To(ContainElement("k8s-1.30-node01-var-lib-rook"))
+
+		By("removing the restored volume with the cluster")
+		Expect(gocli("rm")).Error().To(Succeed())
+		Expect(runtime.Volumes()).NotTo(ContainElement("k8s-1.30-node01-var-lib-rook"))
+	})
+
+	It("should keep the running cluster if the snapshot is incomplete", func() {
+		Expect(gocli("run", "k8s-1.30", "--nodes", "2", "--allow-snapshots")).Error().To(Succeed())
+		Expect(gocli("snapshot", "save", "before")).Error().To(Succeed())
+		node02, _ := runtime.Container("k8s-1.30-node02")
+
+		runtime.RemoveImage("kubevirtci-snapshot/k8s-1.30:before-node02")
+		Expect(gocli("snapshot", "restore", "before")).Error().To(MatchError("the snapshot before of the cluster k8s-1.30 is incomplete, the image kubevirtci-snapshot/k8s-1.30:before-node02 of node02 is gone"))
+		running, ok := runtime.Container("k8s-1.30-node02")
+		Expect(ok).To(BeTrue())
+		Expect(running.ID).To(Equal(node02.ID))
+
+		Expect(gocli("snapshot", "save", "before")).Error().To(Succeed())
+		Expect(runtime.VolumeRemove(context.Background(), "gocli-snapshot-before-k8s-1.30-registry", true)).To(Succeed())
+		Expect(gocli("snapshot", "restore", "before")).Error().To(MatchError(ContainSubstring("the volume gocli-snapshot-before-k8s-1.30-registry holding k8s-1.30-registry is gone")))
+		_, ok = runtime.Container("k8s-1.30-registry")
+		Expect(ok).To(BeTrue())
+	})
+})
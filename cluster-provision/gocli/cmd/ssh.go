@@ -1,60 +1,186 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"net"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
-	"github.com/docker/docker/client"
+	"github.com/alessio/shellescape"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"golang.org/x/term"
-	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/cmd/clusterspec"
 )
 
+// interruptSignals are the signals on which ssh closes the session and the forwards
+var interruptSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
 // NewSSHCommand returns command to SSH to the cluster node
 func NewSSHCommand() *cobra.Command {
 
 	ssh := &cobra.Command{
-		Use:   "ssh",
+		Use:   "ssh NODE [COMMAND...]",
 		Short: "ssh into a node",
-		RunE:  ssh,
-		Args:  cobra.MinimumNArgs(1),
+		Long: `ssh into a node
+
+The session runs through the SSH port dnsmasq publishes, it gets a PTY when stdin is a terminal
+and gocli exits with the exit code of the command. -L and -R forward ports through the node like
+ssh does, the host of -L is dialed from the node, so -L 10250:localhost:10250 reaches the kubelet
+of the node on localhost:10250. Flags have to be passed before NODE.
+
+A single COMMAND argument is run as a command line like ssh does, e.g. "ls | wc -l". Several
+arguments are quoted, so each of them reaches the command as one argument. gocli stops forwarding
+ports and closes the session when it is interrupted.`,
+		RunE: ssh,
+		Args: cobra.MinimumNArgs(1),
 	}
+	ssh.Flags().SetInterspersed(false)
+	ssh.Flags().StringArrayP("local-forward", "L", nil, "forward [bind_address:]port on the local host to host:hostport as seen from the node, [bind_address:]port:host:hostport")
+	ssh.Flags().StringArrayP("remote-forward", "R", nil, "forward [bind_address:]port on the node to host:hostport on the local host, [bind_address:]port:host:hostport")
+	ssh.Flags().BoolP("no-command", "N", false, "only forward ports, don't run a command")
 	return ssh
 }
 
+// exitCodeError makes gocli exit with the exit code of a command run on a node
+type exitCodeError struct {
+	code int
+}
+
+func (e exitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
 func ssh(cmd *cobra.Command, args []string) error {
 
 	prefix, err := cmd.Flags().GetString("prefix")
 	if err != nil {
 		return err
 	}
+	localForwards, err := cmd.Flags().GetStringArray("local-forward")
+	if err != nil {
+		return err
+	}
+	remoteForwards, err := cmd.Flags().GetStringArray("remote-forward")
+	if err != nil {
+		return err
+	}
+	noCommand, err := cmd.Flags().GetBool("no-command")
+	if err != nil {
+		return err
+	}
+	if noCommand && len(localForwards)+len(remoteForwards) == 0 {
+		return fmt.Errorf("-N requires a port to forward with -L or -R")
+	}
 
 	node := args[0]
+	nodeIdx, err := clusterspec.NodeIndex(node)
+	if err != nil {
+		return err
+	}
 
-	cli, err := client.NewClientWithOpts(client.FromEnv)
+	cli, err := newRuntime()
 	if err != nil {
 		return err
 	}
 
-	// TODO we can do the ssh session with the native golang client
-	container := prefix + "-" + node
-	ssh_command := append([]string{"ssh.sh"}, args[1:]...)
-	file := os.Stdout
-	if term.IsTerminal(int(file.Fd())) {
-		exitCode, err := docker.Terminal(cli, container, ssh_command, file)
+	dnsmasq, nodes, err := clusterContainers(cli, prefix)
+	if err != nil {
+		return err
+	}
+	if _, ok := nodes[nodeIdx]; !ok {
+		return fmt.Errorf("failed to find the container %s of the cluster %s", nodeContainer(prefix, node), prefix)
+	}
+
+	sshPort, err := clusterSSHPort(cli, dnsmasq.ID)
+	if err != nil {
+		return err
+	}
+	shell, err := newNodeShell(sshPort, nodeIdx)
+	if err != nil {
+		return err
+	}
+
+	// the forwards run until gocli is interrupted, the session is closed with them
+	ctx := context.Background()
+	if len(localForwards)+len(remoteForwards) > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = signal.NotifyContext(ctx, interruptSignals...)
+		defer cancel()
+	}
+
+	forwardErrs := make(chan error, len(localForwards)+len(remoteForwards))
+	for _, spec := range localForwards {
+		local, remote, err := parseForward(spec)
 		if err != nil {
 			return err
 		}
-		os.Exit(exitCode)
-	} else {
-		execExitCodeIsZero, err := docker.Exec(cli, container, ssh_command, file)
+		go func() { forwardErrs <- shell.LocalForward(ctx, local, remote) }()
+	}
+	for _, spec := range remoteForwards {
+		remote, local, err := parseForward(spec)
 		if err != nil {
 			return err
 		}
-		exitCode := 0
-		if !execExitCodeIsZero {
-			exitCode = 1
+		go func() { forwardErrs <- shell.RemoteForward(ctx, remote, local) }()
+	}
+
+	if noCommand {
+		for range len(localForwards) + len(remoteForwards) {
+			if err := <-forwardErrs; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	go func() {
+		for err := range forwardErrs {
+			if err != nil {
+				logrus.WithError(err).Warn("port forwarding failed")
+			}
 		}
-		os.Exit(exitCode)
+	}()
+
+	// flags are not parsed after NODE, so the -- of gocli ssh node01 -- COMMAND is passed on as an argument
+	command := args[1:]
+	if len(command) > 0 && command[0] == "--" {
+		command = command[1:]
+	}
+	exitCode, err := shell.Shell(ctx, shellCommand(command), os.Stdin, cmd.OutOrStdout(), cmd.ErrOrStderr())
+	if ctx.Err() != nil {
+		return fmt.Errorf("interrupted, closed the session to %s", node)
+	}
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return exitCodeError{code: exitCode}
 	}
 	return nil
 }
+
+// shellCommand returns the command line of the arguments after NODE, a single argument is a command line
+// already
+func shellCommand(args []string) string {
+	if len(args) == 1 {
+		return args[0]
+	}
+	return shellescape.QuoteCommand(args)
+}
+
+// parseForward splits a forward in ssh syntax, [bind_address:]port:host:hostport, into the address to
+// listen on and the address to connect to. Without a bind address only localhost is listened on
+func parseForward(spec string) (string, string, error) {
+	parts := strings.Split(spec, ":")
+	switch len(parts) {
+	case 3:
+		return net.JoinHostPort("localhost", parts[0]), net.JoinHostPort(parts[1], parts[2]), nil
+	case 4:
+		return net.JoinHostPort(parts[0], parts[1]), net.JoinHostPort(parts[2], parts[3]), nil
+	}
+	return "", "", fmt.Errorf("invalid forward %q, expected [bind_address:]port:host:hostport", spec)
+}
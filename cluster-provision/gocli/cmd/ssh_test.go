@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
+)
+
+// fakeShell records the sessions and forwards gocli ssh asks for
+type fakeShell struct {
+	mu       sync.Mutex
+	idx      int
+	commands []string
+	forwards []string
+	exitCode int
+	// interrupt makes the session signal gocli and wait to be closed
+	interrupt bool
+}
+
+func (f *fakeShell) Shell(ctx context.Context, cmd string, _ *os.File, stdout, _ io.Writer) (int, error) {
+	f.commands = append(f.commands, cmd)
+	if f.interrupt {
+		Expect(syscall.Kill(os.Getpid(), syscall.SIGUSR2)).To(Succeed())
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+	fmt.Fprintf(stdout, "ran %q on node %d\n", cmd, f.idx)
+	return f.exitCode, nil
+}
+
+func (f *fakeShell) LocalForward(_ context.Context, local string, remote string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.forwards = append(f.forwards, "L "+local+" "+remote)
+	return nil
+}
+
+func (f *fakeShell) RemoteForward(_ context.Context, remote string, local string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.forwards = append(f.forwards, "R "+remote+" "+local)
+	return nil
+}
+
+var _ = Describe("SSH", func() {
+	var shell *fakeShell
+
+	BeforeEach(func() {
+		runtime := docker.NewFakeRuntime()
+		shell = &fakeShell{}
+		setupFakeCluster(runtime, nil)
+		newNodeShell = func(_ uint16, idx int) (nodeShell, error) {
+			shell.idx = idx
+			return shell, nil
+		}
+
+		_, err := gocli("run", "k8s-1.30", "--nodes", "2", "--background")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should run the command on the node and pass on its exit code", func() {
+		out, err := gocli("ssh", "node02", "systemctl", "is-active", "--quiet", "kubelet")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal("ran \"systemctl is-active --quiet kubelet\" on node 2\n"))
+
+		shell.exitCode = 3
+		_, err = gocli("ssh", "node01", "false")
+		Expect(err).To(Equal(exitCodeError{code: 3}))
+	})
+
+	It("should drop the -- separating the command", func() {
+		out, err := gocli("ssh", "node01", "--", "sudo", "kubectl", "get", "nodes")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal("ran \"sudo kubectl get nodes\" on node 1\n"))
+
+		_, err = gocli("ssh", "-L", "10250:localhost:10250", "node01", "--", "ls", "--", "-x")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shell.commands[1]).To(Equal("ls -- -x"))
+	})
+
+	It("should quote the arguments of the command", func() {
+		_, err := gocli("ssh", "node01", "echo", "a b", "$HOME")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = gocli("ssh", "node01", "ls /etc | wc -l")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shell.commands).To(Equal([]string{"echo 'a b' '$HOME'", "ls /etc | wc -l"}))
+	})
+
+	It("should close the session and the forwards when it is interrupted", func() {
+		// the test runner ends on SIGINT and SIGTERM itself
+		signals := interruptSignals
+		interruptSignals = []os.Signal{syscall.SIGUSR2}
+		DeferCleanup(func() { interruptSignals = signals })
+		shell.interrupt = true
+		_, err := gocli("ssh", "-L", "10250:localhost:10250", "node01", "sleep", "infinity")
+		Expect(err).To(MatchError("interrupted, closed the session to node01"))
+	})
+
+	It("should only forward ports with -N", func() {
+		_, err := gocli("ssh", "-N", "-L", "10250:localhost:10250", "-R", "0.0.0.0:5000:localhost:5000", "node02")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shell.commands).To(BeEmpty())
+		Expect(shell.forwards).To(ConsistOf("L localhost:10250 localhost:10250", "R 0.0.0.0:5000 localhost:5000"))
+	})
+
+	It("should refuse nodes the cluster does not have", func() {
+		_, err := gocli("ssh", "node03")
+		Expect(err).To(MatchError("failed to find the container k8s-1.30-node03 of the cluster k8s-1.30"))
+		_, err = gocli("ssh", "-N", "node01")
+		Expect(err).To(MatchError(ContainSubstring("-N requires a port to forward")))
+		_, err = gocli("ssh", "-L", "10250", "node01")
+		Expect(err).To(MatchError(ContainSubstring("invalid forward")))
+	})
+})
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
+	k8s "kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/k8s"
+)
+
+var nodeGVK = schema.GroupVersionKind{Version: "v1", Kind: "Node"}
+
+// NewStartCommand returns the command to bring back a cluster shut down with gocli stop
+func NewStartCommand() *cobra.Command {
+	start := &cobra.Command{
+		Use:   "start",
+		Short: "start brings back a cluster stopped with gocli stop and waits for its API server",
+		Long: `start brings back a cluster stopped with gocli stop and waits for its API server
+
+dnsmasq is started first as the other containers join its network namespace, the nodes boot
+from their disks. Ports which were published on random host ports may change.`,
+		RunE: start,
+		Args: cobra.NoArgs,
+	}
+	start.Flags().Duration("timeout", 5*time.Minute, "time the API server gets to report node01 as ready")
+	return start
+}
+
+func start(cmd *cobra.Command, _ []string) error {
+	prefix, err := cmd.Flags().GetString("prefix")
+	if err != nil {
+		return err
+	}
+
+	timeout, err := cmd.Flags().GetDuration("timeout")
+	if err != nil {
+		return err
+	}
+
+	cli, err := newRuntime()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	dnsmasq, nodes, err := clusterContainers(cli, prefix)
+	if err != nil {
+		return err
+	}
+	nodeIdxs := slices.Sorted(maps.Keys(nodes))
+
+	if err := cli.ContainerStart(ctx, dnsmasq.ID); err != nil {
+		return err
+	}
+	if err := _cmd(cli, dnsmasq.ID, restoreNodeNetworkScript(nodeIdxs), "restoring the network of the nodes"); err != nil {
+		return err
+	}
+	if err := forwardExposedPorts(cli, dnsmasq.ID, dnsmasq.Labels); err != nil {
+		return err
+	}
+
+	for _, c := range clusterAuxiliaryContainers {
+		err := cli.ContainerStart(ctx, nodeContainer(prefix, c))
+		if err != nil && !docker.IsNotFound(err) {
+			return err
+		}
+	}
+
+	for _, idx := range nodeIdxs {
+		if err := cli.ContainerStart(ctx, nodes[idx].ID); err != nil {
+			return err
+		}
+	}
+	for _, idx := range nodeIdxs {
+		if err := waitForVMToBeUp(cli, prefix, nodeNameFromIndex(idx), stdOutput); err != nil {
+			return err
+		}
+	}
+
+	k8sClient, apiServerPort, err := clusterK8sClient(cli, dnsmasq.ID)
+	if err != nil {
+		return err
+	}
+	if err := k8s.WaitForCondition(k8sClient, nodeGVK, "node01", "", "Ready", timeout); err != nil {
+		return err
+	}
+	if err := restartExposeProxies(cli, prefix, dnsmasq.ID); err != nil {
+		return err
+	}
+
+	logrus.Infof("cluster %s is up, the API server listens on port %d", prefix, apiServerPort)
+	return nil
+}
@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var podGVK = schema.GroupVersionKind{Version: "v1", Kind: "Pod"}
+
+// clusterStatus is what gocli status reports about a cluster, the nodes and pods are only
+// queried while the cluster is running
+type clusterStatus struct {
+	clusterSummary
+	NodeStatus []nodeStatus `json:"nodeStatus,omitempty"`
+	Pods       *podHealth   `json:"pods,omitempty"`
+}
+
+type nodeStatus struct {
+	Name  string `json:"name"`
+	Ready bool   `json:"ready"`
+}
+
+// podHealth counts the pods of the cluster by phase. Pending and failed pods as well as running
+// pods with containers which are not ready are unhealthy
+type podHealth struct {
+	Total     int            `json:"total"`
+	Running   int            `json:"running"`
+	Succeeded int            `json:"succeeded"`
+	Pending   int            `json:"pending"`
+	Failed    int            `json:"failed"`
+	Unhealthy []unhealthyPod `json:"unhealthy,omitempty"`
+}
+
+type unhealthyPod struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Phase     string `json:"phase"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// NewStatusCommand returns the command to show the health of a cluster
+func NewStatusCommand() *cobra.Command {
+	status := &cobra.Command{
+		Use:   "status PREFIX",
+		Short: "status shows the containers, nodes and pods of a cluster",
+		Long: `status shows the containers, nodes and pods of a cluster
+
+On top of what gocli list shows, the readiness of the nodes and the health of the pods is
+queried from the API server of running clusters.`,
+		RunE: status,
+		Args: cobra.ExactArgs(1),
+	}
+	status.Flags().String("output", outputText, "output format, text or json")
+	return status
+}
+
+func status(cmd *cobra.Command, args []string) error {
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	if output != outputText && output != outputJSON {
+		return fmt.Errorf("unsupported output %q, possible values: %s, %s", output, outputText, outputJSON)
+	}
+	prefix := args[0]
+
+	cli, err := newRuntime()
+	if err != nil {
+		return err
+	}
+
+	clusters, err := listClusters(cli)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(clusters, func(c clusterSummary) bool { return c.Prefix == prefix })
+	if i == -1 {
+		return fmt.Errorf("no cluster found, the %s-dnsmasq container does not exist", prefix)
+	}
+	s := clusterStatus{clusterSummary: clusters[i]}
+
+	if s.State == clusterRunning {
+		dnsmasq, _, err := clusterContainers(cli, prefix)
+		if err != nil {
+			return err
+		}
+		k8sClient, _, err := clusterK8sClient(cli, dnsmasq.ID)
+		if err != nil {
+			return err
+		}
+
+		nodes, err := k8sClient.List(nodeGVK, "")
+		if err != nil {
+			return fmt.Errorf("failed to list the nodes of %s: %v", prefix, err)
+		}
+		s.NodeStatus = []nodeStatus{}
+		for _, n := range nodes.Items {
+			s.NodeStatus = append(s.NodeStatus, nodeStatus{Name: n.GetName(), Ready: conditionTrue(n, "Ready")})
+		}
+		slices.SortFunc(s.NodeStatus, func(a, b nodeStatus) int { return strings.Compare(a.Name, b.Name) })
+
+		pods, err := k8sClient.List(podGVK, "")
+		if err != nil {
+			return fmt.Errorf("failed to list the pods of %s: %v", prefix, err)
+		}
+		s.Pods = newPodHealth(pods.Items)
+	}
+
+	if output == outputJSON {
+		return writeJSON(cmd.OutOrStdout(), s)
+	}
+	return writeClusterStatus(cmd.OutOrStdout(), s)
+}
+
+func conditionTrue(obj unstructured.Unstructured, conditionType string) bool {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if ok && condition["type"] == conditionType {
+			return condition["status"] == "True"
+		}
+	}
+	return false
+}
+
+func newPodHealth(pods []unstructured.Unstructured) *podHealth {
+	health := &podHealth{Total: len(pods)}
+	for _, pod := range pods {
+		phase, _, _ := unstructured.NestedString(pod.Object, "status", "phase")
+		reason := ""
+		switch phase {
+		case "Running":
+			health.Running++
+			notReady := notReadyContainers(pod)
+			if len(notReady) == 0 {
+				continue
+			}
+			reason = "containers not ready: " + strings.Join(notReady, ",")
+		case "Succeeded":
+			health.Succeeded++
+			continue
+		case "Pending":
+			health.Pending++
+		case "Failed":
+			health.Failed++
+		}
+		if reason == "" {
+			reason, _, _ = unstructured.NestedString(pod.Object, "status", "reason")
+		}
+		health.Unhealthy = append(health.Unhealthy, unhealthyPod{Namespace: pod.GetNamespace(), Name: pod.GetName(), Phase: phase, Reason: reason})
+	}
+	slices.SortFunc(health.Unhealthy, func(a, b unhealthyPod) int {
+		return strings.Compare(a.Namespace+"/"+a.Name, b.Namespace+"/"+b.Name)
+	})
+	return health
+}
+
+func notReadyContainers(pod unstructured.Unstructured) []string {
+	statuses, _, _ := unstructured.NestedSlice(pod.Object, "status", "containerStatuses")
+	notReady := []string{}
+	for _, s := range statuses {
+		status, ok := s.(map[string]interface{})
+		if ok && status["ready"] != true {
+			notReady = append(notReady, fmt.Sprint(status["name"]))
+		}
+	}
+	return notReady
+}
+
+func writeClusterStatus(w io.Writer, s clusterStatus) error {
+	if err := writeClusterTable(w, []clusterSummary{s.clusterSummary}); err != nil {
+		return err
+	}
+	if s.Pods == nil {
+		return nil
+	}
+
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NODE\tREADY")
+	for _, n := range s.NodeStatus {
+		fmt.Fprintf(tw, "%s\t%t\n", n.Name, n.Ready)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	p := s.Pods
+	fmt.Fprintf(w, "\n%d pods: %d running, %d succeeded, %d pending, %d failed\n", p.Total, p.Running, p.Succeeded, p.Pending, p.Failed)
+	if len(p.Unhealthy) == 0 {
+		return nil
+	}
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "UNHEALTHY POD\tPHASE\tREASON")
+	for _, u := range p.Unhealthy {
+		fmt.Fprintf(tw, "%s/%s\t%s\t%s\n", u.Namespace, u.Name, u.Phase, u.Reason)
+	}
+	return tw.Flush()
+}
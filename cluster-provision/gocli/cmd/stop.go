@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
+)
+
+// NewStopCommand returns the command to shut down a cluster while keeping its containers and volumes
+func NewStopCommand() *cobra.Command {
+	stop := &cobra.Command{
+		Use:   "stop",
+		Short: "stop shuts down the VMs of the cluster and stops its containers, gocli start brings it back",
+		Long: `stop shuts down the VMs of the cluster and stops its containers, gocli start brings it back
+
+The VMs are powered down through ACPI, containers of VMs which did not shut down in time are
+stopped nevertheless. Containers and volumes are kept, gocli rm removes them.`,
+		RunE: stop,
+		Args: cobra.NoArgs,
+	}
+	stop.Flags().Duration("timeout", 2*time.Minute, "time the VMs get to shut down before their containers are stopped")
+	return stop
+}
+
+func stop(cmd *cobra.Command, _ []string) error {
+	prefix, err := cmd.Flags().GetString("prefix")
+	if err != nil {
+		return err
+	}
+
+	timeout, err := cmd.Flags().GetDuration("timeout")
+	if err != nil {
+		return err
+	}
+
+	cli, err := newRuntime()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	dnsmasq, nodes, err := clusterContainers(cli, prefix)
+	if err != nil {
+		return err
+	}
+
+	if err := stopExposeProxies(cli, prefix); err != nil {
+		return err
+	}
+
+	// all VMs shut down at the same time, the containers end with them
+	nodeIdxs := slices.Sorted(maps.Keys(nodes))
+	for _, idx := range nodeIdxs {
+		if nodes[idx].State != "running" {
+			continue
+		}
+		nodeName := nodeNameFromIndex(idx)
+		if err := _cmd(cli, nodes[idx].ID, qemuMonitorCommand("system_powerdown"), fmt.Sprintf("shutting down the VM of %s", nodeName)); err != nil {
+			return err
+		}
+	}
+	// the VMs shut down concurrently, so they share one deadline
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for _, idx := range nodeIdxs {
+		if _, err := cli.ContainerWait(waitCtx, nodes[idx].ID); err != nil {
+			logrus.Warnf("the VM of %s did not shut down within %s, stopping its container", nodeNameFromIndex(idx), timeout)
+		}
+		if err := cli.ContainerStop(ctx, nodes[idx].ID); err != nil {
+			return err
+		}
+	}
+
+	// dnsmasq goes last, the other containers live in its network namespace
+	for _, c := range clusterAuxiliaryContainers {
+		err := cli.ContainerStop(ctx, nodeContainer(prefix, c))
+		if err != nil && !docker.IsNotFound(err) {
+			return err
+		}
+	}
+	return cli.ContainerStop(ctx, dnsmasq.ID)
+}
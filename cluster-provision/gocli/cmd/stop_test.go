@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"io"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
+	k8s "kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/k8s"
+)
+
+var _ = Describe("Stop and start", func() {
+	var (
+		runtime   *docker.FakeRuntime
+		k8sClient k8s.K8sDynamicClient
+	)
+
+	BeforeEach(func() {
+		runtime = docker.NewFakeRuntime()
+		// the node containers end with their VMs
+		runtime.ExecHandler = func(c *docker.FakeContainer, cmd []string, _ io.Writer) int {
+			if strings.Contains(strings.Join(cmd, " "), "system_powerdown") {
+				Expect(runtime.Stop(c.ID)).To(Succeed())
+			}
+			return 0
+		}
+		k8sClient = k8s.NewTestClient(k8s.NewReactorConfig("create", "nodes", k8s.NewConditionReactor("Ready")))
+
+		setupFakeCluster(runtime, k8sClient)
+	})
+
+	clusterContainerNames := []string{"k8s-1.30-dnsmasq", "k8s-1.30-registry", "k8s-1.30-node01", "k8s-1.30-node02"}
+
+	It("should keep the stopped cluster and bring it back", func() {
+		Expect(gocli("run", "k8s-1.30", "--nodes", "2")).Error().To(Succeed())
+		volumes := runtime.Volumes()
+
+		Expect(gocli("stop")).Error().To(Succeed())
+		for _, name := range clusterContainerNames {
+			c, ok := runtime.Container(name)
+			Expect(ok).To(BeTrue(), name)
+			Expect(c.Running).To(BeFalse(), name)
+		}
+		Expect(runtime.Volumes()).To(ConsistOf(volumes))
+
+		node := &unstructured.Unstructured{}
+		node.SetAPIVersion("v1")
+		node.SetKind("Node")
+		node.SetName("node01")
+		Expect(k8sClient.Apply(node)).To(Succeed())
+
+		Expect(gocli("start")).Error().To(Succeed())
+		for _, name := range clusterContainerNames {
+			c, _ := runtime.Container(name)
+			Expect(c.Running).To(BeTrue(), name)
+		}
+	})
+
+	It("should stop the containers of VMs which do not shut down", func() {
+		Expect(gocli("run", "k8s-1.30")).Error().To(Succeed())
+		runtime.ExecHandler = nil
+
+		Expect(gocli("stop", "--timeout", (10 * time.Millisecond).String())).Error().To(Succeed())
+		node01, _ := runtime.Container("k8s-1.30-node01")
+		Expect(node01.Running).To(BeFalse())
+	})
+
+	It("should give all VMs one timeout to shut down", func() {
+		Expect(gocli("run", "k8s-1.30", "--nodes", "4")).Error().To(Succeed())
+		runtime.ExecHandler = nil
+
+		start := time.Now()
+		Expect(gocli("stop", "--timeout", (200 * time.Millisecond).String())).Error().To(Succeed())
+		Expect(time.Since(start)).To(BeNumerically("<", 600*time.Millisecond))
+	})
+
+	It("should fail to start a cluster which does not exist", func() {
+		Expect(gocli("start")).Error().To(MatchError(ContainSubstring("no running cluster found")))
+	})
+})
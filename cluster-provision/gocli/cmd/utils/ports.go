@@ -67,6 +67,13 @@ const (
 	PortNameDNS = "dns"
 )
 
+// NodeSSHPort returns the container port vm.sh forwards to the SSH server of a node, 22 followed by the node
+// index with at least two digits
+func NodeSSHPort(nodeIdx int) uint16 {
+	port, _ := strconv.Atoi(fmt.Sprintf("22%02d", nodeIdx))
+	return uint16(port)
+}
+
 // GetPublicPort returns public port by private port
 func GetPublicPort(port uint16, ports nat.PortMap) (uint16, error) {
 	portStr := strconv.Itoa(int(port))
@@ -4,12 +4,14 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/mount"
-	"github.com/docker/docker/client"
 	"github.com/docker/go-connections/nat"
 	"kubevirt.io/kubevirtci/cluster-provision/gocli/cmd/utils"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/ipam"
 )
 
 type DNSMasqOptions struct {
@@ -19,9 +21,12 @@ type DNSMasqOptions struct {
 	RandomPorts        bool
 	PortMap            nat.PortMap
 	Prefix             string
+	Labels             map[string]string
+	// ExtraPorts are exposed along with the well-known ports, see run --expose
+	ExtraPorts []nat.Port
 }
 
-func DNSMasq(cli *client.Client, ctx context.Context, options *DNSMasqOptions) (*container.CreateResponse, error) {
+func DNSMasq(rt docker.Runtime, ctx context.Context, options *DNSMasqOptions) (string, error) {
 	// Mount /lib/modules at dnsmasq if it's there since sometimes
 	// some kernel modules may be mounted
 	dnsmasqMounts := []mount.Mount{}
@@ -37,28 +42,46 @@ func DNSMasq(cli *client.Client, ctx context.Context, options *DNSMasqOptions) (
 
 	}
 
+	// dnsmasq.sh hands out the static leases of the address plan, images with an older dnsmasq.sh
+	// derive the same addresses from NUM_NODES
+	dhcpHosts := []string{}
+	for nodeIdx := 1; nodeIdx <= int(options.NodeCount); nodeIdx++ {
+		node, err := ipam.NodeAddresses(nodeIdx)
+		if err != nil {
+			return "", err
+		}
+		dhcpHosts = append(dhcpHosts, node.DHCPHost())
+	}
+
+	exposedPorts := nat.PortSet{
+		utils.TCPPortOrDie(utils.PortSSH):                  {},
+		utils.TCPPortOrDie(utils.PortRegistry):             {},
+		utils.TCPPortOrDie(utils.PortOCP):                  {},
+		utils.TCPPortOrDie(utils.PortAPI):                  {},
+		utils.TCPPortOrDie(utils.PortVNC):                  {},
+		utils.TCPPortOrDie(utils.PortHTTP):                 {},
+		utils.TCPPortOrDie(utils.PortHTTPS):                {},
+		utils.TCPPortOrDie(utils.PortPrometheus):           {},
+		utils.TCPPortOrDie(utils.PortGrafana):              {},
+		utils.TCPPortOrDie(utils.PortUploadProxy):          {},
+		utils.TCPPortOrDie(utils.PortUploadProxyLowerBand): {},
+		utils.UDPPortOrDie(utils.PortDNS):                  {},
+	}
+	for _, port := range options.ExtraPorts {
+		exposedPorts[port] = struct{}{}
+	}
+
 	// Start dnsmasq
-	dnsmasq, err := cli.ContainerCreate(ctx, &container.Config{
+	return rt.ContainerCreate(ctx, options.Prefix+"-dnsmasq", &container.Config{
 		Image: options.ClusterImage,
 		Env: []string{
 			fmt.Sprintf("NUM_NODES=%d", options.NodeCount),
 			fmt.Sprintf("NUM_SECONDARY_NICS=%d", options.SecondaryNicsCount),
+			fmt.Sprintf("NODE_DHCP_HOSTS=%s", strings.Join(dhcpHosts, " ")),
 		},
-		Cmd: []string{"/bin/bash", "-c", "/dnsmasq.sh"},
-		ExposedPorts: nat.PortSet{
-			utils.TCPPortOrDie(utils.PortSSH):                  {},
-			utils.TCPPortOrDie(utils.PortRegistry):             {},
-			utils.TCPPortOrDie(utils.PortOCP):                  {},
-			utils.TCPPortOrDie(utils.PortAPI):                  {},
-			utils.TCPPortOrDie(utils.PortVNC):                  {},
-			utils.TCPPortOrDie(utils.PortHTTP):                 {},
-			utils.TCPPortOrDie(utils.PortHTTPS):                {},
-			utils.TCPPortOrDie(utils.PortPrometheus):           {},
-			utils.TCPPortOrDie(utils.PortGrafana):              {},
-			utils.TCPPortOrDie(utils.PortUploadProxy):          {},
-			utils.TCPPortOrDie(utils.PortUploadProxyLowerBand): {},
-			utils.UDPPortOrDie(utils.PortDNS):                  {},
-		},
+		Cmd:          []string{"/bin/bash", "-c", "/dnsmasq.sh"},
+		Labels:       options.Labels,
+		ExposedPorts: exposedPorts,
 	}, &container.HostConfig{
 		Privileged:      true,
 		PublishAllPorts: options.RandomPorts,
@@ -69,9 +92,5 @@ func DNSMasq(cli *client.Client, ctx context.Context, options *DNSMasqOptions) (
 			"ceph:192.168.66.2",
 		},
 		Mounts: dnsmasqMounts,
-	}, nil, nil, options.Prefix+"-dnsmasq")
-	if err != nil {
-		return nil, err
-	}
-	return &dnsmasq, nil
+	})
 }
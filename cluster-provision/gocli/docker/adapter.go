@@ -3,20 +3,18 @@ package docker
 import (
 	"fmt"
 	"os"
-
-	"github.com/docker/docker/client"
 )
 
-// DockerAdapter is a wrapper around client.Client to conform it to the SSH interface
+// DockerAdapter is a wrapper around a Runtime to conform it to the SSH interface
 type DockerAdapter struct {
-	nodeName     string
-	dockerClient *client.Client
+	nodeName string
+	runtime  Runtime
 }
 
-func NewAdapter(cli *client.Client, nodeName string) *DockerAdapter {
+func NewAdapter(rt Runtime, nodeName string) *DockerAdapter {
 	return &DockerAdapter{
-		nodeName:     nodeName,
-		dockerClient: cli,
+		nodeName: nodeName,
+		runtime:  rt,
 	}
 }
 
@@ -36,7 +34,7 @@ func (d *DockerAdapter) Command(cmd string) error {
 		}
 	}
 
-	success, err := Exec(d.dockerClient, d.nodeName, []string{"/bin/bash", "-c", cmd}, os.Stdout)
+	success, err := Exec(d.runtime, d.nodeName, []string{"/bin/bash", "-c", cmd}, os.Stdout)
 	if err != nil {
 		return err
 	}
@@ -14,18 +14,12 @@ import (
 	"time"
 
 	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/filters"
-	"github.com/docker/docker/api/types/image"
-	"github.com/docker/docker/api/types/volume"
-	"github.com/docker/docker/client"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/term"
 )
 
-func GetPrefixedContainers(cli *client.Client, prefix string) ([]container.Summary, error) {
-	containers, err := cli.ContainerList(context.Background(), container.ListOptions{
-		All: true,
-	})
+func GetPrefixedContainers(rt Runtime, prefix string) ([]container.Summary, error) {
+	containers, err := rt.ContainerList(context.Background())
 	if err != nil {
 		return nil, err
 	}
@@ -44,51 +38,36 @@ func filterByPrefix(containers []container.Summary, prefix string) []container.S
 	return prefixedConatiners
 }
 
-func GetPrefixedVolumes(cli *client.Client, prefix string) ([]*volume.Volume, error) {
-	args := filters.NewArgs(filters.KeyValuePair{
-		Key:   "name",
-		Value: prefix,
-	})
-	options := volume.ListOptions{
-		Filters: args,
-	}
-	volumes, err := cli.VolumeList(context.Background(), options)
-	if err != nil {
-		return nil, err
-	}
-	return volumes.Volumes, nil
-}
-
-func ImagePull(cli *client.Client, ctx context.Context, ref string, options image.PullOptions) error {
-
+// normalizeReference adds the latest tag to image references without tag or digest
+func normalizeReference(ref string) string {
 	if !strings.ContainsAny(ref, ":@") {
 		ref = ref + ":latest"
 	}
-	ref = strings.TrimPrefix(ref, "docker.io/")
+	return ref
+}
+
+func ImagePull(rt Runtime, ctx context.Context, ref string, out io.Writer) error {
+	ref = normalizeReference(ref)
 
-	images, err := cli.ImageList(ctx, image.ListOptions{All: true})
+	exists, err := rt.ImageExists(ctx, ref)
 	if err != nil {
 		return err
 	}
-
-	for _, img := range images {
-		for _, tag := range append(img.RepoTags, img.RepoDigests...) {
-			if tag == ref {
-				logrus.Infof("Using local image %s", ref)
-				return nil
-			}
-		}
+	if exists {
+		logrus.Infof("Using local image %s", ref)
+		return nil
 	}
 	logrus.Infof("Using remote image %s", ref)
 
 	for _, i := range []int{0, 1, 2, 6} {
 		time.Sleep(time.Duration(i) * time.Second)
-		reader, err := cli.ImagePull(ctx, ref, options)
+		reader, err := rt.ImagePull(ctx, ref)
 		if err != nil {
 			log.Printf("failed to download %s: %v\n", ref, err)
 			continue
 		}
-		err = PrintProgress(reader, os.Stdout)
+		err = PrintProgress(reader, out)
+		_ = reader.Close()
 		if err != nil {
 			log.Printf("failed to download %s: %v\n", ref, err)
 			continue
@@ -98,121 +77,71 @@ func ImagePull(cli *client.Client, ctx context.Context, ref string, options imag
 	return fmt.Errorf("failed to download %s four times, giving up", ref)
 }
 
-func Exec(cli *client.Client, containerID string, args []string, out io.Writer) (bool, error) {
-	ctx := context.Background()
-	id, err := cli.ContainerExecCreate(ctx, containerID, container.ExecOptions{
-		Privileged:   true,
-		Tty:          true,
-		Detach:       false,
-		Cmd:          args,
-		AttachStdout: true,
-		AttachStderr: true,
-	})
-
-	if err != nil {
-		return false, err
-	}
-
-	attached, err := cli.ContainerExecAttach(ctx, id.ID, container.ExecStartOptions{
-		Detach: false,
-		Tty:    true,
+func Exec(rt Runtime, containerID string, args []string, out io.Writer) (bool, error) {
+	exitCode, err := rt.Exec(context.Background(), containerID, ExecOptions{
+		Cmd:    args,
+		Stdout: out,
 	})
 	if err != nil {
 		return false, err
 	}
-	defer attached.Close()
-
-	io.Copy(out, attached.Reader)
-
-	resp, err := cli.ContainerExecInspect(ctx, id.ID)
-	if err != nil {
-		return false, err
-	}
-	return resp.ExitCode == 0, nil
+	return exitCode == 0, nil
 }
 
-func Terminal(cli *client.Client, containerID string, args []string, file *os.File) (int, error) {
+func Terminal(rt Runtime, containerID string, args []string, file *os.File) (int, error) {
 
 	if !term.IsTerminal(int(file.Fd())) {
 		return 1, fmt.Errorf("failure calling terminal out of TTY")
 	}
 
-	ctx := context.Background()
-	id, err := cli.ContainerExecCreate(ctx, containerID, container.ExecOptions{
-		Privileged:   true,
-		Tty:          true,
-		Detach:       false,
-		Cmd:          args,
-		AttachStdout: true,
-		AttachStderr: true,
-		AttachStdin:  true,
-	})
-
-	if err != nil {
-		return -1, err
-	}
-
-	attached, err := cli.ContainerExecAttach(ctx, id.ID, container.ExecStartOptions{
-		Detach: false,
-		Tty:    true,
-	})
-	if err != nil {
-		return -1, err
-	}
-	defer attached.Close()
-
 	state, err := term.MakeRaw(int(file.Fd()))
 	if err != nil {
 		return -1, err
 	}
+	defer func() {
+		_ = term.Restore(int(file.Fd()), state)
+	}()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
 
 	resizeCh := make(chan os.Signal, 1)
 	signal.Notify(resizeCh, syscall.SIGWINCH)
-	resizeTerminal(ctx, cli, id.ID, file)
-	go func() {
-		for range resizeCh {
-			resizeTerminal(ctx, cli, id.ID, file)
-		}
-	}()
 	defer signal.Stop(resizeCh)
 
-	errChan := make(chan error)
-
-	go func() {
-		interrupt := make(chan os.Signal, 1)
-		signal.Notify(interrupt, os.Interrupt)
-		<-interrupt
-		close(errChan)
-	}()
-
-	go func() {
-		_, err := io.Copy(file, attached.Conn)
-		errChan <- err
-	}()
-
+	sizes := make(chan TerminalSize, 1)
+	sendSize := func() {
+		if w, h, err := term.GetSize(int(file.Fd())); err == nil {
+			select {
+			case sizes <- TerminalSize{Width: uint(w), Height: uint(h)}:
+			default:
+			}
+		}
+	}
+	sendSize()
 	go func() {
-		_, err := io.Copy(attached.Conn, file)
-		errChan <- err
-	}()
-
-	defer func() {
-		_ = term.Restore(int(file.Fd()), state)
+		for {
+			select {
+			case <-resizeCh:
+				sendSize()
+			case <-ctx.Done():
+				return
+			}
+		}
 	}()
 
-	err = <-errChan
-
-	if err != nil {
-		return -1, err
-	}
-
-	resp, err := cli.ContainerExecInspect(ctx, id.ID)
-	if err != nil {
-		return -1, err
-	}
-	return resp.ExitCode, nil
+	return rt.Exec(ctx, containerID, ExecOptions{
+		Cmd:    args,
+		Stdin:  file,
+		Stdout: file,
+		Resize: sizes,
+	})
 }
 
-func NewCleanupHandler(cli *client.Client, cleanupChan chan error, errWriter io.Writer, forceClean bool) (containers chan string, volumes chan string, done chan error) {
+// NewCleanupHandler collects the containers and volumes sent to it and removes them when an error, or with
+// forceClean anything, is sent to cleanupChan. A non-nil ledger is kept in sync with what was created, it is
+// deleted once the resources are removed or handed over and keeps the resources which failed to be removed
+func NewCleanupHandler(rt Runtime, cleanupChan chan error, errWriter io.Writer, forceClean bool, ledger *Ledger) (containers chan string, volumes chan string, done chan error) {
 
 	ctx := context.Background()
 
@@ -220,6 +149,15 @@ func NewCleanupHandler(cli *client.Client, cleanupChan chan error, errWriter io.
 	volumes = make(chan string)
 	done = make(chan error)
 
+	record := func(add func(*Ledger, string) error, resource string) {
+		if ledger == nil {
+			return
+		}
+		if err := add(ledger, resource); err != nil {
+			fmt.Fprintf(errWriter, "%v\n", err)
+		}
+	}
+
 	go func() {
 		createdContainers := []string{}
 		createdVolumes := []string{}
@@ -231,43 +169,61 @@ func NewCleanupHandler(cli *client.Client, cleanupChan chan error, errWriter io.
 			select {
 			case container := <-containers:
 				createdContainers = append(createdContainers, container)
+				record((*Ledger).addContainer, container)
 			case volume := <-volumes:
 				createdVolumes = append(createdVolumes, volume)
+				record((*Ledger).addVolume, volume)
 			case err := <-cleanupChan:
 				log := false
 				if err != nil {
 					log = true
 				}
+				leftContainers := []string{}
+				leftVolumes := []string{}
 				if err != nil || forceClean {
 					for _, c := range createdContainers {
 						if log {
-							reader, err := cli.ContainerLogs(ctx, c, container.LogsOptions{ShowStderr: true, ShowStdout: true, Details: true})
+							reader, err := rt.ContainerLogs(ctx, c)
 							if err == nil {
-								fmt.Fprintf(os.Stderr, "\n===== %s ====\n", c)
-								io.Copy(os.Stderr, reader)
+								fmt.Fprintf(errWriter, "\n===== %s ====\n", c)
+								_, _ = io.Copy(errWriter, reader)
+								_ = reader.Close()
 							}
 						}
-						err := cli.ContainerRemove(ctx, c, container.RemoveOptions{Force: true})
+						err := rt.ContainerRemove(ctx, c, true)
 						if err != nil {
 							fmt.Fprintf(errWriter, "%v\n", err)
 							containersFailedToRemove = append(containersFailedToRemove, c)
 						}
 					}
 					for _, c := range containersFailedToRemove {
-						err := cli.ContainerRemove(ctx, c, container.RemoveOptions{Force: true})
+						err := rt.ContainerRemove(ctx, c, true)
 						if err != nil {
 							fmt.Fprintf(errWriter, "%v\n", err)
+							leftContainers = append(leftContainers, c)
 						}
 					}
 
 					for _, v := range createdVolumes {
-						err := cli.VolumeRemove(ctx, v, true)
-						fmt.Printf("volume: %v\n", v)
+						err := rt.VolumeRemove(ctx, v, true)
 						if err != nil {
 							fmt.Fprintf(errWriter, "%v\n", err)
+							leftVolumes = append(leftVolumes, v)
 						}
 					}
 				}
+				if ledger != nil {
+					var err error
+					if len(leftContainers) == 0 && len(leftVolumes) == 0 {
+						err = ledger.Remove()
+					} else {
+						ledger.Containers, ledger.Volumes = leftContainers, leftVolumes
+						err = ledger.save()
+					}
+					if err != nil {
+						fmt.Fprintf(errWriter, "%v\n", err)
+					}
+				}
 				return
 			}
 		}
@@ -276,11 +232,16 @@ func NewCleanupHandler(cli *client.Client, cleanupChan chan error, errWriter io.
 	return
 }
 
-func PrintProgress(progressReader io.ReadCloser, writer *os.File) error {
-	isTerminal := term.IsTerminal(int(writer.Fd()))
-	w, _, err := term.GetSize(int(writer.Fd()))
+// PrintProgress writes the progress of an image pull, it is redrawn in a single line if writer is a terminal
+func PrintProgress(progressReader io.ReadCloser, writer io.Writer) error {
+	isTerminal, w := false, 0
+	if f, ok := writer.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		var err error
+		w, _, err = term.GetSize(int(f.Fd()))
+		isTerminal = err == nil
+	}
 
-	if isTerminal && err == nil {
+	if isTerminal {
 		scanner := bufio.NewScanner(progressReader)
 		for scanner.Scan() {
 			line := scanner.Text()
@@ -291,7 +252,7 @@ func PrintProgress(progressReader io.ReadCloser, writer *os.File) error {
 			if clearLength < 0 {
 				clearLength = 0
 			}
-			fmt.Print("\r" + line + strings.Repeat(" ", clearLength))
+			fmt.Fprint(writer, "\r"+line+strings.Repeat(" ", clearLength))
 		}
 	} else {
 		fmt.Fprint(writer, "Downloading ...")
@@ -301,9 +262,9 @@ func PrintProgress(progressReader io.ReadCloser, writer *os.File) error {
 			if err := checkForError(line); err != nil {
 				return err
 			}
-			fmt.Print(".")
+			fmt.Fprint(writer, ".")
 		}
-		fmt.Print("\n")
+		fmt.Fprint(writer, "\n")
 	}
 	return nil
 }
@@ -326,12 +287,3 @@ type PullStatus struct {
 	Status string `json:"status,omitempty"`
 	Error  string `json:"error,omitempty"`
 }
-
-func resizeTerminal(ctx context.Context, cli *client.Client, execID string, file *os.File) {
-	if w, h, err := term.GetSize(int(file.Fd())); err == nil {
-		_ = cli.ContainerExecResize(ctx, execID, container.ResizeOptions{
-			Height: uint(h),
-			Width:  uint(w),
-		})
-	}
-}
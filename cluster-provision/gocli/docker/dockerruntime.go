@@ -0,0 +1,236 @@
+package docker
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+)
+
+type dockerRuntime struct {
+	cli *client.Client
+}
+
+// NewDockerRuntime returns a Runtime backed by the docker API
+func NewDockerRuntime(cli *client.Client) Runtime {
+	return &dockerRuntime{cli: cli}
+}
+
+func (d *dockerRuntime) Name() string {
+	return RuntimeDocker
+}
+
+func (d *dockerRuntime) ContainerCreate(ctx context.Context, name string, config *container.Config, hostConfig *container.HostConfig) (string, error) {
+	resp, err := d.cli.ContainerCreate(ctx, config, hostConfig, nil, nil, name)
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+func (d *dockerRuntime) ContainerStart(ctx context.Context, id string) error {
+	return d.cli.ContainerStart(ctx, id, container.StartOptions{})
+}
+
+func (d *dockerRuntime) ContainerStop(ctx context.Context, id string) error {
+	return d.cli.ContainerStop(ctx, id, container.StopOptions{})
+}
+
+func (d *dockerRuntime) ContainerWait(ctx context.Context, id string) (int64, error) {
+	okChan, errChan := d.cli.ContainerWait(ctx, id, container.WaitConditionNotRunning)
+	select {
+	case resp := <-okChan:
+		return resp.StatusCode, nil
+	case err := <-errChan:
+		return -1, err
+	}
+}
+
+func (d *dockerRuntime) ContainerInspect(ctx context.Context, id string) (container.InspectResponse, error) {
+	return d.cli.ContainerInspect(ctx, id)
+}
+
+func (d *dockerRuntime) ContainerList(ctx context.Context) ([]container.Summary, error) {
+	return d.cli.ContainerList(ctx, container.ListOptions{All: true})
+}
+
+func (d *dockerRuntime) ContainerLogs(ctx context.Context, id string) (io.ReadCloser, error) {
+	return d.cli.ContainerLogs(ctx, id, container.LogsOptions{ShowStderr: true, ShowStdout: true, Details: true})
+}
+
+func (d *dockerRuntime) ContainerRemove(ctx context.Context, id string, force bool) error {
+	return d.cli.ContainerRemove(ctx, id, container.RemoveOptions{Force: force})
+}
+
+func (d *dockerRuntime) ContainerCommit(ctx context.Context, id string, options container.CommitOptions) (string, error) {
+	resp, err := d.cli.ContainerCommit(ctx, id, options)
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+func (d *dockerRuntime) CopyToContainer(ctx context.Context, id string, dstPath string, content io.Reader) error {
+	return d.cli.CopyToContainer(ctx, id, dstPath, content, container.CopyToContainerOptions{AllowOverwriteDirWithFile: false})
+}
+
+func (d *dockerRuntime) Exec(ctx context.Context, id string, options ExecOptions) (int, error) {
+	exec, err := d.cli.ContainerExecCreate(ctx, id, container.ExecOptions{
+		Privileged:   true,
+		Tty:          true,
+		Detach:       false,
+		Cmd:          options.Cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+		AttachStdin:  options.Stdin != nil,
+	})
+	if err != nil {
+		return -1, err
+	}
+
+	attached, err := d.cli.ContainerExecAttach(ctx, exec.ID, container.ExecStartOptions{
+		Detach: false,
+		Tty:    true,
+	})
+	if err != nil {
+		return -1, err
+	}
+	defer attached.Close()
+
+	go forwardResize(ctx, options.Resize, func(size TerminalSize) error {
+		return d.cli.ContainerExecResize(ctx, exec.ID, container.ResizeOptions{Height: size.Height, Width: size.Width})
+	})
+
+	if err := streamExec(ctx, attached.Conn, attached.Reader, options); err != nil {
+		return -1, err
+	}
+
+	// the exit code is still of interest if the session was interrupted
+	resp, err := d.cli.ContainerExecInspect(context.WithoutCancel(ctx), exec.ID)
+	if err != nil {
+		return -1, err
+	}
+	return resp.ExitCode, nil
+}
+
+func (d *dockerRuntime) VolumeCreate(ctx context.Context, name string, labels map[string]string) error {
+	_, err := d.cli.VolumeCreate(ctx, volume.CreateOptions{Name: name, Labels: labels})
+	return err
+}
+
+func (d *dockerRuntime) VolumeList(ctx context.Context) ([]volume.Volume, error) {
+	resp, err := d.cli.VolumeList(ctx, volume.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	volumes := []volume.Volume{}
+	for _, v := range resp.Volumes {
+		volumes = append(volumes, *v)
+	}
+	return volumes, nil
+}
+
+func (d *dockerRuntime) VolumeRemove(ctx context.Context, name string, force bool) error {
+	return d.cli.VolumeRemove(ctx, name, force)
+}
+
+func (d *dockerRuntime) ImageExists(ctx context.Context, ref string) (bool, error) {
+	// docker lists images of docker.io without the registry
+	ref = strings.TrimPrefix(ref, "docker.io/")
+
+	images, err := d.cli.ImageList(ctx, image.ListOptions{All: true})
+	if err != nil {
+		return false, err
+	}
+	for _, img := range images {
+		for _, tag := range append(img.RepoTags, img.RepoDigests...) {
+			if tag == ref {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (d *dockerRuntime) ImageInspect(ctx context.Context, ref string) (image.InspectResponse, error) {
+	return d.cli.ImageInspect(ctx, ref)
+}
+
+func (d *dockerRuntime) ImagePull(ctx context.Context, ref string) (io.ReadCloser, error) {
+	return d.cli.ImagePull(ctx, ref, image.PullOptions{})
+}
+
+func (d *dockerRuntime) ImageTag(ctx context.Context, source string, target string) error {
+	return d.cli.ImageTag(ctx, source, target)
+}
+
+func (d *dockerRuntime) ImageSave(ctx context.Context, refs []string) (io.ReadCloser, error) {
+	return d.cli.ImageSave(ctx, refs)
+}
+
+func (d *dockerRuntime) ImageLoad(ctx context.Context, archive io.Reader) error {
+	resp, err := d.cli.ImageLoad(ctx, archive, client.ImageLoadWithQuiet(true))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	// docker reports a broken archive in the JSON lines of the response
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if err := checkForError(scanner.Text()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// streamExec copies the output of an attached exec session to options.Stdout and options.Stdin to the session.
+// It returns once the output ends, stdin is closed or ctx is done
+func streamExec(ctx context.Context, conn net.Conn, output io.Reader, options ExecOptions) error {
+	out := options.Stdout
+	if out == nil {
+		out = io.Discard
+	}
+
+	errChan := make(chan error, 2)
+	go func() {
+		_, err := io.Copy(out, output)
+		errChan <- err
+	}()
+	if options.Stdin != nil {
+		go func() {
+			_, err := io.Copy(conn, options.Stdin)
+			errChan <- err
+		}()
+	}
+
+	select {
+	case err := <-errChan:
+		return err
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+func forwardResize(ctx context.Context, sizes <-chan TerminalSize, resize func(TerminalSize) error) {
+	if sizes == nil {
+		return
+	}
+	for {
+		select {
+		case size, ok := <-sizes:
+			if !ok {
+				return
+			}
+			_ = resize(size)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
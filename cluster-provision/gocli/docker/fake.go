@@ -0,0 +1,564 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/go-connections/nat"
+)
+
+// FakeRuntime is an in-memory Runtime for tests. Its containers don't run anything, commands executed
+// in them are answered by ExecHandler
+type FakeRuntime struct {
+	mu         sync.Mutex
+	containers map[string]*FakeContainer
+	volumes    map[string]volume.Volume
+	images     map[string]bool
+	labels     map[string]map[string]string
+	nextID     int
+	nextPort   int
+
+	// ExecHandler returns the exit code of a command run in a container and may write its output,
+	// all commands succeed without output if it is not set
+	ExecHandler func(c *FakeContainer, cmd []string, out io.Writer) int
+	// RunHandler decides whether the command of a started container ends right away and with which exit code,
+	// containers keep running until they are stopped if it is not set
+	RunHandler func(c *FakeContainer) (exitCode int, exited bool)
+	// Execs records all commands run in containers
+	Execs []FakeExec
+	// Pulled records all pulled images
+	Pulled []string
+	// Saved records the images of every ImageSave call
+	Saved [][]string
+	// Tagged records all tags added with ImageTag
+	Tagged []string
+}
+
+// FakeContainer is a container of the FakeRuntime
+type FakeContainer struct {
+	ID         string
+	Name       string
+	Config     *container.Config
+	HostConfig *container.HostConfig
+	Running    bool
+	Ports      nat.PortMap
+	// Copied records the paths archives were copied to
+	Copied []string
+	// AnonymousVolumes maps the volumes of the config nothing was mounted at to the volumes created for them
+	AnonymousVolumes map[string]string
+
+	exitCode  int
+	created   time.Time
+	startedAt time.Time
+	stopped   chan struct{}
+}
+
+// FakeExec is a command run in a container of the FakeRuntime
+type FakeExec struct {
+	Container string
+	Cmd       []string
+}
+
+// NewFakeRuntime returns an empty FakeRuntime which knows the given images
+func NewFakeRuntime(images ...string) *FakeRuntime {
+	f := &FakeRuntime{
+		containers: map[string]*FakeContainer{},
+		volumes:    map[string]volume.Volume{},
+		images:     map[string]bool{},
+		labels:     map[string]map[string]string{},
+		nextPort:   32768,
+	}
+	for _, i := range images {
+		f.images[normalizeReference(i)] = true
+	}
+	return f
+}
+
+// Container returns the container with the given ID or name
+func (f *FakeRuntime) Container(idOrName string) (*FakeContainer, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, err := f.lookup(idOrName)
+	return c, err == nil
+}
+
+// Stop stops a running container, it stays around until it is removed
+func (f *FakeRuntime) Stop(idOrName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, err := f.lookup(idOrName)
+	if err != nil {
+		return err
+	}
+	f.stop(c)
+	return nil
+}
+
+// Volumes returns the names of all volumes
+func (f *FakeRuntime) Volumes() []string {
+	volumes, _ := f.VolumeList(context.Background())
+	names := []string{}
+	for _, v := range volumes {
+		names = append(names, v.Name)
+	}
+	return names
+}
+
+// RemoveImage removes an image like a prune does
+func (f *FakeRuntime) RemoveImage(ref string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.images, normalizeReference(ref))
+}
+
+func (f *FakeRuntime) Name() string {
+	return "fake"
+}
+
+func (f *FakeRuntime) ContainerCreate(_ context.Context, name string, config *container.Config, hostConfig *container.HostConfig) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.lookup(name); err == nil {
+		return "", fmt.Errorf("the container name %s is already in use", name)
+	}
+	if !f.images[normalizeReference(config.Image)] {
+		return "", fmt.Errorf("image %s: %w", config.Image, ErrNotFound)
+	}
+	if hostConfig == nil {
+		hostConfig = &container.HostConfig{}
+	}
+	// like docker the container inherits the labels of its image
+	if imageLabels := f.labels[normalizeReference(config.Image)]; len(imageLabels) > 0 {
+		labels := maps.Clone(imageLabels)
+		maps.Copy(labels, config.Labels)
+		inherited := *config
+		inherited.Labels = labels
+		config = &inherited
+	}
+
+	f.nextID++
+	c := &FakeContainer{
+		ID:         fmt.Sprintf("%064x", f.nextID),
+		Name:       name,
+		Config:     config,
+		HostConfig: hostConfig,
+		Ports:      nat.PortMap{},
+		created:    time.Now(),
+	}
+	for port, bindings := range hostConfig.PortBindings {
+		c.Ports[port] = append([]nat.PortBinding{}, bindings...)
+	}
+	if hostConfig.PublishAllPorts {
+		for port := range config.ExposedPorts {
+			if _, ok := c.Ports[port]; !ok {
+				c.Ports[port] = []nat.PortBinding{{HostIP: "127.0.0.1"}}
+			}
+		}
+	}
+	for port, bindings := range c.Ports {
+		for i := range bindings {
+			if bindings[i].HostPort == "" {
+				bindings[i].HostPort = strconv.Itoa(f.nextPort)
+				f.nextPort++
+			}
+		}
+		c.Ports[port] = bindings
+	}
+	// like docker every volume of the config nothing is mounted at gets an anonymous volume, which outlives the container
+	c.AnonymousVolumes = map[string]string{}
+	for target := range config.Volumes {
+		if slices.ContainsFunc(hostConfig.Mounts, func(m mount.Mount) bool { return m.Target == target }) {
+			continue
+		}
+		name := fmt.Sprintf("%x", sha256.Sum256([]byte(c.ID+target)))
+		f.volumes[name] = volume.Volume{Name: name, CreatedAt: time.Now().Format(time.RFC3339)}
+		c.AnonymousVolumes[target] = name
+	}
+	f.containers[c.ID] = c
+	return c.ID, nil
+}
+
+func (f *FakeRuntime) ContainerStart(_ context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, err := f.lookup(id)
+	if err != nil {
+		return err
+	}
+	if netns := c.HostConfig.NetworkMode; netns.IsContainer() {
+		if owner, err := f.lookup(netns.ConnectedContainer()); err != nil || !owner.Running {
+			return fmt.Errorf("can't join the network namespace of %s, it is not running", netns.ConnectedContainer())
+		}
+	}
+	if !c.Running {
+		c.Running = true
+		c.startedAt = time.Now()
+		c.stopped = make(chan struct{})
+		if f.RunHandler != nil {
+			if exitCode, exited := f.RunHandler(c); exited {
+				c.exitCode = exitCode
+				f.stop(c)
+			}
+		}
+	}
+	return nil
+}
+
+func (f *FakeRuntime) ContainerStop(_ context.Context, id string) error {
+	return f.Stop(id)
+}
+
+func (f *FakeRuntime) ContainerWait(ctx context.Context, id string) (int64, error) {
+	f.mu.Lock()
+	c, err := f.lookup(id)
+	if err != nil {
+		f.mu.Unlock()
+		return -1, err
+	}
+	stopped := c.stopped
+	f.mu.Unlock()
+	if stopped == nil {
+		return 0, nil
+	}
+	select {
+	case <-stopped:
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return int64(c.exitCode), nil
+	case <-ctx.Done():
+		return -1, ctx.Err()
+	}
+}
+
+func (f *FakeRuntime) ContainerInspect(_ context.Context, id string) (container.InspectResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, err := f.lookup(id)
+	if err != nil {
+		return container.InspectResponse{}, err
+	}
+	status := "created"
+	if c.Running {
+		status = "running"
+	}
+	mounts := []container.MountPoint{}
+	for _, m := range c.HostConfig.Mounts {
+		point := container.MountPoint{Type: m.Type, Source: m.Source, Destination: m.Target}
+		if m.Type == mount.TypeVolume {
+			point.Name = m.Source
+		}
+		mounts = append(mounts, point)
+	}
+	for _, target := range slices.Sorted(maps.Keys(c.AnonymousVolumes)) {
+		name := c.AnonymousVolumes[target]
+		mounts = append(mounts, container.MountPoint{Type: mount.TypeVolume, Name: name, Source: name, Destination: target})
+	}
+	return container.InspectResponse{
+		ContainerJSONBase: &container.ContainerJSONBase{
+			ID:         c.ID,
+			Name:       "/" + c.Name,
+			Image:      c.Config.Image,
+			State:      &container.State{Status: status, Running: c.Running, ExitCode: c.exitCode, StartedAt: c.startedAt.Format(time.RFC3339Nano)},
+			HostConfig: c.HostConfig,
+		},
+		Mounts: mounts,
+		Config: c.Config,
+		NetworkSettings: &container.NetworkSettings{
+			NetworkSettingsBase: container.NetworkSettingsBase{Ports: c.Ports},
+		},
+	}, nil
+}
+
+func (f *FakeRuntime) ContainerList(_ context.Context) ([]container.Summary, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	containers := []container.Summary{}
+	for i := 1; i <= f.nextID; i++ {
+		c, ok := f.containers[fmt.Sprintf("%064x", i)]
+		if !ok {
+			continue
+		}
+		state := "created"
+		if c.Running {
+			state = "running"
+		}
+		containers = append(containers, container.Summary{
+			ID:      c.ID,
+			Names:   []string{"/" + c.Name},
+			Image:   c.Config.Image,
+			Labels:  c.Config.Labels,
+			State:   state,
+			Created: c.created.Unix(),
+		})
+	}
+	return containers, nil
+}
+
+func (f *FakeRuntime) ContainerLogs(_ context.Context, id string) (io.ReadCloser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.lookup(id); err != nil {
+		return nil, err
+	}
+	return io.NopCloser(strings.NewReader("")), nil
+}
+
+func (f *FakeRuntime) ContainerRemove(_ context.Context, id string, force bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, err := f.lookup(id)
+	if err != nil {
+		return err
+	}
+	if c.Running && !force {
+		return fmt.Errorf("container %s is running, it can only be removed with force", c.Name)
+	}
+	f.stop(c)
+	delete(f.containers, c.ID)
+	return nil
+}
+
+func (f *FakeRuntime) ContainerCommit(_ context.Context, id string, options container.CommitOptions) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, err := f.lookup(id)
+	if err != nil {
+		return "", err
+	}
+	ref := normalizeReference(options.Reference)
+	f.images[ref] = true
+	f.labels[ref] = map[string]string{}
+	for k, v := range c.Config.Labels {
+		f.labels[ref][k] = v
+	}
+	// only the LABEL instruction is understood
+	for _, change := range options.Changes {
+		if label, ok := strings.CutPrefix(change, "LABEL "); ok {
+			k, v, _ := strings.Cut(label, "=")
+			f.labels[ref][k] = v
+		}
+	}
+	return "sha256:" + c.ID, nil
+}
+
+func (f *FakeRuntime) CopyToContainer(_ context.Context, id string, dstPath string, content io.Reader) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, err := f.lookup(id)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(io.Discard, content); err != nil {
+		return err
+	}
+	c.Copied = append(c.Copied, dstPath)
+	return nil
+}
+
+func (f *FakeRuntime) Exec(_ context.Context, id string, options ExecOptions) (int, error) {
+	f.mu.Lock()
+	c, err := f.lookup(id)
+	if err == nil && !c.Running {
+		err = fmt.Errorf("container %s is not running", c.Name)
+	}
+	if err != nil {
+		f.mu.Unlock()
+		return -1, err
+	}
+	f.Execs = append(f.Execs, FakeExec{Container: c.Name, Cmd: options.Cmd})
+	handler := f.ExecHandler
+	f.mu.Unlock()
+
+	if handler == nil {
+		return 0, nil
+	}
+	out := options.Stdout
+	if out == nil {
+		out = io.Discard
+	}
+	return handler(c, options.Cmd, out), nil
+}
+
+func (f *FakeRuntime) VolumeCreate(_ context.Context, name string, labels map[string]string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.volumes[name]; !ok {
+		f.volumes[name] = volume.Volume{Name: name, Labels: labels, CreatedAt: time.Now().Format(time.RFC3339)}
+	}
+	return nil
+}
+
+func (f *FakeRuntime) VolumeList(_ context.Context) ([]volume.Volume, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	volumes := []volume.Volume{}
+	for _, name := range slices.Sorted(maps.Keys(f.volumes)) {
+		volumes = append(volumes, f.volumes[name])
+	}
+	return volumes, nil
+}
+
+func (f *FakeRuntime) VolumeRemove(_ context.Context, name string, _ bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.volumes[name]; !ok {
+		return fmt.Errorf("volume %s: %w", name, ErrNotFound)
+	}
+	delete(f.volumes, name)
+	return nil
+}
+
+func (f *FakeRuntime) ImageExists(_ context.Context, ref string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.images[normalizeReference(ref)], nil
+}
+
+func (f *FakeRuntime) ImageInspect(_ context.Context, ref string) (image.InspectResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ref = normalizeReference(ref)
+	if !f.images[ref] {
+		return image.InspectResponse{}, fmt.Errorf("image %s: %w", ref, ErrNotFound)
+	}
+	return image.InspectResponse{
+		ID:       "sha256:" + ref,
+		RepoTags: []string{ref},
+		Config:   &container.Config{Labels: f.labels[ref]},
+	}, nil
+}
+
+func (f *FakeRuntime) ImagePull(_ context.Context, ref string) (io.ReadCloser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.images[normalizeReference(ref)] = true
+	f.Pulled = append(f.Pulled, ref)
+	return io.NopCloser(strings.NewReader(`{"status":"Download complete"}` + "\n")), nil
+}
+
+func (f *FakeRuntime) ImageTag(_ context.Context, source string, target string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.images[normalizeReference(source)] {
+		return fmt.Errorf("image %s: %w", source, ErrNotFound)
+	}
+	f.images[normalizeReference(target)] = true
+	f.Tagged = append(f.Tagged, target)
+	return nil
+}
+
+func (f *FakeRuntime) lookup(idOrName string) (*FakeContainer, error) {
+	if c, ok := f.containers[idOrName]; ok {
+		return c, nil
+	}
+	for _, c := range f.containers {
+		if c.Name == strings.TrimPrefix(idOrName, "/") {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("container %s: %w", idOrName, ErrNotFound)
+}
+
+func (f *FakeRuntime) stop(c *FakeContainer) {
+	if c.Running {
+		c.Running = false
+		close(c.stopped)
+	}
+}
+
+// ImageSave returns a docker-archive in which every image has a layer of its own on top of a base layer they share
+func (f *FakeRuntime) ImageSave(_ context.Context, refs []string) (io.ReadCloser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, ref := range refs {
+		if !f.images[normalizeReference(ref)] {
+			return nil, fmt.Errorf("image %s: %w", ref, ErrNotFound)
+		}
+	}
+	f.Saved = append(f.Saved, refs)
+
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	add := func(content []byte) (string, error) {
+		name := fmt.Sprintf("blobs/sha256/%x", sha256.Sum256(content))
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content))}); err != nil {
+			return "", err
+		}
+		_, err := tw.Write(content)
+		return name, err
+	}
+	base, err := add([]byte("base"))
+	if err != nil {
+		return nil, err
+	}
+	manifest := []map[string]any{}
+	for _, ref := range refs {
+		layer, err := add([]byte(ref))
+		if err != nil {
+			return nil, err
+		}
+		config, err := add([]byte(fmt.Sprintf(`{"architecture":"amd64","os":"linux","config":{"Labels":{"ref":%q}}}`, ref)))
+		if err != nil {
+			return nil, err
+		}
+		manifest = append(manifest, map[string]any{"Config": config, "RepoTags": []string{ref}, "Layers": []string{base, layer}})
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: "manifest.json", Mode: 0o644, Size: int64(len(data))}); err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return io.NopCloser(buf), nil
+}
+
+// ImageLoad adds the images named in the manifest.json of a docker-archive
+func (f *FakeRuntime) ImageLoad(_ context.Context, archive io.Reader) error {
+	tr := tar.NewReader(archive)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return fmt.Errorf("the archive has no manifest.json")
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Name != "manifest.json" {
+			continue
+		}
+		manifest := []struct{ RepoTags []string }{}
+		if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+			return err
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for _, img := range manifest {
+			for _, tag := range img.RepoTags {
+				f.images[normalizeReference(tag)] = true
+			}
+		}
+		return nil
+	}
+}
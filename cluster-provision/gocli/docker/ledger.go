@@ -0,0 +1,197 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// LedgerDirEnv overrides the directory the cleanup ledgers are kept in
+const LedgerDirEnv = "KUBEVIRTCI_LEDGER_DIR"
+
+// Ledger records the containers and volumes a run of gocli created for a cluster. It is written to disk
+// whenever a resource is added and removed once the run either cleaned up or handed the cluster over, so
+// a ledger which outlives its process tells what a killed gocli left behind. The run holds a lock next to
+// the ledger, the kernel releases it with the process. Unlike a PID it works across the PID namespaces of
+// gocli containers, as long as they share the directory
+type Ledger struct {
+	Prefix     string    `json:"prefix"`
+	StartedAt  time.Time `json:"startedAt"`
+	Containers []string  `json:"containers"`
+	Volumes    []string  `json:"volumes"`
+
+	path string
+	lock *os.File
+}
+
+// LedgerDir returns the directory the ledgers are kept in
+func LedgerDir() string {
+	if dir := os.Getenv(LedgerDirEnv); dir != "" {
+		return dir
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "gocli", "ledger")
+}
+
+func ledgerPath(prefix string) string {
+	return filepath.Join(LedgerDir(), prefix+".json")
+}
+
+func lockPath(ledgerPath string) string {
+	return strings.TrimSuffix(ledgerPath, ".json") + ".lock"
+}
+
+// ErrLedgerLocked is returned by NewLedger while another gocli holds the lock of the ledger
+var ErrLedgerLocked = errors.New("the ledger is locked by another gocli")
+
+// NewLedger starts the ledger of a run of gocli for the cluster with the given prefix. The lock is held
+// until the ledger is removed or the process exits
+func NewLedger(prefix string) (*Ledger, error) {
+	if err := os.MkdirAll(LedgerDir(), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create the ledger directory: %v", err)
+	}
+	l := &Ledger{
+		Prefix:     prefix,
+		StartedAt:  time.Now(),
+		Containers: []string{},
+		Volumes:    []string{},
+		path:       ledgerPath(prefix),
+	}
+	lock, err := os.OpenFile(lockPath(l.path), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the ledger lock: %v", err)
+	}
+	if err := unix.Flock(int(lock.Fd()), unix.LOCK_EX|unix.LOCK_NB); err != nil {
+		lock.Close()
+		if errors.Is(err, unix.EWOULDBLOCK) {
+			return nil, ErrLedgerLocked
+		}
+		return nil, fmt.Errorf("failed to lock the ledger: %v", err)
+	}
+	l.lock = lock
+	return l, l.save()
+}
+
+// LoadLedger returns the ledger of the cluster with the given prefix, or nil if there is none
+func LoadLedger(prefix string) (*Ledger, error) {
+	return loadLedger(ledgerPath(prefix))
+}
+
+// LoadLedgers returns all ledgers sorted by prefix
+func LoadLedgers() ([]*Ledger, error) {
+	entries, err := os.ReadDir(LedgerDir())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	ledgers := []*Ledger{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		l, err := loadLedger(filepath.Join(LedgerDir(), e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if l != nil {
+			ledgers = append(ledgers, l)
+		}
+	}
+	return ledgers, nil
+}
+
+func loadLedger(path string) (*Ledger, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	l := &Ledger{path: path}
+	if err := json.Unmarshal(data, l); err != nil {
+		return nil, fmt.Errorf("invalid ledger %s: %v", path, err)
+	}
+	return l, nil
+}
+
+// Stale returns whether the gocli which wrote the ledger is gone, that is nobody holds its lock
+func (l *Ledger) Stale() bool {
+	lock, err := os.Open(lockPath(l.path))
+	if err != nil {
+		return true
+	}
+	defer lock.Close()
+	if err := unix.Flock(int(lock.Fd()), unix.LOCK_SH|unix.LOCK_NB); err != nil {
+		return !errors.Is(err, unix.EWOULDBLOCK)
+	}
+	_ = unix.Flock(int(lock.Fd()), unix.LOCK_UN)
+	return true
+}
+
+// Reconcile removes the containers and volumes of the ledger which still exist and then the ledger.
+// Containers are removed in reverse order, dnsmasq was created first and goes last
+func (l *Ledger) Reconcile(rt Runtime) error {
+	ctx := context.Background()
+	for _, c := range slices.Backward(l.Containers) {
+		if err := rt.ContainerRemove(ctx, c, true); err != nil && !IsNotFound(err) {
+			return err
+		}
+	}
+	for _, v := range l.Volumes {
+		if err := rt.VolumeRemove(ctx, v, true); err != nil && !IsNotFound(err) {
+			return err
+		}
+	}
+	return l.Remove()
+}
+
+// Remove deletes the ledger from disk and releases its lock
+func (l *Ledger) Remove() error {
+	if err := os.Remove(l.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.Remove(lockPath(l.path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if l.lock != nil {
+		l.lock.Close()
+		l.lock = nil
+	}
+	return nil
+}
+
+func (l *Ledger) addContainer(id string) error {
+	l.Containers = append(l.Containers, id)
+	return l.save()
+}
+
+func (l *Ledger) addVolume(name string) error {
+	l.Volumes = append(l.Volumes, name)
+	return l.save()
+}
+
+// save replaces the ledger on disk at once, a gocli killed while writing leaves the previous version
+func (l *Ledger) save() error {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write the ledger %s: %v", l.path, err)
+	}
+	return os.Rename(tmp, l.path)
+}
@@ -0,0 +1,94 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func Test_CleanupHandlerLedger(t *testing.T) {
+	t.Setenv(LedgerDirEnv, t.TempDir())
+	ctx := context.Background()
+	rt := NewFakeRuntime("quay.io/kubevirtci/k8s-1.30")
+	id, err := rt.ContainerCreate(ctx, "k8s-1.30-dnsmasq", &container.Config{Image: "quay.io/kubevirtci/k8s-1.30"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.VolumeCreate(ctx, "k8s-1.30-registry", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	ledger, err := NewLedger("k8s-1.30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan error, 1)
+	containers, volumes, done := NewCleanupHandler(rt, stop, io.Discard, false, ledger)
+	containers <- id
+	volumes <- "k8s-1.30-registry"
+	volumes <- "k8s-1.30-gone"
+
+	if ledger.Stale() {
+		t.Error("the ledger of a running process is stale")
+	}
+
+	stop <- errors.New("interrupt received, clean up")
+	<-done
+	if _, ok := rt.Container("k8s-1.30-dnsmasq"); ok {
+		t.Error("the container was not removed")
+	}
+	left, err := LoadLedger("k8s-1.30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left == nil || len(left.Containers) != 0 || !reflect.DeepEqual(left.Volumes, []string{"k8s-1.30-gone"}) {
+		t.Errorf("the ledger should keep what failed to be removed, got %+v", left)
+	}
+}
+
+func Test_LedgerReconcile(t *testing.T) {
+	t.Setenv(LedgerDirEnv, t.TempDir())
+	ctx := context.Background()
+	rt := NewFakeRuntime("quay.io/kubevirtci/k8s-1.30")
+	id, err := rt.ContainerCreate(ctx, "k8s-1.30-dnsmasq", &container.Config{Image: "quay.io/kubevirtci/k8s-1.30"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ledger, err := NewLedger("k8s-1.30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ledger.addContainer(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := ledger.addVolume("k8s-1.30-gone"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewLedger("k8s-1.30"); !errors.Is(err, ErrLedgerLocked) {
+		t.Errorf("a second run of the cluster should find the ledger locked, got %v", err)
+	}
+	// the kernel releases the lock of a killed gocli
+	ledger.lock.Close()
+
+	ledgers, err := LoadLedgers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ledgers) != 1 || !ledgers[0].Stale() {
+		t.Fatalf("expected one stale ledger, got %+v", ledgers)
+	}
+	if err := ledgers[0].Reconcile(rt); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rt.Container(id); ok {
+		t.Error("the container was not removed")
+	}
+	if ledgers, _ := LoadLedgers(); len(ledgers) != 0 {
+		t.Errorf("the ledger was not removed: %+v", ledgers)
+	}
+}
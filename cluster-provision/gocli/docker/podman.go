@@ -0,0 +1,642 @@
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/go-connections/nat"
+	"golang.org/x/sys/unix"
+)
+
+// libpodAPI is the base of the libpod REST API, podman serves it on the same socket as its docker compatible API
+const libpodAPI = "http://d/v4.0.0/libpod"
+
+// ErrNotFound is returned by the podman runtime for containers, volumes and images which do not exist
+var ErrNotFound = errors.New("not found")
+
+type podmanRuntime struct {
+	socket   string
+	client   *http.Client
+	rootless bool
+	// accessible reports whether the user podman runs as can open a host device, only consulted for rootless podman
+	accessible func(path string) bool
+}
+
+// NewPodmanRuntime returns a Runtime which talks the libpod API on the given unix socket
+func NewPodmanRuntime(socket string) (Runtime, error) {
+	p := &podmanRuntime{
+		socket: socket,
+		client: &http.Client{Transport: &http.Transport{DialContext: unixDialer(socket)}},
+		accessible: func(path string) bool {
+			return unix.Access(path, unix.R_OK|unix.W_OK) == nil
+		},
+	}
+
+	info := struct {
+		Host struct {
+			Security struct {
+				Rootless bool `json:"rootless"`
+			} `json:"security"`
+		} `json:"host"`
+	}{}
+	if err := p.do(context.Background(), http.MethodGet, "/info", nil, nil, &info); err != nil {
+		return nil, fmt.Errorf("podman does not answer on %s: %w", socket, err)
+	}
+	p.rootless = info.Host.Security.Rootless
+	return p, nil
+}
+
+func (p *podmanRuntime) Name() string {
+	return RuntimePodman
+}
+
+// podmanSpec is the subset of the libpod SpecGenerator gocli makes use of
+type podmanSpec struct {
+	Name         string              `json:"name"`
+	Image        string              `json:"image"`
+	Env          map[string]string   `json:"env,omitempty"`
+	Command      []string            `json:"command,omitempty"`
+	Entrypoint   []string            `json:"entrypoint,omitempty"`
+	Labels       map[string]string   `json:"labels,omitempty"`
+	Privileged   bool                `json:"privileged,omitempty"`
+	Netns        *podmanNamespace    `json:"netns,omitempty"`
+	PortMappings []podmanPortMapping `json:"portmappings,omitempty"`
+	PublishPorts bool                `json:"publish_image_ports,omitempty"`
+	Expose       map[uint16]string   `json:"expose,omitempty"`
+	HostAdd      []string            `json:"hostadd,omitempty"`
+	Devices      []podmanDevice      `json:"devices,omitempty"`
+	Mounts       []podmanMount       `json:"mounts,omitempty"`
+	Volumes      []podmanNamedVolume `json:"volumes,omitempty"`
+}
+
+type podmanNamespace struct {
+	NSMode string `json:"nsmode"`
+	Value  string `json:"value,omitempty"`
+}
+
+type podmanPortMapping struct {
+	HostIP        string `json:"host_ip,omitempty"`
+	ContainerPort uint16 `json:"container_port"`
+	HostPort      uint16 `json:"host_port,omitempty"`
+	Protocol      string `json:"protocol,omitempty"`
+}
+
+// podmanDevice takes the device in the format of podman run --device, host-path[:container-path][:permissions]
+type podmanDevice struct {
+	Path string `json:"path"`
+}
+
+type podmanMount struct {
+	Destination string   `json:"destination"`
+	Type        string   `json:"type"`
+	Source      string   `json:"source"`
+	Options     []string `json:"options,omitempty"`
+}
+
+// podmanNamedVolume mounts a volume, an empty name creates an anonymous volume
+type podmanNamedVolume struct {
+	Name    string
+	Dest    string
+	Options []string `json:",omitempty"`
+}
+
+// newPodmanSpec translates the docker container configuration. Rootless podman has no device cgroup to
+// enforce permissions with and can only pass through devices the user running podman has access to
+func (p *podmanRuntime) newPodmanSpec(name string, config *container.Config, hostConfig *container.HostConfig) (*podmanSpec, error) {
+	spec := &podmanSpec{
+		Name:         name,
+		Image:        config.Image,
+		Command:      config.Cmd,
+		Entrypoint:   config.Entrypoint,
+		Labels:       config.Labels,
+		Privileged:   hostConfig.Privileged,
+		PublishPorts: hostConfig.PublishAllPorts,
+		HostAdd:      hostConfig.ExtraHosts,
+	}
+
+	if len(config.Env) > 0 {
+		spec.Env = map[string]string{}
+		for _, e := range config.Env {
+			k, v, _ := strings.Cut(e, "=")
+			spec.Env[k] = v
+		}
+	}
+
+	switch mode := hostConfig.NetworkMode; {
+	case mode.IsContainer():
+		spec.Netns = &podmanNamespace{NSMode: "container", Value: mode.ConnectedContainer()}
+	case mode.IsHost():
+		spec.Netns = &podmanNamespace{NSMode: "host"}
+	}
+
+	for port := range config.ExposedPorts {
+		if spec.Expose == nil {
+			spec.Expose = map[uint16]string{}
+		}
+		spec.Expose[uint16(port.Int())] = port.Proto()
+	}
+	for port, bindings := range hostConfig.PortBindings {
+		for _, b := range bindings {
+			mapping := podmanPortMapping{HostIP: b.HostIP, ContainerPort: uint16(port.Int()), Protocol: port.Proto()}
+			if b.HostPort != "" {
+				hostPort, err := strconv.ParseUint(b.HostPort, 10, 16)
+				if err != nil {
+					return nil, fmt.Errorf("invalid host port %s for %s: %w", b.HostPort, port, err)
+				}
+				mapping.HostPort = uint16(hostPort)
+			}
+			spec.PortMappings = append(spec.PortMappings, mapping)
+		}
+	}
+	sort.Slice(spec.PortMappings, func(i, j int) bool {
+		return spec.PortMappings[i].ContainerPort < spec.PortMappings[j].ContainerPort
+	})
+
+	// podman silently leaves out the devices of privileged rootless containers the user has no access to,
+	// devices which are asked for explicitly have to be there
+	for _, d := range hostConfig.Devices {
+		if p.rootless && !p.accessible(d.PathOnHost) {
+			return nil, fmt.Errorf("device %s can't be passed to %s, the user running rootless podman has no access to it", d.PathOnHost, name)
+		}
+		device := d.PathOnHost
+		if d.PathInContainer != "" {
+			device += ":" + d.PathInContainer
+		}
+		if d.CgroupPermissions != "" && !p.rootless {
+			device += ":" + d.CgroupPermissions
+		}
+		spec.Devices = append(spec.Devices, podmanDevice{Path: device})
+	}
+
+	mounted := map[string]bool{}
+	for _, m := range hostConfig.Mounts {
+		mounted[m.Target] = true
+		switch m.Type {
+		case mount.TypeBind:
+			options := []string{"rbind"}
+			if m.ReadOnly {
+				options = append(options, "ro")
+			}
+			spec.Mounts = append(spec.Mounts, podmanMount{Destination: m.Target, Type: "bind", Source: m.Source, Options: options})
+		case mount.TypeVolume:
+			spec.Volumes = append(spec.Volumes, podmanNamedVolume{Name: m.Source, Dest: m.Target})
+		default:
+			return nil, fmt.Errorf("mounts of type %s are not supported with podman", m.Type)
+		}
+	}
+	anonymous := []string{}
+	for dest := range config.Volumes {
+		if !mounted[dest] {
+			anonymous = append(anonymous, dest)
+		}
+	}
+	sort.Strings(anonymous)
+	for _, dest := range anonymous {
+		spec.Volumes = append(spec.Volumes, podmanNamedVolume{Dest: dest})
+	}
+
+	return spec, nil
+}
+
+func (p *podmanRuntime) ContainerCreate(ctx context.Context, name string, config *container.Config, hostConfig *container.HostConfig) (string, error) {
+	spec, err := p.newPodmanSpec(name, config, hostConfig)
+	if err != nil {
+		return "", err
+	}
+	resp := struct {
+		ID string `json:"Id"`
+	}{}
+	if err := p.do(ctx, http.MethodPost, "/containers/create", nil, spec, &resp); err != nil {
+		return "", fmt.Errorf("creating container %s failed: %w", name, err)
+	}
+	return resp.ID, nil
+}
+
+func (p *podmanRuntime) ContainerStart(ctx context.Context, id string) error {
+	return p.do(ctx, http.MethodPost, "/containers/"+id+"/start", nil, nil, nil)
+}
+
+func (p *podmanRuntime) ContainerStop(ctx context.Context, id string) error {
+	return p.do(ctx, http.MethodPost, "/containers/"+id+"/stop", nil, nil, nil)
+}
+
+func (p *podmanRuntime) ContainerWait(ctx context.Context, id string) (int64, error) {
+	var exitCode int64
+	query := url.Values{"condition": []string{"stopped", "exited"}}
+	if err := p.do(ctx, http.MethodPost, "/containers/"+id+"/wait", query, nil, &exitCode); err != nil {
+		return -1, err
+	}
+	return exitCode, nil
+}
+
+// podmanInspect is the subset of the libpod inspect response gocli makes use of
+type podmanInspect struct {
+	ID    string `json:"Id"`
+	Name  string
+	Image string
+	State struct {
+		Status    string
+		Running   bool
+		ExitCode  int
+		Pid       int
+		StartedAt time.Time
+	}
+	Config struct {
+		Image  string
+		Env    []string
+		Cmd    []string
+		Labels map[string]string
+	}
+	HostConfig struct {
+		Privileged bool
+		ExtraHosts []string
+		Devices    []container.DeviceMapping
+	}
+	Mounts []struct {
+		Type        string
+		Name        string
+		Source      string
+		Destination string
+	}
+	NetworkSettings struct {
+		Ports nat.PortMap
+	}
+}
+
+func (p *podmanRuntime) ContainerInspect(ctx context.Context, id string) (container.InspectResponse, error) {
+	inspect := podmanInspect{}
+	if err := p.do(ctx, http.MethodGet, "/containers/"+id+"/json", nil, nil, &inspect); err != nil {
+		return container.InspectResponse{}, err
+	}
+
+	resp := container.InspectResponse{
+		ContainerJSONBase: &container.ContainerJSONBase{
+			ID:    inspect.ID,
+			Name:  "/" + inspect.Name,
+			Image: inspect.Image,
+			State: &container.State{
+				Status:    inspect.State.Status,
+				Running:   inspect.State.Running,
+				ExitCode:  inspect.State.ExitCode,
+				Pid:       inspect.State.Pid,
+				StartedAt: inspect.State.StartedAt.Format(time.RFC3339Nano),
+			},
+			HostConfig: &container.HostConfig{
+				Privileged: inspect.HostConfig.Privileged,
+				ExtraHosts: inspect.HostConfig.ExtraHosts,
+				Resources:  container.Resources{Devices: inspect.HostConfig.Devices},
+			},
+		},
+		Config: &container.Config{
+			Image:   inspect.Config.Image,
+			Env:     inspect.Config.Env,
+			Cmd:     inspect.Config.Cmd,
+			Labels:  inspect.Config.Labels,
+			Volumes: map[string]struct{}{},
+		},
+		NetworkSettings: &container.NetworkSettings{
+			NetworkSettingsBase: container.NetworkSettingsBase{Ports: inspect.NetworkSettings.Ports},
+		},
+	}
+	for _, m := range inspect.Mounts {
+		resp.Mounts = append(resp.Mounts, container.MountPoint{
+			Type:        mount.Type(m.Type),
+			Name:        m.Name,
+			Source:      m.Source,
+			Destination: m.Destination,
+		})
+		if m.Type == string(mount.TypeVolume) {
+			resp.Config.Volumes[m.Destination] = struct{}{}
+		}
+	}
+	return resp, nil
+}
+
+func (p *podmanRuntime) ContainerList(ctx context.Context) ([]container.Summary, error) {
+	list := []struct {
+		ID      string `json:"Id"`
+		Names   []string
+		Image   string
+		State   string
+		Status  string
+		Labels  map[string]string
+		Created int64
+	}{}
+	if err := p.do(ctx, http.MethodGet, "/containers/json", url.Values{"all": []string{"true"}}, nil, &list); err != nil {
+		return nil, err
+	}
+
+	containers := []container.Summary{}
+	for _, c := range list {
+		containers = append(containers, container.Summary{
+			ID:      c.ID,
+			Names:   c.Names,
+			Image:   c.Image,
+			State:   c.State,
+			Status:  c.Status,
+			Labels:  c.Labels,
+			Created: c.Created,
+		})
+	}
+	return containers, nil
+}
+
+func (p *podmanRuntime) ContainerLogs(ctx context.Context, id string) (io.ReadCloser, error) {
+	return p.stream(ctx, http.MethodGet, "/containers/"+id+"/logs", url.Values{"stdout": []string{"true"}, "stderr": []string{"true"}}, nil)
+}
+
+func (p *podmanRuntime) ContainerRemove(ctx context.Context, id string, force bool) error {
+	return p.do(ctx, http.MethodDelete, "/containers/"+id, url.Values{"force": []string{strconv.FormatBool(force)}}, nil, nil)
+}
+
+func (p *podmanRuntime) ContainerCommit(ctx context.Context, id string, options container.CommitOptions) (string, error) {
+	query := url.Values{
+		"container": []string{id},
+		"comment":   []string{options.Comment},
+		"author":    []string{options.Author},
+		"pause":     []string{strconv.FormatBool(options.Pause)},
+		"changes":   options.Changes,
+	}
+	if options.Reference != "" {
+		repo, tag := splitReference(options.Reference)
+		query.Set("repo", repo)
+		query.Set("tag", tag)
+	}
+
+	resp := struct {
+		ID string `json:"Id"`
+	}{}
+	if err := p.do(ctx, http.MethodPost, "/commit", query, nil, &resp); err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+func (p *podmanRuntime) CopyToContainer(ctx context.Context, id string, dstPath string, content io.Reader) error {
+	return p.do(ctx, http.MethodPut, "/containers/"+id+"/archive", url.Values{"path": []string{dstPath}}, content, nil)
+}
+
+func (p *podmanRuntime) Exec(ctx context.Context, id string, options ExecOptions) (int, error) {
+	exec := struct {
+		ID string `json:"Id"`
+	}{}
+	err := p.do(ctx, http.MethodPost, "/containers/"+id+"/exec", nil, map[string]interface{}{
+		"Cmd":          options.Cmd,
+		"Tty":          true,
+		"Privileged":   true,
+		"AttachStdout": true,
+		"AttachStderr": true,
+		"AttachStdin":  options.Stdin != nil,
+	}, &exec)
+	if err != nil {
+		return -1, err
+	}
+
+	conn, output, err := p.hijack(ctx, "/exec/"+exec.ID+"/start", map[string]interface{}{"Detach": false, "Tty": true})
+	if err != nil {
+		return -1, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	go forwardResize(ctx, options.Resize, func(size TerminalSize) error {
+		query := url.Values{"h": []string{strconv.Itoa(int(size.Height))}, "w": []string{strconv.Itoa(int(size.Width))}}
+		return p.do(ctx, http.MethodPost, "/exec/"+exec.ID+"/resize", query, nil, nil)
+	})
+
+	if err := streamExec(ctx, conn, output, options); err != nil {
+		return -1, err
+	}
+
+	inspect := struct {
+		ExitCode int
+	}{}
+	// the exit code is still of interest if the session was interrupted
+	if err := p.do(context.WithoutCancel(ctx), http.MethodGet, "/exec/"+exec.ID+"/json", nil, nil, &inspect); err != nil {
+		return -1, err
+	}
+	return inspect.ExitCode, nil
+}
+
+func (p *podmanRuntime) VolumeCreate(ctx context.Context, name string, labels map[string]string) error {
+	body := struct {
+		Name   string
+		Labels map[string]string `json:",omitempty"`
+	}{Name: name, Labels: labels}
+	return p.do(ctx, http.MethodPost, "/volumes/create", nil, body, nil)
+}
+
+func (p *podmanRuntime) VolumeList(ctx context.Context) ([]volume.Volume, error) {
+	list := []struct {
+		Name      string
+		Labels    map[string]string
+		CreatedAt time.Time
+	}{}
+	if err := p.do(ctx, http.MethodGet, "/volumes/json", nil, nil, &list); err != nil {
+		return nil, err
+	}
+	volumes := []volume.Volume{}
+	for _, v := range list {
+		volumes = append(volumes, volume.Volume{Name: v.Name, Labels: v.Labels, CreatedAt: v.CreatedAt.Format(time.RFC3339)})
+	}
+	return volumes, nil
+}
+
+func (p *podmanRuntime) VolumeRemove(ctx context.Context, name string, force bool) error {
+	return p.do(ctx, http.MethodDelete, "/volumes/"+name, url.Values{"force": []string{strconv.FormatBool(force)}}, nil, nil)
+}
+
+func (p *podmanRuntime) ImageExists(ctx context.Context, ref string) (bool, error) {
+	err := p.do(ctx, http.MethodGet, "/images/"+url.PathEscape(ref)+"/exists", nil, nil, nil)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (p *podmanRuntime) ImageInspect(ctx context.Context, ref string) (image.InspectResponse, error) {
+	inspect := struct {
+		ID       string `json:"Id"`
+		RepoTags []string
+		Config   struct {
+			Env    []string
+			Cmd    []string
+			Labels map[string]string
+		}
+	}{}
+	if err := p.do(ctx, http.MethodGet, "/images/"+url.PathEscape(ref)+"/json", nil, nil, &inspect); err != nil {
+		return image.InspectResponse{}, err
+	}
+	return image.InspectResponse{
+		ID:       inspect.ID,
+		RepoTags: inspect.RepoTags,
+		Config: &container.Config{
+			Env:    inspect.Config.Env,
+			Cmd:    inspect.Config.Cmd,
+			Labels: inspect.Config.Labels,
+		},
+	}, nil
+}
+
+func (p *podmanRuntime) ImagePull(ctx context.Context, ref string) (io.ReadCloser, error) {
+	return p.stream(ctx, http.MethodPost, "/images/pull", url.Values{"reference": []string{ref}}, nil)
+}
+
+func (p *podmanRuntime) ImageTag(ctx context.Context, source string, target string) error {
+	repo, tag := splitReference(target)
+	return p.do(ctx, http.MethodPost, "/images/"+url.PathEscape(source)+"/tag", url.Values{"repo": []string{repo}, "tag": []string{tag}}, nil, nil)
+}
+
+func (p *podmanRuntime) ImageSave(ctx context.Context, refs []string) (io.ReadCloser, error) {
+	return p.stream(ctx, http.MethodGet, "/images/export", url.Values{"format": []string{"docker-archive"}, "references": refs}, nil)
+}
+
+func (p *podmanRuntime) ImageLoad(ctx context.Context, archive io.Reader) error {
+	return p.do(ctx, http.MethodPost, "/images/load", nil, archive, nil)
+}
+
+// do sends a request to the libpod API. A body which is an io.Reader is sent as tar archive, anything
+// else as JSON. The JSON response is decoded into out if it is set
+func (p *podmanRuntime) do(ctx context.Context, method string, path string, query url.Values, body interface{}, out interface{}) error {
+	resp, err := p.request(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// stream sends a request to the libpod API and returns the response body, which has to be closed by the caller
+func (p *podmanRuntime) stream(ctx context.Context, method string, path string, query url.Values, body interface{}) (io.ReadCloser, error) {
+	resp, err := p.request(ctx, method, path, query, body)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (p *podmanRuntime) request(ctx context.Context, method string, path string, query url.Values, body interface{}) (*http.Response, error) {
+	req, err := newLibpodRequest(ctx, method, path, query, body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := libpodError(resp); err != nil {
+		_ = resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// hijack starts an attached session and takes over the connection, podman streams the session on it
+func (p *podmanRuntime) hijack(ctx context.Context, path string, body interface{}) (net.Conn, io.Reader, error) {
+	req, err := newLibpodRequest(ctx, http.MethodPost, path, nil, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+
+	conn, err := unixDialer(p.socket)(ctx, "", "")
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := req.Write(conn); err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+	if err := libpodError(resp); err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+	return conn, reader, nil
+}
+
+func newLibpodRequest(ctx context.Context, method string, path string, query url.Values, body interface{}) (*http.Request, error) {
+	u := libpodAPI + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	contentType := ""
+	switch b := body.(type) {
+	case nil:
+	case io.Reader:
+		reader = b
+		contentType = "application/x-tar"
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+		contentType = "application/json"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return req, nil
+}
+
+// libpodError turns an error response of the libpod API into an error
+func libpodError(resp *http.Response) error {
+	if resp.StatusCode < http.StatusBadRequest {
+		return nil
+	}
+	apiErr := struct {
+		Message string `json:"message"`
+	}{}
+	data, _ := io.ReadAll(resp.Body)
+	if err := json.Unmarshal(data, &apiErr); err != nil || apiErr.Message == "" {
+		apiErr.Message = strings.TrimSpace(string(data))
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s: %w", apiErr.Message, ErrNotFound)
+	}
+	return fmt.Errorf("podman returned %d: %s", resp.StatusCode, apiErr.Message)
+}
+
+// splitReference splits an image reference into repository and tag, a digest is not expected
+func splitReference(ref string) (string, string) {
+	lastSlash := strings.LastIndex(ref, "/")
+	if idx := strings.LastIndex(ref, ":"); idx > lastSlash {
+		return ref[:idx], ref[idx+1:]
+	}
+	return ref, "latest"
+}
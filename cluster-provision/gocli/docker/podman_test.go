@@ -0,0 +1,238 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/go-connections/nat"
+)
+
+func Test_newPodmanSpec(t *testing.T) {
+	config := &container.Config{
+		Image:        "quay.io/kubevirtci/k8s-1.30",
+		Env:          []string{"NODE_NUM=01", "EMPTY="},
+		Cmd:          []string{"/bin/bash", "-c", "/vm.sh"},
+		ExposedPorts: nat.PortSet{"22/tcp": {}, "53/udp": {}},
+		Volumes:      map[string]struct{}{"/var/lib/rook": {}, "/shared": {}},
+	}
+	hostConfig := &container.HostConfig{
+		Privileged:      true,
+		PublishAllPorts: true,
+		PortBindings:    nat.PortMap{"22/tcp": {{HostIP: "127.0.0.1", HostPort: "2201"}}},
+		NetworkMode:     container.NetworkMode("container:dnsmasq"),
+		Mounts: []mount.Mount{
+			{Type: mount.TypeVolume, Source: "kubevirt-shared", Target: "/shared"},
+			{Type: mount.TypeBind, Source: "/lib/modules", Target: "/lib/modules"},
+		},
+		Resources: container.Resources{Devices: []container.DeviceMapping{
+			{PathOnHost: "/dev/vfio/vfio", PathInContainer: "/dev/vfio/vfio", CgroupPermissions: "mrw"},
+		}},
+	}
+
+	tests := []struct {
+		name       string
+		rootless   bool
+		accessible bool
+		wantDevice string
+		wantErr    string
+	}{
+		{name: "should keep the device permissions with rootful podman", wantDevice: "/dev/vfio/vfio:/dev/vfio/vfio:mrw"},
+		{name: "should drop the device permissions with rootless podman", rootless: true, accessible: true, wantDevice: "/dev/vfio/vfio:/dev/vfio/vfio"},
+		{name: "should reject devices rootless podman can't access", rootless: true, wantErr: "has no access to it"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &podmanRuntime{rootless: tt.rootless, accessible: func(string) bool { return tt.accessible }}
+			spec, err := p.newPodmanSpec("kubevirt-node01", config, hostConfig)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("newPodmanSpec() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newPodmanSpec() error = %v", err)
+			}
+
+			if want := []podmanDevice{{Path: tt.wantDevice}}; !reflect.DeepEqual(spec.Devices, want) {
+				t.Errorf("devices = %v, want %v", spec.Devices, want)
+			}
+			if want := (&podmanNamespace{NSMode: "container", Value: "dnsmasq"}); !reflect.DeepEqual(spec.Netns, want) {
+				t.Errorf("netns = %v, want %v", spec.Netns, want)
+			}
+			if want := map[string]string{"NODE_NUM": "01", "EMPTY": ""}; !reflect.DeepEqual(spec.Env, want) {
+				t.Errorf("env = %v, want %v", spec.Env, want)
+			}
+			if want := []podmanPortMapping{{HostIP: "127.0.0.1", ContainerPort: 22, HostPort: 2201, Protocol: "tcp"}}; !reflect.DeepEqual(spec.PortMappings, want) {
+				t.Errorf("port mappings = %v, want %v", spec.PortMappings, want)
+			}
+			if want := map[uint16]string{22: "tcp", 53: "udp"}; !reflect.DeepEqual(spec.Expose, want) || !spec.PublishPorts {
+				t.Errorf("expose = %v, publish = %t, want %v published", spec.Expose, spec.PublishPorts, want)
+			}
+			wantVolumes := []podmanNamedVolume{{Name: "kubevirt-shared", Dest: "/shared"}, {Dest: "/var/lib/rook"}}
+			if !reflect.DeepEqual(spec.Volumes, wantVolumes) {
+				t.Errorf("volumes = %v, want %v", spec.Volumes, wantVolumes)
+			}
+			wantMounts := []podmanMount{{Destination: "/lib/modules", Type: "bind", Source: "/lib/modules", Options: []string{"rbind"}}}
+			if !reflect.DeepEqual(spec.Mounts, wantMounts) {
+				t.Errorf("mounts = %v, want %v", spec.Mounts, wantMounts)
+			}
+		})
+	}
+}
+
+func Test_podmanRuntime(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v4.0.0/libpod/info", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"host":{"security":{"rootless":true}}}`))
+	})
+	mux.HandleFunc("GET /v4.0.0/libpod/containers/kubevirt-dnsmasq/json", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"Id":"abc","Name":"kubevirt-dnsmasq","State":{"Status":"running","Running":true},
+			"Config":{"Image":"quay.io/kubevirtci/k8s-1.30:latest","Cmd":["/dnsmasq.sh"]},
+			"Mounts":[{"Type":"volume","Name":"0123","Destination":"/var/lib/rook"}],
+			"NetworkSettings":{"Ports":{"22/tcp":[{"HostIp":"127.0.0.1","HostPort":"40022"}]}}}`))
+	})
+	mux.HandleFunc("GET /v4.0.0/libpod/images/{name}/exists", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("name") == "registry:2.7.1" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"cause":"failed to find image","message":"failed to find image nfs","response":404}`))
+	})
+	mux.HandleFunc("GET /v4.0.0/libpod/images/{name}/json", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"Id":"123","RepoTags":["localhost/kubevirtci-snapshot/kubevirt:before-dnsmasq"],
+			"Config":{"Cmd":["/bin/bash","-c","/dnsmasq.sh"],"Labels":{"io.kubevirtci.snapshot":"e30"}}}`))
+	})
+	mux.HandleFunc("GET /v4.0.0/libpod/images/export", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("format") != "docker-archive" || !reflect.DeepEqual(r.URL.Query()["references"], []string{"registry:2.7.1", "nfs"}) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"message":"unexpected export"}`))
+			return
+		}
+		_, _ = w.Write([]byte("archive"))
+	})
+	mux.HandleFunc("POST /v4.0.0/libpod/images/load", func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Content-Type") != "application/x-tar" || string(data) != "archive" {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"message":"payload does not match any of the supported image formats"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"Names":["docker.io/library/registry:2.7.1"]}`))
+	})
+	mux.HandleFunc("POST /v4.0.0/libpod/images/{name}/tag", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("name") != "quay.io/kubevirt/macvtap-cni@sha256:af31" || r.URL.Query().Get("repo") != "quay.io/kubevirt/macvtap-cni" || r.URL.Query().Get("tag") != "sha256-af31" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"message":"unexpected tag"}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("POST /v4.0.0/libpod/containers/create", func(w http.ResponseWriter, r *http.Request) {
+		spec := podmanSpec{}
+		if err := json.NewDecoder(r.Body).Decode(&spec); err != nil || spec.Name != "kubevirt-registry" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"message":"unexpected spec"}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"Id":"def","Warnings":[]}`))
+	})
+	mux.HandleFunc("GET /v4.0.0/libpod/volumes/json", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`[{"Name":"kubevirt-registry","Labels":{"io.kubevirtci.prefix":"kubevirt"},"CreatedAt":"2024-05-01T10:00:00Z"}]`))
+	})
+
+	socket := filepath.Join(t.TempDir(), "podman.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(mux)
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	rt, err := NewPodmanRuntime(socket)
+	if err != nil {
+		t.Fatalf("NewPodmanRuntime() error = %v", err)
+	}
+	if !rt.(*podmanRuntime).rootless {
+		t.Errorf("rootless podman was not detected")
+	}
+	ctx := context.Background()
+
+	inspect, err := rt.ContainerInspect(ctx, "kubevirt-dnsmasq")
+	if err != nil {
+		t.Fatalf("ContainerInspect() error = %v", err)
+	}
+	if inspect.Name != "/kubevirt-dnsmasq" || !inspect.State.Running {
+		t.Errorf("inspect = %+v, want the running kubevirt-dnsmasq container", inspect.ContainerJSONBase)
+	}
+	if got := inspect.NetworkSettings.Ports["22/tcp"]; len(got) != 1 || got[0].HostPort != "40022" {
+		t.Errorf("ports = %v, want 22/tcp published on 40022", inspect.NetworkSettings.Ports)
+	}
+	if _, ok := inspect.Config.Volumes["/var/lib/rook"]; !ok {
+		t.Errorf("volumes = %v, want /var/lib/rook", inspect.Config.Volumes)
+	}
+
+	if exists, err := rt.ImageExists(ctx, "registry:2.7.1"); err != nil || !exists {
+		t.Errorf("ImageExists(registry) = %t, %v, want true", exists, err)
+	}
+	if exists, err := rt.ImageExists(ctx, "nfs"); err != nil || exists {
+		t.Errorf("ImageExists(nfs) = %t, %v, want false", exists, err)
+	}
+
+	image, err := rt.ImageInspect(ctx, "kubevirtci-snapshot/kubevirt:before-dnsmasq")
+	if err != nil || image.Config.Labels["io.kubevirtci.snapshot"] != "e30" {
+		t.Errorf("ImageInspect() = %+v, %v, want the labels of the image", image.Config, err)
+	}
+
+	archive, err := rt.ImageSave(ctx, []string{"registry:2.7.1", "nfs"})
+	if err != nil {
+		t.Fatalf("ImageSave() error = %v", err)
+	}
+	if data, err := io.ReadAll(archive); err != nil || string(data) != "archive" {
+		t.Errorf("ImageSave() = %q, %v, want the archive podman exported", data, err)
+	}
+	_ = archive.Close()
+	if err := rt.ImageLoad(ctx, strings.NewReader("archive")); err != nil {
+		t.Errorf("ImageLoad() error = %v", err)
+	}
+	if err := rt.ImageLoad(ctx, strings.NewReader("garbage")); err == nil || !strings.Contains(err.Error(), "supported image formats") {
+		t.Errorf("ImageLoad() error = %v, want the message of podman", err)
+	}
+
+	if err := rt.ImageTag(ctx, "quay.io/kubevirt/macvtap-cni@sha256:af31", "quay.io/kubevirt/macvtap-cni:sha256-af31"); err != nil {
+		t.Errorf("ImageTag() error = %v", err)
+	}
+
+	id, err := rt.ContainerCreate(ctx, "kubevirt-registry", &container.Config{Image: "registry:2.7.1"}, &container.HostConfig{})
+	if err != nil || id != "def" {
+		t.Errorf("ContainerCreate() = %s, %v, want def", id, err)
+	}
+	_, err = rt.ContainerCreate(ctx, "kubevirt-nfs", &container.Config{Image: "nfs"}, &container.HostConfig{})
+	if err == nil || !strings.Contains(err.Error(), "unexpected spec") {
+		t.Errorf("ContainerCreate() error = %v, want the message of podman", err)
+	}
+
+	volumes, err := rt.VolumeList(ctx)
+	if err != nil || len(volumes) != 1 || volumes[0].Labels["io.kubevirtci.prefix"] != "kubevirt" || volumes[0].CreatedAt != "2024-05-01T10:00:00Z" {
+		t.Errorf("VolumeList() = %+v, %v, want kubevirt-registry with its labels", volumes, err)
+	}
+
+	if err := rt.ContainerStart(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ContainerStart() error = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,139 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+)
+
+const (
+	// RuntimeEnv selects the container runtime, docker or podman. Without it podman is used if the
+	// socket serves the libpod API and docker otherwise
+	RuntimeEnv = "KUBEVIRTCI_RUNTIME"
+
+	RuntimeDocker = "docker"
+	RuntimePodman = "podman"
+)
+
+// Runtime is the container engine the cluster containers run on
+type Runtime interface {
+	// Name returns the name of the runtime, docker or podman
+	Name() string
+
+	ContainerCreate(ctx context.Context, name string, config *container.Config, hostConfig *container.HostConfig) (string, error)
+	ContainerStart(ctx context.Context, id string) error
+	// ContainerStop stops the container, stopping a container which is not running is not an error
+	ContainerStop(ctx context.Context, id string) error
+	// ContainerWait blocks until the container is not running anymore and returns its exit code
+	ContainerWait(ctx context.Context, id string) (int64, error)
+	ContainerInspect(ctx context.Context, id string) (container.InspectResponse, error)
+	// ContainerList returns all containers, including the stopped ones
+	ContainerList(ctx context.Context) ([]container.Summary, error)
+	ContainerLogs(ctx context.Context, id string) (io.ReadCloser, error)
+	ContainerRemove(ctx context.Context, id string, force bool) error
+	// ContainerCommit creates an image from the container and returns its ID
+	ContainerCommit(ctx context.Context, id string, options container.CommitOptions) (string, error)
+	// CopyToContainer extracts the tar archive content into dstPath of the container
+	CopyToContainer(ctx context.Context, id string, dstPath string, content io.Reader) error
+	// Exec runs a command with a TTY in the container and returns its exit code
+	Exec(ctx context.Context, id string, options ExecOptions) (int, error)
+
+	VolumeCreate(ctx context.Context, name string, labels map[string]string) error
+	VolumeList(ctx context.Context) ([]volume.Volume, error)
+	VolumeRemove(ctx context.Context, name string, force bool) error
+
+	ImageExists(ctx context.Context, ref string) (bool, error)
+	ImageInspect(ctx context.Context, ref string) (image.InspectResponse, error)
+	// ImagePull returns the progress of the pull as JSON lines, see PrintProgress
+	ImagePull(ctx context.Context, ref string) (io.ReadCloser, error)
+	// ImageTag adds the tag target to the image source, which may be a reference by digest
+	ImageTag(ctx context.Context, source string, target string) error
+	// ImageSave returns the images as a docker-archive tar, layers shared by the images are included once
+	ImageSave(ctx context.Context, refs []string) (io.ReadCloser, error)
+	// ImageLoad loads the images of a docker-archive tar
+	ImageLoad(ctx context.Context, archive io.Reader) error
+}
+
+// ExecOptions describes a command run with Runtime.Exec
+type ExecOptions struct {
+	Cmd []string
+	// Stdin is attached to the command if set, the command ends when it is closed
+	Stdin io.Reader
+	// Stdout receives stdout and stderr of the command
+	Stdout io.Writer
+	// Resize receives the size of the terminal whenever it changes
+	Resize <-chan TerminalSize
+}
+
+// TerminalSize is the size of the terminal an interactive command runs in
+type TerminalSize struct {
+	Width  uint
+	Height uint
+}
+
+// NewRuntime connects to the runtime selected by KUBEVIRTCI_RUNTIME on the socket configured by DOCKER_HOST
+func NewRuntime() (Runtime, error) {
+	socket := strings.TrimPrefix(client.DefaultDockerHost, "unix://")
+	if host := os.Getenv(client.EnvOverrideHost); host != "" {
+		socket = strings.TrimPrefix(host, "unix://")
+	}
+
+	name := os.Getenv(RuntimeEnv)
+	if name == "" {
+		name = RuntimeDocker
+		if servesLibpod(socket) {
+			name = RuntimePodman
+		}
+	}
+
+	switch name {
+	case RuntimeDocker:
+		cli, err := client.NewClientWithOpts(client.FromEnv)
+		if err != nil {
+			return nil, err
+		}
+		return NewDockerRuntime(cli), nil
+	case RuntimePodman:
+		return NewPodmanRuntime(socket)
+	default:
+		return nil, fmt.Errorf("unsupported container runtime %q set in %s, possible values: %s, %s", name, RuntimeEnv, RuntimeDocker, RuntimePodman)
+	}
+}
+
+// IsNotFound returns whether err reports a container, volume or image which does not exist, regardless of the runtime
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound) || errdefs.IsNotFound(err)
+}
+
+// servesLibpod returns whether the socket belongs to podman, docker does not know the libpod ping endpoint
+func servesLibpod(socket string) bool {
+	c := &http.Client{
+		Timeout:   5 * time.Second,
+		Transport: &http.Transport{DialContext: unixDialer(socket)},
+	}
+	resp, err := c.Get(libpodAPI + "/_ping")
+	if err != nil {
+		return false
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+func unixDialer(socket string) func(ctx context.Context, _, _ string) (net.Conn, error) {
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		d := net.Dialer{}
+		return d.DialContext(ctx, "unix", socket)
+	}
+}
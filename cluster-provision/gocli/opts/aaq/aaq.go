@@ -5,8 +5,10 @@ import (
 	_ "embed"
 	"fmt"
 	"regexp"
+	"time"
 
 	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	k8s "kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/k8s"
 	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/libssh"
 )
@@ -60,7 +62,9 @@ func (o *aaqOpt) Exec() error {
 		}
 	}
 
-	if err := o.sshClient.Command("kubectl --kubeconfig=/etc/kubernetes/admin.conf wait --for=condition=Ready pod --timeout=180s --all --namespace aaq"); err != nil {
+	// the operator reports the AAQ available once all of its components are ready
+	aaqGVK := schema.GroupVersionKind{Group: "aaq.kubevirt.io", Version: "v1alpha1", Kind: "AAQ"}
+	if err := k8s.WaitForCondition(o.client, aaqGVK, "aaq", "", "Available", 180*time.Second); err != nil {
 		return err
 	}
 	logrus.Info("AAQ Operator is ready!")
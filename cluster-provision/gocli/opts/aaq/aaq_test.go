@@ -24,7 +24,7 @@ var _ = ginkgo.Describe("AaqOpt", func() {
 	)
 
 	ginkgo.BeforeEach(func() {
-		client = k8s.NewTestClient()
+		client = k8s.NewTestClient(k8s.NewReactorConfig("create", "aaqs", AaqReactor))
 		ctrl = gomock.NewController(ginkgo.GinkgoT())
 		sshClient = kubevirtcimocks.NewMockSSHClient(ctrl)
 		opt = NewAaqOpt(client, sshClient, "")
@@ -35,8 +35,6 @@ var _ = ginkgo.Describe("AaqOpt", func() {
 	})
 
 	ginkgo.It("should execute without error", func() {
-		sshClient.EXPECT().Command("kubectl --kubeconfig=/etc/kubernetes/admin.conf wait --for=condition=Ready pod --timeout=180s --all --namespace aaq")
-
 		err := opt.Exec()
 		gomega.Expect(err).ToNot(gomega.HaveOccurred())
 	})
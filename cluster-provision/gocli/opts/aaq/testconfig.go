@@ -1,9 +1,8 @@
 package aaq
 
 import (
-	kubevirtcimocks "kubevirt.io/kubevirtci/cluster-provision/gocli/utils/mock"
+	k8s "kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/k8s"
 )
 
-func AddExpectCalls(sshClient *kubevirtcimocks.MockSSHClient) {
-	sshClient.EXPECT().Command("kubectl --kubeconfig=/etc/kubernetes/admin.conf wait --for=condition=Ready pod --timeout=180s --all --namespace aaq")
-}
+// AaqReactor reports the created AAQ as available
+var AaqReactor = k8s.NewConditionReactor("Available")
@@ -0,0 +1,257 @@
+package addon
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/yaml"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts"
+	k8s "kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/k8s"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/libssh"
+)
+
+const (
+	// File is the name of the add-on definition every add-on directory has to contain
+	File = "addon.yaml"
+
+	NodesAll          = "all"
+	NodesControlPlane = "control-plane"
+	NodesWorkers      = "workers"
+
+	defaultReadinessTimeout = 5 * time.Minute
+)
+
+var nameRegex = regexp.MustCompile(`^[a-z0-9]([a-z0-9_-]*[a-z0-9])?$`)
+
+// Addon is an opt defined by an addon.yaml instead of a package of gocli. Paths are relative to the add-on directory
+type Addon struct {
+	Name      string   `json:"name"`
+	DependsOn []string `json:"dependsOn,omitempty"`
+	After     []string `json:"after,omitempty"`
+	Conflicts []string `json:"conflicts,omitempty"`
+	// K8sVersions is a semver constraint on the K8s version, e.g. ">=1.30"
+	K8sVersions string `json:"k8sVersions,omitempty"`
+	// NodeScripts run as root on the nodes before the manifests are applied
+	NodeScripts []NodeScript `json:"nodeScripts,omitempty"`
+	// Manifests are applied in the listed order, a file may contain several documents
+	Manifests []string `json:"manifests,omitempty"`
+	// ReadinessChecks run as root on node01 once the manifests are applied, each is retried until it succeeds
+	ReadinessChecks []ReadinessCheck `json:"readinessChecks,omitempty"`
+
+	dir string
+}
+
+type NodeScript struct {
+	Path string `json:"path"`
+	// Nodes is one of all, control-plane or workers, it defaults to all
+	Nodes string `json:"nodes,omitempty"`
+}
+
+type ReadinessCheck struct {
+	// Command can use kubectl without passing a kubeconfig
+	Command string          `json:"command"`
+	Timeout metav1.Duration `json:"timeout,omitempty"`
+}
+
+// Load reads and validates the addon.yaml of an add-on directory. Unknown fields are rejected
+func Load(dir string) (*Addon, error) {
+	data, err := os.ReadFile(filepath.Join(dir, File))
+	if err != nil {
+		return nil, fmt.Errorf("failed reading add-on: %v", err)
+	}
+	a := &Addon{dir: dir}
+	if err := yaml.UnmarshalStrict(data, a); err != nil {
+		return nil, fmt.Errorf("invalid add-on %s: %v", dir, err)
+	}
+	if errs := a.Validate(); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid add-on %s: %v", dir, errs.ToAggregate())
+	}
+	return a, nil
+}
+
+// Validate checks every field of the add-on and that the files it refers to exist
+func (a *Addon) Validate() field.ErrorList {
+	errs := field.ErrorList{}
+
+	if !nameRegex.MatchString(a.Name) {
+		errs = append(errs, field.Invalid(field.NewPath("name"), a.Name, "must consist of lower case alphanumeric characters, '-' or '_'"))
+	}
+
+	for i, s := range a.NodeScripts {
+		p := field.NewPath("nodeScripts").Index(i)
+		errs = append(errs, a.validateFile(p.Child("path"), s.Path)...)
+		switch s.Nodes {
+		case "", NodesAll, NodesControlPlane, NodesWorkers:
+		default:
+			errs = append(errs, field.NotSupported(p.Child("nodes"), s.Nodes, []string{NodesAll, NodesControlPlane, NodesWorkers}))
+		}
+	}
+
+	for i, m := range a.Manifests {
+		errs = append(errs, a.validateFile(field.NewPath("manifests").Index(i), m)...)
+	}
+
+	for i, c := range a.ReadinessChecks {
+		p := field.NewPath("readinessChecks").Index(i)
+		if c.Command == "" {
+			errs = append(errs, field.Required(p.Child("command"), ""))
+		}
+		if c.Timeout.Duration < 0 {
+			errs = append(errs, field.Invalid(p.Child("timeout"), c.Timeout.Duration.String(), "must not be negative"))
+		}
+	}
+
+	return errs
+}
+
+func (a *Addon) validateFile(p *field.Path, path string) field.ErrorList {
+	if path == "" {
+		return field.ErrorList{field.Required(p, "")}
+	}
+	if !filepath.IsLocal(path) {
+		return field.ErrorList{field.Invalid(p, path, "must be a path inside the add-on directory")}
+	}
+	info, err := os.Stat(filepath.Join(a.dir, path))
+	if err != nil {
+		return field.ErrorList{field.Invalid(p, path, err.Error())}
+	}
+	if info.IsDir() {
+		return field.ErrorList{field.Invalid(p, path, "must be a file")}
+	}
+	return nil
+}
+
+// Descriptor returns how the add-on is ordered among the other opts of the cluster
+func (a *Addon) Descriptor() opts.Descriptor {
+	return opts.Descriptor{
+		Name:        a.Name,
+		DependsOn:   a.DependsOn,
+		After:       a.After,
+		Conflicts:   a.Conflicts,
+		K8sVersions: a.K8sVersions,
+	}
+}
+
+type addonOpt struct {
+	addon     *Addon
+	client    k8s.K8sDynamicClient
+	sshClient libssh.Client
+	// nodes holds a root client per node, starting with node01
+	nodes []libssh.Client
+}
+
+// NewAddonOpt deploys an add-on. sshClient runs the readiness checks on node01, nodes holds a root
+// client for every node of the cluster starting with node01 to run the node scripts
+func NewAddonOpt(a *Addon, c k8s.K8sDynamicClient, sshClient libssh.Client, nodes []libssh.Client) *addonOpt {
+	return &addonOpt{
+		addon:     a,
+		client:    c,
+		sshClient: sshClient,
+		nodes:     nodes,
+	}
+}
+
+// Name reports the add-on under its own name instead of the name of this package
+func (o *addonOpt) Name() string {
+	return o.addon.Name
+}
+
+func (o *addonOpt) Exec() error {
+	for _, s := range o.addon.NodeScripts {
+		if err := o.runNodeScript(s); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range o.addon.Manifests {
+		if err := o.applyManifest(m); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range o.addon.ReadinessChecks {
+		if err := o.waitForReadiness(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *addonOpt) runNodeScript(s NodeScript) error {
+	script, err := os.ReadFile(filepath.Join(o.addon.dir, s.Path))
+	if err != nil {
+		return err
+	}
+	remotePath := fmt.Sprintf("/tmp/addon-%s-%s", o.addon.Name, filepath.Base(s.Path))
+
+	for i, node := range o.nodes {
+		if (s.Nodes == NodesControlPlane && i != 0) || (s.Nodes == NodesWorkers && i == 0) {
+			continue
+		}
+		if err := node.SCP(remotePath, bytes.NewReader(script)); err != nil {
+			return fmt.Errorf("copying %s to node%02d failed: %w", s.Path, i+1, err)
+		}
+		if err := node.Command(remotePath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *addonOpt) applyManifest(path string) error {
+	manifest, err := os.ReadFile(filepath.Join(o.addon.dir, path))
+	if err != nil {
+		return err
+	}
+
+	yamlDocs := bytes.Split(manifest, []byte("---\n"))
+	for _, yamlDoc := range yamlDocs {
+		if len(bytes.TrimSpace(yamlDoc)) == 0 {
+			continue
+		}
+
+		obj, err := k8s.SerializeIntoObject(yamlDoc)
+		if err != nil {
+			return fmt.Errorf("invalid manifest %s: %w", path, err)
+		}
+		if err := o.client.Apply(obj); err != nil {
+			return fmt.Errorf("error applying manifest %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+func (o *addonOpt) waitForReadiness(c ReadinessCheck) error {
+	timeout := c.Timeout.Duration
+	if timeout == 0 {
+		timeout = defaultReadinessTimeout
+	}
+	cmd := "export KUBECONFIG=/etc/kubernetes/admin.conf; " + c.Command
+
+	operation := func() error {
+		_, err := o.sshClient.CommandWithNoStdOut(cmd)
+		if err != nil {
+			logrus.Infof("add-on %s not ready yet: %v", o.addon.Name, err)
+		}
+		return err
+	}
+
+	err := backoff.Retry(operation, backoff.NewExponentialBackOff(
+		backoff.WithInitialInterval(5*time.Second),
+		backoff.WithMaxInterval(30*time.Second),
+		backoff.WithMaxElapsedTime(timeout),
+	))
+	if err != nil {
+		return fmt.Errorf("add-on %s did not become ready within %s: %w", o.addon.Name, timeout, err)
+	}
+	return nil
+}
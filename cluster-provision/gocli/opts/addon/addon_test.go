@@ -0,0 +1,142 @@
+package addon
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	k8s "kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/k8s"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/libssh"
+	kubevirtcimocks "kubevirt.io/kubevirtci/cluster-provision/gocli/utils/mock"
+)
+
+func TestAddonOpt(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "AddonOpt Suite")
+}
+
+const manifest = `apiVersion: v1
+kind: Namespace
+metadata:
+  name: my-addon
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: my-addon-config
+  namespace: my-addon
+data:
+  key: value
+`
+
+var _ = Describe("AddonOpt", func() {
+	var dir string
+
+	writeFile := func(name, content string) {
+		path := filepath.Join(dir, name)
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		Expect(os.WriteFile(path, []byte(content), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		writeFile("manifests/deploy.yaml", manifest)
+		writeFile("scripts/prepare.sh", "modprobe dummy\n")
+	})
+
+	Describe("Load", func() {
+		It("should load a valid add-on", func() {
+			writeFile(File, `name: my-addon
+after: [multus]
+k8sVersions: ">=1.30"
+nodeScripts:
+- path: scripts/prepare.sh
+  nodes: workers
+manifests:
+- manifests/deploy.yaml
+readinessChecks:
+- command: kubectl rollout status -n my-addon ds/my-addon
+  timeout: 2m
+`)
+			a, err := Load(dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(a.Descriptor().After).To(Equal([]string{"multus"}))
+			Expect(a.Descriptor().K8sVersions).To(Equal(">=1.30"))
+			Expect(a.ReadinessChecks[0].Timeout.Duration).To(Equal(2 * time.Minute))
+		})
+
+		It("should reject unknown fields", func() {
+			writeFile(File, "name: my-addon\nmanifest: manifests/deploy.yaml\n")
+			_, err := Load(dir)
+			Expect(err).To(MatchError(ContainSubstring("unknown field")))
+		})
+
+		It("should report every invalid field", func() {
+			writeFile(File, `name: My_Addon
+nodeScripts:
+- path: ../outside.sh
+  nodes: some
+manifests:
+- manifests/missing.yaml
+readinessChecks:
+- timeout: 1m
+`)
+			_, err := Load(dir)
+			Expect(err).To(MatchError(ContainSubstring("name: Invalid value")))
+			Expect(err).To(MatchError(ContainSubstring("nodeScripts[0].path: Invalid value")))
+			Expect(err).To(MatchError(ContainSubstring("nodeScripts[0].nodes: Unsupported value")))
+			Expect(err).To(MatchError(ContainSubstring("manifests[0]: Invalid value")))
+			Expect(err).To(MatchError(ContainSubstring("readinessChecks[0].command: Required value")))
+		})
+	})
+
+	Describe("Exec", func() {
+		var (
+			mockCtrl  *gomock.Controller
+			node01    *kubevirtcimocks.MockSSHClient
+			node02    *kubevirtcimocks.MockSSHClient
+			k8sClient k8s.K8sDynamicClient
+		)
+
+		BeforeEach(func() {
+			mockCtrl = gomock.NewController(GinkgoT())
+			node01 = kubevirtcimocks.NewMockSSHClient(mockCtrl)
+			node02 = kubevirtcimocks.NewMockSSHClient(mockCtrl)
+			k8sClient = k8s.NewTestClient()
+		})
+
+		AfterEach(func() {
+			mockCtrl.Finish()
+		})
+
+		It("should run the node scripts, apply the manifests and wait for readiness", func() {
+			a := &Addon{
+				Name:            "my-addon",
+				NodeScripts:     []NodeScript{{Path: "scripts/prepare.sh", Nodes: NodesWorkers}},
+				Manifests:       []string{"manifests/deploy.yaml"},
+				ReadinessChecks: []ReadinessCheck{{Command: "kubectl get ns my-addon"}},
+				dir:             dir,
+			}
+
+			gomock.InOrder(
+				node02.EXPECT().SCP("/tmp/addon-my-addon-prepare.sh", gomock.Any()),
+				node02.EXPECT().Command("/tmp/addon-my-addon-prepare.sh"),
+				node01.EXPECT().CommandWithNoStdOut("export KUBECONFIG=/etc/kubernetes/admin.conf; kubectl get ns my-addon"),
+			)
+
+			opt := NewAddonOpt(a, k8sClient, node01, []libssh.Client{node01, node02})
+			Expect(opt.Name()).To(Equal("my-addon"))
+			Expect(opt.Exec()).To(Succeed())
+
+			cm, err := k8sClient.Get(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, "my-addon-config", "my-addon")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cm.Object["data"]).To(HaveKeyWithValue("key", "value"))
+		})
+	})
+})
@@ -7,8 +7,10 @@ import (
 	"io/fs"
 	"path/filepath"
 	"regexp"
+	"time"
 
 	"github.com/sirupsen/logrus"
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts"
 	k8s "kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/k8s"
 	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/libssh"
 )
@@ -22,15 +24,18 @@ type cnaoOpt struct {
 	multusEnabled bool
 	dncEnabled    bool
 	skipCR        bool
+	// images replaces the images of the manifests, like the ones pinned by digest which bundles carry by tag
+	images map[string]string
 }
 
-func NewCnaoOpt(c k8s.K8sDynamicClient, sshClient libssh.Client, multusEnabled, dncEnabled, skipCR bool) *cnaoOpt {
+func NewCnaoOpt(c k8s.K8sDynamicClient, sshClient libssh.Client, multusEnabled, dncEnabled, skipCR bool, images map[string]string) *cnaoOpt {
 	return &cnaoOpt{
 		client:        c,
 		sshClient:     sshClient,
 		multusEnabled: multusEnabled,
 		skipCR:        skipCR,
 		dncEnabled:    dncEnabled,
+		images:        images,
 	}
 }
 
@@ -44,7 +49,7 @@ func (o *cnaoOpt) Exec() error {
 			if err != nil {
 				return err
 			}
-			yamlDocs := bytes.Split(yamlData, []byte("---\n"))
+			yamlDocs := bytes.Split(opts.ReplaceImages(yamlData, o.images), []byte("---\n"))
 			for _, yamlDoc := range yamlDocs {
 				if len(yamlDoc) == 0 {
 					continue
@@ -85,8 +90,5 @@ func (o *cnaoOpt) Exec() error {
 		return err
 	}
 
-	if err := o.sshClient.Command("kubectl --kubeconfig=/etc/kubernetes/admin.conf wait deployment -n cluster-network-addons cluster-network-addons-operator --for condition=Available --timeout=200s"); err != nil {
-		return err
-	}
-	return nil
+	return k8s.WaitForDeployment(o.client, "cluster-network-addons-operator", "cluster-network-addons", 200*time.Second)
 }
@@ -6,6 +6,7 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"go.uber.org/mock/gomock"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	k8s "kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/k8s"
 	kubevirtcimocks "kubevirt.io/kubevirtci/cluster-provision/gocli/utils/mock"
@@ -29,7 +30,7 @@ var _ = Describe("CnaoOpt", func() {
 
 	BeforeEach(func() {
 		mockCtrl = gomock.NewController(GinkgoT())
-		client = k8s.NewTestClient()
+		client = k8s.NewTestClient(k8s.NewReactorConfig("create", "deployments", k8s.RolloutReactor))
 		sshClient = kubevirtcimocks.NewMockSSHClient(mockCtrl)
 	})
 
@@ -42,9 +43,8 @@ var _ = Describe("CnaoOpt", func() {
 		dncEnabled = true
 		multusEnabled = false
 
-		opt = NewCnaoOpt(client, sshClient, multusEnabled, dncEnabled, skipCR)
+		opt = NewCnaoOpt(client, sshClient, multusEnabled, dncEnabled, skipCR, nil)
 
-		sshClient.EXPECT().Command("kubectl --kubeconfig=/etc/kubernetes/admin.conf wait deployment -n cluster-network-addons cluster-network-addons-operator --for condition=Available --timeout=200s")
 		Expect(opt.Exec()).To(Succeed())
 
 		obj, err := client.Get(schema.GroupVersionKind{Group: "networkaddonsoperator.network.kubevirt.io",
@@ -63,8 +63,7 @@ var _ = Describe("CnaoOpt", func() {
 		dncEnabled = false
 		multusEnabled = true
 
-		opt = NewCnaoOpt(client, sshClient, multusEnabled, dncEnabled, skipCR)
-		sshClient.EXPECT().Command("kubectl --kubeconfig=/etc/kubernetes/admin.conf wait deployment -n cluster-network-addons cluster-network-addons-operator --for condition=Available --timeout=200s")
+		opt = NewCnaoOpt(client, sshClient, multusEnabled, dncEnabled, skipCR, nil)
 		Expect(opt.Exec()).To(Succeed())
 
 		obj, err := client.Get(schema.GroupVersionKind{Group: "networkaddonsoperator.network.kubevirt.io",
@@ -83,8 +82,7 @@ var _ = Describe("CnaoOpt", func() {
 		dncEnabled = true
 		multusEnabled = false
 
-		opt = NewCnaoOpt(client, sshClient, multusEnabled, dncEnabled, skipCR)
-		sshClient.EXPECT().Command("kubectl --kubeconfig=/etc/kubernetes/admin.conf wait deployment -n cluster-network-addons cluster-network-addons-operator --for condition=Available --timeout=200s")
+		opt = NewCnaoOpt(client, sshClient, multusEnabled, dncEnabled, skipCR, nil)
 		Expect(opt.Exec()).To(Succeed())
 
 		obj, err := client.Get(schema.GroupVersionKind{Group: "networkaddonsoperator.network.kubevirt.io",
@@ -97,4 +95,21 @@ var _ = Describe("CnaoOpt", func() {
 		Expect(spec).To(HaveKey("multusDynamicNetworks"))
 		Expect(spec).To(HaveKey("multus"))
 	})
+
+	It("should deploy the replaced images", func() {
+		opt = NewCnaoOpt(client, sshClient, false, false, false, map[string]string{
+			"quay.io/brancz/kube-rbac-proxy@sha256:e6a323504999b2a4d2a6bf94f8580a050378eba0900fd31335cf9df5787d9a9b": "quay.io/brancz/kube-rbac-proxy:sha256-e6a323504999b2a4d2a6bf94f8580a050378eba0900fd31335cf9df5787d9a9b",
+		})
+		Expect(opt.Exec()).To(Succeed())
+
+		obj, err := client.Get(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, "cluster-network-addons-operator", "cluster-network-addons")
+		Expect(err).NotTo(HaveOccurred())
+		containers, _, err := unstructured.NestedSlice(obj.Object, "spec", "template", "spec", "containers")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(containers).To(ContainElement(HaveKeyWithValue("image", "quay.io/brancz/kube-rbac-proxy:sha256-e6a323504999b2a4d2a6bf94f8580a050378eba0900fd31335cf9df5787d9a9b")))
+		Expect(containers).To(ContainElement(HaveKeyWithValue("env", ContainElement(And(
+			HaveKeyWithValue("name", "KUBE_RBAC_PROXY_IMAGE"),
+			HaveKeyWithValue("value", "quay.io/brancz/kube-rbac-proxy:sha256-e6a323504999b2a4d2a6bf94f8580a050378eba0900fd31335cf9df5787d9a9b"),
+		)))))
+	})
 })
@@ -0,0 +1,33 @@
+package drainnode
+
+import (
+	"fmt"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/libssh"
+)
+
+type drainNodeOpt struct {
+	sshClient libssh.Client
+	nodeName  string
+}
+
+// NewDrainNodeOpt drains a node and deletes it from the cluster, the ssh client has to point at the control plane
+func NewDrainNodeOpt(sc libssh.Client, nodeName string) *drainNodeOpt {
+	return &drainNodeOpt{
+		sshClient: sc,
+		nodeName:  nodeName,
+	}
+}
+
+func (o *drainNodeOpt) Exec() error {
+	cmds := []string{
+		"kubectl --kubeconfig=/etc/kubernetes/admin.conf drain " + o.nodeName + " --ignore-daemonsets --delete-emptydir-data --force --timeout=300s",
+		"kubectl --kubeconfig=/etc/kubernetes/admin.conf delete node " + o.nodeName,
+	}
+	for _, cmd := range cmds {
+		if err := o.sshClient.Command(cmd); err != nil {
+			return fmt.Errorf("error executing %s: %s", cmd, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package drainnode
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+	kubevirtcimocks "kubevirt.io/kubevirtci/cluster-provision/gocli/utils/mock"
+)
+
+func TestDrainNodeOpt(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "DrainNodeOpt Suite")
+}
+
+var _ = Describe("DrainNodeOpt", func() {
+	var (
+		sshClient *kubevirtcimocks.MockSSHClient
+		opt       *drainNodeOpt
+	)
+
+	BeforeEach(func() {
+		sshClient = kubevirtcimocks.NewMockSSHClient(gomock.NewController(GinkgoT()))
+		opt = NewDrainNodeOpt(sshClient, "node03")
+		AddExpectCalls(sshClient, "node03")
+	})
+
+	It("should execute DrainNodeOpt successfully", func() {
+		err := opt.Exec()
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
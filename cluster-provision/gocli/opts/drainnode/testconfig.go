@@ -0,0 +1,8 @@
+package drainnode
+
+import kubevirtcimocks "kubevirt.io/kubevirtci/cluster-provision/gocli/utils/mock"
+
+func AddExpectCalls(sshClient *kubevirtcimocks.MockSSHClient, nodeName string) {
+	sshClient.EXPECT().Command("kubectl --kubeconfig=/etc/kubernetes/admin.conf drain " + nodeName + " --ignore-daemonsets --delete-emptydir-data --force --timeout=300s")
+	sshClient.EXPECT().Command("kubectl --kubeconfig=/etc/kubernetes/admin.conf delete node " + nodeName)
+}
@@ -0,0 +1,149 @@
+package opts
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"golang.org/x/sync/errgroup"
+)
+
+// Descriptor declares how an opt relates to the other opts enabled for a cluster
+type Descriptor struct {
+	Name string
+	// DependsOn lists opts which have to be enabled as well, they run before this opt
+	DependsOn []string
+	// After lists opts which run before this opt if they are enabled
+	After []string
+	// Conflicts lists opts which can't be enabled together with this opt
+	Conflicts []string
+	// K8sVersions is a semver constraint on the K8s version, e.g. "1.30.x". Any version is supported if it is empty
+	K8sVersions string
+}
+
+// Graph holds enabled opts ordered by their dependencies
+type Graph struct {
+	levels [][]Descriptor
+}
+
+// NewGraph checks that the enabled opts can be combined on the given K8s version and orders them.
+// A nil version fails for every opt with a version constraint
+func NewGraph(enabled []Descriptor, k8sVersion *semver.Version) (*Graph, error) {
+	byName := map[string]Descriptor{}
+	for _, d := range enabled {
+		if _, ok := byName[d.Name]; ok {
+			return nil, fmt.Errorf("opt %s is registered twice", d.Name)
+		}
+		byName[d.Name] = d
+	}
+
+	errs := []string{}
+	for _, d := range enabled {
+		for _, dep := range d.DependsOn {
+			if _, ok := byName[dep]; !ok {
+				errs = append(errs, fmt.Sprintf("%s requires %s to be enabled", d.Name, dep))
+			}
+		}
+		for _, c := range d.Conflicts {
+			if _, ok := byName[c]; ok {
+				errs = append(errs, fmt.Sprintf("%s can't be enabled together with %s", d.Name, c))
+			}
+		}
+		if d.K8sVersions == "" {
+			continue
+		}
+		constraint, err := semver.NewConstraint(d.K8sVersions)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s has an invalid K8s version constraint %q: %v", d.Name, d.K8sVersions, err))
+		} else if k8sVersion == nil {
+			errs = append(errs, fmt.Sprintf("%s requires K8s %s but the K8s version of the cluster is unknown", d.Name, d.K8sVersions))
+		} else if !constraint.Check(k8sVersion) {
+			errs = append(errs, fmt.Sprintf("%s requires K8s %s but the cluster runs %s", d.Name, d.K8sVersions, k8sVersion))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid opt combination: %s", strings.Join(errs, ", "))
+	}
+
+	levels, err := sortTopologically(enabled, byName)
+	if err != nil {
+		return nil, err
+	}
+	return &Graph{levels: levels}, nil
+}
+
+// sortTopologically groups the opts into levels, every opt only runs after the opts of the previous
+// levels. Opts of the same level are independent and keep the order they were enabled in
+func sortTopologically(enabled []Descriptor, byName map[string]Descriptor) ([][]Descriptor, error) {
+	done := map[string]bool{}
+	remaining := enabled
+	levels := [][]Descriptor{}
+
+	for len(remaining) > 0 {
+		level := []Descriptor{}
+		blocked := []Descriptor{}
+		for _, d := range remaining {
+			if ready(d, byName, done) {
+				level = append(level, d)
+			} else {
+				blocked = append(blocked, d)
+			}
+		}
+		if len(level) == 0 {
+			names := []string{}
+			for _, d := range blocked {
+				names = append(names, d.Name)
+			}
+			return nil, fmt.Errorf("opts %s depend on each other in a cycle", strings.Join(names, ", "))
+		}
+		for _, d := range level {
+			done[d.Name] = true
+		}
+		levels = append(levels, level)
+		remaining = blocked
+	}
+	return levels, nil
+}
+
+func ready(d Descriptor, byName map[string]Descriptor, done map[string]bool) bool {
+	for _, pre := range append(append([]string{}, d.DependsOn...), d.After...) {
+		if _, enabled := byName[pre]; enabled && !done[pre] {
+			return false
+		}
+	}
+	return true
+}
+
+// Levels returns the names of the opts grouped by the level they run in
+func (g *Graph) Levels() [][]string {
+	levels := [][]string{}
+	for _, level := range g.levels {
+		names := []string{}
+		for _, d := range level {
+			names = append(names, d.Name)
+		}
+		levels = append(levels, names)
+	}
+	return levels
+}
+
+// Run executes the opts level by level, the opts of a level concurrently. It stops after the
+// first level with a failed opt
+func (g *Graph) Run(newOpt func(d Descriptor) Opt) error {
+	for _, level := range g.levels {
+		var eg errgroup.Group
+		for _, d := range level {
+			o := newOpt(d)
+			eg.Go(func() error {
+				if err := o.Exec(); err != nil {
+					return fmt.Errorf("%s failed: %w", d.Name, err)
+				}
+				return nil
+			})
+		}
+		if err := eg.Wait(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package opts
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/Masterminds/semver/v3"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestGraph(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Opt Graph Suite")
+}
+
+type funcOpt func() error
+
+func (f funcOpt) Exec() error {
+	return f()
+}
+
+var _ = Describe("Graph", func() {
+	version := semver.MustParse("1.30")
+
+	It("should order opts by their dependencies", func() {
+		g, err := NewGraph([]Descriptor{
+			{Name: "istio", After: []string{"cnao"}},
+			{Name: "cnao", After: []string{"multus"}},
+			{Name: "prometheus"},
+			{Name: "multus"},
+			{Name: "nfscsi", After: []string{"rookceph"}},
+		}, version)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(g.Levels()).To(Equal([][]string{
+			{"prometheus", "multus", "nfscsi"},
+			{"cnao"},
+			{"istio"},
+		}))
+	})
+
+	DescribeTable("should reject impossible combinations",
+		func(enabled []Descriptor, k8sVersion *semver.Version, message string) {
+			_, err := NewGraph(enabled, k8sVersion)
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("missing dependency", []Descriptor{{Name: "aaq", DependsOn: []string{"cdi"}}}, version, "aaq requires cdi to be enabled"),
+		Entry("conflict", []Descriptor{{Name: "a", Conflicts: []string{"b"}}, {Name: "b"}}, version, "a can't be enabled together with b"),
+		Entry("unsupported version", []Descriptor{{Name: "aaq", K8sVersions: "1.30.x"}}, semver.MustParse("1.31"), "aaq requires K8s 1.30.x but the cluster runs 1.31.0"),
+		Entry("unknown version", []Descriptor{{Name: "aaq", K8sVersions: "1.30.x"}}, nil, "the K8s version of the cluster is unknown"),
+		Entry("cycle", []Descriptor{{Name: "a", After: []string{"b"}}, {Name: "b", DependsOn: []string{"a"}}}, version, "opts a, b depend on each other in a cycle"),
+	)
+
+	It("should run the opts of a level concurrently", func() {
+		g, err := NewGraph([]Descriptor{{Name: "a"}, {Name: "b"}, {Name: "c", After: []string{"a", "b"}}}, version)
+		Expect(err).NotTo(HaveOccurred())
+
+		var mu sync.Mutex
+		order := []string{}
+		started := make(chan struct{}, 2)
+		err = g.Run(func(d Descriptor) Opt {
+			return funcOpt(func() error {
+				if d.Name != "c" {
+					started <- struct{}{}
+					// both opts of the first level have to run at the same time to get past here
+					Eventually(started).Should(HaveLen(2))
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				order = append(order, d.Name)
+				return nil
+			})
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(order).To(HaveLen(3))
+		Expect(order[2]).To(Equal("c"))
+	})
+
+	It("should stop after a failed level", func() {
+		g, err := NewGraph([]Descriptor{{Name: "a"}, {Name: "b", After: []string{"a"}}}, version)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = g.Run(func(d Descriptor) Opt {
+			return funcOpt(func() error {
+				if d.Name == "b" {
+					Fail("b should not run")
+				}
+				return fmt.Errorf("boom")
+			})
+		})
+		Expect(err).To(MatchError("a failed: boom"))
+	})
+})
@@ -0,0 +1,85 @@
+package opts
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/distribution/reference"
+)
+
+//go:embed */manifests
+var manifests embed.FS
+
+// imageLine matches the lines referencing an image like k8s/fetch-images.sh does when it lists the images
+// the provider images pre-pull
+var imageLine = regexp.MustCompile(`(?i)(?:image|value): "?((?:[a-z0-9_.]+[/-]?)+(?:@sha256)?:[a-z0-9_.\-]+)"?$`)
+
+// Images returns the images referenced by the embedded manifests, keyed by the opt deploying them.
+// The names are normalized like the container runtimes do, references to services of the cluster are left out
+func Images() (map[string][]string, error) {
+	images := map[string][]string{}
+	err := fs.WalkDir(manifests, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || (path.Ext(p) != ".yaml" && path.Ext(p) != ".yml") {
+			return err
+		}
+		f, err := manifests.Open(p)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+
+		opt, _, _ := strings.Cut(p, "/")
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(nil, 1024*1024)
+		for scanner.Scan() {
+			match := imageLine.FindStringSubmatch(strings.TrimRight(scanner.Text(), " \t\r"))
+			if match == nil || strings.Contains(match[1], ".svc:") {
+				continue
+			}
+			named, err := reference.ParseNormalizedNamed(match[1])
+			if err != nil {
+				continue
+			}
+			if !slices.Contains(images[opt], named.String()) {
+				images[opt] = append(images[opt], named.String())
+			}
+		}
+		return scanner.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, refs := range images {
+		slices.Sort(refs)
+	}
+	return images, nil
+}
+
+// ReplaceImages returns the manifest with the images which have a replacement in images replaced, the keys are
+// normalized like the names Images returns
+func ReplaceImages(manifest []byte, images map[string]string) []byte {
+	if len(images) == 0 {
+		return manifest
+	}
+	lines := bytes.Split(manifest, []byte("\n"))
+	for i, line := range lines {
+		match := imageLine.FindSubmatchIndex(bytes.TrimRight(line, " \t\r"))
+		if match == nil {
+			continue
+		}
+		named, err := reference.ParseNormalizedNamed(string(line[match[2]:match[3]]))
+		if err != nil {
+			continue
+		}
+		if replacement, ok := images[named.String()]; ok {
+			lines[i] = slices.Concat(line[:match[2]], []byte(replacement), line[match[3]:])
+		}
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
@@ -0,0 +1,49 @@
+package opts
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Images", func() {
+	It("should list the images of the embedded manifests per opt", func() {
+		images, err := Images()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(images["cdi"]).To(ContainElement("quay.io/kubevirt/cdi-operator:v1.65.0"))
+		// quoted images and images without registry
+		Expect(images["rookceph"]).To(ContainElement("quay.io/cephcsi/cephcsi:v3.13.0"))
+		Expect(images["prometheus"]).To(ContainElement("docker.io/grafana/grafana:11.1.0"))
+		Expect(images["cnao"]).To(ContainElement(HavePrefix("ghcr.io/k8snetworkplumbingwg/multus-cni@sha256:")))
+		Expect(images).NotTo(HaveKey("psa"))
+		for opt, refs := range images {
+			for _, ref := range refs {
+				Expect(ref).NotTo(ContainSubstring(".svc:"), opt)
+			}
+		}
+	})
+
+	It("should replace the images which have a replacement", func() {
+		manifest := []byte(`containers:
+- image: "quay.io/kubevirt/bridge-marker@sha256:bf269af61e618857e7b14439cfc003aac2d65db9ee633147a73f5d9648dab377"
+  env:
+  - name: KUBE_RBAC_PROXY_IMAGE
+    value: quay.io/brancz/kube-rbac-proxy@sha256:e6a323504999b2a4d2a6bf94f8580a050378eba0900fd31335cf9df5787d9a9b
+  - name: OTHER_IMAGE
+    value: grafana/grafana:11.1.0
+`)
+		replaced := ReplaceImages(manifest, map[string]string{
+			"quay.io/kubevirt/bridge-marker@sha256:bf269af61e618857e7b14439cfc003aac2d65db9ee633147a73f5d9648dab377": "quay.io/kubevirt/bridge-marker:sha256-bf269af61e618857e7b14439cfc003aac2d65db9ee633147a73f5d9648dab377",
+			"quay.io/brancz/kube-rbac-proxy@sha256:e6a323504999b2a4d2a6bf94f8580a050378eba0900fd31335cf9df5787d9a9b": "quay.io/brancz/kube-rbac-proxy:sha256-e6a323504999b2a4d2a6bf94f8580a050378eba0900fd31335cf9df5787d9a9b",
+			"docker.io/grafana/grafana:11.1.0": "registry:5000/grafana/grafana:11.1.0",
+		})
+		Expect(string(replaced)).To(Equal(`containers:
+- image: "quay.io/kubevirt/bridge-marker:sha256-bf269af61e618857e7b14439cfc003aac2d65db9ee633147a73f5d9648dab377"
+  env:
+  - name: KUBE_RBAC_PROXY_IMAGE
+    value: quay.io/brancz/kube-rbac-proxy:sha256-e6a323504999b2a4d2a6bf94f8580a050378eba0900fd31335cf9df5787d9a9b
+  - name: OTHER_IMAGE
+    value: registry:5000/grafana/grafana:11.1.0
+`))
+		Expect(ReplaceImages(manifest, nil)).To(Equal(manifest))
+	})
+})
@@ -5,12 +5,13 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/cenkalti/backoff/v4"
 	"github.com/sirupsen/logrus"
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/retry"
 	k8s "kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/k8s"
 	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/libssh"
 )
@@ -26,6 +27,21 @@ var istioNoCnao []byte
 
 const istioVersion = "1.30.2"
 
+// hub is the registry path the manifests pull the istio images from
+const hub = "quay.io/kubevirtci"
+
+// Images returns the images istioctl deploys with the demo profile of the manifests, they are not
+// referenced by the manifests themselves
+func Images() []string {
+	return []string{
+		fmt.Sprintf("%s/install-cni:%s", hub, istioVersion),
+		fmt.Sprintf("%s/pilot:%s", hub, istioVersion),
+		fmt.Sprintf("%s/proxyv2:%s", hub, istioVersion),
+	}
+}
+
+var cniDaemonSetGVK = schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "DaemonSet"}
+
 type istioOpt struct {
 	cnaoEnabled bool
 	client      k8s.K8sDynamicClient
@@ -66,51 +82,51 @@ func (o *istioOpt) Exec() error {
 		}
 	}
 
+	// istioctl install waits for the CNI pods, which only start once the CNI DaemonSet it creates is privileged
+	patched := make(chan error, 1)
 	go func() {
-		operation := func() error {
-			obj, err := o.client.Get(schema.GroupVersionKind{Group: "apps",
-				Version: "v1",
-				Kind:    "DaemonSet"}, "istio-cni-node", "kube-system")
-			if err != nil {
-				fmt.Printf("Error getting the CNI DaemonSet: %s\n", err.Error())
-				return err
-			}
-
-			cniDaemonSet := &appsv1.DaemonSet{}
-			err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, cniDaemonSet)
-			if err != nil {
-				fmt.Printf("Error converting the CNI DaemonSet: %s\n", err.Error())
-				return err
-			}
-
-			privileged := true
-			cniDaemonSet.Spec.Template.Spec.Containers[0].SecurityContext.Privileged = &privileged
-			newCniDaemonSet, err := runtime.DefaultUnstructuredConverter.ToUnstructured(cniDaemonSet)
-			if err != nil {
-				fmt.Printf("Error converting the CNI DaemonSet: %s\n", err.Error())
-				return err
-			}
-
-			err = o.client.Update(&unstructured.Unstructured{Object: newCniDaemonSet})
-			if err != nil {
-				fmt.Printf("Error patching the CNI DaemonSet: %s\n", err.Error())
-				return err
-			}
-			return nil
-		}
-
-		backoffStrategy := backoff.NewExponentialBackOff()
-		backoffStrategy.InitialInterval = 10 * time.Second
-		backoffStrategy.MaxElapsedTime = 3 * time.Minute
-
-		_ = backoff.Retry(operation, backoffStrategy)
+		patched <- makePrivileged(o.client)
 	}()
 
 	istioInstallCmd := "PATH=/opt/istio-" + istioVersion + "/bin:$PATH istioctl --kubeconfig /etc/kubernetes/admin.conf install -y -f " + istioFile
 	if err := o.sshClient.Command(istioInstallCmd); err != nil {
 		return err
 	}
+	if err := <-patched; err != nil {
+		return fmt.Errorf("failed making the istio CNI privileged: %w", err)
+	}
 
 	logrus.Info("Istio operator is now ready!")
 	return nil
 }
+
+// makePrivileged waits for the CNI DaemonSet istioctl creates and updates it to run privileged, updates
+// conflicting with the ones of istioctl are retried
+func makePrivileged(c k8s.K8sDynamicClient) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj, err := k8s.WaitForObject(c, cniDaemonSetGVK, "istio-cni-node", "kube-system", 3*time.Minute)
+		if err != nil {
+			return err
+		}
+		cniDaemonSet := &appsv1.DaemonSet{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, cniDaemonSet); err != nil {
+			return err
+		}
+		if len(cniDaemonSet.Spec.Template.Spec.Containers) == 0 {
+			return fmt.Errorf("the CNI DaemonSet has no containers")
+		}
+
+		container := &cniDaemonSet.Spec.Template.Spec.Containers[0]
+		if container.SecurityContext == nil {
+			container.SecurityContext = &corev1.SecurityContext{}
+		}
+		privileged := true
+		container.SecurityContext.Privileged = &privileged
+
+		newCniDaemonSet, err := runtime.DefaultUnstructuredConverter.ToUnstructured(cniDaemonSet)
+		if err != nil {
+			return err
+		}
+		return c.Update(&unstructured.Unstructured{Object: newCniDaemonSet})
+	})
+}
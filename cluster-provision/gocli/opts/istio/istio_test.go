@@ -6,6 +6,7 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"go.uber.org/mock/gomock"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	k8s "kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/k8s"
 	kubevirtcimocks "kubevirt.io/kubevirtci/cluster-provision/gocli/utils/mock"
 )
@@ -28,7 +29,7 @@ var _ = Describe("IstioOpt", func() {
 		sshClient = kubevirtcimocks.NewMockSSHClient(mockCtrl)
 		k8sclient = k8s.NewTestClient()
 		opt = NewIstioOpt(sshClient, k8sclient, false)
-		AddExpectCalls(sshClient)
+		Expect(AddExpectCalls(sshClient, k8sclient)).To(Succeed())
 	})
 
 	AfterEach(func() {
@@ -38,5 +39,11 @@ var _ = Describe("IstioOpt", func() {
 	It("should execute IstioOpt successfully", func() {
 		err := opt.Exec()
 		Expect(err).NotTo(HaveOccurred())
+
+		obj, err := k8sclient.Get(cniDaemonSetGVK, "istio-cni-node", "kube-system")
+		Expect(err).NotTo(HaveOccurred())
+		containers, _, err := unstructured.NestedSlice(obj.Object, "spec", "template", "spec", "containers")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(containers[0]).To(HaveKeyWithValue("securityContext", HaveKeyWithValue("privileged", true)))
 	})
 })
@@ -4,6 +4,7 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	k8stesting "k8s.io/client-go/testing"
+	k8s "kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/k8s"
 	kubevirtcimocks "kubevirt.io/kubevirtci/cluster-provision/gocli/utils/mock"
 )
 
@@ -19,7 +20,36 @@ var IstioReactor = func(action k8stesting.Action) (bool, runtime.Object, error)
 	return false, obj, nil
 }
 
-func AddExpectCalls(sshClient *kubevirtcimocks.MockSSHClient) {
+// cniDaemonSet stands in for the DaemonSet istioctl creates on a real cluster
+const cniDaemonSet = `apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: istio-cni-node
+  namespace: kube-system
+spec:
+  selector:
+    matchLabels:
+      k8s-app: istio-cni-node
+  template:
+    metadata:
+      labels:
+        k8s-app: istio-cni-node
+    spec:
+      containers:
+      - name: install-cni
+        image: istio/install-cni
+`
+
+// AddExpectCalls expects the istioctl install and creates the CNI DaemonSet it would create
+func AddExpectCalls(sshClient *kubevirtcimocks.MockSSHClient, k8sClient k8s.K8sDynamicClient) error {
+	obj, err := k8s.SerializeIntoObject([]byte(cniDaemonSet))
+	if err != nil {
+		return err
+	}
+	if err := k8sClient.Apply(obj); err != nil {
+		return err
+	}
+
 	cmds := []string{
 		"source /var/lib/kubevirtci/shared_vars.sh",
 		`echo '` + string(istioWithCnao) + `' |  tee /opt/istio-operator-with-cnao.yaml > /dev/null`,
@@ -30,4 +60,5 @@ func AddExpectCalls(sshClient *kubevirtcimocks.MockSSHClient) {
 	for _, cmd := range cmds {
 		sshClient.EXPECT().Command(cmd)
 	}
+	return nil
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	_ "embed"
 	"fmt"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	k8s "kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/k8s"
@@ -41,8 +42,5 @@ func (o *multusOpt) Exec() error {
 			return fmt.Errorf("error applying manifest %s", err)
 		}
 	}
-	if err := o.sshClient.Command("kubectl --kubeconfig=/etc/kubernetes/admin.conf rollout status -n kube-system ds/kube-multus-ds --timeout=200s"); err != nil {
-		return err
-	}
-	return nil
+	return k8s.WaitForDaemonSet(o.client, "kube-multus-ds", "kube-system", 200*time.Second)
 }
@@ -26,10 +26,8 @@ var _ = Describe("MultusOpt", func() {
 	BeforeEach(func() {
 		mockCtrl = gomock.NewController(GinkgoT())
 		sshClient = kubevirtcimocks.NewMockSSHClient(mockCtrl)
-		k8sClient = k8s.NewTestClient()
+		k8sClient = k8s.NewTestClient(k8s.NewReactorConfig("create", "daemonsets", k8s.RolloutReactor))
 		opt = NewMultusOpt(k8sClient, sshClient)
-
-		sshClient.EXPECT().Command("kubectl --kubeconfig=/etc/kubernetes/admin.conf rollout status -n kube-system ds/kube-multus-ds --timeout=200s")
 	})
 
 	AfterEach(func() {
@@ -2,6 +2,7 @@ package network_resources_injector
 
 import (
 	_ "embed"
+	"time"
 
 	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/common"
 	k8s "kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/k8s"
@@ -46,5 +47,5 @@ func (o *networkResourcesInjectorOpt) Exec() error {
 		return err
 	}
 
-	return o.sshClient.Command("kubectl --kubeconfig=/etc/kubernetes/admin.conf rollout status -n kube-system deploy/network-resources-injector --timeout=200s")
+	return k8s.WaitForDeployment(o.client, "network-resources-injector", "kube-system", 200*time.Second)
 }
@@ -26,9 +26,8 @@ var _ = Describe("Network Resources Injector", func() {
 	BeforeEach(func() {
 		mockCtrl = gomock.NewController(GinkgoT())
 		sshClient = kubevirtcimocks.NewMockSSHClient(mockCtrl)
-		k8sClient = k8s.NewTestClient()
+		k8sClient = k8s.NewTestClient(k8s.NewReactorConfig("create", "deployments", k8s.RolloutReactor))
 		opt = NewNetworkResourcesInjectorOpt(sshClient, k8sClient)
-		sshClient.EXPECT().Command("kubectl --kubeconfig=/etc/kubernetes/admin.conf rollout status -n kube-system deploy/network-resources-injector --timeout=200s")
 	})
 
 	AfterEach(func() {
@@ -8,10 +8,7 @@ import (
 	"path/filepath"
 	"time"
 
-	"github.com/cenkalti/backoff/v4"
 	"github.com/sirupsen/logrus"
-	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	k8s "kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/k8s"
 )
@@ -62,42 +59,8 @@ func (o *nfsCsiOpt) Exec() error {
 		return err
 	}
 
-	pvc := &corev1.PersistentVolumeClaim{}
-
-	operation := func() error {
-		obj, err := o.client.Get(schema.GroupVersionKind{
-			Group:   "",
-			Version: "v1",
-			Kind:    "PersistentVolumeClaim",
-		}, "pvc-nfs-dynamic", "nfs-csi")
-
-		if err != nil {
-			logrus.Errorf("Attempt failed, PVC is still not bound: %v", err)
-			return err
-		}
-
-		err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, pvc)
-		if err != nil {
-			logrus.Errorf("Attempt failed, PVC is still not bound: %v", err)
-			return err
-		}
-
-		if pvc.Status.Phase != "Bound" {
-			err := fmt.Errorf("PVC didn't move to Bound phase")
-			logrus.Info(err)
-			return err
-		}
-
-		return nil
-	}
-
-	backoffStrategy := backoff.NewExponentialBackOff()
-	backoffStrategy.InitialInterval = 10 * time.Second
-	backoffStrategy.MaxElapsedTime = 5 * time.Minute
-
-	err = backoff.Retry(operation, backoffStrategy)
-	if err != nil {
-		return fmt.Errorf("waiting on PVC to become bound failed after maximum retries: %v", err)
+	if err := k8s.WaitForPVCBound(o.client, "pvc-nfs-dynamic", "nfs-csi", 5*time.Minute); err != nil {
+		return err
 	}
 
 	err = o.client.Delete(schema.GroupVersionKind{
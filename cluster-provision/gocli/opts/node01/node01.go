@@ -52,6 +52,9 @@ func (n *node01Provisioner) Exec() error {
 		}
 	}
 
+	// images provisioned before the API server certificate covered the port published on localhost lack the SANs
+	certSANsCmd := `grep -q certSANs ` + kubeadmConf + ` || sed -i 's/^apiServer:$/apiServer:\n  certSANs:\n  - 127.0.0.1\n  - localhost/' ` + kubeadmConf
+
 	kubeadmInitCmd := "kubeadm init --config " + kubeadmConf + " -v5"
 	if n.etcdNoFsync {
 		kubeadmInitCmd = fmt.Sprintf("sed -i 's/#etcdExtraArgs/extraArgs: \\{unsafe-no-fsync: \\\"True\\\"}/' %s && %s", kubeadmConf, kubeadmInitCmd)
@@ -70,6 +73,7 @@ func (n *node01Provisioner) Exec() error {
 	cmds = append(cmds,
 		"until ip address show dev eth0 | grep global | grep inet6; do sleep 1; done",
 		`timeout=60; interval=5; while ! systemctl status crio | grep -w "active"; do echo "Waiting for cri-o service to be ready"; sleep $interval; timeout=$((timeout - interval)); if [[ $timeout -le 0 ]]; then exit 1; fi; done`,
+		certSANsCmd,
 		kubeadmInitCmd,
 		`kubectl --kubeconfig=/etc/kubernetes/admin.conf patch deployment coredns -n kube-system -p "$(cat /provision/kubeadm-patches/add-security-context-deployment-patch.yaml)"`,
 		`kubectl --kubeconfig=/etc/kubernetes/admin.conf create -f `+cniManifest,
@@ -14,6 +14,7 @@ func AddExpectCalls(sshClient *kubevirtcimocks.MockSSHClient) {
 		"swapoff -a",
 		"until ip address show dev eth0 | grep global | grep inet6; do sleep 1; done",
 		`timeout=60; interval=5; while ! systemctl status crio | grep -w "active"; do echo "Waiting for cri-o service to be ready"; sleep $interval; timeout=$((timeout - interval)); if [[ $timeout -le 0 ]]; then exit 1; fi; done`,
+		`grep -q certSANs /etc/kubernetes/kubeadm.conf || sed -i 's/^apiServer:$/apiServer:\n  certSANs:\n  - 127.0.0.1\n  - localhost/' /etc/kubernetes/kubeadm.conf`,
 		`kubeadm init --config /etc/kubernetes/kubeadm.conf -v5`,
 		`kubectl --kubeconfig=/etc/kubernetes/admin.conf patch deployment coredns -n kube-system -p "$(cat /provision/kubeadm-patches/add-security-context-deployment-patch.yaml)"`,
 		`kubectl --kubeconfig=/etc/kubernetes/admin.conf create -f /provision/cni.yaml`,
@@ -10,11 +10,14 @@ import (
 	"github.com/Masterminds/semver/v3"
 	"github.com/sirupsen/logrus"
 
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/ipam"
 	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/libssh"
 )
 
 const (
 	kubevirtProviderEnv = "KUBEVIRT_PROVIDER"
+	// DefaultJoinToken is the bootstrap token the kubeadm config of node01 creates, it expires 24h after kubeadm init
+	DefaultJoinToken = "abcdef.1234567890123456"
 )
 
 var (
@@ -32,9 +35,14 @@ type nodesProvisioner struct {
 	secondaryNicBridges   bool
 	topologyManagerPolicy string
 	reservedSystemCPUs    string
+	joinToken             string
 }
 
-func NewNodesProvisioner(k8sVersion string, sc libssh.Client, singleStack, secondaryNicBridges bool, topologyManagerPolicy, reservedSystemCPUs string) *nodesProvisioner {
+// NewNodesProvisioner returns the opt joining a worker to the cluster, the default token is used if joinToken is empty
+func NewNodesProvisioner(k8sVersion string, sc libssh.Client, singleStack, secondaryNicBridges bool, topologyManagerPolicy, reservedSystemCPUs, joinToken string) *nodesProvisioner {
+	if joinToken == "" {
+		joinToken = DefaultJoinToken
+	}
 	submatches := versionRegex.FindStringSubmatch(k8sVersion)
 	if len(submatches) != 2 {
 		logrus.Infof("not a parseable semver contained in %q. Trying the %q environment variable", k8sVersion, kubevirtProviderEnv)
@@ -59,17 +67,18 @@ func NewNodesProvisioner(k8sVersion string, sc libssh.Client, singleStack, secon
 		secondaryNicBridges:   secondaryNicBridges,
 		topologyManagerPolicy: topologyManagerPolicy,
 		reservedSystemCPUs:    reservedSystemCPUs,
+		joinToken:             joinToken,
 	}
 }
 
 func (n *nodesProvisioner) Exec() error {
 	var (
 		nodeIP         = ""
-		controlPlaneIP = "192.168.66.101"
+		controlPlaneIP = ipam.ControlPlane().IPv4.String()
 	)
 
 	if n.singleStack {
-		controlPlaneIP = "[fd00::101]"
+		controlPlaneIP = "[" + ipam.ControlPlane().IPv6.String() + "]"
 		nodeIP = "--node-ip=::"
 	}
 
@@ -102,7 +111,7 @@ func (n *nodesProvisioner) Exec() error {
 	cmds = append(cmds,
 		"until ip address show dev eth0 | grep global | grep inet6; do sleep 1; done",
 		`timeout=60; interval=5; while ! systemctl status crio | grep -w "active"; do echo "Waiting for cri-o service to be ready"; sleep $interval; timeout=$((timeout - interval)); if [[ $timeout -le 0 ]]; then exit 1; fi; done`,
-		"kubeadm join --token abcdef.1234567890123456 "+controlPlaneIP+":6443 --ignore-preflight-errors=all --discovery-token-unsafe-skip-ca-verification=true",
+		"kubeadm join --token "+n.joinToken+" "+controlPlaneIP+":6443 --ignore-preflight-errors=all --discovery-token-unsafe-skip-ca-verification=true",
 		"mkdir -p /var/lib/rook",
 		"chcon -t container_file_t /var/lib/rook",
 	)
@@ -8,10 +8,7 @@ import (
 	"path/filepath"
 	"time"
 
-	"github.com/cenkalti/backoff/v4"
-	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
 	"github.com/sirupsen/logrus"
-	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	k8s "kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/k8s"
 	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/libssh"
@@ -64,51 +61,9 @@ func (o *cephOpt) Exec() error {
 		return err
 	}
 
-	blockpool := &cephv1.CephBlockPool{}
-
-	operation := func() error {
-		obj, err := o.client.Get(schema.GroupVersionKind{
-			Group:   "ceph.rook.io",
-			Version: "v1",
-			Kind:    "CephBlockPool",
-		}, "replicapool", "rook-ceph")
-
-		if err != nil {
-			logrus.Errorf("Attempt failed: %v", err)
-			return err
-		}
-
-		err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, blockpool)
-		if err != nil {
-			logrus.Errorf("Attempt failed: %v", err)
-			return err
-		}
-
-		if blockpool.Status == nil {
-			err := fmt.Errorf("ceph block pool: no status yet")
-			logrus.Info(err)
-			return err
-		}
-
-		if blockpool.Status.Phase != "Ready" {
-			err := fmt.Errorf("ceph block pool phase=%q: CephBlockPool=%+v", blockpool.Status.Phase, blockpool)
-			logrus.Info(err)
-			return err
-		}
-
-		logrus.Infof("ceph block pool phase=%q: CephBlockPool=%+v", blockpool.Status.Phase, blockpool)
-
-		return nil
-	}
-
-	maxElapsedTime := 10 * time.Minute
-	err = backoff.Retry(operation, backoff.NewExponentialBackOff(
-		backoff.WithInitialInterval(45*time.Second),
-		backoff.WithMaxInterval(90*time.Second),
-		backoff.WithMaxElapsedTime(maxElapsedTime),
-	))
-	if err != nil {
-		return fmt.Errorf("operation timed out after %s: %w", maxElapsedTime, err)
+	blockPoolGVK := schema.GroupVersionKind{Group: "ceph.rook.io", Version: "v1", Kind: "CephBlockPool"}
+	if err := k8s.WaitForPhase(o.client, blockPoolGVK, "replicapool", "rook-ceph", "Ready", 10*time.Minute); err != nil {
+		return err
 	}
 
 	cmds := []string{
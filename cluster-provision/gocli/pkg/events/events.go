@@ -0,0 +1,132 @@
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Type is the kind of a provisioning event
+type Type string
+
+const (
+	PhaseStart Type = "phase_start"
+	PhaseEnd   Type = "phase_end"
+	OptStart   Type = "opt_start"
+	OptEnd     Type = "opt_end"
+	Command    Type = "command"
+)
+
+// Status is the outcome of a finished phase, opt or command
+type Status string
+
+const (
+	Succeeded Status = "succeeded"
+	Failed    Status = "failed"
+)
+
+// Event is a single machine readable provisioning event
+type Event struct {
+	Time     time.Time `json:"time"`
+	Type     Type      `json:"type"`
+	Phase    string    `json:"phase,omitempty"`
+	Node     int       `json:"node,omitempty"`
+	Opt      string    `json:"opt,omitempty"`
+	Command  string    `json:"command,omitempty"`
+	Duration float64   `json:"durationSeconds,omitempty"`
+	Status   Status    `json:"status,omitempty"`
+	// ExitStatus is set for commands which ran but exited with a non zero status
+	ExitStatus *int   `json:"exitStatus,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Emitter receives the events of a provisioning run, implementations have to be safe for concurrent use
+type Emitter interface {
+	Emit(e Event)
+}
+
+type discardEmitter struct{}
+
+func (discardEmitter) Emit(Event) {}
+
+// Discard returns an emitter which drops all events
+func Discard() Emitter {
+	return discardEmitter{}
+}
+
+type jsonEmitter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONEmitter writes every event as a single line of JSON
+func NewJSONEmitter(w io.Writer) Emitter {
+	return &jsonEmitter{enc: json.NewEncoder(w)}
+}
+
+func (j *jsonEmitter) Emit(e Event) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_ = j.enc.Encode(e)
+}
+
+// Recorder keeps the events in memory
+type Recorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+// NewRecorder returns an emitter which keeps all events
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+func (r *Recorder) Emit(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+// Events returns the events emitted so far
+func (r *Recorder) Events() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.events)
+}
+
+type multiEmitter []Emitter
+
+func (m multiEmitter) Emit(e Event) {
+	for _, emitter := range m {
+		emitter.Emit(e)
+	}
+}
+
+// Multi passes every event to all emitters
+func Multi(emitters ...Emitter) Emitter {
+	return multiEmitter(emitters)
+}
+
+// Phase emits the start and the end of fn as a phase of the given node, node 0 is the cluster itself
+func Phase(e Emitter, node int, phase string, fn func() error) error {
+	e.Emit(Event{Time: time.Now(), Type: PhaseStart, Phase: phase, Node: node})
+	start := time.Now()
+	err := fn()
+	end := Event{Type: PhaseEnd, Phase: phase, Node: node}
+	finish(&end, start, err)
+	e.Emit(end)
+	return err
+}
+
+// finish stamps a finished event with its duration and outcome
+func finish(e *Event, start time.Time, err error) {
+	e.Time = time.Now()
+	e.Duration = e.Time.Sub(start).Seconds()
+	e.Status = Succeeded
+	if err != nil {
+		e.Status = Failed
+		e.Error = err.Error()
+	}
+}
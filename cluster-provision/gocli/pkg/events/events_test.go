@@ -0,0 +1,82 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts/psa"
+	kubevirtcimocks "kubevirt.io/kubevirtci/cluster-provision/gocli/utils/mock"
+)
+
+func TestEvents(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Events Suite")
+}
+
+type recorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *recorder) Emit(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+var _ = Describe("Events", func() {
+	var rec *recorder
+
+	BeforeEach(func() {
+		rec = &recorder{}
+	})
+
+	It("should emit the start and the end of a phase", func() {
+		err := Phase(rec, 2, "boot", func() error { return errors.New("no ssh") })
+		Expect(err).To(MatchError("no ssh"))
+		Expect(rec.events).To(HaveLen(2))
+		Expect(rec.events[0].Type).To(Equal(PhaseStart))
+		Expect(rec.events[1]).To(And(
+			HaveField("Type", PhaseEnd),
+			HaveField("Node", 2),
+			HaveField("Phase", "boot"),
+			HaveField("Status", Failed),
+			HaveField("Error", "no ssh"),
+		))
+	})
+
+	It("should name wrapped opts after their package", func() {
+		sshClient := kubevirtcimocks.NewMockSSHClient(gomock.NewController(GinkgoT()))
+		psa.AddExpectCalls(sshClient)
+
+		opt := WrapOpt(rec, 1, psa.NewPsaOpt(WrapSSHClient(rec, 1, sshClient)))
+		Expect(opt.Exec()).To(Succeed())
+
+		Expect(rec.events).To(HaveLen(4))
+		Expect(rec.events[0]).To(And(HaveField("Type", OptStart), HaveField("Opt", "psa")))
+		Expect(rec.events[1]).To(And(HaveField("Type", Command), HaveField("Command", "rm /etc/kubernetes/psa.yaml"), HaveField("Status", Succeeded)))
+		Expect(rec.events[3]).To(And(HaveField("Type", OptEnd), HaveField("Opt", "psa"), HaveField("Status", Succeeded)))
+	})
+
+	It("should write one JSON object per line", func() {
+		out := &bytes.Buffer{}
+		e := NewJSONEmitter(out)
+		e.Emit(Event{Type: OptStart, Node: 1, Opt: "psa"})
+		e.Emit(Event{Type: OptEnd, Node: 1, Opt: "psa", Status: Succeeded})
+
+		lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+		Expect(lines).To(HaveLen(2))
+		decoded := map[string]interface{}{}
+		Expect(json.Unmarshal(lines[1], &decoded)).To(Succeed())
+		Expect(decoded).To(HaveKeyWithValue("type", "opt_end"))
+		Expect(decoded).To(HaveKeyWithValue("status", "succeeded"))
+		Expect(decoded).NotTo(HaveKey("error"))
+	})
+})
@@ -0,0 +1,52 @@
+package events
+
+import (
+	"path"
+	"reflect"
+	"time"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/opts"
+)
+
+// Named is implemented by opts which wrap other opts to report the name of the wrapped opt
+type Named interface {
+	Name() string
+}
+
+// OptName returns the name events report for an opt, which is the name of the package implementing it
+func OptName(o opts.Opt) string {
+	if n, ok := o.(Named); ok {
+		return n.Name()
+	}
+	t := reflect.TypeOf(o)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return path.Base(t.PkgPath())
+}
+
+type trackedOpt struct {
+	emitter Emitter
+	node    int
+	name    string
+	opt     opts.Opt
+}
+
+// WrapOpt emits the start and the end of every execution of the opt
+func WrapOpt(e Emitter, node int, o opts.Opt) opts.Opt {
+	return &trackedOpt{emitter: e, node: node, name: OptName(o), opt: o}
+}
+
+func (t *trackedOpt) Name() string {
+	return t.name
+}
+
+func (t *trackedOpt) Exec() error {
+	t.emitter.Emit(Event{Time: time.Now(), Type: OptStart, Node: t.node, Opt: t.name})
+	start := time.Now()
+	err := t.opt.Exec()
+	end := Event{Type: OptEnd, Node: t.node, Opt: t.name}
+	finish(&end, start, err)
+	t.emitter.Emit(end)
+	return err
+}
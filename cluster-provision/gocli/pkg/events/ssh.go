@@ -0,0 +1,73 @@
+package events
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/libssh"
+)
+
+type trackedSSHClient struct {
+	libssh.Client
+	emitter Emitter
+	node    int
+}
+
+// WrapSSHClient emits an event for every command run through the client
+func WrapSSHClient(e Emitter, node int, c libssh.Client) libssh.Client {
+	return &trackedSSHClient{Client: c, emitter: e, node: node}
+}
+
+func (t *trackedSSHClient) Command(cmd string) error {
+	start := time.Now()
+	err := t.Client.Command(cmd)
+	t.emitCommand(cmd, start, err)
+	return err
+}
+
+func (t *trackedSSHClient) CommandWithNoStdOut(cmd string) (string, error) {
+	start := time.Now()
+	out, err := t.Client.CommandWithNoStdOut(cmd)
+	t.emitCommand(cmd, start, err)
+	return out, err
+}
+
+func (t *trackedSSHClient) CopyRemoteFile(remotePathToCopy string, out io.Writer) error {
+	start := time.Now()
+	err := t.Client.CopyRemoteFile(remotePathToCopy, out)
+	t.emitCommand("copy "+remotePathToCopy, start, err)
+	return err
+}
+
+func (t *trackedSSHClient) SCP(destPath string, contents io.Reader) error {
+	start := time.Now()
+	err := t.Client.SCP(destPath, contents)
+	t.emitCommand("scp "+destPath, start, err)
+	return err
+}
+
+func (t *trackedSSHClient) emitCommand(cmd string, start time.Time, err error) {
+	emitCommand(t.emitter, t.node, cmd, start, err)
+}
+
+// TrackCommand emits the outcome of a command executed by fn
+func TrackCommand(e Emitter, node int, cmd string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	emitCommand(e, node, cmd, start, err)
+	return err
+}
+
+func emitCommand(emitter Emitter, node int, cmd string, start time.Time, err error) {
+	e := Event{Type: Command, Node: node, Command: cmd}
+	finish(&e, start, err)
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		exitStatus := exitErr.ExitStatus()
+		e.ExitStatus = &exitStatus
+	}
+	emitter.Emit(e)
+}
@@ -0,0 +1,115 @@
+package ipam
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+)
+
+const (
+	// firstNodeHost is the host part of the IPv4 address of node01, the following nodes count up from it
+	firstNodeHost = 101
+	macPrefix     = "52:55:00:d1"
+
+	// the fifth byte of the MACs tells their kind apart, the secondary NICs keep 0x56 they always had,
+	// the nodes from 100 on get the next free bytes
+	macNode          = 0x55
+	macSecondaryNIC  = 0x56
+	macSRIOV         = 0x57
+	macNodeFrom100   = 0x58
+	macSRIOVFrom100  = 0x59
+	maxSecondaryNICs = 256
+)
+
+var (
+	// Subnet4 is the IPv4 subnet of the cluster network, the dnsmasq container owns 192.168.66.2
+	Subnet4 = netip.MustParsePrefix("192.168.66.0/24")
+	// Subnet6 is the IPv6 subnet of the cluster network
+	Subnet6 = netip.MustParsePrefix("fd00::/64")
+
+	// MaxNodes is the number of nodes the IPv4 subnet has addresses for, the broadcast address is left out
+	MaxNodes = 1<<(32-Subnet4.Bits()) - 1 - firstNodeHost
+)
+
+// Node holds the addresses of a node on the cluster network
+type Node struct {
+	Index    int
+	Hostname string
+	IPv4     netip.Addr
+	IPv6     netip.Addr
+	MAC      net.HardwareAddr
+	// SRIOVMAC is the MAC of the emulated SR-IOV capable NIC
+	SRIOVMAC net.HardwareAddr
+}
+
+// NodeAddresses returns the addresses of the node with the given index, node01 has index 1.
+// The addresses of the first 99 nodes match the ones the cluster images assigned before:
+// node NN gets 192.168.66.1NN, fd00::1NN, 52:55:00:d1:55:NN and 52:55:00:d1:57:NN for SR-IOV. Node 1NN gets
+// 52:55:00:d1:58:NN and 52:55:00:d1:59:NN
+func NodeAddresses(nodeIdx int) (Node, error) {
+	if nodeIdx < 1 || nodeIdx > MaxNodes {
+		return Node{}, fmt.Errorf("node index %d is out of range, the cluster network has addresses for %d nodes", nodeIdx, MaxNodes)
+	}
+	host := firstNodeHost + nodeIdx - 1
+
+	ipv4 := Subnet4.Addr().As4()
+	ipv4[3] = byte(host)
+
+	// the IPv6 address reads like the IPv4 one, 192.168.66.123 becomes fd00::123
+	hostHex, err := strconv.ParseUint(strconv.Itoa(host), 16, 16)
+	if err != nil {
+		return Node{}, err
+	}
+	ipv6 := Subnet6.Addr().As16()
+	ipv6[14] = byte(hostHex >> 8)
+	ipv6[15] = byte(hostHex)
+
+	// the last byte of the MACs reads like the last two digits of the node name
+	nodeByte, sriovByte := macNode, macSRIOV
+	if nodeIdx >= 100 {
+		nodeByte, sriovByte = macNodeFrom100, macSRIOVFrom100
+	}
+	mac, err := net.ParseMAC(fmt.Sprintf("%s:%02x:%02d", macPrefix, nodeByte, nodeIdx%100))
+	if err != nil {
+		return Node{}, err
+	}
+	sriovMAC, err := net.ParseMAC(fmt.Sprintf("%s:%02x:%02d", macPrefix, sriovByte, nodeIdx%100))
+	if err != nil {
+		return Node{}, err
+	}
+
+	return Node{
+		Index:    nodeIdx,
+		Hostname: fmt.Sprintf("node%02d", nodeIdx),
+		IPv4:     netip.AddrFrom4(ipv4),
+		IPv6:     netip.AddrFrom16(ipv6),
+		MAC:      mac,
+		SRIOVMAC: sriovMAC,
+	}, nil
+}
+
+// SecondaryNICMAC returns the MAC of a secondary NIC, the NICs of all nodes are counted through with nicIdx
+// starting at 0
+func SecondaryNICMAC(nicIdx int) (net.HardwareAddr, error) {
+	if nicIdx < 0 || nicIdx >= maxSecondaryNICs {
+		return nil, fmt.Errorf("secondary NIC %d is out of range, the cluster network has MACs for %d secondary NICs", nicIdx, maxSecondaryNICs)
+	}
+	return net.ParseMAC(fmt.Sprintf("%s:%02x:%02x", macPrefix, macSecondaryNIC, nicIdx))
+}
+
+// ControlPlane returns the addresses of node01, which runs the control plane
+func ControlPlane() Node {
+	n, _ := NodeAddresses(1)
+	return n
+}
+
+// DHCPHost returns the static lease of the node in the format of dnsmasq --dhcp-host
+func (n Node) DHCPHost() string {
+	return fmt.Sprintf("%s,%s,[%s],%s,infinite", n.MAC, n.IPv4, n.IPv6, n.Hostname)
+}
+
+// SSHAddress returns the address the SSH server of the node listens on
+func (n Node) SSHAddress() string {
+	return net.JoinHostPort(n.IPv4.String(), "22")
+}
@@ -0,0 +1,70 @@
+package ipam
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestIPAM(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "IPAM Suite")
+}
+
+var _ = Describe("NodeAddresses", func() {
+	It("should keep the addresses the cluster images assigned to the first nodes", func() {
+		n, err := NodeAddresses(3)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.DHCPHost()).To(Equal("52:55:00:d1:55:03,192.168.66.103,[fd00::103],node03,infinite"))
+		Expect(n.SSHAddress()).To(Equal("192.168.66.103:22"))
+
+		n, err = NodeAddresses(10)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.DHCPHost()).To(Equal("52:55:00:d1:55:10,192.168.66.110,[fd00::110],node10,infinite"))
+	})
+
+	It("should hand out unique addresses to every node the subnet has room for", func() {
+		seen := map[string]bool{}
+		for idx := 1; idx <= MaxNodes; idx++ {
+			n, err := NodeAddresses(idx)
+			Expect(err).NotTo(HaveOccurred())
+			for _, addr := range []string{n.IPv4.String(), n.IPv6.String(), n.MAC.String(), n.SRIOVMAC.String(), n.Hostname} {
+				Expect(seen).NotTo(HaveKey(addr))
+				seen[addr] = true
+			}
+			Expect(Subnet4.Contains(n.IPv4)).To(BeTrue())
+			Expect(Subnet6.Contains(n.IPv6)).To(BeTrue())
+		}
+
+		last, err := NodeAddresses(MaxNodes)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(last.DHCPHost()).To(Equal("52:55:00:d1:58:54,192.168.66.254,[fd00::254],node154,infinite"))
+	})
+
+	It("should not hand out the MACs of the secondary NICs to nodes", func() {
+		nics := map[string]bool{}
+		for idx := 0; idx < maxSecondaryNICs; idx++ {
+			mac, err := SecondaryNICMAC(idx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(nics).NotTo(HaveKey(mac.String()))
+			nics[mac.String()] = true
+		}
+		for idx := 1; idx <= MaxNodes; idx++ {
+			n, err := NodeAddresses(idx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(nics).NotTo(HaveKey(n.MAC.String()), n.Hostname)
+			Expect(nics).NotTo(HaveKey(n.SRIOVMAC.String()), n.Hostname)
+		}
+
+		_, err := SecondaryNICMAC(maxSecondaryNICs)
+		Expect(err).To(MatchError(ContainSubstring("MACs for 256 secondary NICs")))
+	})
+
+	It("should reject indexes the subnet has no address for", func() {
+		_, err := NodeAddresses(0)
+		Expect(err).To(HaveOccurred())
+		_, err = NodeAddresses(MaxNodes + 1)
+		Expect(err).To(MatchError(ContainSubstring("addresses for 154 nodes")))
+	})
+})
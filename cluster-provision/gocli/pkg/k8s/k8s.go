@@ -2,7 +2,9 @@ package utils
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"strings"
 	"time"
 
@@ -19,6 +21,7 @@ import (
 	"github.com/cenkalti/backoff/v4"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -34,6 +37,9 @@ import (
 	"sigs.k8s.io/yaml"
 )
 
+// FieldManager owns the fields gocli sets through server-side apply
+const FieldManager = "gocli"
+
 var s = initSchema()
 
 type K8sDynamicClient interface {
@@ -54,17 +60,50 @@ type ReactorConfig struct {
 	reactfunc func(action testing.Action) (bool, runtime.Object, error)
 }
 
+// NewConfig returns the config of a client for the API server published on the given port of localhost,
+// the certificate of the API server is verified against the CA of the kubeconfig unless it is not valid for 127.0.0.1
 func NewConfig(manifestPath string, apiServerPort uint16) (*rest.Config, error) {
 	config, err := clientcmd.BuildConfigFromFlags("", manifestPath)
 	if err != nil {
 		return nil, fmt.Errorf("error building kubeconfig: %v", err)
 	}
-	config.Host = "https://127.0.0.1:" + fmt.Sprintf("%d", apiServerPort)
-	config.Insecure = true
-	config.CAData = []byte{}
+	config.Host = LocalServer(apiServerPort)
+	if !LocalServerVerifiable(apiServerPort) {
+		config.Insecure = true
+		config.CAData = nil
+		config.CAFile = ""
+	}
 	return config, nil
 }
 
+// LocalServerVerifiable tells whether the certificate served on the given port of localhost is valid for 127.0.0.1,
+// the API servers of provider images built before kubeadm added 127.0.0.1 to the certSANs serve one which is not.
+// It warns when the certificate is not, and assumes it is when the API server cannot be reached.
+func LocalServerVerifiable(apiServerPort uint16) bool {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	conn, err := tls.DialWithDialer(dialer, "tcp", fmt.Sprintf("127.0.0.1:%d", apiServerPort), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		logrus.Debugf("could not fetch the certificate of the API server: %v", err)
+		return true
+	}
+	defer conn.Close()
+
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return true
+	}
+	if err := certs[0].VerifyHostname("127.0.0.1"); err != nil {
+		logrus.Warnf("the certificate of the API server is not valid for 127.0.0.1, skipping TLS verification, reprovision the cluster with a newer provider image to verify it: %v", err)
+		return false
+	}
+	return true
+}
+
+// LocalServer returns the URL of the API server published on the given port of localhost
+func LocalServer(apiServerPort uint16) string {
+	return fmt.Sprintf("https://127.0.0.1:%d", apiServerPort)
+}
+
 func NewDynamicClient(config *rest.Config) (*k8sDynamicClientImpl, error) {
 	dynamicClient, err := dynamic.NewForConfig(config)
 	if err != nil {
@@ -78,6 +117,7 @@ func NewDynamicClient(config *rest.Config) (*k8sDynamicClientImpl, error) {
 
 func NewTestClient(reactors ...ReactorConfig) *k8sDynamicClientImpl {
 	dynamicClient := fake.NewSimpleDynamicClient(s)
+	dynamicClient.PrependReactor("patch", "*", newApplyReactor(dynamicClient.Tracker(), reactors))
 	for _, r := range reactors {
 		dynamicClient.PrependReactor(r.verb, r.resource, r.reactfunc)
 	}
@@ -111,16 +151,12 @@ func (c *k8sDynamicClientImpl) Get(gvk schema.GroupVersionKind, name, ns string)
 }
 
 func (c *k8sDynamicClientImpl) Update(newResource *unstructured.Unstructured) error {
-	gv := strings.Split(newResource.GetAPIVersion(), "/")
-	if len(gv) != 2 {
+	gvk := newResource.GroupVersionKind()
+	if gvk.Version == "" || strings.Count(newResource.GetAPIVersion(), "/") > 1 {
 		return fmt.Errorf("resource has no proper group and version, got: %s", newResource.GetAPIVersion())
 	}
 
-	resourceClient, err := c.initResourceClientForGVKAndNamespace(schema.GroupVersionKind{
-		Group:   gv[0],
-		Version: gv[1],
-		Kind:    newResource.GetKind(),
-	}, newResource.GetNamespace())
+	resourceClient, err := c.initResourceClientForGVKAndNamespace(gvk, newResource.GetNamespace())
 	if err != nil {
 		return err
 	}
@@ -152,7 +188,7 @@ func (c *k8sDynamicClientImpl) Apply(obj *unstructured.Unstructured) error {
 		return err
 	}
 
-	err = c.createWithExponentialBackoff(resourceClient, obj)
+	err = c.applyWithExponentialBackoff(resourceClient, prepareForApply(obj))
 	if err != nil {
 		return err
 	}
@@ -175,9 +211,16 @@ func SerializeIntoObject(manifest []byte) (*unstructured.Unstructured, error) {
 	return obj, nil
 }
 
-func (c *k8sDynamicClientImpl) createWithExponentialBackoff(resourceClient dynamic.ResourceInterface, obj *unstructured.Unstructured) error {
+// applyWithExponentialBackoff applies the object server side, so it is created or updated to match the manifest
+// and opts can be run again on a cluster. Force takes over fields other managers set, e.g. kubectl, as the
+// manifests of gocli are the desired state. Requests are retried while CRDs or namespaces the object depends on
+// are not ready yet, requests the API server rejects are not
+func (c *k8sDynamicClientImpl) applyWithExponentialBackoff(resourceClient dynamic.ResourceInterface, obj *unstructured.Unstructured) error {
 	operation := func() error {
-		_, err := resourceClient.Create(context.TODO(), obj, v1.CreateOptions{})
+		_, err := resourceClient.Apply(context.TODO(), obj.GetName(), obj, v1.ApplyOptions{FieldManager: FieldManager, Force: true})
+		if apierrors.IsInvalid(err) || apierrors.IsBadRequest(err) || apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err) {
+			return backoff.Permanent(err)
+		}
 		return err
 	}
 
@@ -192,6 +235,17 @@ func (c *k8sDynamicClientImpl) createWithExponentialBackoff(resourceClient dynam
 	return nil
 }
 
+// prepareForApply drops the status and the metadata maintained by the API server, which an apply request must
+// not contain. The status is owned by the controllers of the object, it is only applied through its subresource
+func prepareForApply(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	obj = obj.DeepCopy()
+	delete(obj.Object, "status")
+	for _, field := range []string{"resourceVersion", "uid", "generation", "creationTimestamp", "managedFields"} {
+		unstructured.RemoveNestedField(obj.Object, "metadata", field)
+	}
+	return obj
+}
+
 func (c *k8sDynamicClientImpl) Delete(gvk schema.GroupVersionKind, name, ns string) error {
 	resourceClient, err := c.initResourceClientForGVKAndNamespace(gvk, ns)
 	if err != nil {
@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+const configMap = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: test
+  resourceVersion: "42"
+data:
+  key: %s
+`
+
+var configMapGVK = schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+
+func configMapWithValue(value string) string {
+	return fmt.Sprintf(configMap, value)
+}
+
+var _ = Describe("Apply", func() {
+	apply := func(c K8sDynamicClient, manifest string) error {
+		obj, err := SerializeIntoObject([]byte(manifest))
+		Expect(err).NotTo(HaveOccurred())
+		return c.Apply(obj)
+	}
+
+	It("should update objects which already exist", func() {
+		c := NewTestClient()
+		Expect(apply(c, configMapWithValue("first"))).To(Succeed())
+		Expect(apply(c, configMapWithValue("second"))).To(Succeed())
+
+		obj, err := c.Get(configMapGVK, "settings", "test")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(obj.Object["data"]).To(HaveKeyWithValue("key", "second"))
+		Expect(obj.GetResourceVersion()).NotTo(Equal("42"))
+	})
+
+	It("should keep the status when a rolled out object is applied again", func() {
+		c := NewTestClient(NewReactorConfig("create", "deployments", RolloutReactor))
+		Expect(apply(c, deployment)).To(Succeed())
+		Expect(apply(c, deployment)).To(Succeed())
+
+		obj, err := c.Get(deploymentGVK, "operator", "test")
+		Expect(err).NotTo(HaveOccurred())
+		available, _, err := unstructured.NestedInt64(obj.Object, "status", "availableReplicas")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(available).To(BeEquivalentTo(2))
+	})
+
+	It("should not apply the status of a manifest", func() {
+		obj, err := SerializeIntoObject([]byte(pvc + "status:\n  phase: Bound\n"))
+		Expect(err).NotTo(HaveOccurred())
+
+		prepared := prepareForApply(obj)
+		Expect(prepared.Object).NotTo(HaveKey("status"))
+		Expect(obj.Object).To(HaveKey("status"))
+	})
+})
+
+var _ = Describe("NewConfig", func() {
+	// serve starts a TLS server with a certificate for the given names and returns its port on localhost
+	serve := func(names ...string) uint16 {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "kube-apiserver"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			DNSNames:     names,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		for _, name := range names {
+			if ip := net.ParseIP(name); ip != nil {
+				template.IPAddresses = append(template.IPAddresses, ip)
+			}
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		Expect(err).NotTo(HaveOccurred())
+
+		server := httptest.NewUnstartedServer(http.NotFoundHandler())
+		server.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+		server.StartTLS()
+		DeferCleanup(server.Close)
+		return uint16(server.Listener.Addr().(*net.TCPAddr).Port)
+	}
+
+	newConfig := func(apiServerPort uint16) *rest.Config {
+		kubeconfig := clientcmdapi.NewConfig()
+		kubeconfig.Clusters["kubernetes"] = &clientcmdapi.Cluster{Server: "https://192.168.66.101:6443", CertificateAuthorityData: []byte("ca")}
+		kubeconfig.AuthInfos["kubernetes-admin"] = &clientcmdapi.AuthInfo{Token: "token"}
+		kubeconfig.Contexts["kubernetes-admin@kubernetes"] = &clientcmdapi.Context{Cluster: "kubernetes", AuthInfo: "kubernetes-admin"}
+		kubeconfig.CurrentContext = "kubernetes-admin@kubernetes"
+		path := filepath.Join(GinkgoT().TempDir(), "admin.conf")
+		Expect(clientcmd.WriteToFile(*kubeconfig, path)).To(Succeed())
+
+		config, err := NewConfig(path, apiServerPort)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Host).To(Equal(LocalServer(apiServerPort)))
+		return config
+	}
+
+	It("should verify the API server when its certificate is valid for 127.0.0.1", func() {
+		config := newConfig(serve("kubernetes", "127.0.0.1"))
+		Expect(config.Insecure).To(BeFalse())
+		Expect(config.CAData).To(BeEquivalentTo("ca"))
+	})
+
+	It("should skip the verification when the certificate of the API server is not valid for 127.0.0.1", func() {
+		config := newConfig(serve("kubernetes", "192.168.66.101"))
+		Expect(config.Insecure).To(BeTrue())
+		Expect(config.CAData).To(BeEmpty())
+	})
+
+	It("should verify the API server when it cannot be reached", func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		port := uint16(listener.Addr().(*net.TCPAddr).Port)
+		Expect(listener.Close()).To(Succeed())
+
+		config := newConfig(port)
+		Expect(config.Insecure).To(BeFalse())
+		Expect(config.CAData).To(BeEquivalentTo("ca"))
+	})
+})
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newApplyReactor emulates server-side apply, which the fake client only supports for existing objects.
+// Objects applied for the first time are created through the create reactors, so reactors which fill in the
+// status keep working. Applying an existing object replaces it but keeps its status
+func newApplyReactor(tracker k8stesting.ObjectTracker, reactors []ReactorConfig) k8stesting.ReactionFunc {
+	return func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch, ok := action.(k8stesting.PatchAction)
+		if !ok || patch.GetPatchType() != types.ApplyPatchType || action.GetSubresource() != "" {
+			return false, nil, nil
+		}
+
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(patch.GetPatch()); err != nil {
+			return true, nil, err
+		}
+		gvr, ns := action.GetResource(), action.GetNamespace()
+
+		existing, err := tracker.Get(gvr, ns, patch.GetName())
+		if apierrors.IsNotFound(err) {
+			create := k8stesting.NewCreateAction(gvr, ns, obj)
+			for _, r := range reactors {
+				if r.verb != "create" || (r.resource != "*" && r.resource != gvr.Resource) {
+					continue
+				}
+				if handled, ret, err := r.reactfunc(create); handled {
+					return true, ret, err
+				}
+			}
+			return true, obj, tracker.Create(gvr, obj, ns)
+		}
+		if err != nil {
+			return true, nil, err
+		}
+
+		existingObj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(existing)
+		if err != nil {
+			return true, nil, err
+		}
+		if status, ok := existingObj["status"]; ok {
+			obj.Object["status"] = status
+		}
+		return true, obj, tracker.Update(gvr, obj, ns)
+	}
+}
+
+// RolloutReactor completes the rollout of created Deployments, DaemonSets and StatefulSets
+var RolloutReactor = func(action k8stesting.Action) (bool, runtime.Object, error) {
+	obj := action.(k8stesting.CreateAction).GetObject().(*unstructured.Unstructured)
+	replicas, found, err := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+	if err != nil {
+		return true, nil, err
+	}
+	if !found {
+		replicas = 1
+	}
+
+	status := map[string]interface{}{}
+	switch obj.GetKind() {
+	case "Deployment":
+		status = map[string]interface{}{
+			"replicas":          replicas,
+			"updatedReplicas":   replicas,
+			"readyReplicas":     replicas,
+			"availableReplicas": replicas,
+		}
+	case "DaemonSet":
+		status = map[string]interface{}{
+			"desiredNumberScheduled": int64(1),
+			"updatedNumberScheduled": int64(1),
+			"numberReady":            int64(1),
+			"numberAvailable":        int64(1),
+		}
+	case "StatefulSet":
+		status = map[string]interface{}{
+			"replicas":        replicas,
+			"updatedReplicas": replicas,
+			"readyReplicas":   replicas,
+		}
+	}
+	status["observedGeneration"] = obj.GetGeneration()
+	if err := unstructured.SetNestedField(obj.Object, status, "status"); err != nil {
+		return true, nil, err
+	}
+	return false, obj, nil
+}
+
+// NewConditionReactor returns a reactor which reports the condition as True on every created object
+func NewConditionReactor(conditionType string) func(action k8stesting.Action) (bool, runtime.Object, error) {
+	return func(action k8stesting.Action) (bool, runtime.Object, error) {
+		obj := action.(k8stesting.CreateAction).GetObject().(*unstructured.Unstructured)
+		conditions := []interface{}{
+			map[string]interface{}{"type": conditionType, "status": "True"},
+		}
+		if err := unstructured.SetNestedSlice(obj.Object, conditions, "status", "conditions"); err != nil {
+			return true, nil, err
+		}
+		return false, obj, nil
+	}
+}
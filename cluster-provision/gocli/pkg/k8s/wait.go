@@ -0,0 +1,196 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	pollInterval    = 2 * time.Second
+	maxPollInterval = 15 * time.Second
+
+	deploymentGVK  = schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+	daemonSetGVK   = schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "DaemonSet"}
+	statefulSetGVK = schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "StatefulSet"}
+	crdGVK         = schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"}
+	pvcGVK         = schema.GroupVersionKind{Version: "v1", Kind: "PersistentVolumeClaim"}
+)
+
+// ReadyFunc returns nil once the object is ready, otherwise an error telling why it is not
+type ReadyFunc func(obj *unstructured.Unstructured) error
+
+// WaitFor polls an object until ready accepts it and returns its last state. Objects which don't exist yet
+// are polled as well. On timeout the error contains the last reason the object was not ready
+func WaitFor(c K8sDynamicClient, gvk schema.GroupVersionKind, name, ns string, timeout time.Duration, ready ReadyFunc) (*unstructured.Unstructured, error) {
+	key := name
+	if ns != "" {
+		key = ns + "/" + name
+	}
+
+	var obj *unstructured.Unstructured
+	operation := func() error {
+		var err error
+		obj, err = c.Get(gvk, name, ns)
+		if err == nil {
+			err = ready(obj)
+		}
+		if err != nil {
+			logrus.Infof("waiting for %s %s: %v", gvk.Kind, key, err)
+		}
+		return err
+	}
+
+	err := backoff.Retry(operation, backoff.NewExponentialBackOff(
+		backoff.WithInitialInterval(pollInterval),
+		backoff.WithMaxInterval(maxPollInterval),
+		backoff.WithMaxElapsedTime(timeout),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("%s %s not ready after %s: %w", gvk.Kind, key, timeout, err)
+	}
+	return obj, nil
+}
+
+// WaitForObject waits until an object exists and returns it
+func WaitForObject(c K8sDynamicClient, gvk schema.GroupVersionKind, name, ns string, timeout time.Duration) (*unstructured.Unstructured, error) {
+	return WaitFor(c, gvk, name, ns, timeout, func(*unstructured.Unstructured) error { return nil })
+}
+
+// WaitForDeployment waits until all replicas of a Deployment are updated and available
+func WaitForDeployment(c K8sDynamicClient, name, ns string, timeout time.Duration) error {
+	_, err := WaitFor(c, deploymentGVK, name, ns, timeout, deploymentRolledOut)
+	return err
+}
+
+// WaitForDaemonSet waits until the pods of a DaemonSet are updated and available on all scheduled nodes
+func WaitForDaemonSet(c K8sDynamicClient, name, ns string, timeout time.Duration) error {
+	_, err := WaitFor(c, daemonSetGVK, name, ns, timeout, daemonSetRolledOut)
+	return err
+}
+
+// WaitForStatefulSet waits until all replicas of a StatefulSet are updated and ready
+func WaitForStatefulSet(c K8sDynamicClient, name, ns string, timeout time.Duration) error {
+	_, err := WaitFor(c, statefulSetGVK, name, ns, timeout, statefulSetRolledOut)
+	return err
+}
+
+// WaitForCRDEstablished waits until the API server serves the resources of a CustomResourceDefinition
+func WaitForCRDEstablished(c K8sDynamicClient, name string, timeout time.Duration) error {
+	return WaitForCondition(c, crdGVK, name, "", "Established", timeout)
+}
+
+// WaitForCondition waits until the status of an object reports the condition as True
+func WaitForCondition(c K8sDynamicClient, gvk schema.GroupVersionKind, name, ns, conditionType string, timeout time.Duration) error {
+	_, err := WaitFor(c, gvk, name, ns, timeout, func(obj *unstructured.Unstructured) error {
+		return conditionTrue(obj, conditionType)
+	})
+	return err
+}
+
+// WaitForPhase waits until status.phase of an object reaches the given phase
+func WaitForPhase(c K8sDynamicClient, gvk schema.GroupVersionKind, name, ns, phase string, timeout time.Duration) error {
+	_, err := WaitFor(c, gvk, name, ns, timeout, func(obj *unstructured.Unstructured) error {
+		current, _, err := unstructured.NestedString(obj.Object, "status", "phase")
+		if err != nil {
+			return err
+		}
+		if current != phase {
+			return fmt.Errorf("phase is %q, expected %q", current, phase)
+		}
+		return nil
+	})
+	return err
+}
+
+// WaitForPVCBound waits until a PersistentVolumeClaim is bound to a volume
+func WaitForPVCBound(c K8sDynamicClient, name, ns string, timeout time.Duration) error {
+	return WaitForPhase(c, pvcGVK, name, ns, "Bound", timeout)
+}
+
+func deploymentRolledOut(obj *unstructured.Unstructured) error {
+	d := &appsv1.Deployment{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, d); err != nil {
+		return err
+	}
+	if d.Status.ObservedGeneration < d.Generation {
+		return fmt.Errorf("the update of the spec was not observed yet")
+	}
+	replicas := int32(1)
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+	if d.Status.UpdatedReplicas < replicas {
+		return fmt.Errorf("%d of %d replicas updated", d.Status.UpdatedReplicas, replicas)
+	}
+	if d.Status.Replicas > d.Status.UpdatedReplicas {
+		return fmt.Errorf("%d old replicas pending termination", d.Status.Replicas-d.Status.UpdatedReplicas)
+	}
+	if d.Status.AvailableReplicas < d.Status.UpdatedReplicas {
+		return fmt.Errorf("%d of %d updated replicas available", d.Status.AvailableReplicas, d.Status.UpdatedReplicas)
+	}
+	return nil
+}
+
+func daemonSetRolledOut(obj *unstructured.Unstructured) error {
+	ds := &appsv1.DaemonSet{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, ds); err != nil {
+		return err
+	}
+	if ds.Status.ObservedGeneration < ds.Generation {
+		return fmt.Errorf("the update of the spec was not observed yet")
+	}
+	// a DaemonSet whose node selector matches no node is rolled out without any pod
+	if ds.Status.UpdatedNumberScheduled < ds.Status.DesiredNumberScheduled {
+		return fmt.Errorf("%d of %d pods updated", ds.Status.UpdatedNumberScheduled, ds.Status.DesiredNumberScheduled)
+	}
+	if ds.Status.NumberAvailable < ds.Status.DesiredNumberScheduled {
+		return fmt.Errorf("%d of %d updated pods available", ds.Status.NumberAvailable, ds.Status.DesiredNumberScheduled)
+	}
+	return nil
+}
+
+func statefulSetRolledOut(obj *unstructured.Unstructured) error {
+	sts := &appsv1.StatefulSet{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, sts); err != nil {
+		return err
+	}
+	if sts.Status.ObservedGeneration < sts.Generation {
+		return fmt.Errorf("the update of the spec was not observed yet")
+	}
+	replicas := int32(1)
+	if sts.Spec.Replicas != nil {
+		replicas = *sts.Spec.Replicas
+	}
+	if sts.Status.ReadyReplicas < replicas {
+		return fmt.Errorf("%d of %d replicas ready", sts.Status.ReadyReplicas, replicas)
+	}
+	if sts.Status.UpdatedReplicas < replicas {
+		return fmt.Errorf("%d of %d replicas updated", sts.Status.UpdatedReplicas, replicas)
+	}
+	return nil
+}
+
+func conditionTrue(obj *unstructured.Unstructured, conditionType string) error {
+	conditions, _, err := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	if err != nil {
+		return err
+	}
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok || condition["type"] != conditionType {
+			continue
+		}
+		if condition["status"] == "True" {
+			return nil
+		}
+		return fmt.Errorf("condition %s is %v: %v", conditionType, condition["status"], condition["message"])
+	}
+	return fmt.Errorf("condition %s is not reported yet", conditionType)
+}
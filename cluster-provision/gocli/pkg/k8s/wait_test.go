@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestK8s(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "K8s Suite")
+}
+
+const (
+	deployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: operator
+  namespace: test
+spec:
+  replicas: 2
+  selector:
+    matchLabels:
+      app: operator
+  template:
+    metadata:
+      labels:
+        app: operator
+    spec:
+      containers:
+      - name: operator
+        image: operator
+`
+	daemonSet = `apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: agent
+  namespace: test
+spec:
+  selector:
+    matchLabels:
+      app: agent
+  template:
+    metadata:
+      labels:
+        app: agent
+    spec:
+      containers:
+      - name: agent
+        image: agent
+`
+	pvc = `apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: claim
+  namespace: test
+spec:
+  accessModes: [ReadWriteOnce]
+  resources:
+    requests:
+      storage: 1Gi
+`
+)
+
+var _ = Describe("Waiters", func() {
+	apply := func(c K8sDynamicClient, manifest string) {
+		obj, err := SerializeIntoObject([]byte(manifest))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Apply(obj)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		interval, maxInterval := pollInterval, maxPollInterval
+		pollInterval, maxPollInterval = 10*time.Millisecond, 10*time.Millisecond
+		DeferCleanup(func() {
+			pollInterval, maxPollInterval = interval, maxInterval
+		})
+	})
+
+	It("should wait for rolled out Deployments and DaemonSets", func() {
+		c := NewTestClient(
+			NewReactorConfig("create", "deployments", RolloutReactor),
+			NewReactorConfig("create", "daemonsets", RolloutReactor),
+		)
+		apply(c, deployment)
+		apply(c, daemonSet)
+
+		Expect(WaitForDeployment(c, "operator", "test", time.Second)).To(Succeed())
+		Expect(WaitForDaemonSet(c, "agent", "test", time.Second)).To(Succeed())
+	})
+
+	It("should accept DaemonSets which match no node once their spec is observed", func() {
+		c := NewTestClient()
+		apply(c, daemonSet)
+		obj, err := c.Get(daemonSetGVK, "agent", "test")
+		Expect(err).NotTo(HaveOccurred())
+		obj.SetGeneration(2)
+		Expect(unstructured.SetNestedField(obj.Object, int64(1), "status", "observedGeneration")).To(Succeed())
+		Expect(c.Update(obj)).To(Succeed())
+
+		Expect(WaitForDaemonSet(c, "agent", "test", 50*time.Millisecond)).To(MatchError(ContainSubstring("the update of the spec was not observed yet")))
+
+		Expect(unstructured.SetNestedField(obj.Object, int64(2), "status", "observedGeneration")).To(Succeed())
+		Expect(c.Update(obj)).To(Succeed())
+		Expect(WaitForDaemonSet(c, "agent", "test", time.Second)).To(Succeed())
+	})
+
+	It("should report why a rollout did not finish", func() {
+		c := NewTestClient()
+		apply(c, deployment)
+
+		err := WaitForDeployment(c, "operator", "test", 100*time.Millisecond)
+		Expect(err).To(MatchError(ContainSubstring("Deployment test/operator not ready after 100ms: 0 of 2 replicas updated")))
+	})
+
+	It("should report objects which do not exist", func() {
+		err := WaitForDaemonSet(NewTestClient(), "agent", "test", 50*time.Millisecond)
+		Expect(err).To(MatchError(ContainSubstring("not found")))
+	})
+
+	It("should wait for conditions", func() {
+		c := NewTestClient(NewReactorConfig("create", "deployments", NewConditionReactor("Available")))
+		apply(c, deployment)
+
+		gvk := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+		Expect(WaitForCondition(c, gvk, "operator", "test", "Available", time.Second)).To(Succeed())
+		Expect(WaitForCondition(c, gvk, "operator", "test", "Progressing", 50*time.Millisecond)).To(MatchError(ContainSubstring("condition Progressing is not reported yet")))
+	})
+
+	It("should wait for PVCs to be bound", func() {
+		c := NewTestClient()
+		apply(c, pvc)
+
+		Expect(WaitForPVCBound(c, "claim", "test", 50*time.Millisecond)).To(MatchError(ContainSubstring(`phase is "", expected "Bound"`)))
+
+		obj, err := c.Get(pvcGVK, "claim", "test")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(unstructured.SetNestedField(obj.Object, "Bound", "status", "phase")).To(Succeed())
+		Expect(c.Update(obj)).To(Succeed())
+		Expect(WaitForPVCBound(c, "claim", "test", time.Second)).To(Succeed())
+	})
+})
@@ -0,0 +1,154 @@
+package libssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// Shell runs cmd on the node, or a login shell if cmd is empty, and returns its exit code. If stdin is a
+// terminal it is put into raw mode and the session gets a PTY which follows the size of the terminal.
+// The session is closed once ctx is done
+func (s *SSHClientImpl) Shell(ctx context.Context, cmd string, stdin *os.File, stdout, stderr io.Writer) (int, error) {
+	if err := s.initClient(); err != nil {
+		return 0, err
+	}
+	session, err := s.client.NewSession()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = session.Close() }()
+	stop := context.AfterFunc(ctx, func() { _ = session.Close() })
+	defer stop()
+
+	session.Stdin = stdin
+	session.Stdout = stdout
+	session.Stderr = stderr
+
+	fd := int(stdin.Fd())
+	if term.IsTerminal(fd) {
+		width, height, err := term.GetSize(fd)
+		if err != nil {
+			return 0, err
+		}
+		termType := os.Getenv("TERM")
+		if termType == "" {
+			termType = "xterm-256color"
+		}
+		modes := ssh.TerminalModes{ssh.ECHO: 1, ssh.TTY_OP_ISPEED: 14400, ssh.TTY_OP_OSPEED: 14400}
+		if err := session.RequestPty(termType, height, width, modes); err != nil {
+			return 0, fmt.Errorf("failed to request a PTY: %v", err)
+		}
+
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return 0, err
+		}
+		defer func() { _ = term.Restore(fd, state) }()
+
+		resize := make(chan os.Signal, 1)
+		signal.Notify(resize, syscall.SIGWINCH)
+		defer signal.Stop(resize)
+		go func() {
+			for range resize {
+				if width, height, err := term.GetSize(fd); err == nil {
+					_ = session.WindowChange(height, width)
+				}
+			}
+		}()
+	}
+
+	if cmd == "" {
+		err = session.Shell()
+		if err == nil {
+			err = session.Wait()
+		}
+	} else {
+		err = session.Run(cmd)
+	}
+
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus(), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
+
+// LocalForward accepts connections on the local address and forwards them to the remote address, which is
+// dialed from the node. It returns once ctx is done or the listener fails
+func (s *SSHClientImpl) LocalForward(ctx context.Context, local string, remote string) error {
+	if err := s.initClient(); err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", local)
+	if err != nil {
+		return err
+	}
+	return forward(ctx, listener, func() (net.Conn, error) { return s.client.Dial("tcp", remote) })
+}
+
+// RemoteForward accepts connections on the remote address of the node and forwards them to the local
+// address. It returns once ctx is done or the listener fails
+func (s *SSHClientImpl) RemoteForward(ctx context.Context, remote string, local string) error {
+	if err := s.initClient(); err != nil {
+		return err
+	}
+	listener, err := s.client.Listen("tcp", remote)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s on the node: %v", remote, err)
+	}
+	return forward(ctx, listener, func() (net.Conn, error) { return net.Dial("tcp", local) })
+}
+
+// forward copies the data of every connection accepted by the listener to a connection returned by dial
+func forward(ctx context.Context, listener net.Listener, dial func() (net.Conn, error)) error {
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			defer func() { _ = conn.Close() }()
+			target, err := dial()
+			if err != nil {
+				logrus.WithError(err).Warnf("failed to forward the connection from %s", conn.RemoteAddr())
+				return
+			}
+			defer func() { _ = target.Close() }()
+
+			done := make(chan struct{}, 2)
+			go func() {
+				_, _ = io.Copy(target, conn)
+				done <- struct{}{}
+			}()
+			go func() {
+				_, _ = io.Copy(conn, target)
+				done <- struct{}{}
+			}()
+			<-done
+		}()
+	}
+}
@@ -8,13 +8,13 @@ import (
 	"io"
 	"net"
 	"os"
-	"strconv"
-	"strings"
 	"sync"
 
 	"github.com/bramvdbogaerde/go-scp"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/ssh"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/ipam"
 )
 
 //go:embed key.pem
@@ -37,6 +37,8 @@ type SSHClientImpl struct {
 	initMutex sync.Mutex
 	config    *ssh.ClientConfig
 	client    *ssh.Client
+	stdout    io.Writer
+	stderr    io.Writer
 }
 
 func NewSSHClient(port uint16, idx int, root bool) (*SSHClientImpl, error) {
@@ -61,15 +63,23 @@ func NewSSHClient(port uint16, idx int, root bool) (*SSHClientImpl, error) {
 		sshPort:   port,
 		initMutex: sync.Mutex{},
 		nodeIdx:   idx,
+		stdout:    os.Stdout,
+		stderr:    os.Stderr,
 	}, nil
 }
 
+// SetOutput redirects the output of the commands run through Command, e.g. to prefix the lines of concurrently provisioned nodes
+func (s *SSHClientImpl) SetOutput(stdout, stderr io.Writer) {
+	s.stdout = stdout
+	s.stderr = stderr
+}
+
 func GetSSHUser() string {
 	return "cloud-user"
 }
 
 func (s *SSHClientImpl) Command(cmd string) error {
-	return s.executeCommand(cmd, os.Stdout, os.Stderr)
+	return s.executeCommand(cmd, s.stdout, s.stderr)
 }
 
 func (s *SSHClientImpl) CommandWithNoStdOut(cmd string) (string, error) {
@@ -84,11 +94,8 @@ func (s *SSHClientImpl) CommandWithNoStdOut(cmd string) (string, error) {
 
 // Copies a file from a jump host after first establishing a connection with the forwarded port by dnsmasq
 func (s *SSHClientImpl) SCP(fileName string, contents io.Reader) error {
-	if s.client == nil {
-		err := s.initClient()
-		if err != nil {
-			return err
-		}
+	if err := s.initClient(); err != nil {
+		return err
 	}
 
 	scpClient, err := scp.NewClientBySSH(s.client)
@@ -111,94 +118,12 @@ func (s *SSHClientImpl) SCP(fileName string, contents io.Reader) error {
 
 // Copies a file on a jump host after first establishing a connection with the forwarded port by dnsmasq
 func (s *SSHClientImpl) CopyRemoteFile(remotePathToCopy string, target io.Writer) error {
-	if s.client == nil {
-		err := s.initClient()
-		if err != nil {
-			return err
-		}
-	}
-
-	session, err := s.client.NewSession()
-	if err != nil {
-		return err
-	}
-
-	stdout, err := session.StdoutPipe()
-	if err != nil {
-		return fmt.Errorf("unable to setup stdout for session: %v", err)
-	}
-
-	stderr, err := session.StderrPipe()
-	if err != nil {
-		return fmt.Errorf("unable to setup stderr for session: %v", err)
-	}
-	go io.Copy(os.Stderr, stderr)
-
-	errChan := make(chan error)
-
-	go func() {
-		defer close(errChan)
-		b := make([]byte, 1)
-		var buf bytes.Buffer
-		for {
-			n, err := stdout.Read(b)
-			if err != nil {
-				errChan <- fmt.Errorf("error: %v", err)
-				return
-			}
-			if n == 0 {
-				continue
-			}
-
-			if b[0] == '\n' {
-				break
-			}
-			buf.WriteByte(b[0])
-		}
-
-		metadata := strings.Split(buf.String(), " ")
-		if len(metadata) < 3 || !strings.HasPrefix(buf.String(), "C") {
-			errChan <- fmt.Errorf("%v", buf.String())
-			return
-		}
-		l, err := strconv.Atoi(metadata[1])
-		if err != nil {
-			errChan <- fmt.Errorf("invalid metadata: %v", buf.String())
-			return
-		}
-		_, err = io.CopyN(target, stdout, int64(l))
-		errChan <- err
-	}()
-	wrPipe, err := session.StdinPipe()
-	if err != nil {
-		return fmt.Errorf("failed to open pipe: %v", err)
-	}
-
-	go func(wrPipe io.WriteCloser) {
-		defer func() { _ = wrPipe.Close() }()
-		fmt.Fprintf(wrPipe, "\x00")
-		fmt.Fprintf(wrPipe, "\x00")
-		fmt.Fprintf(wrPipe, "\x00")
-		fmt.Fprintf(wrPipe, "\x00")
-	}(wrPipe)
-
-	err = session.Run("sudo -i /usr/bin/scp -qf " + remotePathToCopy)
-
-	copyError := <-errChan
-
-	if err == nil && copyError != nil {
-		return copyError
-	}
-
-	return err
+	return s.Download(remotePathToCopy, target, nil)
 }
 
 func (s *SSHClientImpl) executeCommand(cmd string, outWriter, errWriter io.Writer) error {
-	if s.client == nil {
-		err := s.initClient()
-		if err != nil {
-			return err
-		}
+	if err := s.initClient(); err != nil {
+		return err
 	}
 	session, err := s.client.NewSession()
 	if err != nil {
@@ -220,7 +145,7 @@ func (s *SSHClientImpl) executeCommand(cmd string, outWriter, errWriter io.Write
 
 	err = session.Run(cmd)
 	if err != nil {
-		return fmt.Errorf("failed to execute command: %s", cmd)
+		return fmt.Errorf("failed to execute command: %s: %w", cmd, err)
 	}
 	return nil
 }
@@ -228,17 +153,27 @@ func (s *SSHClientImpl) executeCommand(cmd string, outWriter, errWriter io.Write
 func (s *SSHClientImpl) initClient() error {
 	s.initMutex.Lock()
 	defer s.initMutex.Unlock()
+	// the client is shared by opts running concurrently, only the first call connects
+	if s.client != nil {
+		return nil
+	}
+
+	node, err := ipam.NodeAddresses(s.nodeIdx)
+	if err != nil {
+		return err
+	}
+
 	client, err := ssh.Dial("tcp", net.JoinHostPort("127.0.0.1", fmt.Sprint(s.sshPort)), s.config)
 	if err != nil {
 		return fmt.Errorf("failed to connect to SSH server: %v", err)
 	}
 
-	conn, err := client.Dial("tcp", fmt.Sprintf("192.168.66.10%d:22", s.nodeIdx))
+	conn, err := client.Dial("tcp", node.SSHAddress())
 	if err != nil {
 		return fmt.Errorf("error establishing connection to the next hop host: %s", err)
 	}
 
-	ncc, chans, reqs, err := ssh.NewClientConn(conn, fmt.Sprintf("192.168.66.10%d:22", s.nodeIdx), s.config)
+	ncc, chans, reqs, err := ssh.NewClientConn(conn, node.SSHAddress(), s.config)
 	if err != nil {
 		return fmt.Errorf("error creating forwarded ssh connection: %s", err)
 	}
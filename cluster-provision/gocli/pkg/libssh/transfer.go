@@ -0,0 +1,113 @@
+package libssh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/bramvdbogaerde/go-scp"
+)
+
+// PassThru wraps the reader of a transfer, e.g. to show its progress
+type PassThru = scp.PassThru
+
+// remoteSCP runs as root on the node, so files of any owner can be copied
+const remoteSCP = "sudo /usr/bin/scp"
+
+// RemoteFile is a file or directory found on a node by List
+type RemoteFile struct {
+	// Root is the path the file was found under, a match of the listed pattern
+	Root string
+	// Rel is the slash separated path of the file relative to Root, empty for Root itself
+	Rel  string
+	Dir  bool
+	Mode os.FileMode
+	Size int64
+}
+
+// Path returns the path of the file on the node
+func (f RemoteFile) Path() string {
+	if f.Rel == "" {
+		return f.Root
+	}
+	return strings.TrimSuffix(f.Root, "/") + "/" + f.Rel
+}
+
+// List expands the pattern on the node like a shell does and returns the matches along with everything
+// below them, parents come before their children. Symlinks below the matches are skipped
+func (s *SSHClientImpl) List(pattern string) ([]RemoteFile, error) {
+	script := fmt.Sprintf(`shopt -s nullglob dotglob; for p in %s; do find -H "$p" \( -type f -o -type d \) -printf '%%y\t%%m\t%%s\t%%H\t%%P\n'; done`, pattern)
+	out, err := s.CommandWithNoStdOut("sudo /bin/bash -c " + shellescape.Quote(script))
+	if err != nil {
+		return nil, err
+	}
+
+	files := []RemoteFile{}
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.SplitN(line, "\t", 5)
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("unexpected listing of %s: %q", pattern, line)
+		}
+		mode, err := strconv.ParseUint(fields[1], 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected mode of %s: %q", fields[3], fields[1])
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected size of %s: %q", fields[3], fields[2])
+		}
+		files = append(files, RemoteFile{Root: fields[3], Rel: fields[4], Dir: fields[0] == "d", Mode: os.FileMode(mode), Size: size})
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no such file or directory: %s", pattern)
+	}
+	return files, nil
+}
+
+// IsDir returns whether the path is a directory on the node
+func (s *SSHClientImpl) IsDir(path string) (bool, error) {
+	out, err := s.CommandWithNoStdOut(fmt.Sprintf("sudo test -d %s && echo dir || true", shellescape.Quote(path)))
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(out) == "dir", nil
+}
+
+// Mkdir creates the directory and its parents on the node and sets its permissions
+func (s *SSHClientImpl) Mkdir(path string, mode os.FileMode) error {
+	p := shellescape.Quote(path)
+	_, err := s.CommandWithNoStdOut(fmt.Sprintf("sudo mkdir -p %s && sudo chmod %o %s", p, mode.Perm(), p))
+	return err
+}
+
+// Download writes the contents of a file on the node to w
+func (s *SSHClientImpl) Download(remotePath string, w io.Writer, passThru PassThru) error {
+	client, err := s.scpClient()
+	if err != nil {
+		return err
+	}
+	return client.CopyFromRemotePassThru(context.Background(), w, remotePath, passThru)
+}
+
+// Upload writes size bytes of r to a file on the node, a new file gets the given permissions
+func (s *SSHClientImpl) Upload(r io.Reader, size int64, remotePath string, mode os.FileMode, passThru PassThru) error {
+	client, err := s.scpClient()
+	if err != nil {
+		return err
+	}
+	return client.CopyPassThru(context.Background(), r, remotePath, fmt.Sprintf("%04o", mode.Perm()), size, passThru)
+}
+
+func (s *SSHClientImpl) scpClient() (scp.Client, error) {
+	if err := s.initClient(); err != nil {
+		return scp.Client{}, err
+	}
+	return scp.NewConfigurer("", nil).SSHClient(s.client).RemoteBinary(remoteSCP).Create(), nil
+}
@@ -0,0 +1,149 @@
+package registry
+
+import (
+	"archive/tar"
+	"bufio"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+const (
+	mediaTypeManifest  = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeConfig    = "application/vnd.oci.image.config.v1+json"
+	mediaTypeLayer     = "application/vnd.oci.image.layer.v1.tar"
+	mediaTypeLayerGzip = "application/vnd.oci.image.layer.v1.tar+gzip"
+)
+
+// Blob is a file of an extracted archive with the digest it is stored under in a registry
+type Blob struct {
+	Path      string
+	Digest    string
+	Size      int64
+	MediaType string
+}
+
+// Image is an image of a docker-archive, layers shared with other images of the archive point to the same file
+type Image struct {
+	RepoTags []string
+	Config   Blob
+	Layers   []Blob
+}
+
+// archiveManifest is an entry of the manifest.json of a docker-archive
+type archiveManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// ExtractArchive extracts a docker-archive as written by docker save and podman save into dir and returns its images.
+// The digests are computed while extracting, the archive is read once
+func ExtractArchive(r io.Reader, dir string) ([]Image, error) {
+	blobs := map[string]Blob{}
+	links := map[string]string{}
+	var manifests []archiveManifest
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := path.Clean(hdr.Name)
+		if !filepath.IsLocal(name) {
+			return nil, fmt.Errorf("invalid path %s in the image archive", hdr.Name)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeSymlink:
+			// docker keeps the legacy layout as links to the blobs of the OCI layout
+			links[name] = path.Join(path.Dir(name), hdr.Linkname)
+		case tar.TypeReg:
+			if name == "manifest.json" {
+				if err := json.NewDecoder(tr).Decode(&manifests); err != nil {
+					return nil, fmt.Errorf("failed to parse the manifest.json of the image archive: %v", err)
+				}
+				continue
+			}
+			blob, err := extractBlob(tr, dir, name)
+			if err != nil {
+				return nil, err
+			}
+			blobs[name] = blob
+		}
+	}
+	if manifests == nil {
+		return nil, fmt.Errorf("the image archive has no manifest.json")
+	}
+
+	lookup := func(name string) (Blob, error) {
+		name = path.Clean(name)
+		// follow the links, an archive never links more than once
+		for range 2 {
+			if target, ok := links[name]; ok {
+				name = target
+			}
+		}
+		blob, ok := blobs[name]
+		if !ok {
+			return Blob{}, fmt.Errorf("the image archive misses %s", name)
+		}
+		return blob, nil
+	}
+
+	images := []Image{}
+	for _, m := range manifests {
+		config, err := lookup(m.Config)
+		if err != nil {
+			return nil, err
+		}
+		config.MediaType = mediaTypeConfig
+		img := Image{RepoTags: m.RepoTags, Config: config}
+		for _, l := range m.Layers {
+			layer, err := lookup(l)
+			if err != nil {
+				return nil, err
+			}
+			img.Layers = append(img.Layers, layer)
+		}
+		images = append(images, img)
+	}
+	return images, nil
+}
+
+// extractBlob writes a file of the archive below dir and digests it
+func extractBlob(r io.Reader, dir string, name string) (Blob, error) {
+	target := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return Blob{}, err
+	}
+	f, err := os.Create(target)
+	if err != nil {
+		return Blob{}, err
+	}
+	defer func() { _ = f.Close() }()
+
+	br := bufio.NewReader(r)
+	mediaType := mediaTypeLayer
+	// layers are stored uncompressed by docker and podman, but archives of other tools may keep them compressed
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		mediaType = mediaTypeLayerGzip
+	}
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, h), br)
+	if err != nil {
+		return Blob{}, err
+	}
+	if err := f.Close(); err != nil {
+		return Blob{}, err
+	}
+	return Blob{Path: target, Digest: fmt.Sprintf("sha256:%x", h.Sum(nil)), Size: size, MediaType: mediaType}, nil
+}
@@ -0,0 +1,160 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// Client pushes images to a registry speaking the distribution API over plain HTTP, like the registry
+// container of a cluster. It remembers the blobs it pushed, a Client must not be used concurrently
+type Client struct {
+	base   *url.URL
+	client *http.Client
+	// pushed holds a repository each pushed blob is stored in, to mount it into others instead of uploading it again
+	pushed map[string]string
+}
+
+// PushResult tells how many blobs of an image were uploaded, the others were in the registry already
+type PushResult struct {
+	Blobs    int
+	Uploaded int
+}
+
+// NewClient returns a client for the registry listening on host, e.g. 127.0.0.1:5000
+func NewClient(host string) *Client {
+	return &Client{
+		base:   &url.URL{Scheme: "http", Host: host},
+		client: http.DefaultClient,
+		pushed: map[string]string{},
+	}
+}
+
+// Push uploads the blobs of the image which are missing in repository and tags its manifest
+func (c *Client) Push(ctx context.Context, img Image, repository string, tag string) (PushResult, error) {
+	result := PushResult{}
+	for _, blob := range append(append([]Blob{}, img.Layers...), img.Config) {
+		uploaded, err := c.pushBlob(ctx, repository, blob)
+		if err != nil {
+			return result, fmt.Errorf("failed to push %s to %s: %w", blob.Digest, repository, err)
+		}
+		result.Blobs++
+		if uploaded {
+			result.Uploaded++
+		}
+	}
+
+	layers := []map[string]any{}
+	for _, l := range img.Layers {
+		layers = append(layers, descriptor(l))
+	}
+	manifest := map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     mediaTypeManifest,
+		"config":        descriptor(img.Config),
+		"layers":        layers,
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return result, err
+	}
+	resp, err := c.do(ctx, http.MethodPut, c.url("/v2/%s/manifests/%s", repository, tag), bytes.NewReader(data), int64(len(data)), mediaTypeManifest, http.StatusCreated)
+	if err != nil {
+		return result, fmt.Errorf("failed to tag %s:%s: %w", repository, tag, err)
+	}
+	_ = resp.Body.Close()
+	return result, nil
+}
+
+// pushBlob makes sure the blob is in repository and reports whether it had to be uploaded
+func (c *Client) pushBlob(ctx context.Context, repository string, blob Blob) (bool, error) {
+	resp, err := c.do(ctx, http.MethodHead, c.url("/v2/%s/blobs/%s", repository, blob.Digest), nil, 0, "", http.StatusOK, http.StatusNotFound)
+	if err != nil {
+		return false, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return false, nil
+	}
+
+	query := url.Values{}
+	if from, ok := c.pushed[blob.Digest]; ok {
+		query.Set("mount", blob.Digest)
+		query.Set("from", from)
+	}
+	uploads := c.url("/v2/%s/blobs/uploads/", repository)
+	uploads.RawQuery = query.Encode()
+	resp, err = c.do(ctx, http.MethodPost, uploads, nil, 0, "", http.StatusCreated, http.StatusAccepted)
+	if err != nil {
+		return false, err
+	}
+	_ = resp.Body.Close()
+	// the registry mounted the blob from the other repository
+	if resp.StatusCode == http.StatusCreated {
+		c.pushed[blob.Digest] = repository
+		return false, nil
+	}
+
+	location, err := c.base.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return false, fmt.Errorf("invalid upload location %q: %v", resp.Header.Get("Location"), err)
+	}
+	query = location.Query()
+	query.Set("digest", blob.Digest)
+	location.RawQuery = query.Encode()
+
+	f, err := os.Open(blob.Path)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = f.Close() }()
+	resp, err = c.do(ctx, http.MethodPut, location, f, blob.Size, "application/octet-stream", http.StatusCreated)
+	if err != nil {
+		return false, err
+	}
+	_ = resp.Body.Close()
+	c.pushed[blob.Digest] = repository
+	return true, nil
+}
+
+func (c *Client) url(format string, a ...any) *url.URL {
+	u := *c.base
+	u.Path = fmt.Sprintf(format, a...)
+	return &u
+}
+
+// do sends a request and fails unless the registry answers with one of the expected status codes
+func (c *Client) do(ctx context.Context, method string, u *url.URL, body io.Reader, size int64, contentType string, expected ...int) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range expected {
+		if resp.StatusCode == code {
+			return resp, nil
+		}
+	}
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	_ = resp.Body.Close()
+	if len(bytes.TrimSpace(message)) == 0 {
+		return nil, fmt.Errorf("%s %s: %s", method, u.Path, resp.Status)
+	}
+	return nil, fmt.Errorf("%s %s: %s: %s", method, u.Path, resp.Status, bytes.TrimSpace(message))
+}
+
+func descriptor(b Blob) map[string]any {
+	return map[string]any{"mediaType": b.MediaType, "digest": b.Digest, "size": b.Size}
+}
@@ -0,0 +1,201 @@
+package registry
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/docker"
+)
+
+func TestRegistry(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Registry Suite")
+}
+
+// fakeRegistry keeps the blobs per repository like the distribution registry does
+type fakeRegistry struct {
+	mu        sync.Mutex
+	blobs     map[string]map[string][]byte
+	manifests map[string][]byte
+	uploads   int
+	mounts    int
+}
+
+func newFakeRegistry() *fakeRegistry {
+	return &fakeRegistry{blobs: map[string]map[string][]byte{}, manifests: map[string][]byte{}}
+}
+
+func (r *fakeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p := strings.TrimPrefix(req.URL.Path, "/v2/")
+	switch {
+	case req.Method == http.MethodHead && strings.Contains(p, "/blobs/"):
+		repo, digest, _ := strings.Cut(p, "/blobs/")
+		if _, ok := r.blobs[repo][digest]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case req.Method == http.MethodPost && strings.HasSuffix(p, "/blobs/uploads/"):
+		repo := strings.TrimSuffix(p, "/blobs/uploads/")
+		mount, from := req.URL.Query().Get("mount"), req.URL.Query().Get("from")
+		if data, ok := r.blobs[from][mount]; ok {
+			r.store(repo, mount, data)
+			r.mounts++
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		// like the distribution registry the location is absolute and has a query of its own
+		w.Header().Set("Location", fmt.Sprintf("http://%s/v2/%s/blobs/uploads/uuid?_state=state", req.Host, repo))
+		w.WriteHeader(http.StatusAccepted)
+	case req.Method == http.MethodPut && strings.Contains(p, "/blobs/uploads/"):
+		repo, _, _ := strings.Cut(p, "/blobs/uploads/")
+		data, _ := io.ReadAll(req.Body)
+		digest := req.URL.Query().Get("digest")
+		if req.URL.Query().Get("_state") != "state" || digest != fmt.Sprintf("sha256:%x", sha256.Sum256(data)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.store(repo, digest, data)
+		r.uploads++
+		w.WriteHeader(http.StatusCreated)
+	case req.Method == http.MethodPut && strings.Contains(p, "/manifests/"):
+		if req.Header.Get("Content-Type") != mediaTypeManifest {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.manifests[p], _ = io.ReadAll(req.Body)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		_, _ = w.Write([]byte(`{"errors":[{"code":"UNSUPPORTED"}]}`))
+	}
+}
+
+func (r *fakeRegistry) store(repo string, digest string, data []byte) {
+	if r.blobs[repo] == nil {
+		r.blobs[repo] = map[string][]byte{}
+	}
+	r.blobs[repo][digest] = data
+}
+
+var _ = Describe("Registry", func() {
+	var images []Image
+
+	BeforeEach(func() {
+		rt := docker.NewFakeRuntime("quay.io/kubevirt/virt-api:devel", "quay.io/kubevirt/virt-handler:devel")
+		archive, err := rt.ImageSave(context.Background(), []string{"quay.io/kubevirt/virt-api:devel", "quay.io/kubevirt/virt-handler:devel"})
+		Expect(err).NotTo(HaveOccurred())
+		images, err = ExtractArchive(archive, GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should extract the images of a docker-archive with their digests", func() {
+		Expect(images).To(HaveLen(2))
+		Expect(images[0].RepoTags).To(Equal([]string{"quay.io/kubevirt/virt-api:devel"}))
+		Expect(images[0].Layers).To(HaveLen(2))
+		Expect(images[0].Layers[0]).To(Equal(images[1].Layers[0]))
+
+		data, err := os.ReadFile(images[0].Layers[1].Path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("quay.io/kubevirt/virt-api:devel"))
+		Expect(images[0].Layers[1].Digest).To(Equal(fmt.Sprintf("sha256:%x", sha256.Sum256(data))))
+		Expect(images[0].Layers[1].MediaType).To(Equal(mediaTypeLayer))
+		Expect(images[0].Config.MediaType).To(Equal(mediaTypeConfig))
+	})
+
+	It("should resolve the links of the legacy layout", func() {
+		buf := &bytes.Buffer{}
+		tw := tar.NewWriter(buf)
+		write := func(name string, data string) {
+			Expect(tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(data))})).To(Succeed())
+			_, err := tw.Write([]byte(data))
+			Expect(err).NotTo(HaveOccurred())
+		}
+		write("blobs/sha256/layer", "layer")
+		write("blobs/sha256/config", "{}")
+		Expect(tw.WriteHeader(&tar.Header{Name: "abc/layer.tar", Typeflag: tar.TypeSymlink, Linkname: "../blobs/sha256/layer"})).To(Succeed())
+		write("manifest.json", `[{"Config":"blobs/sha256/config","RepoTags":["virt-api:devel"],"Layers":["abc/layer.tar"]}]`)
+		Expect(tw.Close()).To(Succeed())
+
+		images, err := ExtractArchive(buf, GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(images).To(HaveLen(1))
+		Expect(images[0].Layers[0].Digest).To(Equal(fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("layer")))))
+	})
+
+	It("should refuse archives without manifest", func() {
+		buf := &bytes.Buffer{}
+		Expect(tar.NewWriter(buf).Close()).To(Succeed())
+		_, err := ExtractArchive(buf, GinkgoT().TempDir())
+		Expect(err).To(MatchError("the image archive has no manifest.json"))
+	})
+
+	It("should upload every blob once and tag the manifests", func() {
+		fake := newFakeRegistry()
+		server := httptest.NewServer(fake)
+		DeferCleanup(server.Close)
+		u, err := url.Parse(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		client := NewClient(u.Host)
+
+		result, err := client.Push(context.Background(), images[0], "kubevirt/virt-api", "devel")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(PushResult{Blobs: 3, Uploaded: 3}))
+
+		// the shared base layer is mounted from virt-api
+		result, err = client.Push(context.Background(), images[1], "kubevirt/virt-handler", "devel")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(PushResult{Blobs: 3, Uploaded: 2}))
+		Expect(fake.mounts).To(Equal(1))
+
+		// a second push finds all blobs
+		result, err = NewClient(u.Host).Push(context.Background(), images[0], "kubevirt/virt-api", "devel")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(PushResult{Blobs: 3}))
+		Expect(fake.uploads).To(Equal(5))
+
+		manifest := struct {
+			MediaType string
+			Config    struct{ Digest string }
+			Layers    []struct{ Digest string }
+		}{}
+		Expect(json.Unmarshal(fake.manifests["kubevirt/virt-api/manifests/devel"], &manifest)).To(Succeed())
+		Expect(manifest.MediaType).To(Equal(mediaTypeManifest))
+		Expect(manifest.Config.Digest).To(Equal(images[0].Config.Digest))
+		Expect(manifest.Layers).To(HaveLen(2))
+		Expect(manifest.Layers[1].Digest).To(Equal(images[0].Layers[1].Digest))
+	})
+
+	It("should report the errors of the registry", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodHead {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"errors":[{"code":"UNAUTHORIZED"}]}`))
+		}))
+		DeferCleanup(server.Close)
+		u, err := url.Parse(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = NewClient(u.Host).Push(context.Background(), images[0], "kubevirt/virt-api", "devel")
+		Expect(err).To(MatchError(ContainSubstring(`POST /v2/kubevirt/virt-api/blobs/uploads/: 401 Unauthorized: {"errors":[{"code":"UNAUTHORIZED"}]}`)))
+	})
+})
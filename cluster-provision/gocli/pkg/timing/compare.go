@@ -0,0 +1,108 @@
+package timing
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+// Diff is the change of a step between two reports. A step missing in one of the reports has a negative duration there
+type Diff struct {
+	Key       string
+	Old       float64
+	New       float64
+	Regressed bool
+}
+
+// Delta is the change in seconds
+func (d Diff) Delta() float64 {
+	return d.New - d.Old
+}
+
+// Thresholds decide which slowdowns count as regression, both have to be exceeded
+type Thresholds struct {
+	// Percent is the relative slowdown
+	Percent float64
+	// Seconds is the absolute slowdown, it keeps short steps from being reported for noise
+	Seconds float64
+}
+
+// Compare returns the differences of all steps of both reports, sorted by their delta, biggest slowdown first.
+// Steps which ran several times on the same node, e.g. bind-vfio for every sound card, are compared by their total
+func Compare(old, new *Summary, t Thresholds) []Diff {
+	oldTotals := totals(old)
+	newTotals := totals(new)
+
+	diffs := []Diff{}
+	for key, n := range newTotals {
+		o, ok := oldTotals[key]
+		if !ok {
+			o = -1
+		}
+		diffs = append(diffs, Diff{Key: key, Old: o, New: n, Regressed: ok && regressed(o, n, t)})
+	}
+	for key, o := range oldTotals {
+		if _, ok := newTotals[key]; !ok {
+			diffs = append(diffs, Diff{Key: key, Old: o, New: -1})
+		}
+	}
+	diffs = append(diffs, Diff{Key: "total", Old: old.Total, New: new.Total, Regressed: regressed(old.Total, new.Total, t)})
+
+	sort.SliceStable(diffs, func(i, j int) bool {
+		if diffs[i].Delta() != diffs[j].Delta() {
+			return diffs[i].Delta() > diffs[j].Delta()
+		}
+		return diffs[i].Key < diffs[j].Key
+	})
+	return diffs
+}
+
+// WriteComparison prints the differences as a table
+func WriteComparison(w io.Writer, diffs []Diff) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP\tOLD\tNEW\tDELTA\t")
+	for _, d := range diffs {
+		mark := ""
+		if d.Regressed {
+			mark = "REGRESSION"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", d.Key, formatOptional(d.Old), formatOptional(d.New), formatDelta(d), mark)
+	}
+	return tw.Flush()
+}
+
+func totals(r *Summary) map[string]float64 {
+	t := map[string]float64{}
+	for _, e := range r.Steps {
+		t[e.Key()] += e.Duration
+	}
+	return t
+}
+
+func regressed(old, new float64, t Thresholds) bool {
+	delta := new - old
+	return delta > t.Seconds && old > 0 && delta/old*100 > t.Percent
+}
+
+func formatOptional(s float64) string {
+	if s < 0 {
+		return "-"
+	}
+	return formatSeconds(s)
+}
+
+func formatDelta(d Diff) string {
+	if d.Old < 0 || d.New < 0 {
+		return "-"
+	}
+	sign := "+"
+	if d.Delta() < 0 {
+		sign = "-"
+	}
+	delta := d.Delta()
+	if delta < 0 {
+		delta = -delta
+	}
+	return sign + formatSeconds(delta)
+}
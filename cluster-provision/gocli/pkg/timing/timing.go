@@ -0,0 +1,162 @@
+package timing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/events"
+)
+
+// Step is the timing of a finished phase or opt
+type Step struct {
+	Kind     string        `json:"kind"`
+	Name     string        `json:"name"`
+	Node     int           `json:"node,omitempty"`
+	Start    time.Time     `json:"start"`
+	Duration float64       `json:"durationSeconds"`
+	Status   events.Status `json:"status"`
+}
+
+// Key identifies the same step across reports
+func (e Step) Key() string {
+	if e.Node == 0 {
+		return e.Kind + " " + e.Name
+	}
+	return fmt.Sprintf("%s %s node%02d", e.Kind, e.Name, e.Node)
+}
+
+func (e Step) end() time.Time {
+	return e.Start.Add(time.Duration(e.Duration * float64(time.Second)))
+}
+
+// Summary holds the timings of a cluster bring-up
+type Summary struct {
+	Cluster string  `json:"cluster"`
+	Total   float64 `json:"totalSeconds"`
+	Steps   []Step  `json:"steps"`
+}
+
+// Collector is an events.Emitter which records the duration of every finished phase and opt
+type Collector struct {
+	mu    sync.Mutex
+	start time.Time
+	steps []Step
+}
+
+func NewCollector() *Collector {
+	return &Collector{start: time.Now()}
+}
+
+func (c *Collector) Emit(e events.Event) {
+	kind := ""
+	name := ""
+	switch e.Type {
+	case events.PhaseEnd:
+		kind, name = "phase", e.Phase
+	case events.OptEnd:
+		kind, name = "opt", e.Opt
+	default:
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.steps = append(c.steps, Step{
+		Kind:     kind,
+		Name:     name,
+		Node:     e.Node,
+		Start:    e.Time.Add(-time.Duration(e.Duration * float64(time.Second))),
+		Duration: e.Duration,
+		Status:   e.Status,
+	})
+}
+
+// Summary returns the timings collected so far ordered by their start
+func (c *Collector) Summary(cluster string) *Summary {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	steps := append([]Step{}, c.steps...)
+	sort.SliceStable(steps, func(i, j int) bool {
+		return steps[i].Start.Before(steps[j].Start)
+	})
+	return &Summary{
+		Cluster: cluster,
+		Total:   time.Since(c.start).Seconds(),
+		Steps:   steps,
+	}
+}
+
+// CriticalPath returns the chain of phases which determined the total duration. Phases of
+// concurrently provisioned nodes overlap, only the one finishing last is part of the chain
+func (r *Summary) CriticalPath() []Step {
+	phases := []Step{}
+	for _, e := range r.Steps {
+		if e.Kind == "phase" {
+			phases = append(phases, e)
+		}
+	}
+	sort.SliceStable(phases, func(i, j int) bool {
+		return phases[i].end().Before(phases[j].end())
+	})
+
+	path := []Step{}
+	for i := len(phases) - 1; i >= 0; i-- {
+		if len(path) > 0 && phases[i].end().After(path[0].Start) {
+			continue
+		}
+		path = append([]Step{phases[i]}, path...)
+	}
+	return path
+}
+
+// WriteTable prints the timings and the critical path of the report
+func (r *Summary) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP\tDURATION\tSTATUS")
+	for _, e := range r.Steps {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", e.Key(), formatSeconds(e.Duration), e.Status)
+	}
+	fmt.Fprintf(tw, "total\t%s\t\n", formatSeconds(r.Total))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "\nCritical path:")
+	for _, e := range r.CriticalPath() {
+		fmt.Fprintf(w, "  %s (%s)\n", e.Key(), formatSeconds(e.Duration))
+	}
+	return nil
+}
+
+// WriteFile stores the report as JSON, to be compared later with gocli report
+func (r *Summary) WriteFile(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// ReadFile loads a report stored by WriteFile
+func ReadFile(path string) (*Summary, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &Summary{}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("reading timing report %s failed: %v", path, err)
+	}
+	return r, nil
+}
+
+func formatSeconds(s float64) string {
+	return time.Duration(s * float64(time.Second)).Round(100 * time.Millisecond).String()
+}
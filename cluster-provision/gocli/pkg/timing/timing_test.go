@@ -0,0 +1,113 @@
+package timing
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirtci/cluster-provision/gocli/pkg/events"
+)
+
+func TestTiming(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Timing Suite")
+}
+
+var _ = Describe("Timing", func() {
+	var base time.Time
+
+	// phase returns the end event of a phase running from start to end seconds after base
+	phase := func(name string, node int, start, end float64) events.Event {
+		return events.Event{
+			Type:     events.PhaseEnd,
+			Phase:    name,
+			Node:     node,
+			Time:     base.Add(time.Duration(end * float64(time.Second))),
+			Duration: end - start,
+			Status:   events.Succeeded,
+		}
+	}
+
+	BeforeEach(func() {
+		base = time.Now()
+	})
+
+	Describe("Collector", func() {
+		It("should record phases and opts only", func() {
+			c := NewCollector()
+			c.Emit(events.Event{Type: events.Command, Command: "true"})
+			c.Emit(phase("boot", 1, 0, 5))
+			c.Emit(events.Event{Type: events.OptEnd, Opt: "rookceph", Time: base.Add(9 * time.Second), Duration: 3, Status: events.Failed})
+
+			r := c.Summary("k8s-1.30")
+			Expect(r.Steps).To(HaveLen(2))
+			Expect(r.Steps[0].Key()).To(Equal("phase boot node01"))
+			Expect(r.Steps[1].Key()).To(Equal("opt rookceph"))
+			Expect(r.Steps[1].Start).To(BeTemporally("~", base.Add(6*time.Second), time.Millisecond))
+		})
+	})
+
+	Describe("CriticalPath", func() {
+		It("should follow the slowest of concurrent nodes", func() {
+			c := NewCollector()
+			c.Emit(phase("image-pull", 0, 0, 10))
+			c.Emit(phase("provision", 1, 10, 40))
+			c.Emit(phase("provision", 2, 10, 60))
+			c.Emit(phase("k8s", 0, 60, 90))
+
+			keys := []string{}
+			for _, e := range c.Summary("k8s-1.30").CriticalPath() {
+				keys = append(keys, e.Key())
+			}
+			Expect(keys).To(Equal([]string{"phase image-pull", "phase provision node02", "phase k8s"}))
+		})
+	})
+
+	Describe("Compare", func() {
+		It("should flag slowdowns above both thresholds", func() {
+			old := &Summary{Total: 100, Steps: []Step{
+				{Kind: "opt", Name: "rookceph", Duration: 60},
+				{Kind: "opt", Name: "cdi", Duration: 5},
+				{Kind: "opt", Name: "istio", Duration: 20},
+			}}
+			new := &Summary{Total: 140, Steps: []Step{
+				{Kind: "opt", Name: "rookceph", Duration: 90},
+				{Kind: "opt", Name: "cdi", Duration: 9},
+				{Kind: "opt", Name: "multus", Duration: 20},
+			}}
+
+			diffs := Compare(old, new, Thresholds{Percent: 20, Seconds: 10})
+			regressed := map[string]bool{}
+			for _, d := range diffs {
+				regressed[d.Key] = d.Regressed
+			}
+			Expect(regressed).To(Equal(map[string]bool{
+				"total":        true,
+				"opt rookceph": true,
+				"opt cdi":      false,
+				"opt istio":    false,
+				"opt multus":   false,
+			}))
+			Expect(diffs[0].Key).To(Equal("total"))
+
+			out := &bytes.Buffer{}
+			Expect(WriteComparison(out, diffs)).To(Succeed())
+			Expect(out.String()).To(ContainSubstring("REGRESSION"))
+		})
+	})
+
+	It("should round trip through a file", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "timing.json")
+		r := &Summary{Cluster: "k8s-1.30", Total: 12, Steps: []Step{{Kind: "phase", Name: "boot", Node: 2, Duration: 12, Status: events.Succeeded}}}
+		Expect(r.WriteFile(path)).To(Succeed())
+
+		read, err := ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(read.Steps).To(HaveLen(1))
+		Expect(read.Steps[0].Key()).To(Equal("phase boot node02"))
+	})
+})
@@ -76,7 +76,7 @@ gpgcheck=0
 enabled=1
 EOF
 
-dnf install -y cri-o
+dnf install -y cri-o skopeo
 
 systemctl enable --now crio
 
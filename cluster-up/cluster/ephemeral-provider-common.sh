@@ -45,7 +45,16 @@ else
 fi
 
 _cli_container="${KUBEVIRTCI_GOCLI_CONTAINER:-quay.io/kubevirtci/gocli:${KUBEVIRTCI_TAG}}"
-_cli="${_cri_bin} run --privileged --net=host --rm ${USE_TTY} -v ${_cri_socket}:/var/run/docker.sock -e KUBEVIRT_PROVIDER=${KUBEVIRT_PROVIDER} -e DOCKER_API_VERSION"
+_cli="${_cri_bin} run --privileged --net=host --rm ${USE_TTY} -v ${_cri_socket}:/var/run/docker.sock -e KUBEVIRT_PROVIDER=${KUBEVIRT_PROVIDER} -e DOCKER_API_VERSION -e KUBEVIRTCI_RUNTIME"
+# gocli runs in a throwaway container, keep the ledgers of its runs on the host
+# so that gocli cleanup finds what an interrupted run left behind
+mkdir -p ${KUBEVIRTCI_CONFIG_PATH}/ledger
+_cli="${_cli} -v ${KUBEVIRTCI_CONFIG_PATH}/ledger:/kubevirtci_ledger -e KUBEVIRTCI_LEDGER_DIR=/kubevirtci_ledger"
+# gocli writes the diagnostics of a failed run next to the other artifacts of the CI job
+if [ -n "${ARTIFACTS}" ]; then
+    mkdir -p ${ARTIFACTS}
+    _cli="${_cli} -v ${ARTIFACTS}:/kubevirtci_artifacts"
+fi
 # gocli will try to mount /lib/modules to make it accessible to dnsmasq in
 # in case it exists
 if [ -d /lib/modules ]; then
@@ -91,6 +100,10 @@ function _add_common_params() {
 
     params=" --dns-port $KUBEVIRT_DNS_HOST_PORT $params"
 
+    if [ -n "${ARTIFACTS}" ]; then
+        params=" --gather-dir /kubevirtci_artifacts $params"
+    fi
+
     if [ "$KUBEVIRT_SECONDARY_NIC_BRIDGES" == "true" ]; then
         params=" --enable-secondary-nic-bridges $params"
     fi
@@ -155,10 +168,6 @@ function _add_common_params() {
         params=" --enable-audit $params"
     fi
 
-    if [ $KUBVIRT_WITH_CNAO_SKIP_CONFIG == "true" ]; then
-        params=" --skip-cnao-cr $params"
-    fi
-
     if [ $KUBEVIRT_DEPLOY_NFS_CSI == "true" ]; then
         if [ -z $KUBEVIRT_NFS_DIR ]; then
             >&2 echo "NFS requested but no NFS directory specified (KUBEVIRT_NFS_DIR)"
@@ -210,8 +219,23 @@ function _add_common_params() {
         params=" --enable-cnao $params"
     fi
 
-    if [ "$KUBEVIRT_WITH_DYN_NET_CTRL" == "true" ]; then
-        params=" --deploy-dnc $params"
+    # gocli refuses the settings of CNAO without it
+    if [ "$KUBEVIRT_WITH_CNAO" == "true" ] || [[ $KUBEVIRT_PROVIDER_EXTRA_ARGS == *"--enable-cnao"* ]]; then
+        if [ "$KUBVIRT_WITH_CNAO_SKIP_CONFIG" == "true" ]; then
+            params=" --skip-cnao-cr $params"
+        fi
+
+        if [ "$KUBEVIRT_WITH_DYN_NET_CTRL" == "true" ]; then
+            params=" --deploy-dnc $params"
+        fi
+    else
+        if [ "$KUBVIRT_WITH_CNAO_SKIP_CONFIG" == "true" ]; then
+            >&2 echo "WARNING: KUBVIRT_WITH_CNAO_SKIP_CONFIG is ignored because KUBEVIRT_WITH_CNAO is not true"
+        fi
+
+        if [ "$KUBEVIRT_WITH_DYN_NET_CTRL" == "true" ]; then
+            >&2 echo "WARNING: KUBEVIRT_WITH_DYN_NET_CTRL is ignored because KUBEVIRT_WITH_CNAO is not true"
+        fi
     fi
 
     if [ "$KUBEVIRT_DEPLOY_CDI" == "true" ]; then